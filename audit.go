@@ -0,0 +1,135 @@
+package justgrep
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const AuditStart = "start"
+const AuditEnd = "end"
+
+// AuditGenesis is Prev of the first record of an audit log.
+var AuditGenesis = strings.Repeat("0", sha256.Size*2)
+
+// AuditRecord is a line of an audit log, written as JSON. Every search adds an AuditStart record before any results
+// are printed and an AuditEnd record with their counts once it's done, interrupted searches only have the first one.
+//
+// Prev is the SHA-256 hash of the line before, so changing or removing a record breaks the chain after it, see
+// VerifyAuditLog. Removing records from the end can only be noticed by comparing the hash of the last record with
+// one kept elsewhere.
+type AuditRecord struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	User  string    `json:"user,omitempty"`
+	Host  string    `json:"host,omitempty"`
+
+	// Args are the options of the search, without secrets
+	Args     []string   `json:"args,omitempty"`
+	Channels []string   `json:"channels,omitempty"`
+	Start    *time.Time `json:"start,omitempty"`
+	End      *time.Time `json:"end,omitempty"`
+
+	// Search is the hash of the AuditStart record of the search an AuditEnd record belongs to
+	Search      string       `json:"search,omitempty"`
+	Results     ResultCounts `json:"results,omitempty"`
+	FetchErrors int          `json:"fetch_errors,omitempty"`
+
+	Prev string `json:"prev"`
+}
+
+// AuditHash is the hash of a line of an audit log, without the line break.
+func AuditHash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// lastLine returns the last line of file, without the line break. It reads backwards from the end, so long logs
+// don't have to be read.
+func lastLine(file io.ReadSeeker) ([]byte, error) {
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	var line []byte
+	end := size
+	for end > 0 {
+		start := end - 4096
+		if start < 0 {
+			start = 0
+		}
+		chunk := make([]byte, end-start)
+		_, err = file.Seek(start, io.SeekStart)
+		if err == nil {
+			_, err = io.ReadFull(file, chunk)
+		}
+		if err != nil {
+			return nil, err
+		}
+		line = append(chunk, line...)
+		if end == size {
+			// the line break ending the last line
+			line = bytes.TrimSuffix(line, []byte("\n"))
+		}
+		if index := bytes.LastIndexByte(line, '\n'); index != -1 {
+			return line[index+1:], nil
+		}
+		end = start
+	}
+	return line, nil
+}
+
+// AppendAuditRecord sets Prev of record to the hash of the last line of file, appends record to it and returns the
+// hash of the new line. Writers have to make sure nothing else appends to file at the same time.
+func AppendAuditRecord(file io.ReadWriteSeeker, record *AuditRecord) (string, error) {
+	last, err := lastLine(file)
+	if err != nil {
+		return "", err
+	}
+	record.Prev = AuditGenesis
+	if len(last) != 0 {
+		record.Prev = AuditHash(last)
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		return "", err
+	}
+	return AuditHash(line), nil
+}
+
+// VerifyAuditLog checks the chain of an audit log. It returns the number of records and the hash of the last one.
+func VerifyAuditLog(reader io.Reader) (records int, last string, err error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	last = AuditGenesis
+	for scanner.Scan() {
+		records++
+		var record AuditRecord
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			return records, last, errors.New(fmt.Sprintf("audit: record %d isn't valid: %s", records, err))
+		}
+		if record.Prev != last {
+			return records, last, errors.New(
+				fmt.Sprintf("audit: record %d doesn't follow the record before it, the log was changed", records),
+			)
+		}
+		last = AuditHash(scanner.Bytes())
+	}
+	return records, last, scanner.Err()
+}
@@ -0,0 +1,79 @@
+package justgrep
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryFile is an io.ReadWriteSeeker in memory.
+type memoryFile struct {
+	data   []byte
+	offset int64
+}
+
+func (f *memoryFile) Read(p []byte) (int, error) {
+	if f.offset >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memoryFile) Write(p []byte) (int, error) {
+	f.data = append(f.data[:f.offset], p...)
+	f.offset += int64(len(p))
+	return len(p), nil
+}
+
+func (f *memoryFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		f.offset = offset
+	case io.SeekEnd:
+		f.offset = int64(len(f.data)) + offset
+	}
+	return f.offset, nil
+}
+
+func TestAuditLog(t *testing.T) {
+	file := &memoryFile{}
+	start, err := AppendAuditRecord(
+		file,
+		&AuditRecord{
+			Event: AuditStart,
+			Time:  time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			User:  "someone",
+			// long enough to be read in chunks
+			Args:     []string{"-regex=" + strings.Repeat("a", 10000)},
+			Channels: []string{"pajlada"},
+		},
+	)
+	assert(t, "error", err, nil)
+	results := NewResultCounts()
+	results[ResultOk] = 3
+	end, err := AppendAuditRecord(file, &AuditRecord{Event: AuditEnd, Search: start, Results: results})
+	assert(t, "error", err, nil)
+
+	records, last, err := VerifyAuditLog(bytes.NewReader(file.data))
+	assert(t, "error", err, nil)
+	assert(t, "records", records, 2)
+	assert(t, "last", last, end)
+	lines := strings.Split(strings.TrimSuffix(string(file.data), "\n"), "\n")
+	assert(t, "first prev", strings.Contains(lines[0], `"prev":"`+AuditGenesis+`"`), true)
+	assert(t, "second prev", strings.Contains(lines[1], `"prev":"`+start+`"`), true)
+
+	changed := bytes.Replace(file.data, []byte("someone"), []byte("nobody!"), 1)
+	_, _, err = VerifyAuditLog(bytes.NewReader(changed))
+	if err == nil {
+		t.Errorf("expected a changed record to break the chain")
+	}
+	removed := []byte(lines[1] + "\n")
+	_, _, err = VerifyAuditLog(bytes.NewReader(removed))
+	if err == nil {
+		t.Errorf("expected a removed record to break the chain")
+	}
+}
@@ -0,0 +1,94 @@
+package justgrep
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate is a number of messages within a time window.
+type Rate struct {
+	Count  int
+	Window time.Duration
+}
+
+// ParseRate parses rates like "10 in 30s" or "10/30s".
+func ParseRate(input string) (Rate, error) {
+	var count, window string
+	if idx := strings.Index(input, " in "); idx != -1 {
+		count, window = input[:idx], input[idx+len(" in "):]
+	} else if idx := strings.IndexRune(input, '/'); idx != -1 {
+		count, window = input[:idx], input[idx+1:]
+	} else {
+		return Rate{}, errors.New(fmt.Sprintf("invalid rate %q, expected something like \"10 in 30s\"", input))
+	}
+	parsedCount, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || parsedCount <= 0 {
+		return Rate{}, errors.New(fmt.Sprintf("invalid message count in rate %q", input))
+	}
+	parsedWindow, err := time.ParseDuration(strings.TrimSpace(window))
+	if err != nil || parsedWindow <= 0 {
+		return Rate{}, errors.New(fmt.Sprintf("invalid window in rate %q", input))
+	}
+	return Rate{Count: parsedCount, Window: parsedWindow}, nil
+}
+
+func (r Rate) String() string {
+	return fmt.Sprintf("%d in %s", r.Count, r.Window)
+}
+
+// Burst is a period during which messages were sent faster than a Rate.
+type Burst struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Messages int       `json:"messages"`
+}
+
+// Contains returns true if timestamp is within the burst.
+func (b Burst) Contains(timestamp time.Time) bool {
+	return !timestamp.Before(b.Start) && !timestamp.After(b.End)
+}
+
+// FindBursts finds periods where at least rate.Count timestamps fall within rate.Window. Overlapping windows are
+// merged into one burst. timestamps are sorted in place.
+func FindBursts(timestamps []time.Time, rate Rate) []Burst {
+	sort.Slice(
+		timestamps, func(i, j int) bool {
+			return timestamps[i].Before(timestamps[j])
+		},
+	)
+	var output []Burst
+	// index of the first message of the current burst, -1 if there's none
+	burstStart := -1
+	burstEnd := 0
+	windowStart := 0
+	for i, timestamp := range timestamps {
+		for timestamp.Sub(timestamps[windowStart]) > rate.Window {
+			windowStart++
+		}
+		if i-windowStart+1 < rate.Count {
+			continue
+		}
+		if burstStart != -1 && windowStart > burstEnd {
+			output = append(
+				output,
+				Burst{Start: timestamps[burstStart], End: timestamps[burstEnd], Messages: burstEnd - burstStart + 1},
+			)
+			burstStart = -1
+		}
+		if burstStart == -1 {
+			burstStart = windowStart
+		}
+		burstEnd = i
+	}
+	if burstStart != -1 {
+		output = append(
+			output,
+			Burst{Start: timestamps[burstStart], End: timestamps[burstEnd], Messages: burstEnd - burstStart + 1},
+		)
+	}
+	return output
+}
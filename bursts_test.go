@@ -0,0 +1,40 @@
+package justgrep
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	for input, expect := range map[string]Rate{
+		"10 in 30s": {Count: 10, Window: 30 * time.Second},
+		"3/1m":      {Count: 3, Window: time.Minute},
+	} {
+		have, err := ParseRate(input)
+		assert(t, "error for "+input, err, nil)
+		assert(t, "rate for "+input, have, expect)
+	}
+	for _, input := range []string{"", "10", "0 in 30s", "10 in nope", "10 in -1s"} {
+		_, err := ParseRate(input)
+		if err == nil {
+			t.Errorf("expected ParseRate(%q) to fail", input)
+		}
+	}
+}
+
+func TestFindBursts(t *testing.T) {
+	base := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	var timestamps []time.Time
+	// unsorted, a burst of 4 messages at 100-103s, a burst of 3 at 200-210s and single messages
+	for _, second := range []int{210, 0, 100, 101, 50, 102, 103, 200, 205, 300} {
+		timestamps = append(timestamps, base.Add(time.Duration(second)*time.Second))
+	}
+	bursts := FindBursts(timestamps, Rate{Count: 3, Window: 10 * time.Second})
+	assert(t, "count", len(bursts), 2)
+	assert(t, "first", bursts[0], Burst{Start: base.Add(100 * time.Second), End: base.Add(103 * time.Second), Messages: 4})
+	assert(t, "second", bursts[1], Burst{Start: base.Add(200 * time.Second), End: base.Add(210 * time.Second), Messages: 3})
+	assert(t, "contains", bursts[0].Contains(base.Add(101*time.Second)), true)
+	assert(t, "doesn't contain", bursts[0].Contains(base.Add(104*time.Second)), false)
+
+	assert(t, "too slow", len(FindBursts(timestamps, Rate{Count: 5, Window: 10 * time.Second})), 0)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const rateAlertRecord = "rate-alert"
+
+// rateAlerts finds bursts of matches faster than -alert-rate in every channel. With -alert-only, matches outside of
+// bursts are dropped, which needs all matches to be held until the search is done.
+type rateAlerts struct {
+	rate justgrep.Rate
+	only bool
+
+	timestamps map[string][]time.Time
+	held       *spillStore
+}
+
+type rateAlertRecordJson struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	Rate    string `json:"rate"`
+	justgrep.Burst
+}
+
+func newRateAlerts(rate justgrep.Rate, only bool, budget *memoryBudget) *rateAlerts {
+	return &rateAlerts{
+		rate:       rate,
+		only:       only,
+		timestamps: make(map[string][]time.Time),
+		held:       newSpillStore(budget),
+	}
+}
+
+// observe records msg, true is returned if it should be printed right away.
+func (a *rateAlerts) observe(msg *justgrep.Message) bool {
+	channel := msg.Channel()
+	a.timestamps[channel] = append(a.timestamps[channel], msg.Timestamp)
+	if a.only {
+		a.held.add("", msg)
+		return false
+	}
+	return true
+}
+
+// write prints the held matches which are part of a burst followed by a summary of every burst.
+func (a *rateAlerts) write(output *matchOutput) {
+	channels := make([]string, 0, len(a.timestamps))
+	bursts := make(map[string][]justgrep.Burst, len(a.timestamps))
+	for channel, timestamps := range a.timestamps {
+		channels = append(channels, channel)
+		bursts[channel] = justgrep.FindBursts(timestamps, a.rate)
+	}
+	sort.Strings(channels)
+
+	err := a.held.each(
+		"", func(msg *justgrep.Message) {
+			for _, burst := range bursts[msg.Channel()] {
+				if burst.Contains(msg.Timestamp) {
+					output.print(msg)
+					break
+				}
+			}
+		},
+	)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to read matches moved to disk: %s\n", err)
+	}
+	a.held.close()
+
+	for _, channel := range channels {
+		for _, burst := range bursts[channel] {
+			if isJsonFormat(output.format) {
+				_ = output.json.Encode(
+					rateAlertRecordJson{Type: rateAlertRecord, Channel: channel, Rate: a.rate.String(), Burst: burst},
+				)
+				continue
+			}
+			_, _ = fmt.Fprintf(
+				output.out,
+				"# rate alert: #%s %d matches from %s to %s, at least %s\n",
+				channel,
+				burst.Messages,
+				burst.Start.Format(time.RFC3339),
+				burst.End.Format(time.RFC3339),
+				a.rate,
+			)
+		}
+	}
+}
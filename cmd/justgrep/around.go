@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// aroundContext prints messages of the channel sent close to matches for -around, whether they matched or not.
+// Messages which didn't match are kept while they're within the window of the last one, so they can still be printed
+// with a match found after them. Log files are searched from the newest one, so messages can arrive in either order.
+//
+// matched and reject are called by the filter in the order messages were searched, but matches are printed by another
+// goroutine which can fall behind. Context is collected for every match when it's filtered and printed with it.
+type aroundContext struct {
+	window time.Duration
+	output *matchOutput
+
+	lock     sync.Mutex
+	channels map[string]*channelContext
+	// pending has the context of matches which weren't printed yet
+	pending map[*justgrep.Message]*matchContext
+}
+
+type channelContext struct {
+	// recent are messages which didn't match and aren't context of a match
+	recent []*justgrep.Message
+	// last is the newest match, messages within the window of it are its context
+	last *matchContext
+}
+
+type matchContext struct {
+	match   *justgrep.Message
+	context []*justgrep.Message
+	printed bool
+}
+
+func newAroundContext(window time.Duration) *aroundContext {
+	return &aroundContext{
+		window:   window,
+		channels: make(map[string]*channelContext),
+		pending:  make(map[*justgrep.Message]*matchContext),
+	}
+}
+
+// within returns true if a and b were sent at most the window apart.
+func (c *aroundContext) within(a time.Time, b time.Time) bool {
+	return a.Sub(b) <= c.window && b.Sub(a) <= c.window
+}
+
+func (c *aroundContext) channel(msg *justgrep.Message) *channelContext {
+	state, ok := c.channels[msg.Channel()]
+	if !ok {
+		state = &channelContext{}
+		c.channels[msg.Channel()] = state
+	}
+	return state
+}
+
+// matched receives a match from the filter and takes the kept messages within the window of it as its context.
+func (c *aroundContext) matched(msg *justgrep.Message) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	state := c.channel(msg)
+	entry := &matchContext{match: msg}
+	kept := state.recent[:0]
+	for _, other := range state.recent {
+		if c.within(other.Timestamp, msg.Timestamp) {
+			entry.context = append(entry.context, other)
+		} else {
+			kept = append(kept, other)
+		}
+	}
+	state.recent = kept
+	state.last = entry
+	c.pending[msg] = entry
+}
+
+// reject receives a message which didn't match.
+func (c *aroundContext) reject(msg *justgrep.Message) {
+	if msg.Timestamp.IsZero() {
+		// unparsable lines
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	state := c.channel(msg)
+	if state.last != nil && c.within(msg.Timestamp, state.last.match.Timestamp) {
+		if state.last.printed {
+			c.printContext(msg)
+		} else {
+			state.last.context = append(state.last.context, msg)
+		}
+		return
+	}
+	kept := state.recent[:0]
+	for _, other := range state.recent {
+		if c.within(other.Timestamp, msg.Timestamp) {
+			kept = append(kept, other)
+		}
+	}
+	state.recent = append(kept, msg)
+}
+
+// match prints msg together with its context collected so far, in the order they were sent.
+func (c *aroundContext) match(msg *justgrep.Message) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.pending[msg]
+	if !ok {
+		c.output.print(msg)
+		return
+	}
+	delete(c.pending, msg)
+	entry.printed = true
+	sort.SliceStable(
+		entry.context, func(i, j int) bool {
+			return entry.context[i].Timestamp.Before(entry.context[j].Timestamp)
+		},
+	)
+	printed := false
+	for _, other := range entry.context {
+		if !printed && other.Timestamp.After(msg.Timestamp) {
+			c.output.print(msg)
+			printed = true
+		}
+		c.printContext(other)
+	}
+	if !printed {
+		c.output.print(msg)
+	}
+	entry.context = nil
+}
+
+func (c *aroundContext) printContext(msg *justgrep.Message) {
+	msg.Annotate("context", "1")
+	c.output.print(msg)
+}
+
+// validateAroundFlags checks -around, it only works when matches are printed as they're found.
+func (args *arguments) validateAroundFlags() (valid bool) {
+	valid = true
+	if *args.aroundWindow < 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "-around can't be negative.")
+		return false
+	}
+	if *args.aroundWindow == 0 {
+		return
+	}
+	if *args.top != "" || *args.report != "" || *args.rank || *args.alertRateRaw != "" || *args.groupBy != "" {
+		_, _ = fmt.Fprintln(
+			os.Stderr,
+			"-around prints matches as they're found, it can't be used with -top, -report, -rank, -alert-rate or "+
+				"-group-by.",
+		)
+		valid = false
+	}
+	if *args.justUsers || *args.anyPerChannel {
+		_, _ = fmt.Fprintln(os.Stderr, "-around can't be used with -just-users or -any-per-channel.")
+		valid = false
+	}
+	if *args.shards > 1 {
+		_, _ = fmt.Fprintln(os.Stderr, "-around can't be used with -shards.")
+		valid = false
+	}
+	args.around = newAroundContext(*args.aroundWindow)
+	return
+}
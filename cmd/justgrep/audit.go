@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const EnvAuditLog = "JUSTGREP_AUDIT_LOG"
+
+// auditLog appends the records of a search to -audit-log, see justgrep.AuditRecord.
+type auditLog struct {
+	path     string
+	progress *justgrep.ProgressState
+	// search is the hash of the start record, empty until it's written
+	search string
+}
+
+// append appends record to the log, holding a lock so concurrent searches don't break the chain.
+func (a *auditLog) append(record *justgrep.AuditRecord) (string, error) {
+	file, err := os.OpenFile(a.path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	err = lockFile(file)
+	if err != nil {
+		return "", err
+	}
+	defer unlockFile(file)
+	hash, err := justgrep.AppendAuditRecord(file, record)
+	if err != nil {
+		return "", err
+	}
+	return hash, file.Sync()
+}
+
+// auditArgs returns the given options for the audit log, with credentials in URLs and secrets left out.
+func auditArgs() []string {
+	var output []string
+	flag.CommandLine.Visit(
+		func(f *flag.Flag) {
+			switch f.Name {
+			case "upload-token":
+				return
+			case "url", "prefer-url":
+				for _, instance := range splitInstanceList(f.Value.String()) {
+					output = append(output, "-"+f.Name+"="+redactURL(instance))
+				}
+				return
+			}
+			output = append(output, "-"+f.Name+"="+f.Value.String())
+		},
+	)
+	return output
+}
+
+// currentUser is who ran justgrep: the login name and host name.
+func currentUser() (string, string) {
+	name := os.Getenv("USER")
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	host, _ := os.Hostname()
+	return name, host
+}
+
+// startAudit writes the start record of a search into -audit-log before any results are printed. If that fails
+// nothing is searched, unlogged searches are what the log is there to prevent.
+func (args *arguments) startAudit(channels []string, progress *justgrep.ProgressState) {
+	if args.auditLogPath == "" {
+		return
+	}
+	name, host := currentUser()
+	record := &justgrep.AuditRecord{
+		Event:    justgrep.AuditStart,
+		Time:     time.Now().UTC(),
+		User:     name,
+		Host:     host,
+		Args:     auditArgs(),
+		Channels: channels,
+	}
+	if !args.startTime.IsZero() {
+		start, end := args.startTime.UTC(), args.endTime.UTC()
+		record.Start, record.End = &start, &end
+	}
+	args.audit = &auditLog{path: args.auditLogPath, progress: progress}
+	hash, err := args.audit.append(record)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to write the audit log, not searching: %s\n", err)
+		args.finishDebug()
+		os.Exit(1)
+	}
+	args.audit.search = hash
+}
+
+// finish writes the end record of the search with the number of results.
+func (a *auditLog) finish() {
+	if a == nil || a.search == "" {
+		return
+	}
+	name, host := currentUser()
+	_, err := a.append(
+		&justgrep.AuditRecord{
+			Event:       justgrep.AuditEnd,
+			Time:        time.Now().UTC(),
+			User:        name,
+			Host:        host,
+			Search:      a.search,
+			Results:     a.progress.TotalResults,
+			FetchErrors: a.progress.FetchErrors,
+		},
+	)
+	a.search = ""
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to write the audit log: %s\n", err)
+	}
+}
+
+// runAudit is justgrep audit FILE, it checks the chain of an audit log. It returns the exit code.
+func runAudit(cliArgs []string) int {
+	if len(cliArgs) != 1 {
+		_, _ = fmt.Fprintln(os.Stderr, "Usage: justgrep audit FILE")
+		return 2
+	}
+	file, err := os.Open(cliArgs[0])
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to open %s: %s\n", cliArgs[0], err)
+		return 1
+	}
+	defer file.Close()
+	records, last, err := justgrep.VerifyAuditLog(file)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("%d records, the chain is intact. Hash of the last record: %s\n", records, last)
+	return 0
+}
+
+func (args *arguments) validateAuditFlags() (valid bool) {
+	args.auditLogPath = *args.auditLogRaw
+	if args.auditLogPath == "" && !*args.noEnv {
+		args.auditLogPath = os.Getenv(EnvAuditLog)
+	}
+	if args.auditLogPath == "" {
+		return true
+	}
+	if info, err := os.Stat(args.auditLogPath); err == nil && info.IsDir() {
+		_, _ = fmt.Fprintln(os.Stderr, "-audit-log needs to be a file, not a directory.")
+		return false
+	}
+	return true
+}
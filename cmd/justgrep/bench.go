@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// benchDuration is how long justgrep bench runs at least, the corpus is searched again until it's reached.
+const benchDuration = 2 * time.Second
+
+const benchCorpusLines = 200000
+
+// benchWords are used in messages of the built-in corpus.
+var benchWords = strings.Fields(
+	"Kappa PogChamp LUL forsenE pajaDank monkaS OMEGALUL KEKW Pog 4Head widepeepoHappy " +
+		"hello hi bye what why how lol lmao yes no maybe stream game chat mod vip sub gift raid " +
+		"https://example.com/clip @forsen @pajlada !uptime !followage 1 2 3 10 100 1000",
+)
+
+// builtinCorpus generates raw IRC lines looking like a day of logs of a busy channel. It's always the same, so results
+// can be compared between builds and machines.
+func builtinCorpus() []byte {
+	random := rand.New(rand.NewSource(1))
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	buffer := &bytes.Buffer{}
+	for i := 0; i < benchCorpusLines; i++ {
+		timestamp := start.Add(time.Duration(i)*24*time.Hour/benchCorpusLines).UnixNano() / int64(time.Millisecond)
+		userID := random.Intn(5000)
+		login := fmt.Sprintf("user%d", userID)
+		words := make([]string, 1+random.Intn(12))
+		for j := range words {
+			words[j] = benchWords[random.Intn(len(benchWords))]
+		}
+		text := strings.Join(words, " ")
+		switch roll := random.Intn(100); {
+		case roll < 2:
+			_, _ = fmt.Fprintf(
+				buffer,
+				"@display-name=User%d;id=bench-%d;login=%s;msg-id=sub;room-id=11148817;"+
+					"system-msg=User%d\\ssubscribed\\sat\\sTier\\s1.;tmi-sent-ts=%d;user-id=%d "+
+					":tmi.twitch.tv USERNOTICE #pajlada :%s\n",
+				userID, i, login, userID, timestamp, userID, text,
+			)
+		case roll < 3:
+			_, _ = fmt.Fprintf(
+				buffer,
+				"@ban-duration=600;room-id=11148817;target-user-id=%d;tmi-sent-ts=%d :tmi.twitch.tv CLEARCHAT #pajlada :%s\n",
+				userID, timestamp, login,
+			)
+		default:
+			_, _ = fmt.Fprintf(
+				buffer,
+				"@badges=;color=#FF0000;display-name=User%d;emotes=;id=bench-%d;mod=0;room-id=11148817;subscriber=0;"+
+					"tmi-sent-ts=%d;turbo=0;user-id=%d;user-type= :%s!%s@%s.tmi.twitch.tv PRIVMSG #pajlada :%s\n",
+				userID, i, timestamp, userID, login, login, login, text,
+			)
+		}
+	}
+	return buffer.Bytes()
+}
+
+// benchRound is what searching the corpus once took.
+type benchRound struct {
+	lines   int
+	matches int
+	elapsed time.Duration
+	allocs  uint64
+	bytes   uint64
+}
+
+// searchCorpus decodes, parses and filters every line of corpus like -stdin-format does, without printing matches.
+func searchCorpus(args *arguments, corpus []byte) (round benchRound, err error) {
+	filter, ok := buildFilter(args, *args.messageRegex)
+	if !ok {
+		return round, errors.New("invalid filter")
+	}
+	if *args.stdinFormat == "packed" {
+		return searchPackedCorpus(filter, corpus)
+	}
+	decode := justgrep.NewMessage
+	if *args.stdinFormat == "ndjson" {
+		decode = args.fieldMapping.Decode
+	}
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	began := time.Now()
+	scanner := newLineScanner(bytes.NewReader(corpus))
+	for scanner.Scan() {
+		line, err := args.fetchOptions.DecodeLine(scanner.Text())
+		if line == "" {
+			continue
+		}
+		round.lines++
+		var msg *justgrep.Message
+		if err == nil {
+			msg, err = decode(line)
+		}
+		if err != nil {
+			if args.fetchOptions.OnInvalidLine == justgrep.InvalidLineAbort {
+				return round, errors.New(fmt.Sprintf("line %d: %s", round.lines, err))
+			}
+			continue
+		}
+		if filter.Filter(msg) == justgrep.ResultOk {
+			round.matches++
+		}
+	}
+	round.elapsed = time.Since(began)
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	round.allocs = after.Mallocs - before.Mallocs
+	round.bytes = after.TotalAlloc - before.TotalAlloc
+	return round, scanner.Err()
+}
+
+// searchPackedCorpus filters every message of a packed corpus, there's nothing to decode or parse.
+func searchPackedCorpus(filter justgrep.Filter, corpus []byte) (round benchRound, err error) {
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	began := time.Now()
+	packed, err := justgrep.NewPackedReader(bytes.NewReader(corpus))
+	if err != nil {
+		return round, err
+	}
+	for {
+		msg, err := packed.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return round, err
+		}
+		round.lines++
+		if filter.Filter(msg) == justgrep.ResultOk {
+			round.matches++
+		}
+	}
+	round.elapsed = time.Since(began)
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	round.allocs = after.Mallocs - before.Mallocs
+	round.bytes = after.TotalAlloc - before.TotalAlloc
+	return round, nil
+}
+
+// runBench searches the corpus of justgrep bench again and again for at least benchDuration and prints how fast it
+// was. It returns the exit code.
+func runBench(args *arguments) int {
+	name := "built-in"
+	var corpus []byte
+	if args.benchCorpus != "" {
+		name = args.benchCorpus
+		var err error
+		corpus, err = os.ReadFile(args.benchCorpus)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to read the corpus: %s\n", err)
+			return 1
+		}
+	} else {
+		corpus = builtinCorpus()
+	}
+	if *args.stdinFormat == "packed" && args.benchCorpus == "" {
+		var packed bytes.Buffer
+		_, _, err := packLines(bytes.NewReader(corpus), &packed)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to pack the corpus: %s\n", err)
+			return 1
+		}
+		name = "built-in, packed"
+		corpus = packed.Bytes()
+	}
+
+	var total benchRound
+	rounds := 0
+	for total.elapsed < benchDuration {
+		round, err := searchCorpus(args, corpus)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to search the corpus: %s\n", err)
+			return 1
+		}
+		if round.lines == 0 {
+			_, _ = fmt.Fprintln(os.Stderr, "The corpus is empty.")
+			return 1
+		}
+		rounds++
+		total.lines += round.lines
+		total.matches = round.matches
+		total.elapsed += round.elapsed
+		total.allocs += round.allocs
+		total.bytes += round.bytes
+	}
+	seconds := total.elapsed.Seconds()
+	fmt.Printf(
+		"justgrep commit %s, %s, %s/%s, GOMAXPROCS %d\n",
+		gitCommit,
+		runtime.Version(),
+		runtime.GOOS,
+		runtime.GOARCH,
+		runtime.GOMAXPROCS(0),
+	)
+	fmt.Printf("corpus:      %s, %d lines, %.2f MB\n", name, total.lines/rounds, float64(len(corpus))/1000/1000)
+	fmt.Printf("rounds:      %d in %s\n", rounds, total.elapsed.Round(time.Millisecond))
+	fmt.Printf("matches:     %d per round\n", total.matches)
+	fmt.Printf("lines/s:     %.0f\n", float64(total.lines)/seconds)
+	fmt.Printf("MB/s:        %.2f\n", float64(len(corpus))*float64(rounds)/1000/1000/seconds)
+	fmt.Printf("allocs/line: %.2f\n", float64(total.allocs)/float64(total.lines))
+	fmt.Printf("bytes/line:  %.1f\n", float64(total.bytes)/float64(total.lines))
+	return 0
+}
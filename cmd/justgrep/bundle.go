@@ -0,0 +1,272 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const bundleVersion = 1
+
+// bundleDroppedFlags are options -redact leaves out of the query of a bundle: credentials, and paths and settings
+// telling more about the machine of whoever searched than about the search.
+var bundleDroppedFlags = map[string]bool{
+	"upload-token": true,
+	"ca-cert":      true,
+	"client-cert":  true,
+	"client-key":   true,
+	"user-agent":   true,
+	"session":      true,
+	"o":            true,
+	"summary-file": true,
+	"audit-log":    true,
+	"encrypt-to":   true,
+	"pprof-addr":   true,
+	"cpuprofile":   true,
+	"memprofile":   true,
+	"debug-http":   true,
+	"debug-filter": true,
+}
+
+// bundleBaseNameFlags are options whose file -redact keeps only the name of.
+var bundleBaseNameFlags = map[string]bool{
+	"regex-file":    true,
+	"template-file": true,
+	"stopwords":     true,
+}
+
+// bundleSummary is summary.json in bundles.
+type bundleSummary struct {
+	Version  int       `json:"version"`
+	Channels []string  `json:"channels"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	// Redacted is true if the bundle was made with -redact
+	Redacted bool `json:"redacted"`
+
+	Matches int        `json:"matches"`
+	First   *time.Time `json:"first,omitempty"`
+	Last    *time.Time `json:"last,omitempty"`
+	// Users are all users with matches, most first
+	Users []userCount `json:"users"`
+
+	Results    justgrep.ResultCounts `json:"results"`
+	StartedAt  time.Time             `json:"started_at"`
+	FinishedAt time.Time             `json:"finished_at"`
+}
+
+// redactInstance leaves the user name out of an instance URL, unlike redactURL which only hides the password.
+// Instance URLs can't have a query or fragment.
+func redactInstance(instance string) string {
+	u, err := url.Parse(instance)
+	if err != nil {
+		return "[failed to url parse, hiding to not show any secrets]"
+	}
+	u.User = nil
+	return u.String()
+}
+
+// redactArgs returns the arguments of a manifest without bundleDroppedFlags and with bundleBaseNameFlags and
+// instances redacted.
+func redactArgs(args []string) []string {
+	output := make([]string, 0, len(args))
+	for _, arg := range args {
+		split := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)
+		name := split[0]
+		switch {
+		case bundleDroppedFlags[name]:
+			continue
+		case len(split) == 1:
+		case bundleBaseNameFlags[name]:
+			arg = "-" + name + "=" + filepath.Base(split[1])
+		case name == "url" || name == "prefer-url":
+			instances := splitInstanceList(split[1])
+			for i, instance := range instances {
+				instances[i] = redactInstance(instance)
+			}
+			arg = "-" + name + "=" + strings.Join(instances, ",")
+		}
+		output = append(output, arg)
+	}
+	return output
+}
+
+// redact removes credentials and local paths from m, see redactInstance and redactArgs.
+func (m *runManifest) redact() {
+	m.Args = redactArgs(m.Args)
+	for i, instance := range m.Instances {
+		m.Instances[i] = redactInstance(instance)
+	}
+	if m.Instance != "" {
+		m.Instance = redactInstance(m.Instance)
+	}
+	for channel, instance := range m.Routes {
+		m.Routes[channel] = redactInstance(instance)
+	}
+	m.ResultFile = filepath.Base(m.ResultFile)
+}
+
+// writeBundle writes the zip archive of a run: the manifest with the query, summary.json, the raw results and
+// messages.txt with the results formatted for reading.
+func writeBundle(output io.Writer, dir string, manifest *runManifest, redact bool) error {
+	results, err := loadRunResults(dir)
+	if err != nil {
+		return err
+	}
+	if redact {
+		manifest.redact()
+	}
+	summary := &bundleSummary{
+		Version:    bundleVersion,
+		Channels:   manifest.Channels,
+		Start:      manifest.Start,
+		End:        manifest.End,
+		Redacted:   redact,
+		Matches:    len(results.keys),
+		Users:      []userCount{},
+		Results:    manifest.Results,
+		StartedAt:  manifest.StartedAt,
+		FinishedAt: manifest.FinishedAt,
+	}
+	var readable strings.Builder
+	users := make(map[string]int)
+	for _, key := range results.keys {
+		msg, err := justgrep.NewMessage(results.messages[key])
+		if err != nil {
+			_, _ = fmt.Fprintf(&readable, "[invalid] %s\n", results.messages[key])
+			continue
+		}
+		timestamp := msg.Timestamp
+		if summary.First == nil || timestamp.Before(*summary.First) {
+			summary.First = &timestamp
+		}
+		if summary.Last == nil || timestamp.After(*summary.Last) {
+			summary.Last = &timestamp
+		}
+		if msg.User != "" {
+			users[msg.User]++
+		}
+		_, _ = fmt.Fprintf(
+			&readable,
+			"[%s UTC] #%s %s: %s\n",
+			msg.Timestamp.UTC().Format("2006-01-02 15:04:05"),
+			msg.Channel(),
+			chatterinoUser(msg),
+			msg.Text(),
+		)
+	}
+	for user, count := range users {
+		summary.Users = append(summary.Users, userCount{User: user, Matches: count})
+	}
+	sort.Slice(
+		summary.Users, func(i, j int) bool {
+			if summary.Users[i].Matches != summary.Users[j].Matches {
+				return summary.Users[i].Matches > summary.Users[j].Matches
+			}
+			return summary.Users[i].User < summary.Users[j].User
+		},
+	)
+
+	var raw strings.Builder
+	for _, key := range results.keys {
+		raw.WriteString(results.messages[key] + "\n")
+	}
+	manifestJson, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	summaryJson, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	archive := zip.NewWriter(output)
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{runManifestFile, append(manifestJson, '\n')},
+		{"summary.json", append(summaryJson, '\n')},
+		{runResultsFile, []byte(raw.String())},
+		{"messages.txt", []byte(readable.String())},
+	}
+	for _, file := range files {
+		writer, err := archive.CreateHeader(
+			&zip.FileHeader{
+				Name:     file.name,
+				Method:   zip.Deflate,
+				Modified: manifest.FinishedAt,
+			},
+		)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(file.content)
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// runBundle is `justgrep bundle RUN_DIR`, it packs a run saved with -run-dir into a single zip file to be shared.
+func runBundle(cliArgs []string) int {
+	flags := flag.NewFlagSet("justgrep bundle", flag.ContinueOnError)
+	redact := flags.Bool(
+		"redact",
+		false,
+		"Leave credentials, user names in instance URLs and local paths out of the query",
+	)
+	outputPath := flags.String("o", "", "File to write, RUN_DIR.zip in the current directory by default")
+	usage := "Usage: justgrep bundle RUN_DIR [-redact] [-o FILE]"
+	if err := flags.Parse(cliArgs); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		_, _ = fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	// options can come after the directory too
+	dir := flags.Arg(0)
+	if err := flags.Parse(flags.Args()[1:]); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		_, _ = fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	manifest, err := loadRunManifest(dir)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to load run manifest: %s\n", err)
+		return 1
+	}
+	if *outputPath == "" {
+		*outputPath = filepath.Base(filepath.Clean(dir)) + ".zip"
+	}
+	// never overwrite, the previous bundle could have been shared already
+	file, err := os.OpenFile(*outputPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to create the bundle: %s\n", err)
+		return 1
+	}
+	err = writeBundle(file, dir, manifest, *redact)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(*outputPath)
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to write the bundle: %s\n", err)
+		return 1
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Wrote %s\n", *outputPath)
+	return 0
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// values of -order-channels
+const (
+	orderSmallestFirst = "smallest-first"
+	orderLargestFirst  = "largest-first"
+	orderAlpha         = "alpha"
+	orderAsIs          = "asis"
+)
+
+// orderListers is how many channels have their available logs listed at the same time for the size orders.
+const orderListers = 8
+
+func (args *arguments) validateOrderFlags() (valid bool) {
+	valid = true
+	switch *args.orderChannels {
+	case "":
+		// recursive searches surface quick wins first, given channels are searched in the given order
+		*args.orderChannels = orderAsIs
+		if *args.recursive && !*args.fixedSteps {
+			*args.orderChannels = orderSmallestFirst
+		}
+	case orderSmallestFirst, orderLargestFirst:
+		if *args.fixedSteps {
+			_, _ = fmt.Fprintf(
+				os.Stderr,
+				"-order-channels %s needs the list of available logs, it can't be used with -fixed-steps.\n",
+				*args.orderChannels,
+			)
+			valid = false
+		}
+	case orderAlpha, orderAsIs:
+	default:
+		_, _ = fmt.Fprintf(
+			os.Stderr,
+			"-order-channels: unknown order %q, expected %s, %s, %s or %s\n",
+			*args.orderChannels,
+			orderSmallestFirst,
+			orderLargestFirst,
+			orderAlpha,
+			orderAsIs,
+		)
+		valid = false
+	}
+	return
+}
+
+// logFilesInRange counts the available log files of apis within the time range of args. ok is false if none of the
+// apis know which log files are available.
+func logFilesInRange(args *arguments, apis []justgrep.JustlogAPI) (count int, ok bool) {
+	for _, api := range apis {
+		available, isAvailable := api.(*justgrep.AvailableLogsAPI)
+		if !isAvailable {
+			continue
+		}
+		ok = true
+		for _, date := range available.Dates {
+			if date.After(args.endTime) {
+				continue
+			}
+			fileEnd := date.AddDate(0, 0, 1)
+			if available.Monthly {
+				fileEnd = date.AddDate(0, 1, 0)
+			}
+			if !args.startEarliest && !fileEnd.After(args.startTime) {
+				// dates are newest first
+				break
+			}
+			count++
+		}
+	}
+	return
+}
+
+// orderChannels sorts channels for -order-channels. The size orders list the available logs of every channel to
+// count the log files that will be searched, the APIs made for that are returned so they aren't listed again.
+// Channels whose logs couldn't be listed are searched last.
+func orderChannels(
+	args *arguments,
+	channels []string,
+	routes map[string]string,
+) ([]string, map[string][]justgrep.JustlogAPI) {
+	ordered := append([]string(nil), channels...)
+	switch *args.orderChannels {
+	case orderAlpha:
+		sort.Strings(ordered)
+		return ordered, nil
+	case orderSmallestFirst, orderLargestFirst:
+	default:
+		return ordered, nil
+	}
+
+	apis := make(map[string][]justgrep.JustlogAPI, len(channels))
+	sizes := make(map[string]int, len(channels))
+	var lock sync.Mutex
+	var wait sync.WaitGroup
+	listers := make(chan struct{}, orderListers)
+	for _, channel := range channels {
+		wait.Add(1)
+		listers <- struct{}{}
+		go func(channel string) {
+			defer func() {
+				<-listers
+				wait.Done()
+			}()
+			channelArgs, _ := args.forChannel(channel, justgrep.Filter{})
+			channelAPIs := channelAPIs(args, channel, routes[channel])
+			size, ok := logFilesInRange(channelArgs, channelAPIs)
+			lock.Lock()
+			defer lock.Unlock()
+			apis[channel] = channelAPIs
+			if ok {
+				sizes[channel] = size
+			} else {
+				sizes[channel] = -1
+			}
+		}(channel)
+	}
+	wait.Wait()
+
+	largest := *args.orderChannels == orderLargestFirst
+	sort.SliceStable(
+		ordered, func(i, j int) bool {
+			a, b := sizes[ordered[i]], sizes[ordered[j]]
+			if (a == -1) != (b == -1) {
+				return b == -1
+			}
+			if largest {
+				return a > b
+			}
+			return a < b
+		},
+	)
+	if *args.verbose {
+		shown := ordered
+		more := ""
+		if len(shown) > 10 {
+			shown = shown[:10]
+			more = fmt.Sprintf(" and %d more", len(ordered)-10)
+		}
+		_, _ = fmt.Fprintf(
+			os.Stderr,
+			"Searching channels %s first by available log files: %s%s\n",
+			strings.TrimSuffix(*args.orderChannels, "-first"),
+			strings.Join(shown, ", "),
+			more,
+		)
+	}
+	return ordered, apis
+}
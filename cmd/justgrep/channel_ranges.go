@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// timeRange is the part of the logs searched in a single channel, given with -channel name@start..end.
+type timeRange struct {
+	// start and end are zero if they weren't given, -start and -end are used then
+	start time.Time
+	end   time.Time
+}
+
+// parseChannelRanges parses the -channel list, whose entries can have a time range: "name@start..end". Either side
+// of the range can be left out. It returns the channels and the ranges of the ones which had one.
+func parseChannelRanges(list string) ([]string, map[string]timeRange, error) {
+	entries := strings.FieldsFunc(
+		list, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		},
+	)
+	names := make([]string, 0, len(entries))
+	ranges := make(map[string]timeRange)
+	for _, entry := range entries {
+		at := strings.IndexByte(entry, '@')
+		if at == -1 {
+			names = append(names, entry)
+			continue
+		}
+		name, err := justgrep.NormalizeChannelName(entry[:at])
+		if err != nil {
+			return nil, nil, err
+		}
+		channelRange, err := parseTimeRange(entry[at+1:])
+		if err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("time range of %s: %s", name, err))
+		}
+		if _, ok := ranges[name]; ok {
+			return nil, nil, errors.New(fmt.Sprintf("%s has more than one time range", name))
+		}
+		ranges[name] = channelRange
+		names = append(names, name)
+	}
+	channels, err := justgrep.ParseChannelList(strings.Join(names, ","))
+	if err != nil {
+		return nil, nil, err
+	}
+	return channels, ranges, nil
+}
+
+// parseTimeRange parses "start..end", either of which can be empty.
+func parseTimeRange(text string) (timeRange, error) {
+	dots := strings.Index(text, "..")
+	if dots == -1 {
+		return timeRange{}, errors.New(fmt.Sprintf("%q isn't a range like 2023-01-01..2023-02-01", text))
+	}
+	var output timeRange
+	var err error
+	if start := text[:dots]; start != "" {
+		output.start, err = parseTime(start)
+		if err != nil {
+			return timeRange{}, err
+		}
+	}
+	if end := text[dots+len(".."):]; end != "" {
+		output.end, err = parseTime(end)
+		if err != nil {
+			return timeRange{}, err
+		}
+	}
+	if !output.start.IsZero() && !output.end.IsZero() && !output.start.Before(output.end) {
+		return timeRange{}, errors.New(fmt.Sprintf("%q ends before it starts", text))
+	}
+	return output, nil
+}
+
+// hasAllStarts returns true if every channel has a start time of its own, so -start isn't needed.
+func (args *arguments) hasAllStarts() bool {
+	if len(args.channels) == 0 {
+		return false
+	}
+	for _, channel := range args.channels {
+		if args.channelRanges[channel].start.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// applyChannelRanges fills in the missing sides of channel ranges with -start and -end, channels without a range get
+// -start and -end. Afterwards the overall range covers all channel ranges, it's saved in manifests and used by reports.
+// It returns false if a channel range ended up empty.
+func (args *arguments) applyChannelRanges() (valid bool) {
+	valid = true
+	if len(args.channelRanges) == 0 {
+		return
+	}
+	var start, end time.Time
+	for _, channel := range args.channels {
+		channelRange := args.channelRanges[channel]
+		if channelRange.start.IsZero() {
+			channelRange.start = args.startTime
+		}
+		if channelRange.end.IsZero() {
+			channelRange.end = args.endTime
+		}
+		if !channelRange.start.Before(channelRange.end) {
+			_, _ = fmt.Fprintf(os.Stderr, "-channel: the time range of %s ends before it starts.\n", channel)
+			valid = false
+		}
+		if start.IsZero() || channelRange.start.Before(start) {
+			start = channelRange.start
+		}
+		if channelRange.end.After(end) {
+			end = channelRange.end
+		}
+		args.channelRanges[channel] = channelRange
+	}
+	args.startTime = start
+	args.endTime = end
+	return
+}
+
+// forChannel returns the arguments and filter used to search channel, with its time range if it has one and starting
+// after its newest message in the output file with -since-last.
+func (args *arguments) forChannel(channel string, filter justgrep.Filter) (*arguments, justgrep.Filter) {
+	channelRange, ok := args.channelRanges[channel]
+	if !ok {
+		channelRange = timeRange{start: args.startTime, end: args.endTime}
+	}
+	if last, written := args.lastWritten[channel]; written && !last.Before(channelRange.start) {
+		// -since-last, messages up to the newest one written are in the output file already
+		channelRange.start = last.Add(time.Nanosecond)
+		ok = true
+	}
+	if !ok {
+		return args, filter
+	}
+	channelArgs := &arguments{}
+	*channelArgs = *args
+	channelArgs.startTime = channelRange.start
+	channelArgs.endTime = channelRange.end
+	filter.StartDate = channelRange.start
+	filter.EndDate = channelRange.end
+	return channelArgs, filter
+}
+
+// channelSpec returns channel as it's passed to -channel, with its time range if it has one.
+func (args *arguments) channelSpec(channel string) string {
+	channelRange, ok := args.channelRanges[channel]
+	if !ok {
+		return channel
+	}
+	return fmt.Sprintf(
+		"%s@%s..%s",
+		channel,
+		channelRange.start.Format(time.RFC3339Nano),
+		channelRange.end.Format(time.RFC3339Nano),
+	)
+}
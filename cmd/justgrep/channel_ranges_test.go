@@ -0,0 +1,207 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+func TestParseChannelRanges(t *testing.T) {
+	day := func(day int) time.Time {
+		return testLogStart.AddDate(0, 0, day-1)
+	}
+	tests := []struct {
+		list     string
+		channels string
+		ranges   map[string]timeRange
+		err      string
+	}{
+		{"pajlada, forsen", "pajlada,forsen", map[string]timeRange{}, ""},
+		{
+			"#Pajlada@2021-01-02..2021-01-03,forsen",
+			"pajlada,forsen",
+			map[string]timeRange{"pajlada": {start: day(2), end: day(3)}},
+			"",
+		},
+		{
+			"pajlada@2021-01-02..,forsen@..2021-01-03T12:00:00Z",
+			"pajlada,forsen",
+			map[string]timeRange{
+				"pajlada": {start: day(2)},
+				"forsen":  {end: day(3).Add(12 * time.Hour)},
+			},
+			"",
+		},
+		{"pajlada@..", "pajlada", map[string]timeRange{"pajlada": {}}, ""},
+		{"pajlada@2021-01-02", "", nil, `time range of pajlada: "2021-01-02" isn't a range`},
+		{"pajlada@2021-01-03..2021-01-02", "", nil, "ends before it starts"},
+		{"pajlada@2021-01-02..2021-01-02", "", nil, "ends before it starts"},
+		{"pajlada@yesterday..", "", nil, "time range of pajlada: "},
+		{"pajlada@2021-01-02..,pajlada@..2021-01-01", "", nil, "pajlada has more than one time range"},
+		{"@2021-01-02..", "", nil, "is empty"},
+		{"paj-lada@2021-01-02..", "", nil, "only letters, digits and underscores are allowed"},
+		{"paj-lada", "", nil, "only letters, digits and underscores are allowed"},
+	}
+	for _, test := range tests {
+		channels, ranges, err := parseChannelRanges(test.list)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", test.list, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.list, err)
+			continue
+		}
+		assert(t, test.list+" channels", strings.Join(channels, ","), test.channels)
+		assert(t, test.list+" ranges", len(ranges), len(test.ranges))
+		for channel, expect := range test.ranges {
+			assert(t, test.list+" "+channel+" start", ranges[channel].start, expect.start)
+			assert(t, test.list+" "+channel+" end", ranges[channel].end, expect.end)
+		}
+	}
+}
+
+// testRangeArgs returns arguments searching channels from start to end, with the time ranges of list.
+func testRangeArgs(t *testing.T, list string, start time.Time, end time.Time) *arguments {
+	channels, ranges, err := parseChannelRanges(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &arguments{channels: channels, channelRanges: ranges, startTime: start, endTime: end}
+}
+
+func TestApplyChannelRanges(t *testing.T) {
+	start := testLogStart
+	end := testLogStart.AddDate(0, 0, 7)
+
+	args := testRangeArgs(t, "pajlada@2020-12-25..,forsen@..2021-01-10,xqc@2021-01-02..2021-01-03", start, end)
+	assert(t, "has all starts", args.hasAllStarts(), false)
+	assert(t, "valid", args.applyChannelRanges(), true)
+	assert(t, "pajlada start", args.channelRanges["pajlada"].start, testLogStart.AddDate(0, 0, -7))
+	assert(t, "pajlada end", args.channelRanges["pajlada"].end, end)
+	assert(t, "forsen start", args.channelRanges["forsen"].start, start)
+	assert(t, "forsen end", args.channelRanges["forsen"].end, testLogStart.AddDate(0, 0, 9))
+	// the overall range covers all channels
+	assert(t, "start", args.startTime, testLogStart.AddDate(0, 0, -7))
+	assert(t, "end", args.endTime, testLogStart.AddDate(0, 0, 9))
+
+	// channels without a range use -start and -end
+	args = testRangeArgs(t, "pajlada@2021-01-02..,forsen", start, end)
+	assert(t, "valid with a channel without range", args.applyChannelRanges(), true)
+	assert(t, "forsen filled in", args.channelRanges["forsen"], timeRange{start: start, end: end})
+	assert(t, "start with a channel without range", args.startTime, start)
+
+	args = testRangeArgs(t, "pajlada@2021-01-09..", start, end)
+	assert(t, "starting after -end valid", args.applyChannelRanges(), false)
+
+	args = testRangeArgs(t, "pajlada@2021-01-02..,forsen@2021-01-03..", time.Time{}, end)
+	assert(t, "all starts", args.hasAllStarts(), true)
+	assert(t, "valid without -start", args.applyChannelRanges(), true)
+	assert(t, "start without -start", args.startTime, testLogStart.AddDate(0, 0, 1))
+
+	args = testRangeArgs(t, "pajlada,forsen", start, end)
+	assert(t, "valid without ranges", args.applyChannelRanges(), true)
+	assert(t, "no ranges", len(args.channelRanges), 0)
+}
+
+func TestForChannel(t *testing.T) {
+	start := testLogStart
+	end := testLogStart.AddDate(0, 0, 7)
+	args := testRangeArgs(t, "pajlada@2021-01-02..2021-01-03,forsen,xqc", start, end)
+	args.applyChannelRanges()
+	args.lastWritten = map[string]time.Time{
+		"xqc": testLogStart.Add(time.Hour),
+		// before the channel range, doesn't change it
+		"pajlada": testLogStart,
+	}
+	filter := justgrep.Filter{StartDate: start, EndDate: end}
+
+	tests := []struct {
+		channel string
+		start   time.Time
+		end     time.Time
+		spec    string
+	}{
+		{
+			"pajlada",
+			testLogStart.AddDate(0, 0, 1),
+			testLogStart.AddDate(0, 0, 2),
+			"pajlada@2021-01-02T00:00:00Z..2021-01-03T00:00:00Z",
+		},
+		{"forsen", start, end, "forsen@2021-01-01T00:00:00Z..2021-01-08T00:00:00Z"},
+		{"xqc", testLogStart.Add(time.Hour + time.Nanosecond), end, "xqc@2021-01-01T00:00:00Z..2021-01-08T00:00:00Z"},
+	}
+	for _, test := range tests {
+		channelArgs, channelFilter := args.forChannel(test.channel, filter)
+		assert(t, test.channel+" start", channelArgs.startTime, test.start)
+		assert(t, test.channel+" end", channelArgs.endTime, test.end)
+		assert(t, test.channel+" filter start", channelFilter.StartDate, test.start)
+		assert(t, test.channel+" filter end", channelFilter.EndDate, test.end)
+		assert(t, test.channel+" spec", args.channelSpec(test.channel), test.spec)
+	}
+	assert(t, "arguments unchanged", args.startTime, start)
+
+	// without ranges the arguments are shared
+	args = testRangeArgs(t, "pajlada", start, end)
+	channelArgs, _ := args.forChannel("pajlada", filter)
+	assert(t, "shared arguments", channelArgs, args)
+	assert(t, "spec without range", args.channelSpec("pajlada"), "pajlada")
+}
+
+func TestChannelRangesSearch(t *testing.T) {
+	server := newTestServer(t, 3)
+	tests := []struct {
+		name    string
+		args    []string
+		matches int
+	}{
+		// pajlada on day 2 and 3, forsen on days 1 to 3
+		{"range and -start", []string{"-channel", "pajlada@2021-01-02..,forsen", "-start", "2021-01-01"}, 30},
+		// pajlada on day 2 and the end is included, forsen on day 3
+		{
+			"ranges only",
+			[]string{"-channel", "pajlada@2021-01-02..2021-01-03,forsen@2021-01-03.."},
+			13,
+		},
+	}
+	for _, test := range tests {
+		args := append(
+			[]string{"-no-env", "-url", server.URL, "-end", "2021-01-03T23:59:59Z", "-regex", "pajaS"},
+			test.args...,
+		)
+		result := runJustgrep(t, "", args...)
+		if result.code != 0 || len(result.lines()) != test.matches {
+			t.Errorf(
+				"%s: expected %d matches, got %d, exit code %d: %s",
+				test.name,
+				test.matches,
+				len(result.lines()),
+				result.code,
+				result.stderr,
+			)
+		}
+		for _, line := range result.lines() {
+			if strings.Contains(line, "#pajlada") && strings.Contains(line, "day 1 ") {
+				t.Errorf("%s: found a match before the time range of #pajlada: %s", test.name, line)
+			}
+		}
+	}
+
+	result := runJustgrep(
+		t,
+		"",
+		"-no-env",
+		"-url", server.URL,
+		"-channel", "pajlada@2021-01-05..",
+		"-start", "2021-01-01",
+		"-end", "2021-01-03",
+		"-regex", "pajaS",
+	)
+	if result.code == 0 || !strings.Contains(result.stderr, "the time range of pajlada ends before it starts") {
+		t.Errorf("expected an empty time range to be rejected, got exit code %d: %s", result.code, result.stderr)
+	}
+}
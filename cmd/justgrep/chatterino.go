@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const formatChatterino = "chatterino"
+
+// chatterinoWriter formats messages like Chatterino's logs do. When writing into a directory, messages are collected
+// into one file per channel and day, sorted oldest first, laid out like Chatterino's log directory:
+// DIR/CHANNEL/CHANNEL-YYYY-MM-DD.log.
+type chatterinoWriter struct {
+	dir string
+	out io.Writer
+
+	// files has messages by relative paths of log files
+	files *spillStore
+}
+
+func newChatterinoWriter(dir string, out io.Writer, budget *memoryBudget) *chatterinoWriter {
+	return &chatterinoWriter{dir: dir, out: out, files: newSpillStore(budget)}
+}
+
+// chatterinoLine formats msg as a line of Chatterino's logs.
+func chatterinoLine(msg *justgrep.Message) string {
+	return fmt.Sprintf(
+		"[%s] %s%s\n",
+		msg.Timestamp.Local().Format("15:04:05"),
+		chatterinoText(msg),
+		formatAnnotations(msg, " (", ")"),
+	)
+}
+
+// chatterinoUser returns the name Chatterino shows for the sender of msg, localized display names are followed by the
+// login.
+func chatterinoUser(msg *justgrep.Message) string {
+	displayName := msg.Tags["display-name"]
+	if displayName == "" {
+		return msg.User
+	}
+	if !strings.EqualFold(displayName, msg.User) {
+		return displayName + " (" + msg.User + ")"
+	}
+	return displayName
+}
+
+// chatterinoText formats msg without the timestamp.
+func chatterinoText(msg *justgrep.Message) string {
+	if msg.Invalid != nil {
+		return msg.Raw
+	}
+	switch msg.Action {
+	case "PRIVMSG":
+		text := msg.Text()
+		if strings.HasPrefix(text, "\x01ACTION ") && strings.HasSuffix(text, "\x01") {
+			return chatterinoUser(msg) + " " + text[len("\x01ACTION "):len(text)-1]
+		}
+		return chatterinoUser(msg) + ": " + text
+	case "CLEARCHAT":
+		target := msg.Text()
+		if target == "" {
+			return "Chat has been cleared by a moderator."
+		}
+		if duration, ok := msg.Tags["ban-duration"]; ok {
+			return fmt.Sprintf("%s has been timed out for %ss.", target, duration)
+		}
+		return target + " has been permanently banned."
+	case "USERNOTICE":
+		text := msg.Tags["system-msg"]
+		if len(msg.Args) >= 2 {
+			text += " " + chatterinoUser(msg) + ": " + msg.Text()
+		}
+		return text
+	default:
+		return msg.Text()
+	}
+}
+
+func (w *chatterinoWriter) write(msg *justgrep.Message) {
+	if w.dir == "" {
+		_, _ = io.WriteString(w.out, chatterinoLine(msg))
+		return
+	}
+	channel := msg.Channel()
+	if channel == "" {
+		channel = "unknown"
+	}
+	path := filepath.Join(channel, channel+"-"+msg.Timestamp.Local().Format("2006-01-02")+".log")
+	w.files.add(path, msg)
+}
+
+// finish writes the collected log files.
+func (w *chatterinoWriter) finish() error {
+	defer w.files.close()
+	for _, path := range w.files.keys() {
+		fullPath := filepath.Join(w.dir, path)
+		err := os.MkdirAll(filepath.Dir(fullPath), 0o755)
+		if err != nil {
+			return err
+		}
+		file, err := os.Create(fullPath)
+		if err != nil {
+			return err
+		}
+		writer := bufio.NewWriter(file)
+		first := w.files.stats[path].first.Local()
+		_, _ = fmt.Fprintf(writer, "# Start logging at %s\n", first.Format("2006-01-02 15:04:05 MST"))
+		err = w.files.each(
+			path, func(msg *justgrep.Message) {
+				_, _ = writer.WriteString(chatterinoLine(msg))
+			},
+		)
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+		err = writer.Flush()
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+		err = file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// debugFilter writes every message rejected by the filter and why into a file for -debug-filter, one JSON line each.
+type debugFilter struct {
+	lock    sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+type rejectRecord struct {
+	Result  string `json:"result"`
+	Channel string `json:"channel,omitempty"`
+	Raw     string `json:"raw"`
+}
+
+// newDebugFilter creates path. If path is "-", rejected messages are written to stderr.
+func newDebugFilter(path string) (*debugFilter, error) {
+	file := os.Stderr
+	if path != "-" {
+		var err error
+		file, err = os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	writer := bufio.NewWriter(file)
+	return &debugFilter{file: file, writer: writer, encoder: json.NewEncoder(writer)}, nil
+}
+
+// onReject returns the callback for justgrep.Filter, or nil on a nil debugFilter.
+func (d *debugFilter) onReject() func(msg *justgrep.Message, result justgrep.FilterResult) {
+	if d == nil {
+		return nil
+	}
+	return func(msg *justgrep.Message, result justgrep.FilterResult) {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		_ = d.encoder.Encode(rejectRecord{Result: result.String(), Channel: msg.Channel(), Raw: msg.Raw})
+	}
+}
+
+// finish flushes and closes the file. It does nothing on a nil debugFilter.
+func (d *debugFilter) finish() {
+	if d == nil {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	err := d.writer.Flush()
+	if err == nil && d.file != os.Stderr {
+		err = d.file.Close()
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to write -debug-filter file: %s\n", err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// debugHTTP writes every request made for -debug-http into a file. Files ending with .har get an HTTP Archive
+// written once the search is done, anything else gets a JSON line per request as soon as it's complete.
+type debugHTTP struct {
+	file *os.File
+	har  bool
+	log  *justgrep.HTTPLog
+}
+
+// newDebugHTTP creates path and makes client record its requests into it.
+func newDebugHTTP(path string, client *http.Client) (*debugHTTP, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	output := &debugHTTP{
+		file: file,
+		har:  strings.EqualFold(filepath.Ext(path), ".har"),
+		log:  &justgrep.HTTPLog{},
+	}
+	if !output.har {
+		encoder := json.NewEncoder(file)
+		output.log.OnEntry = func(entry justgrep.HTTPLogEntry) {
+			_ = encoder.Encode(entry)
+		}
+	}
+	client.Transport = output.log.RoundTripper(client.Transport)
+	return output, nil
+}
+
+// finish writes the HAR file if needed and closes the file. It does nothing on a nil debugHTTP.
+func (d *debugHTTP) finish() {
+	if d == nil {
+		return
+	}
+	if d.har {
+		err := d.log.WriteHAR(d.file, gitCommit)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to write -debug-http file: %s\n", err)
+		}
+	}
+	err := d.file.Close()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to write -debug-http file: %s\n", err)
+	}
+}
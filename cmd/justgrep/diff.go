@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// runResults are the messages saved into a run directory, in the order they were found.
+type runResults struct {
+	keys     []string
+	messages map[string]string
+}
+
+// messageKey identifies a message in run results: its id or the whole line for messages without one.
+func messageKey(line string) string {
+	msg, err := justgrep.NewMessage(line)
+	if err != nil || msg.Tags["id"] == "" {
+		return line
+	}
+	return msg.Tags["id"]
+}
+
+func loadRunResults(dir string) (*runResults, error) {
+	file, err := os.Open(filepath.Join(dir, runResultsFile))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	results := &runResults{messages: make(map[string]string)}
+	scanner := newLineScanner(file)
+	for scanner.Scan() {
+		line, _ := justgrep.DecodeLine(scanner.Text())
+		if line == "" {
+			continue
+		}
+		key := messageKey(line)
+		if _, ok := results.messages[key]; ok {
+			continue
+		}
+		results.keys = append(results.keys, key)
+		results.messages[key] = line
+	}
+	return results, scanner.Err()
+}
+
+// missingFrom writes messages of results which other doesn't have, prefixed with prefix. It returns how many there
+// were.
+func (results *runResults) missingFrom(other *runResults, prefix string, output io.Writer) (int, error) {
+	count := 0
+	for _, key := range results.keys {
+		if _, ok := other.messages[key]; ok {
+			continue
+		}
+		count++
+		_, err := fmt.Fprintf(output, "%s %s\n", prefix, results.messages[key])
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// diffRuns prints the messages found by only one of two runs saved with -run-dir, like diff: "<" for the first and
+// ">" for the second run. It returns the exit code, 0 if the runs found the same messages, 1 if they didn't and 2 on
+// errors.
+func diffRuns(dirA string, dirB string) int {
+	a, err := loadRunResults(dirA)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to load results of %s: %s\n", dirA, err)
+		return 2
+	}
+	b, err := loadRunResults(dirB)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to load results of %s: %s\n", dirB, err)
+		return 2
+	}
+	output := bufio.NewWriter(os.Stdout)
+	onlyA, err := a.missingFrom(b, "<", output)
+	var onlyB int
+	if err == nil {
+		onlyB, err = b.missingFrom(a, ">", output)
+	}
+	if err == nil {
+		err = output.Flush()
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to write the difference: %s\n", err)
+		return 2
+	}
+	_, _ = fmt.Fprintf(
+		os.Stderr,
+		"%d only in %s, %d only in %s, %d in both\n",
+		onlyA,
+		dirA,
+		onlyB,
+		dirB,
+		len(a.keys)-onlyA,
+	)
+	if onlyA != 0 || onlyB != 0 {
+		return 1
+	}
+	return 0
+}
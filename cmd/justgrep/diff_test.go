@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	server := newTestServer(t, 2)
+	dir := t.TempDir()
+	search := func(name string, regex string) string {
+		runDir := filepath.Join(dir, name)
+		result := runJustgrep(t, dir, testSearchArgs(server, "pajlada", 2, "-regex", regex, "-run-dir", runDir)...)
+		if result.code != 0 {
+			t.Fatalf("search of %s failed with exit code %d: %s", name, result.code, result.stderr)
+		}
+		return runDir
+	}
+	all := search("all", "pajaS")
+	again := search("again", "pajaS")
+	day1 := search("day1", "pajaS day 1 ")
+	hour0 := search("hour0", "hour 0$")
+
+	same := runJustgrep(t, dir, "diff", all, again)
+	assert(t, "same exit code", same.code, 0)
+	assert(t, "same output", same.stdout, "")
+	assert(t, "same counts", same.stderr, "0 only in "+all+", 0 only in "+again+", 12 in both\n")
+
+	subset := runJustgrep(t, dir, "diff", all, day1)
+	assert(t, "subset exit code", subset.code, 1)
+	assert(t, "subset differences", len(subset.lines()), 6)
+	for _, line := range subset.lines() {
+		if !strings.HasPrefix(line, "< ") || !strings.Contains(line, "pajaS day 2 ") {
+			t.Errorf("unexpected difference %q", line)
+		}
+	}
+
+	// hour 0 of day 1 is found by both
+	both := runJustgrep(t, dir, "diff", day1, hour0)
+	assert(t, "both exit code", both.code, 1)
+	lines := both.lines()
+	if len(lines) != 6 {
+		t.Fatalf("expected 6 differences, got %q", both.stdout)
+	}
+	assert(t, "newest only in the first run", strings.HasSuffix(lines[0], "day 1 hour 20"), true)
+	assert(t, "only in the second run", strings.HasPrefix(lines[5], "> "), true)
+	assert(t, "both counts", both.stderr, "5 only in "+day1+", 1 only in "+hour0+", 1 in both\n")
+
+	missing := runJustgrep(t, dir, "diff", all, filepath.Join(dir, "missing"))
+	if missing.code != 2 || !strings.Contains(missing.stderr, "Unable to load results of") {
+		t.Errorf("expected diffing a missing run to fail, got exit code %d: %s", missing.code, missing.stderr)
+	}
+	usage := runJustgrep(t, dir, "diff", all)
+	assert(t, "usage exit code", usage.code, 2)
+}
+
+func TestLoadRunResults(t *testing.T) {
+	lines := testLogLines(1)
+	dir := t.TempDir()
+	// the same message twice, once with other tags, and a line without an id
+	content := lines[0] + "\n" + lines[1] + "\n" + strings.Replace(lines[0], "room-id=1", "room-id=2", 1) + "\n\nno id\n"
+	err := ioutil.WriteFile(filepath.Join(dir, runResultsFile), []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := loadRunResults(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "keys", strings.Join(results.keys, " "), "pajlada-0 pajlada-1 no id")
+	assert(t, "first one kept", results.messages["pajlada-0"], lines[0])
+
+	_, err = loadRunResults(filepath.Join(dir, "missing"))
+	assert(t, "missing results", os.IsNotExist(err), true)
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// justgrep discord-bot answers the /grep slash command through Discord's interactions endpoint: Discord sends every
+// interaction to -listen as a signed HTTP request, so no gateway connection is needed. Searches are bounded, they
+// return at most discordMaxResults matches and are stopped after discordSearchTimeout.
+
+const DiscordAPIURL = "https://discord.com/api/v10"
+const EnvDiscordToken = "JUSTGREP_DISCORD_TOKEN"
+
+const discordPageSize = 10
+const discordMaxResults = 100
+const discordSearchTimeout = time.Minute
+
+// discordSignatureMaxAge is how far the timestamp of a signed request can be from now, older requests could be
+// replayed. It leaves room for clocks which are a bit off.
+const discordSignatureMaxAge = 5 * time.Minute
+
+// discordMaxSearches is how many searches run at the same time at most, discordKeptSearches is how many finished ones
+// are kept for paging through them.
+const discordMaxSearches = 4
+const discordKeptSearches = 100
+
+// discordModerateMembers is the permission needed to use /grep by default, server admins can change it.
+const discordModerateMembers = "1099511627776"
+
+const (
+	discordInteractionPing      = 1
+	discordInteractionCommand   = 2
+	discordInteractionComponent = 3
+)
+
+const (
+	discordResponsePong          = 1
+	discordResponseMessage       = 4
+	discordResponseDeferred      = 5
+	discordResponseUpdateMessage = 7
+)
+
+// discordEphemeral makes responses visible only to the user who ran the command, results can be sensitive.
+const discordEphemeral = 64
+
+type discordInteraction struct {
+	Type  int    `json:"type"`
+	Token string `json:"token"`
+	Data  struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string      `json:"name"`
+			Value interface{} `json:"value"`
+		} `json:"options"`
+		CustomID string `json:"custom_id"`
+	} `json:"data"`
+}
+
+type discordEmbed struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Color       int    `json:"color"`
+	Footer      *struct {
+		Text string `json:"text"`
+	} `json:"footer,omitempty"`
+}
+
+type discordComponent struct {
+	Type       int                `json:"type"`
+	Style      int                `json:"style,omitempty"`
+	Label      string             `json:"label,omitempty"`
+	CustomID   string             `json:"custom_id,omitempty"`
+	Disabled   bool               `json:"disabled,omitempty"`
+	Components []discordComponent `json:"components,omitempty"`
+}
+
+type discordMessage struct {
+	Content    string             `json:"content,omitempty"`
+	Embeds     []discordEmbed     `json:"embeds"`
+	Components []discordComponent `json:"components"`
+	Flags      int                `json:"flags,omitempty"`
+}
+
+type discordResponse struct {
+	Type int             `json:"type"`
+	Data *discordMessage `json:"data,omitempty"`
+}
+
+// discordSearch is a finished search which can be paged through.
+type discordSearch struct {
+	query   string
+	matches []matchSummary
+	err     error
+}
+
+type discordBot struct {
+	selfSearch
+	token         string
+	publicKey     ed25519.PublicKey
+	apiURL        string
+	applicationID string
+
+	running chan struct{}
+
+	lock     sync.Mutex
+	nextID   int
+	searches map[string]*discordSearch
+	// order has ids of kept searches, oldest first
+	order []string
+}
+
+// request makes a request to the Discord API, output can be nil.
+func (b *discordBot) request(method string, endpoint string, body interface{}, output interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, b.apiURL+endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bot "+b.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", justgrep.UserAgent)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		text, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.New(fmt.Sprintf("discord: %s %s failed: %s %s", method, endpoint, resp.Status, text))
+	}
+	if output == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(output)
+}
+
+// registerCommand finds the application of the bot and creates the /grep command, replacing its other commands.
+func (b *discordBot) registerCommand() error {
+	application := struct {
+		ID string `json:"id"`
+	}{}
+	err := b.request("GET", "/oauth2/applications/@me", nil, &application)
+	if err != nil {
+		return err
+	}
+	b.applicationID = application.ID
+	option := func(name string, description string, required bool) map[string]interface{} {
+		// 3 is a string option
+		return map[string]interface{}{"type": 3, "name": name, "description": description, "required": required}
+	}
+	command := map[string]interface{}{
+		"name":                       "grep",
+		"description":                "Search the chat logs of Twitch channels",
+		"default_member_permissions": discordModerateMembers,
+		"options": []interface{}{
+			option("channels", "Channel names separated with commas", true),
+			option("start", "Start time, e.g. 2021-01-01, 2021-01-01T12:00:00Z or earliest", true),
+			option("end", "End time, now by default", false),
+			option("regex", "Only messages matching this regular expression", false),
+			option("literal", "Only messages containing this text", false),
+			option("user", "Only messages of these users, separated with commas", false),
+		},
+	}
+	return b.request("PUT", "/applications/"+b.applicationID+"/commands", []interface{}{command}, nil)
+}
+
+// verify checks that a request was signed by Discord, which it checks before sending any interactions, and that it
+// was signed at most discordSignatureMaxAge before now.
+func (b *discordBot) verify(r *http.Request, body []byte, now time.Time) bool {
+	signature, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return false
+	}
+	timestamp := r.Header.Get("X-Signature-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > discordSignatureMaxAge || age < -discordSignatureMaxAge {
+		return false
+	}
+	message := append([]byte(timestamp), body...)
+	return ed25519.Verify(b.publicKey, message, signature)
+}
+
+func (b *discordBot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Discord interactions are POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1024*1024))
+	if err != nil || !b.verify(r, body, time.Now()) {
+		http.Error(w, "invalid request signature", http.StatusUnauthorized)
+		return
+	}
+	var interaction discordInteraction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var response discordResponse
+	switch interaction.Type {
+	case discordInteractionPing:
+		response = discordResponse{Type: discordResponsePong}
+	case discordInteractionCommand:
+		response = b.command(&interaction)
+	case discordInteractionComponent:
+		response = b.page(&interaction)
+	default:
+		http.Error(w, "unsupported interaction", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// discordReply is an ephemeral message with text, for responses which aren't search results.
+func discordReply(text string) discordResponse {
+	return discordResponse{
+		Type: discordResponseMessage,
+		Data: &discordMessage{
+			Content:    text,
+			Embeds:     []discordEmbed{},
+			Components: []discordComponent{},
+			Flags:      discordEphemeral,
+		},
+	}
+}
+
+// command starts the search of a /grep command. Discord needs an answer within three seconds, so the search runs in
+// the background and the answer is edited once it's done.
+func (b *discordBot) command(interaction *discordInteraction) discordResponse {
+	if interaction.Data.Name != "grep" {
+		return discordReply("Unknown command.")
+	}
+	arguments := make(map[string]string)
+	var query []string
+	for _, option := range interaction.Data.Options {
+		value := fmt.Sprint(option.Value)
+		arguments[option.Name] = value
+		query = append(query, option.Name+": "+value)
+	}
+	flags, err := searchArgs(arguments)
+	if err != nil {
+		return discordReply(err.Error())
+	}
+	select {
+	case b.running <- struct{}{}:
+	default:
+		return discordReply("Too many searches are running, try again in a bit.")
+	}
+	flags = append(flags, "-max="+strconv.Itoa(discordMaxResults), "-format=json")
+	flags = append(flags, b.instanceArgs("")...)
+	go func() {
+		defer func() {
+			<-b.running
+		}()
+		search := &discordSearch{query: strings.Join(query, ", ")}
+		ctx, cancel := context.WithTimeout(context.Background(), discordSearchTimeout)
+		search.err = b.run(
+			ctx, flags, func(line string) {
+				search.matches = append(search.matches, summarizeMatch(line))
+			},
+		)
+		cancel()
+		id := b.keep(search)
+		err := b.request(
+			"PATCH",
+			"/webhooks/"+b.applicationID+"/"+interaction.Token+"/messages/@original",
+			search.message(id, 0),
+			nil,
+		)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to send search results: %s\n", err)
+		}
+	}()
+	return discordResponse{
+		Type: discordResponseDeferred,
+		Data: &discordMessage{Embeds: []discordEmbed{}, Components: []discordComponent{}, Flags: discordEphemeral},
+	}
+}
+
+// keep keeps search for paging through it and returns its id, the oldest search is dropped if there are too many.
+func (b *discordBot) keep(search *discordSearch) string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.nextID++
+	id := strconv.Itoa(b.nextID)
+	b.searches[id] = search
+	b.order = append(b.order, id)
+	if len(b.order) > discordKeptSearches {
+		delete(b.searches, b.order[0])
+		b.order = b.order[1:]
+	}
+	return id
+}
+
+// page shows another page of results when a button was clicked. Their custom ids are "page:SEARCH:PAGE".
+func (b *discordBot) page(interaction *discordInteraction) discordResponse {
+	parts := strings.Split(interaction.Data.CustomID, ":")
+	if len(parts) != 3 || parts[0] != "page" {
+		return discordReply("Unknown button.")
+	}
+	page, err := strconv.Atoi(parts[2])
+	b.lock.Lock()
+	search := b.searches[parts[1]]
+	b.lock.Unlock()
+	if search == nil || err != nil {
+		return discordReply("These results are gone, run the search again.")
+	}
+	message := search.message(parts[1], page)
+	return discordResponse{Type: discordResponseUpdateMessage, Data: &message}
+}
+
+// discordEscape escapes Discord's markdown in text from chat.
+func discordEscape(text string) string {
+	var output strings.Builder
+	for _, r := range text {
+		switch r {
+		case '\\', '*', '_', '~', '`', '|', '>', '[', ']', '(', ')':
+			output.WriteRune('\\')
+		}
+		output.WriteRune(r)
+	}
+	return output.String()
+}
+
+// shorten cuts text to at most length runes.
+func shorten(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length-1]) + "…"
+}
+
+// message shows a page of the results, with buttons to the other pages.
+func (s *discordSearch) message(id string, page int) discordMessage {
+	embed := discordEmbed{Title: shorten(s.query, 256), Color: 0x9146ff}
+	pages := (len(s.matches) + discordPageSize - 1) / discordPageSize
+	switch {
+	case s.err != nil:
+		embed.Description = "Search failed:\n```\n" + shorten(strings.ReplaceAll(s.err.Error(), "`", "'"), 1500) + "\n```"
+		embed.Color = 0xe01e5a
+	case len(s.matches) == 0:
+		embed.Description = "Nothing found."
+	default:
+		if page < 0 || page >= pages {
+			page = 0
+		}
+		end := (page + 1) * discordPageSize
+		if end > len(s.matches) {
+			end = len(s.matches)
+		}
+		var lines []string
+		for _, match := range s.matches[page*discordPageSize : end] {
+			lines = append(
+				lines,
+				fmt.Sprintf(
+					"`%s` #%s **%s**: %s",
+					match.Timestamp.UTC().Format("2006-01-02 15:04:05"),
+					match.Channel,
+					discordEscape(match.User),
+					discordEscape(shorten(match.Text, 250)),
+				),
+			)
+		}
+		embed.Description = strings.Join(lines, "\n")
+		footer := fmt.Sprintf("Page %d/%d, %d matches", page+1, pages, len(s.matches))
+		if len(s.matches) >= discordMaxResults {
+			footer += fmt.Sprintf(", stopped after %d", discordMaxResults)
+		}
+		embed.Footer = &struct {
+			Text string `json:"text"`
+		}{Text: footer}
+	}
+	message := discordMessage{Embeds: []discordEmbed{embed}, Components: []discordComponent{}}
+	if pages > 1 {
+		button := func(label string, target int, disabled bool) discordComponent {
+			// 2 is a button, style 2 a grey one
+			return discordComponent{
+				Type:     2,
+				Style:    2,
+				Label:    label,
+				CustomID: fmt.Sprintf("page:%s:%d", id, target),
+				Disabled: disabled,
+			}
+		}
+		message.Components = []discordComponent{
+			{
+				// 1 is a row of buttons
+				Type: 1,
+				Components: []discordComponent{
+					button("Previous", page-1, page == 0),
+					button("Next", page+1, page == pages-1),
+				},
+			},
+		}
+	}
+	return message
+}
+
+// runDiscordBot is justgrep discord-bot [options]. It returns the exit code.
+func runDiscordBot(cliArgs []string) int {
+	flags := flag.NewFlagSet("justgrep discord-bot", flag.ContinueOnError)
+	bot := &discordBot{
+		running:  make(chan struct{}, discordMaxSearches),
+		searches: make(map[string]*discordSearch),
+	}
+	bot.register(flags)
+	flags.StringVar(&bot.token, "token", "", "Token of the bot, "+EnvDiscordToken+" is used if it's not given")
+	publicKey := flags.String("public-key", "", "Public key of the Discord application, in hex")
+	listen := flags.String("listen", ":8080", "Address to receive interactions on")
+	flags.StringVar(&bot.apiURL, "api-url", DiscordAPIURL, "Discord API to use")
+	if err := flags.Parse(cliArgs); err != nil {
+		return 2
+	}
+	if bot.token == "" && !bot.noEnv {
+		bot.token = os.Getenv(EnvDiscordToken)
+	}
+	key, err := hex.DecodeString(*publicKey)
+	if bot.token == "" || err != nil || len(key) != ed25519.PublicKeySize {
+		_, _ = fmt.Fprintln(os.Stderr, "justgrep discord-bot needs a -token and the -public-key of the application.")
+		return 2
+	}
+	bot.publicKey = key
+	if err := bot.findExecutable(); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := bot.registerCommand(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to register the /grep command: %s\n", err)
+		return 1
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Receiving interactions on %s\n", *listen)
+	err = http.ListenAndServe(*listen, bot)
+	_, _ = fmt.Fprintf(os.Stderr, "Unable to receive interactions: %s\n", err)
+	return 1
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiscordVerify(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot := &discordBot{publicKey: publicKey}
+	now := time.Unix(1700000000, 0)
+	body := `{"type":1}`
+	sign := func(timestamp string, signed string) string {
+		return hex.EncodeToString(ed25519.Sign(privateKey, []byte(timestamp+signed)))
+	}
+	at := func(offset time.Duration) string {
+		return strconv.FormatInt(now.Add(offset).Unix(), 10)
+	}
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		expect    bool
+	}{
+		{"valid", at(0), sign(at(0), body), true},
+		{"a bit old", at(-3 * time.Minute), sign(at(-3*time.Minute), body), true},
+		// the clock of the machine is behind
+		{"a bit ahead", at(time.Minute), sign(at(time.Minute), body), true},
+		{"too old", at(-10 * time.Minute), sign(at(-10*time.Minute), body), false},
+		{"from the future", at(10 * time.Minute), sign(at(10*time.Minute), body), false},
+		{"other body", at(0), sign(at(0), `{"type":2}`), false},
+		{"other timestamp", at(-time.Second), sign(at(0), body), false},
+		{"timestamp not a number", "now", sign("now", body), false},
+		{"missing signature", at(0), "", false},
+		{"signature not hex", at(0), "zz", false},
+		{"short signature", at(0), sign(at(0), body)[:64], false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		r.Header.Set("X-Signature-Timestamp", test.timestamp)
+		r.Header.Set("X-Signature-Ed25519", test.signature)
+		assert(t, test.name, bot.verify(r, []byte(body), now), test.expect)
+	}
+
+	otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("X-Signature-Timestamp", at(0))
+	r.Header.Set("X-Signature-Ed25519", sign(at(0), body))
+	assert(t, "other key", (&discordBot{publicKey: otherKey}).verify(r, []byte(body), now), false)
+}
+
+// testDiscordSearch returns a search with count matches, the newest first.
+func testDiscordSearch(count int) *discordSearch {
+	search := &discordSearch{query: "channels: pajlada"}
+	for i := 0; i < count; i++ {
+		search.matches = append(
+			search.matches,
+			matchSummary{
+				Timestamp: time.Date(2021, 1, 1, 0, 0, count-i, 0, time.UTC),
+				Channel:   "pajlada",
+				User:      "user_" + strconv.Itoa(i),
+				Text:      fmt.Sprintf("message %d", i),
+			},
+		)
+	}
+	return search
+}
+
+func TestDiscordSearchMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		search   *discordSearch
+		page     int
+		contains string
+		footer   string
+		buttons  bool
+	}{
+		{"nothing found", testDiscordSearch(0), 0, "Nothing found.", "", false},
+		{"failed", &discordSearch{query: "q", err: errors.New("`boom`")}, 0, "Search failed:\n```\n'boom'", "", false},
+		{"one page", testDiscordSearch(3), 0, "**user\\_0**: message 0", "Page 1/1, 3 matches", false},
+		{"first page", testDiscordSearch(25), 0, "message 9", "Page 1/3, 25 matches", true},
+		{"last page", testDiscordSearch(25), 2, "message 24", "Page 3/3, 25 matches", true},
+		{"page out of range", testDiscordSearch(25), 7, "message 0", "Page 1/3, 25 matches", true},
+		{
+			"stopped",
+			testDiscordSearch(discordMaxResults),
+			0,
+			"message 0",
+			"Page 1/10, 100 matches, stopped after 100",
+			true,
+		},
+	}
+	for _, test := range tests {
+		message := test.search.message("7", test.page)
+		if len(message.Embeds) != 1 {
+			t.Fatalf("%s: expected one embed, got %d", test.name, len(message.Embeds))
+		}
+		embed := message.Embeds[0]
+		if !strings.Contains(embed.Description, test.contains) {
+			t.Errorf("%s: expected %q in the description %q", test.name, test.contains, embed.Description)
+		}
+		if lines := strings.Count(embed.Description, "\n") + 1; test.footer != "" && lines > discordPageSize {
+			t.Errorf("%s: expected at most %d matches on a page, got %d", test.name, discordPageSize, lines)
+		}
+		footer := ""
+		if embed.Footer != nil {
+			footer = embed.Footer.Text
+		}
+		assert(t, test.name+" footer", footer, test.footer)
+		assert(t, test.name+" buttons", len(message.Components) != 0, test.buttons)
+	}
+
+	message := testDiscordSearch(25).message("7", 2)
+	buttons := message.Components[0].Components
+	assert(t, "previous", buttons[0].CustomID, "page:7:1")
+	assert(t, "previous disabled", buttons[0].Disabled, false)
+	assert(t, "next", buttons[1].CustomID, "page:7:3")
+	assert(t, "next disabled", buttons[1].Disabled, true)
+}
+
+func TestDiscordPage(t *testing.T) {
+	bot := &discordBot{searches: make(map[string]*discordSearch)}
+	for i := 0; i < discordKeptSearches+1; i++ {
+		bot.keep(testDiscordSearch(25))
+	}
+	assert(t, "kept searches", len(bot.searches), discordKeptSearches)
+
+	tests := []struct {
+		customID string
+		contains string
+	}{
+		{"page:2:1", "message 10"},
+		{"page:101:2", "message 20"},
+		// dropped to keep discordKeptSearches
+		{"page:1:1", "These results are gone"},
+		{"page:2:x", "These results are gone"},
+		{"page:2", "Unknown button."},
+		{"other:2:1", "Unknown button."},
+	}
+	for _, test := range tests {
+		interaction := &discordInteraction{Type: discordInteractionComponent}
+		interaction.Data.CustomID = test.customID
+		response := bot.page(interaction)
+		text := response.Data.Content
+		if len(response.Data.Embeds) != 0 {
+			text = response.Data.Embeds[0].Description
+			assert(t, test.customID+" type", response.Type, discordResponseUpdateMessage)
+		}
+		if !strings.Contains(text, test.contains) {
+			t.Errorf("%s: expected %q in %q", test.customID, test.contains, text)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const reportEmotes = "emotes"
+
+// emotesReport counts the Twitch, 7TV, BTTV and FFZ emotes used in matches. Emote sets are fetched the first time a
+// channel is seen, using the room-id tag.
+type emotesReport struct {
+	client *justgrep.EmoteClient
+	n      int
+
+	global justgrep.EmoteSet
+	// sets has the emote sets of channels by room id, global emotes included
+	sets   map[string]justgrep.EmoteSet
+	counts map[justgrep.Emote]uint64
+}
+
+type emoteCount struct {
+	justgrep.Emote
+	Count uint64 `json:"count"`
+}
+
+type emotesRecord struct {
+	Type   string       `json:"type"`
+	Emotes []emoteCount `json:"emotes"`
+}
+
+func newEmotesReport(n int) *emotesReport {
+	return &emotesReport{
+		client: &justgrep.EmoteClient{HTTP: &httpClient},
+		n:      n,
+		sets:   make(map[string]justgrep.EmoteSet),
+		counts: make(map[justgrep.Emote]uint64),
+	}
+}
+
+// set returns the emotes available in the channel of msg. Failing to fetch emotes isn't fatal, only Twitch emotes and
+// the emotes of the providers which worked are counted then.
+func (r *emotesReport) set(msg *justgrep.Message) justgrep.EmoteSet {
+	if r.global == nil {
+		emotes, err := r.client.GlobalEmotes(context.Background())
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Failed to fetch global emotes: %s\n", err)
+		}
+		r.global = justgrep.EmoteSet{}
+		r.global.Add(emotes)
+	}
+	roomID := msg.Tags["room-id"]
+	if roomID == "" {
+		return r.global
+	}
+	set, ok := r.sets[roomID]
+	if ok {
+		return set
+	}
+	emotes, err := r.client.ChannelEmotes(context.Background(), roomID)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Failed to fetch the emotes of #%s: %s\n", msg.Channel(), err)
+	}
+	set = make(justgrep.EmoteSet, len(r.global)+len(emotes))
+	for name, emote := range r.global {
+		set[name] = emote
+	}
+	set.Add(emotes)
+	r.sets[roomID] = set
+	return set
+}
+
+func (r *emotesReport) observe(msg *justgrep.Message) {
+	for _, emote := range r.set(msg).Find(msg) {
+		r.counts[emote]++
+	}
+}
+
+func (r *emotesReport) write(output *matchOutput) {
+	record := emotesRecord{Type: reportEmotes, Emotes: make([]emoteCount, 0, len(r.counts))}
+	for emote, count := range r.counts {
+		record.Emotes = append(record.Emotes, emoteCount{Emote: emote, Count: count})
+	}
+	sort.Slice(
+		record.Emotes, func(i, j int) bool {
+			a, b := record.Emotes[i], record.Emotes[j]
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+			if a.Name != b.Name {
+				return a.Name < b.Name
+			}
+			return a.Provider < b.Provider
+		},
+	)
+	if len(record.Emotes) > r.n {
+		record.Emotes = record.Emotes[:r.n]
+	}
+	if isJsonFormat(output.format) {
+		_ = output.json.Encode(record)
+		return
+	}
+	for i, emote := range record.Emotes {
+		_, _ = fmt.Fprintf(output.out, "%3d. %s (%s) %d\n", i+1, emote.Name, emote.Provider, emote.Count)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// recipientFlag is -encrypt-to, which can be repeated.
+type recipientFlag []string
+
+func (f *recipientFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *recipientFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// ageWriter encrypts results for -encrypt-to by piping them through the age command, https://age-encryption.org.
+// The standard library doesn't have the X25519 and ChaCha20-Poly1305 age needs, and age itself is the reference.
+type ageWriter struct {
+	command *exec.Cmd
+	stdin   io.WriteCloser
+	closed  bool
+}
+
+// newAgeWriter starts age encrypting to recipients into out. Encrypted output is armored if out is a terminal.
+func newAgeWriter(agePath string, recipients []string, out *os.File) (*ageWriter, error) {
+	flags := []string{"-e"}
+	for _, recipient := range recipients {
+		flags = append(flags, "-r", recipient)
+	}
+	if isTerminal(out) {
+		flags = append(flags, "-a")
+	}
+	command := exec.Command(agePath, flags...)
+	command.Stdout = out
+	command.Stderr = os.Stderr
+	stdin, err := command.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = command.Start()
+	if err != nil {
+		return nil, err
+	}
+	return &ageWriter{command: command, stdin: stdin}, nil
+}
+
+func (w *ageWriter) Write(p []byte) (int, error) {
+	return w.stdin.Write(p)
+}
+
+// close waits until age has written everything, the output isn't valid before that.
+func (w *ageWriter) close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.stdin.Close()
+	if waitErr := w.command.Wait(); waitErr != nil {
+		err = errors.New(fmt.Sprintf("age failed: %s", waitErr))
+	}
+	return err
+}
+
+func (args *arguments) validateEncryptFlags() (valid bool) {
+	valid = true
+	if len(args.encryptTo) == 0 {
+		return
+	}
+	for _, recipient := range args.encryptTo {
+		if !strings.HasPrefix(recipient, "age1") && !strings.HasPrefix(recipient, "ssh-") {
+			_, _ = fmt.Fprintf(
+				os.Stderr,
+				"-encrypt-to: %q isn't an age recipient, they look like age1... or ssh-ed25519 ...\n",
+				recipient,
+			)
+			valid = false
+		}
+	}
+	if *args.runDir != "" || *args.upload != "" {
+		_, _ = fmt.Fprintln(os.Stderr, "-run-dir and -upload would keep results unencrypted, use them without -encrypt-to.")
+		valid = false
+	}
+	if *args.format == formatChatterino || *args.format == formatJsonlEvents {
+		_, _ = fmt.Fprintf(os.Stderr, "-encrypt-to can't be used with -format %s.\n", *args.format)
+		valid = false
+	}
+	agePath, err := exec.LookPath("age")
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "-encrypt-to needs the age command, see https://age-encryption.org.")
+		valid = false
+	}
+	args.agePath = agePath
+	return
+}
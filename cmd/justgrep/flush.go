@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// flushWriter buffers output and flushes it after every few lines, every interval or both, see -flush-every.
+type flushWriter struct {
+	lock sync.Mutex
+	buf  *bufio.Writer
+
+	// lines is how many lines are buffered at most, 0 means no limit
+	lines   int
+	pending int
+
+	ticker *time.Ticker
+	done   chan struct{}
+	// closed is set once close was called
+	closed bool
+}
+
+// parseFlushEvery parses -flush-every: a number of lines or a duration.
+func parseFlushEvery(value string) (lines int, interval time.Duration, err error) {
+	if n, err := strconv.Atoi(value); err == nil {
+		if n < 1 {
+			return 0, 0, errors.New(fmt.Sprintf("%d lines doesn't make sense, use at least 1", n))
+		}
+		return n, 0, nil
+	}
+	interval, err = time.ParseDuration(value)
+	if err != nil {
+		return 0, 0, errors.New(fmt.Sprintf("%q is neither a number of lines nor a duration", value))
+	}
+	if interval <= 0 {
+		return 0, 0, errors.New(fmt.Sprintf("%s doesn't make sense, use a positive duration", value))
+	}
+	return 0, interval, nil
+}
+
+// defaultFlushEvery flushes every line if out is a terminal someone is watching, every second otherwise.
+func defaultFlushEvery(out *os.File) (lines int, interval time.Duration) {
+	if isTerminal(out) {
+		return 1, 0
+	}
+	return 0, time.Second
+}
+
+func newFlushWriter(out io.Writer, lines int, interval time.Duration) *flushWriter {
+	w := &flushWriter{buf: bufio.NewWriterSize(out, 64*1024), lines: lines}
+	if interval > 0 {
+		w.ticker = time.NewTicker(interval)
+		w.done = make(chan struct{})
+		go w.flushPeriodically(w.ticker.C, w.done)
+	}
+	return w
+}
+
+// flushPeriodically gets the channels of w, so it doesn't read w while close stops it.
+func (w *flushWriter) flushPeriodically(ticks <-chan time.Time, done <-chan struct{}) {
+	for {
+		select {
+		case <-ticks:
+			_ = w.Flush()
+		case <-done:
+			return
+		}
+	}
+}
+
+func (w *flushWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	n, err := w.buf.Write(p)
+	if err == nil && w.closed {
+		// nothing would flush it anymore
+		return n, w.buf.Flush()
+	}
+	if err != nil || w.lines == 0 {
+		return n, err
+	}
+	w.pending += bytes.Count(p[:n], []byte{'\n'})
+	if w.pending >= w.lines {
+		w.pending = 0
+		err = w.buf.Flush()
+	}
+	return n, err
+}
+
+func (w *flushWriter) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.pending = 0
+	return w.buf.Flush()
+}
+
+// close stops periodic flushing and writes what's left. Later writes aren't buffered.
+func (w *flushWriter) close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.ticker != nil && !w.closed {
+		w.ticker.Stop()
+		close(w.done)
+	}
+	w.closed = true
+	w.pending = 0
+	return w.buf.Flush()
+}
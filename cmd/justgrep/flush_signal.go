@@ -0,0 +1,29 @@
+//go:build !js && !wasip1
+// +build !js,!wasip1
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// flushOnInterrupt makes sure output buffered by w isn't lost when justgrep is interrupted, then runs every function
+// of then. On Windows, Ctrl+Break arrives as os.Interrupt too and closing the console as SIGTERM.
+func flushOnInterrupt(w *flushWriter, then ...func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		_ = w.Flush()
+		for _, f := range then {
+			f()
+		}
+		code := 1
+		if number, ok := sig.(syscall.Signal); ok {
+			code = 128 + int(number)
+		}
+		os.Exit(code)
+	}()
+}
@@ -0,0 +1,7 @@
+//go:build js || wasip1
+// +build js wasip1
+
+package main
+
+// flushOnInterrupt does nothing, WebAssembly has no signals to be interrupted with.
+func flushOnInterrupt(w *flushWriter, then ...func()) {}
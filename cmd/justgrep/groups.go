@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const groupByChannel = "channel"
+const groupByUser = "user"
+const groupByDay = "day"
+
+// validateGroupFlags checks -group-by, -group-by-login is the same as -group-by user.
+func (args *arguments) validateGroupFlags() (valid bool) {
+	if *args.groupByLogin {
+		if *args.groupBy != "" && *args.groupBy != groupByUser {
+			_, _ = fmt.Fprintln(os.Stderr, "-group-by-login is -group-by user, it can't be used with other groups.")
+			return false
+		}
+		*args.groupBy = groupByUser
+	}
+	switch *args.groupBy {
+	case "", groupByChannel, groupByUser, groupByDay:
+		return true
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "-group-by: unknown group %q, expected channel, user or day\n", *args.groupBy)
+	return false
+}
+
+// groupKey returns the group of msg for -group-by. Days are in UTC, like the log files.
+func groupKey(groupBy string, msg *justgrep.Message) string {
+	switch groupBy {
+	case groupByChannel:
+		return msg.Channel()
+	case groupByDay:
+		return msg.Timestamp.UTC().Format("2006-01-02")
+	}
+	return msg.User
+}
+
+// groupRecord is a group of -group-by in JSON, its messages follow as "messages".
+type groupRecord struct {
+	Type    string    `json:"type"`
+	GroupBy string    `json:"group_by"`
+	Key     string    `json:"key"`
+	Count   int       `json:"count"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+}
+
+// printGroups prints the matches grouped by -group-by, groups are ordered by their oldest message. Text formats get a
+// header line for every group and an empty line between them, JSON formats an object per group with the matches in
+// it.
+func (o *matchOutput) printGroups() {
+	keys := o.groups.keys()
+	sort.SliceStable(
+		keys, func(i, j int) bool {
+			return o.groups.stats[keys[i]].first.Before(o.groups.stats[keys[j]].first)
+		},
+	)
+	for i, key := range keys {
+		stats := o.groups.stats[key]
+		var err error
+		if isJsonFormat(o.format) {
+			err = o.printJsonGroup(key, stats)
+		} else {
+			if i != 0 {
+				_, _ = fmt.Fprintln(o.out)
+			}
+			name := key
+			if name == "" {
+				name = "(no " + o.groupBy + ")"
+			}
+			_, _ = fmt.Fprintf(
+				o.out,
+				"# %s: %d messages from %s to %s\n",
+				name,
+				stats.count,
+				stats.first.Format(time.RFC3339),
+				stats.last.Format(time.RFC3339),
+			)
+			err = o.groups.each(key, o.print)
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to read matches moved to disk: %s\n", err)
+		}
+	}
+	o.groups.close()
+	o.groups = nil
+}
+
+// printJsonGroup writes a group as a single JSON line. Matches are written one by one, so groups moved to disk don't
+// have to fit into memory.
+func (o *matchOutput) printJsonGroup(key string, stats *spillStats) error {
+	header, err := json.Marshal(
+		groupRecord{
+			Type:    "group",
+			GroupBy: o.groupBy,
+			Key:     key,
+			Count:   stats.count,
+			First:   stats.first,
+			Last:    stats.last,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	// the object is left open for the messages
+	_, _ = o.out.Write(header[:len(header)-1])
+	_, _ = fmt.Fprint(o.out, `,"messages":[`)
+	first := true
+	err = o.groups.each(
+		key, func(msg *justgrep.Message) {
+			// schema was validated together with the flags
+			value, _ := justgrep.WithSchema(msg, o.schema)
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return
+			}
+			if !first {
+				_, _ = fmt.Fprint(o.out, ",")
+			}
+			first = false
+			_, _ = o.out.Write(encoded)
+		},
+	)
+	_, _ = fmt.Fprintln(o.out, "]}")
+	return err
+}
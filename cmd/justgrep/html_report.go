@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const formatHtml = "html"
+
+// htmlChartHours is the longest span of matches the chart of -format html shows by hour, longer ones are by day.
+const htmlChartHours = 72
+
+// htmlReport writes a standalone HTML page for -format html: the query, a chart of matches over time and a table of
+// the matches which can be searched and sorted without a server. Matches are held until the search is done.
+type htmlReport struct {
+	query    []string
+	channels []string
+	start    time.Time
+	end      time.Time
+
+	held    *spillStore
+	matches int
+	// hours counts matches by the hour they were sent in, as unix time
+	hours map[int64]int
+}
+
+func newHtmlReport(args *arguments) *htmlReport {
+	return &htmlReport{
+		query:    auditArgs(),
+		channels: args.channels,
+		start:    args.startTime,
+		end:      args.endTime,
+		held:     newSpillStore(&memoryBudget{limit: args.maxMemory}),
+		hours:    make(map[int64]int),
+	}
+}
+
+// validateHtmlFlags checks flags which don't work with -format html, it only prints matches in a table.
+func (args *arguments) validateHtmlFlags() (valid bool) {
+	if *args.top != "" || *args.report != "" || *args.rank || *args.aroundWindow != 0 || *args.groupBy != "" ||
+		*args.alertRateRaw != "" || *args.justUsers || *args.anyPerChannel {
+		_, _ = fmt.Fprintln(
+			os.Stderr,
+			"-format html writes a table of matches, it can't be used with -top, -report, -rank, -around, "+
+				"-group-by, -alert-rate, -just-users or -any-per-channel.",
+		)
+		return false
+	}
+	return true
+}
+
+func (r *htmlReport) observe(msg *justgrep.Message) {
+	r.held.add("", msg)
+	r.matches++
+	r.hours[msg.Timestamp.Unix()/3600]++
+}
+
+type htmlRow struct {
+	Time string
+	// Unix is in milliseconds, JavaScript numbers can't hold nanoseconds
+	Unix        int64
+	Channel     string
+	User        string
+	Text        string
+	Annotations string
+}
+
+type htmlBar struct {
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+	Label  string
+	Count  int
+}
+
+type htmlPage struct {
+	Query     []string
+	Channels  string
+	Start     string
+	End       string
+	Generated string
+	Matches   int
+	Unit      string
+	Bars      []htmlBar
+	Max       int
+	First     string
+	Last      string
+}
+
+// chart returns the bars of the chart, one per hour or day between the first and last match, and the unit.
+func (r *htmlReport) chart() ([]htmlBar, string, int) {
+	if len(r.hours) == 0 {
+		return nil, "", 0
+	}
+	first, last := int64(-1), int64(-1)
+	for hour := range r.hours {
+		if first == -1 || hour < first {
+			first = hour
+		}
+		if hour > last {
+			last = hour
+		}
+	}
+	unit, size := "hour", int64(1)
+	if last-first >= htmlChartHours {
+		unit, size = "day", 24
+		first, last = first-first%24, last-last%24
+	}
+	counts := make([]int, (last-first)/size+1)
+	for hour, count := range r.hours {
+		counts[(hour-hour%size-first)/size] += count
+	}
+	max := 0
+	for _, count := range counts {
+		if count > max {
+			max = count
+		}
+	}
+	const width, height = 1000.0, 200.0
+	bars := make([]htmlBar, len(counts))
+	for i, count := range counts {
+		bucket := time.Unix((first+int64(i)*size)*3600, 0).UTC()
+		label := bucket.Format("2006-01-02 15:00")
+		if unit == "day" {
+			label = bucket.Format("2006-01-02")
+		}
+		barHeight := height * float64(count) / float64(max)
+		bars[i] = htmlBar{
+			X:      width * float64(i) / float64(len(counts)),
+			Y:      height - barHeight,
+			Width:  width / float64(len(counts)),
+			Height: barHeight,
+			Label:  label,
+			Count:  count,
+		}
+	}
+	return bars, unit, max
+}
+
+func (r *htmlReport) write(output *matchOutput) {
+	bars, unit, max := r.chart()
+	page := htmlPage{
+		Query:     r.query,
+		Channels:  strings.Join(r.channels, ", "),
+		Generated: time.Now().UTC().Format(time.RFC3339),
+		Matches:   r.matches,
+		Unit:      unit,
+		Bars:      bars,
+		Max:       max,
+	}
+	if !r.start.IsZero() {
+		page.Start, page.End = r.start.UTC().Format(time.RFC3339), r.end.UTC().Format(time.RFC3339)
+	}
+	if len(bars) != 0 {
+		page.First, page.Last = bars[0].Label, bars[len(bars)-1].Label
+	}
+	err := htmlTemplate.ExecuteTemplate(output.out, "head", page)
+	if err == nil {
+		err = r.held.each(
+			"", func(msg *justgrep.Message) {
+				text := msg.Text()
+				if msg.Invalid != nil {
+					text = msg.Raw
+				}
+				user := msg.Tags["display-name"]
+				if user == "" || !strings.EqualFold(user, msg.User) {
+					user = strings.TrimSpace(msg.User + " " + user)
+				}
+				_ = htmlTemplate.ExecuteTemplate(
+					output.out,
+					"row",
+					htmlRow{
+						Time:        msg.Timestamp.UTC().Format("2006-01-02 15:04:05"),
+						Unix:        msg.Timestamp.UnixNano() / int64(time.Millisecond),
+						Channel:     msg.Channel(),
+						User:        user,
+						Text:        text,
+						Annotations: formatAnnotations(msg, "", ""),
+					},
+				)
+			},
+		)
+	}
+	if err == nil {
+		err = htmlTemplate.ExecuteTemplate(output.out, "foot", page)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to write the HTML report: %s\n", err)
+	}
+	r.held.close()
+}
+
+var htmlTemplate = template.Must(
+	template.New("html").Parse(
+		`{{define "head"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>justgrep report{{if .Channels}}: {{.Channels}}{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+dl { display: grid; grid-template-columns: max-content auto; gap: .2em 1em; }
+dt { font-weight: bold; }
+dd { margin: 0; }
+code { background: #eee; padding: 0 .2em; }
+svg { width: 100%; height: 200px; background: #f6f6f6; }
+rect { fill: #6441a5; }
+rect:hover { fill: #9b6fe0; }
+.axis { display: flex; justify-content: space-between; color: #666; font-size: .9em; }
+input { width: 100%; padding: .4em; margin: 1em 0 .5em; box-sizing: border-box; }
+table { border-collapse: collapse; width: 100%; }
+th { text-align: left; cursor: pointer; user-select: none; background: #eee; }
+th, td { padding: .3em .6em; border-bottom: 1px solid #ddd; vertical-align: top; }
+td:nth-child(1) { white-space: nowrap; }
+td:nth-child(4) { word-break: break-word; }
+</style>
+</head>
+<body>
+<h1>justgrep report</h1>
+<dl>
+{{if .Channels}}<dt>Channels</dt><dd>{{.Channels}}</dd>{{end}}
+{{if .Start}}<dt>Time range</dt><dd>{{.Start}} to {{.End}}</dd>{{end}}
+<dt>Matches</dt><dd>{{.Matches}}</dd>
+<dt>Generated</dt><dd>{{.Generated}}</dd>
+<dt>Query</dt><dd>{{range .Query}}<code>{{.}}</code> {{end}}</dd>
+</dl>
+{{if .Bars}}<h2>Matches by {{.Unit}}</h2>
+<svg viewBox="0 0 1000 200" preserveAspectRatio="none">
+{{range .Bars}}<rect x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}">
+<title>{{.Label}}: {{.Count}}</title></rect>
+{{end}}</svg>
+<div class="axis"><span>{{.First}}</span><span>most in one {{.Unit}}: {{.Max}}</span><span>{{.Last}}</span></div>
+{{end}}<h2>Matches</h2>
+<input id="search" type="search" placeholder="Search matches">
+<div id="shown"></div>
+<table>
+<thead><tr><th>Time (UTC)</th><th>Channel</th><th>User</th><th>Message</th><th>Annotations</th></tr></thead>
+<tbody>
+{{end}}{{define "row"}}<tr><td data-sort="{{.Unix}}">{{.Time}}</td><td>{{.Channel}}</td><td>{{.User}}</td>
+<td>{{.Text}}</td><td>{{.Annotations}}</td></tr>
+{{end}}{{define "foot"}}</tbody>
+</table>
+<script>
+(function () {
+	var body = document.querySelector("tbody");
+	var rows = Array.prototype.slice.call(body.rows);
+	var shown = document.getElementById("shown");
+	function filter() {
+		var words = document.getElementById("search").value.toLowerCase().split(/\s+/).filter(Boolean);
+		var count = 0;
+		rows.forEach(function (row) {
+			var text = row.textContent.toLowerCase();
+			var match = words.every(function (word) { return text.indexOf(word) !== -1; });
+			row.hidden = !match;
+			if (match) count++;
+		});
+		shown.textContent = count + " of " + rows.length + " matches shown";
+	}
+	document.getElementById("search").addEventListener("input", filter);
+	var order = {};
+	document.querySelectorAll("th").forEach(function (th, column) {
+		th.addEventListener("click", function () {
+			var direction = order[column] = -(order[column] || -1);
+			rows.sort(function (a, b) {
+				var x = a.cells[column], y = b.cells[column];
+				x = x.dataset.sort ? Number(x.dataset.sort) : x.textContent.toLowerCase();
+				y = y.dataset.sort ? Number(y.dataset.sort) : y.textContent.toLowerCase();
+				return (x < y ? -1 : x > y ? 1 : 0) * direction;
+			});
+			rows.forEach(function (row) { body.appendChild(row); });
+		});
+	});
+	filter();
+})();
+</script>
+</body>
+</html>
+{{end}}`,
+	),
+)
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// incident is a named time window given with -incident, matches sent during it are annotated with its name.
+type incident struct {
+	name string
+	timeRange
+}
+
+// incidentFlag is the value of -incident. It can be repeated and every value can be a list separated with commas.
+type incidentFlag []incident
+
+func (f *incidentFlag) String() string {
+	entries := make([]string, len(*f))
+	for i, window := range *f {
+		entries[i] = window.name + "@" + formatRangeTime(window.start) + ".." + formatRangeTime(window.end)
+	}
+	return strings.Join(entries, ",")
+}
+
+func formatRangeTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func (f *incidentFlag) Set(value string) error {
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		at := strings.IndexByte(entry, '@')
+		if at <= 0 {
+			return errors.New(fmt.Sprintf("%q isn't a named time range like name@2023-01-01..2023-02-01", entry))
+		}
+		window := incident{name: entry[:at]}
+		for _, other := range *f {
+			if other.name == window.name {
+				return errors.New(fmt.Sprintf("%s is given more than once", window.name))
+			}
+		}
+		var err error
+		window.timeRange, err = parseTimeRange(entry[at+1:])
+		if err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", window.name, err))
+		}
+		*f = append(*f, window)
+	}
+	return nil
+}
+
+// hasStarts returns true if there are incidents and all of them have a start, so -start isn't needed.
+func (f incidentFlag) hasStarts() bool {
+	for _, window := range f {
+		if window.start.IsZero() {
+			return false
+		}
+	}
+	return len(f) != 0
+}
+
+// applyIncidents fills in the missing sides of incidents with -start and -end. If -start wasn't given, the search
+// starts with the oldest incident.
+func (args *arguments) applyIncidents() {
+	if args.startTime.IsZero() && !args.startEarliest && args.incidents.hasStarts() {
+		for _, window := range args.incidents {
+			if args.startTime.IsZero() || window.start.Before(args.startTime) {
+				args.startTime = window.start
+			}
+		}
+	}
+	for i := range args.incidents {
+		window := &args.incidents[i]
+		if window.start.IsZero() {
+			window.start = args.startTime
+		}
+		if window.end.IsZero() {
+			window.end = args.endTime
+		}
+	}
+}
+
+// annotateIncidents adds the names of the incidents msg was sent during as "incident", separated with commas.
+func annotateIncidents(incidents incidentFlag, msg *justgrep.Message) {
+	var names []string
+	for _, window := range incidents {
+		if !msg.Timestamp.Before(window.start) && !msg.Timestamp.After(window.end) {
+			names = append(names, window.name)
+		}
+	}
+	if len(names) != 0 {
+		msg.Annotate("incident", strings.Join(names, ","))
+	}
+}
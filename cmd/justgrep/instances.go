@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const defaultInstance = "http://localhost:8025"
+
+const rankOrder = "order"
+const rankLatency = "latency"
+
+// instanceFlag is the value of -url. It can be repeated and every value can be a list separated with commas or spaces.
+type instanceFlag []string
+
+func (f *instanceFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *instanceFlag) Set(value string) error {
+	*f = append(*f, splitInstanceList(value)...)
+	return nil
+}
+
+func splitInstanceList(list string) []string {
+	return strings.FieldsFunc(
+		list, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		},
+	)
+}
+
+// configuredInstance is a justlog instance and where it was configured, for error messages.
+type configuredInstance struct {
+	url    string
+	source string
+	// preferred is set for instances from -prefer-url or JUSTGREP_PREFERRED_INSTANCES
+	preferred bool
+}
+
+// configuredInstances returns the justlog instances to use, most preferred first: every -url in the order they were
+// given, then the ones from JUSTGREP_DEFAULT_INSTANCES, unless -no-env was passed. -r only uses the environment
+// variable if there's no -url, it needs a single instance. Duplicates are removed. If no instance was configured
+// the default justlog listen address is used. Invalid instances are reported and false is returned.
+func configuredInstances(args *arguments) ([]configuredInstance, bool) {
+	var candidates []configuredInstance
+	for _, instance := range args.urls {
+		candidates = append(candidates, configuredInstance{url: instance, source: "-url"})
+	}
+	if !*args.noEnv && !(*args.recursive && len(args.urls) != 0) {
+		for _, instance := range splitInstanceList(os.Getenv(EnvDefaultInstances)) {
+			candidates = append(candidates, configuredInstance{url: instance, source: EnvDefaultInstances})
+		}
+	}
+
+	valid := true
+	seen := make(map[string]int, len(candidates))
+	instances := make([]configuredInstance, 0, len(candidates))
+	for _, instance := range candidates {
+		normalized, err := justgrep.NormalizeInstanceURL(instance.url)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Invalid justlog instance from %s: %s\n", instance.source, err)
+			valid = false
+			continue
+		}
+		instance.url = normalized
+		instances = addInstance(args, instances, seen, instance)
+	}
+	if !valid {
+		return nil, false
+	}
+	instances, valid = preferInstances(args, instances)
+	if !valid {
+		return nil, false
+	}
+
+	if len(instances) == 0 {
+		instances = []configuredInstance{{url: defaultInstance, source: "default"}}
+		if *args.verbose {
+			_, _ = fmt.Fprintf(
+				os.Stderr,
+				"Assuming you wanted to use %s as the justlog instance. Use -url or set the %q env variable.\n",
+				defaultInstance,
+				EnvDefaultInstances,
+			)
+		}
+	}
+	return instances, true
+}
+
+// addInstance appends instance to instances unless it's there already, possibly under another URL of the same
+// instance (see justgrep.InstanceKey). seen maps keys of instances to their index. If an instance is configured with
+// both http and https, https is used.
+func addInstance(
+	args *arguments,
+	instances []configuredInstance,
+	seen map[string]int,
+	instance configuredInstance,
+) []configuredInstance {
+	key := justgrep.InstanceKey(instance.url)
+	i, ok := seen[key]
+	if !ok {
+		seen[key] = len(instances)
+		return append(instances, instance)
+	}
+	kept := &instances[i]
+	previous := kept.url
+	if previous == instance.url {
+		return instances
+	}
+	if strings.HasPrefix(instance.url, "https://") {
+		kept.url = instance.url
+	}
+	if *args.verbose {
+		_, _ = fmt.Fprintf(
+			os.Stderr,
+			"%s from %s is the same instance as %s, using %s\n",
+			redactURL(instance.url),
+			instance.source,
+			redactURL(previous),
+			redactURL(kept.url),
+		)
+	}
+	return instances
+}
+
+// instanceURLs returns the URLs of instances.
+func instanceURLs(instances []configuredInstance) []string {
+	output := make([]string, len(instances))
+	for i, instance := range instances {
+		output[i] = instance.url
+	}
+	return output
+}
+
+// preferInstances moves the instances given with -prefer-url and JUSTGREP_PREFERRED_INSTANCES (unless -no-env was
+// passed) to the front of instances, in that order. Preferred instances which weren't configured are added. Like
+// JUSTGREP_DEFAULT_INSTANCES, the environment variable isn't used for -r with -url.
+func preferInstances(args *arguments, instances []configuredInstance) ([]configuredInstance, bool) {
+	var preferred []configuredInstance
+	for _, instance := range args.preferURLs {
+		preferred = append(preferred, configuredInstance{url: instance, source: "-prefer-url"})
+	}
+	if !*args.noEnv && !(*args.recursive && len(args.urls) != 0) {
+		for _, instance := range splitInstanceList(os.Getenv(EnvPreferredInstances)) {
+			preferred = append(preferred, configuredInstance{url: instance, source: EnvPreferredInstances})
+		}
+	}
+	if len(preferred) == 0 {
+		return instances, true
+	}
+
+	valid := true
+	output := make([]configuredInstance, 0, len(preferred)+len(instances))
+	seen := make(map[string]int, len(preferred)+len(instances))
+	for _, instance := range preferred {
+		normalized, err := justgrep.NormalizeInstanceURL(instance.url)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Invalid justlog instance from %s: %s\n", instance.source, err)
+			valid = false
+			continue
+		}
+		output = addInstance(
+			args,
+			output,
+			seen,
+			configuredInstance{url: normalized, source: instance.source, preferred: true},
+		)
+	}
+	for _, instance := range instances {
+		output = addInstance(args, output, seen, instance)
+	}
+	return output, valid
+}
+
+// instanceProbe is the answer of an instance to the list of its channels.
+type instanceProbe struct {
+	instance configuredInstance
+	channels map[string]bool
+	latency  time.Duration
+	err      error
+
+	// addresses the host name of the instance resolved to, if it could be resolved
+	addresses []string
+}
+
+func probeInstance(instance configuredInstance) instanceProbe {
+	probe := instanceProbe{instance: instance}
+	start := time.Now()
+	channels, err := justgrep.GetChannelsFromJustLog(context.Background(), &httpClient, instance.url)
+	probe.latency = time.Since(start)
+	if err != nil {
+		probe.err = err
+		return probe
+	}
+	probe.channels = make(map[string]bool, len(channels))
+	for _, channel := range channels {
+		probe.channels[channel] = true
+	}
+	if u, err := url.Parse(instance.url); err == nil {
+		// failing to resolve it only means aliases aren't detected
+		probe.addresses, _ = net.LookupHost(u.Hostname())
+	}
+	return probe
+}
+
+// isAliasOf returns true if p and other are likely the same instance reached under different host names: the host
+// names share an address, the port and path are the same and both have the same channels.
+func (p instanceProbe) isAliasOf(other instanceProbe) bool {
+	if p.err != nil || other.err != nil || len(p.channels) != len(other.channels) {
+		return false
+	}
+	u, err := url.Parse(p.instance.url)
+	if err != nil {
+		return false
+	}
+	otherU, err := url.Parse(other.instance.url)
+	if err != nil || u.Port() != otherU.Port() || u.Path != otherU.Path {
+		return false
+	}
+	shared := false
+	for _, address := range p.addresses {
+		for _, otherAddress := range other.addresses {
+			shared = shared || address == otherAddress
+		}
+	}
+	if !shared {
+		return false
+	}
+	for channel := range p.channels {
+		if !other.channels[channel] {
+			return false
+		}
+	}
+	return true
+}
+
+// dropAliases removes probes of instances which are aliases of a more preferred one, so they're not searched twice.
+func dropAliases(args *arguments, probes []instanceProbe) []instanceProbe {
+	output := probes[:0]
+	for _, probe := range probes {
+		alias := false
+		for _, kept := range output {
+			if probe.isAliasOf(kept) {
+				alias = true
+				if *args.verbose {
+					_, _ = fmt.Fprintf(
+						os.Stderr,
+						"%s looks like the same instance as %s, not using it\n",
+						redactURL(probe.instance.url),
+						redactURL(kept.instance.url),
+					)
+				}
+				break
+			}
+		}
+		if !alias {
+			output = append(output, probe)
+		}
+	}
+	return output
+}
+
+// hasAll returns true if the instance has logs of all of channels.
+func (p instanceProbe) hasAll(channels []string) bool {
+	if p.err != nil {
+		return false
+	}
+	for _, channel := range channels {
+		if !p.channels[channel] {
+			return false
+		}
+	}
+	return true
+}
+
+// rankedProbes asks instances for their channels and returns the answers, most preferred first. With -rank-instances
+// latency all instances are asked at the same time and ordered by how fast they answered, preferred instances still
+// come first. Otherwise they're asked one by one in the configured order until one has all of wanted. Failures are
+// reported.
+func rankedProbes(args *arguments, instances []configuredInstance, wanted []string) []instanceProbe {
+	probes := make([]instanceProbe, 0, len(instances))
+	if *args.rankInstances == rankLatency {
+		probes = probes[:len(instances)]
+		var wait sync.WaitGroup
+		for i, instance := range instances {
+			wait.Add(1)
+			go func(i int, instance configuredInstance) {
+				defer wait.Done()
+				probes[i] = probeInstance(instance)
+			}(i, instance)
+		}
+		wait.Wait()
+		sort.SliceStable(
+			probes, func(i, j int) bool {
+				if probes[i].instance.preferred != probes[j].instance.preferred {
+					return probes[i].instance.preferred
+				}
+				return probes[i].latency < probes[j].latency
+			},
+		)
+	} else {
+		for _, instance := range instances {
+			probe := probeInstance(instance)
+			probes = append(probes, probe)
+			if probe.hasAll(wanted) {
+				break
+			}
+		}
+	}
+	for _, probe := range probes {
+		if probe.err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Fetching channels from %q failed: %s\n", redactURL(probe.instance.url), probe.err)
+		} else if *args.verbose && *args.rankInstances == rankLatency {
+			_, _ = fmt.Fprintf(
+				os.Stderr,
+				"%s answered in %s\n",
+				redactURL(probe.instance.url),
+				probe.latency.Round(time.Millisecond),
+			)
+		}
+	}
+	return dropAliases(args, probes)
+}
+
+// routeChannels decides which instance logs of every channel in wanted are downloaded from. If an instance has all of
+// them, it's used for all of them, otherwise every channel goes to the most preferred instance which has it. Channels
+// no instance has are returned as missing.
+func routeChannels(
+	args *arguments,
+	instances []configuredInstance,
+	wanted []string,
+) (routes map[string]string, missing []string) {
+	probes := rankedProbes(args, instances, wanted)
+	routes = make(map[string]string, len(wanted))
+	for _, probe := range probes {
+		if probe.hasAll(wanted) {
+			for _, channel := range wanted {
+				routes[channel] = probe.instance.url
+			}
+			return routes, nil
+		}
+	}
+	for _, channel := range wanted {
+		for _, probe := range probes {
+			if probe.err == nil && probe.channels[channel] {
+				routes[channel] = probe.instance.url
+				break
+			}
+		}
+		if routes[channel] == "" {
+			missing = append(missing, channel)
+		}
+	}
+	return routes, missing
+}
+
+// routedInstances returns the instances used by routes, in the order of the channels using them first.
+func routedInstances(routes map[string]string, channels []string) []string {
+	var output []string
+	seen := make(map[string]bool)
+	for _, channel := range channels {
+		instance := routes[channel]
+		if !seen[instance] {
+			seen[instance] = true
+			output = append(output, instance)
+		}
+	}
+	return output
+}
+
+type routeRecord struct {
+	Type     string `json:"type"`
+	Channel  string `json:"channel"`
+	Instance string `json:"instance"`
+	// Start and End are set if the channel has its own time range
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+// printRoutes prints which instance is used for every channel, for -dry-run.
+func printRoutes(args *arguments, routes map[string]string, channels []string) {
+	start := args.startTime.Format(time.RFC3339)
+	if args.startEarliest {
+		start = "the earliest logs"
+	}
+	if isJsonFormat(*args.format) {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, channel := range channels {
+			record := routeRecord{Type: "route", Channel: channel, Instance: redactURL(routes[channel])}
+			if channelRange, ok := args.channelRanges[channel]; ok {
+				record.Start = &channelRange.start
+				record.End = &channelRange.end
+			}
+			_ = encoder.Encode(record)
+		}
+		return
+	}
+	if len(args.channelRanges) != 0 {
+		_, _ = fmt.Println("Would search:")
+	} else {
+		_, _ = fmt.Printf("Would search from %s to %s:\n", start, args.endTime.Format(time.RFC3339))
+	}
+	for _, channel := range channels {
+		if channelRange, ok := args.channelRanges[channel]; ok {
+			_, _ = fmt.Printf(
+				"#%s from %s to %s => %s\n",
+				channel,
+				channelRange.start.Format(time.RFC3339),
+				channelRange.end.Format(time.RFC3339),
+				redactURL(routes[channel]),
+			)
+			continue
+		}
+		_, _ = fmt.Printf("#%s => %s\n", channel, redactURL(routes[channel]))
+	}
+}
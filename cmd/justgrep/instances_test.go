@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mm2PL/justgrep/justgreptest"
+)
+
+// testInstanceArgs returns arguments with the options of instances set.
+func testInstanceArgs(urls []string, preferURLs []string, noEnv bool, recursive bool) *arguments {
+	verbose := false
+	rank := rankOrder
+	return &arguments{
+		urls:          urls,
+		preferURLs:    preferURLs,
+		noEnv:         &noEnv,
+		recursive:     &recursive,
+		verbose:       &verbose,
+		rankInstances: &rank,
+	}
+}
+
+// setEnv sets key to value until the test is done.
+func setEnv(t *testing.T, key string, value string) {
+	previous, ok := os.LookupEnv(key)
+	err := os.Setenv(key, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(
+		func() {
+			if ok {
+				_ = os.Setenv(key, previous)
+			} else {
+				_ = os.Unsetenv(key)
+			}
+		},
+	)
+}
+
+func TestConfiguredInstances(t *testing.T) {
+	setEnv(t, EnvDefaultInstances, "https://env.example, https://a.example")
+	setEnv(t, EnvPreferredInstances, "https://preferred-env.example")
+	tests := []struct {
+		name       string
+		urls       []string
+		preferURLs []string
+		noEnv      bool
+		recursive  bool
+		expect     string
+	}{
+		{"default", nil, nil, true, false, defaultInstance},
+		{
+			"normalized and deduplicated",
+			[]string{"HTTPS://A.example/", "https://b.example:443", "https://a.example"},
+			nil,
+			true,
+			false,
+			"https://a.example https://b.example",
+		},
+		{"https wins", []string{"http://a.example", "https://a.example"}, nil, true, false, "https://a.example"},
+		{
+			"environment after -url",
+			[]string{"https://b.example"},
+			nil,
+			false,
+			false,
+			"https://preferred-env.example https://b.example https://env.example https://a.example",
+		},
+		{
+			"-prefer-url first",
+			[]string{"https://b.example", "https://a.example"},
+			[]string{"https://a.example", "https://c.example"},
+			true,
+			false,
+			"https://a.example https://c.example https://b.example",
+		},
+		{
+			"-prefer-url before the environment",
+			nil,
+			[]string{"https://c.example"},
+			false,
+			false,
+			"https://c.example https://preferred-env.example https://env.example https://a.example",
+		},
+		// -r searches the channels of a single instance
+		{"-r with -url", []string{"https://b.example"}, nil, false, true, "https://b.example"},
+		{
+			"-r without -url",
+			nil,
+			nil,
+			false,
+			true,
+			"https://preferred-env.example https://env.example https://a.example",
+		},
+	}
+	for _, test := range tests {
+		args := testInstanceArgs(test.urls, test.preferURLs, test.noEnv, test.recursive)
+		instances, ok := configuredInstances(args)
+		assert(t, test.name+" valid", ok, true)
+		assert(t, test.name, strings.Join(instanceURLs(instances), " "), test.expect)
+	}
+
+	for _, invalid := range []string{"a.example", "ftp://a.example", "https://a.example/?q=1"} {
+		_, ok := configuredInstances(testInstanceArgs([]string{invalid}, nil, true, false))
+		assert(t, invalid+" valid", ok, false)
+		_, ok = configuredInstances(testInstanceArgs(nil, []string{invalid}, true, false))
+		assert(t, invalid+" preferred valid", ok, false)
+	}
+}
+
+// testInstance starts an instance with a message in each of channels.
+func testInstance(t *testing.T, channels ...string) *justgreptest.Server {
+	var lines []string
+	for i, channel := range channels {
+		lines = append(lines, testLogLine(channel, channel, 0, testLogStart.Add(time.Duration(i)*time.Hour), "hello"))
+	}
+	server, err := justgreptest.NewServer(lines...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRouteChannels(t *testing.T) {
+	both := testInstance(t, "pajlada", "forsen")
+	pajlada := testInstance(t, "pajlada")
+	forsen := testInstance(t, "forsen", "xqc")
+	down := testInstance(t, "pajlada", "forsen", "xqc")
+	down.Close()
+
+	tests := []struct {
+		name      string
+		urls      []string
+		preferURL []string
+		wanted    []string
+		expect    map[string]string
+		missing   string
+	}{
+		{
+			"first with all channels",
+			[]string{pajlada.URL, both.URL, forsen.URL},
+			nil,
+			[]string{"pajlada", "forsen"},
+			map[string]string{"pajlada": both.URL, "forsen": both.URL},
+			"",
+		},
+		{
+			"split if none has all",
+			[]string{pajlada.URL, both.URL, forsen.URL},
+			nil,
+			[]string{"pajlada", "forsen", "xqc"},
+			map[string]string{"pajlada": pajlada.URL, "forsen": both.URL, "xqc": forsen.URL},
+			"",
+		},
+		{
+			"fallback if an instance is down",
+			[]string{down.URL, both.URL},
+			nil,
+			[]string{"pajlada", "forsen"},
+			map[string]string{"pajlada": both.URL, "forsen": both.URL},
+			"",
+		},
+		{
+			"-prefer-url with all channels",
+			[]string{both.URL, forsen.URL},
+			[]string{forsen.URL},
+			[]string{"forsen"},
+			map[string]string{"forsen": forsen.URL},
+			"",
+		},
+		{
+			"-prefer-url split",
+			[]string{both.URL, forsen.URL},
+			[]string{forsen.URL},
+			[]string{"forsen", "xqc", "pajlada"},
+			map[string]string{"forsen": forsen.URL, "xqc": forsen.URL, "pajlada": both.URL},
+			"",
+		},
+		{
+			"missing",
+			[]string{pajlada.URL, down.URL},
+			nil,
+			[]string{"pajlada", "xqc"},
+			map[string]string{"pajlada": pajlada.URL},
+			"xqc",
+		},
+	}
+	for _, test := range tests {
+		args := testInstanceArgs(test.urls, test.preferURL, true, false)
+		instances, ok := configuredInstances(args)
+		assert(t, test.name+" valid", ok, true)
+		routes, missing := routeChannels(args, instances, test.wanted)
+		assert(t, test.name+" missing", strings.Join(missing, ","), test.missing)
+		assert(t, test.name+" routed channels", len(routes), len(test.expect))
+		for channel, instance := range test.expect {
+			assert(t, test.name+" #"+channel, routes[channel], instance)
+		}
+	}
+
+	routes := map[string]string{"pajlada": both.URL, "forsen": forsen.URL, "xqc": forsen.URL}
+	assert(
+		t,
+		"routed instances",
+		strings.Join(routedInstances(routes, []string{"xqc", "pajlada", "forsen"}), " "),
+		forsen.URL+" "+both.URL,
+	)
+}
+
+func TestRankInstances(t *testing.T) {
+	fast := testInstance(t, "pajlada", "forsen")
+	slowInstance := testInstance(t, "pajlada", "forsen", "xqc")
+	slow := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(100 * time.Millisecond)
+				slowInstance.Config.Handler.ServeHTTP(w, r)
+			},
+		),
+	)
+	t.Cleanup(slow.Close)
+
+	tests := []struct {
+		name      string
+		rank      string
+		preferURL []string
+		wanted    []string
+		expect    string
+	}{
+		{"in order", rankOrder, nil, []string{"pajlada"}, slow.URL},
+		{"by latency", rankLatency, nil, []string{"pajlada"}, fast.URL},
+		{"by latency, only the slow one has all", rankLatency, nil, []string{"pajlada", "xqc"}, slow.URL},
+		{"preferred first", rankLatency, []string{slow.URL}, []string{"pajlada"}, slow.URL},
+	}
+	for _, test := range tests {
+		args := testInstanceArgs([]string{slow.URL, fast.URL}, test.preferURL, true, false)
+		*args.rankInstances = test.rank
+		instances, ok := configuredInstances(args)
+		assert(t, test.name+" valid", ok, true)
+		routes, missing := routeChannels(args, instances, test.wanted)
+		assert(t, test.name+" missing", len(missing), 0)
+		assert(t, test.name, routes["pajlada"], test.expect)
+	}
+
+	result := runJustgrep(t, "", testSearchArgs(fast, "pajlada", 1, "-rank-instances", "fastest")...)
+	if result.code == 0 || !strings.Contains(result.stderr, "-rank-instances: unknown ranking") {
+		t.Errorf("expected an unknown ranking to be rejected, got exit code %d: %s", result.code, result.stderr)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	pajlada := testInstance(t, "pajlada")
+	forsen := testInstance(t, "forsen", "xqc")
+	args := []string{
+		"-no-env",
+		"-url", pajlada.URL,
+		"-url", forsen.URL,
+		"-channel", "pajlada,xqc",
+		"-start", "2021-01-01",
+		"-end", "2021-01-02",
+		"-regex", ".",
+		"-dry-run",
+	}
+	text := runJustgrep(t, "", args...)
+	assert(t, "text exit code", text.code, 0)
+	assert(
+		t,
+		"text routes",
+		text.stdout,
+		"Would search from 2021-01-01T00:00:00Z to 2021-01-02T00:00:00Z:\n"+
+			"#pajlada => "+pajlada.URL+"\n"+
+			"#xqc => "+forsen.URL+"\n",
+	)
+
+	result := runJustgrep(t, "", append(args, "-format", "json")...)
+	assert(t, "json exit code", result.code, 0)
+	lines := result.lines()
+	if len(lines) != 2 {
+		t.Fatalf("expected a route for every channel, got %q", result.stdout)
+	}
+	for i, expect := range []routeRecord{
+		{Type: "route", Channel: "pajlada", Instance: pajlada.URL},
+		{Type: "route", Channel: "xqc", Instance: forsen.URL},
+	} {
+		var record routeRecord
+		err := json.Unmarshal([]byte(lines[i]), &record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert(t, "json route", record, expect)
+	}
+
+	missing := runJustgrep(
+		t,
+		"",
+		"-no-env",
+		"-url", pajlada.URL,
+		"-url", forsen.URL,
+		"-channel", "pajlada,shroud",
+		"-start", "2021-01-01",
+		"-regex", ".",
+		"-dry-run",
+	)
+	if missing.code != 1 || !strings.Contains(missing.stderr, `No justlog instance has the channels "shroud"`) {
+		t.Errorf("expected a channel no instance has to be rejected, got exit code %d: %s", missing.code, missing.stderr)
+	}
+}
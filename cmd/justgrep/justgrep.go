@@ -5,12 +5,15 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"math"
 	"net/http"
-	"net/url"
 	"os"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/Mm2PL/justgrep"
@@ -33,25 +36,144 @@ type progressUpdate struct {
 type errorReport struct {
 	Type     string                 `json:"type"`
 	Error    string                 `json:"error"`
+	Channel  string                 `json:"channel,omitempty"`
+	Date     string                 `json:"date,omitempty"`
 	Progress justgrep.ProgressState `json:"progress"`
 }
 
-type summaryReport struct {
-	Type     string                 `json:"type"`
-	Results  map[string]int         `json:"results"`
+type startClampedReport struct {
+	Type           string                 `json:"type"`
+	Channel        string                 `json:"channel"`
+	RequestedStart time.Time              `json:"requested_start"`
+	Start          time.Time              `json:"start"`
+	Progress       justgrep.ProgressState `json:"progress"`
+}
+
+type channelFinishedReport struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	// Status is done, skipped (not searched to the end, see -on-error) or aborted
+	Status      string                `json:"status"`
+	Results     justgrep.ResultCounts `json:"results"`
+	CountLines  int                   `json:"count_lines"`
+	CountBytes  int                   `json:"count_bytes"`
+	FetchErrors int                   `json:"fetch_errors"`
+
+	CurrentChannelNum int `json:"current_channel_num"`
+	CountChannels     int `json:"count_channels"`
+
 	Progress justgrep.ProgressState `json:"progress"`
 }
 
+type summaryReport struct {
+	Type string `json:"type"`
+	// Results are keyed by the descriptions of the results, like in older versions
+	Results      map[string]int         `json:"results"`
+	ResultCounts justgrep.ResultCounts  `json:"result_counts"`
+	Progress     justgrep.ProgressState `json:"progress"`
+	// NoResults is why nothing was found, only set without matches
+	NoResults *justgrep.NoResultsExplanation `json:"no_results,omitempty"`
+	// PatternHits are the matches of every pattern of -regex-file which matched
+	PatternHits []patternHit `json:"pattern_hits,omitempty"`
+}
+
 type arguments struct {
-	url *string
+	urls       instanceFlag
+	preferURLs instanceFlag
+	dryRun     *bool
+	// rankInstances is how instances which have the channel are ordered: order or latency
+	rankInstances *string
 
 	user        *string
 	notUser     *string
 	userIsRegex *bool
+	// anyName makes -user and -notuser match display names too
+	anyName     *bool
+	displayName *string
+	// userLogins, notUserLogins and displayNames are the lists given with -user, -notuser and -display-name, unless
+	// -uregex makes them regexes
+	userLogins     []string
+	notUserLogins  []string
+	displayNames   []string
+	userRegexes    patternFlag
+	notUserRegexes patternFlag
+
+	userIDRaw *string
+	// userID is given with -userid or looked up with Helix, userLogin is the current login of -userid
+	userID    string
+	userLogin string
+
+	currentNames   *bool
+	annotateSource *bool
+	names          *currentNames
+
+	nameChanges  *bool
+	groupByLogin *bool
+	groupBy      *string
+
+	alertRateRaw *string
+	alertRate    justgrep.Rate
+	alertOnly    *bool
+
+	maxMemoryRaw *string
+	maxMemory    int64
+
+	memoryCacheRaw *string
+	memoryCache    *justgrep.MemoryCache
+	cacheDir       *string
+	diskCache      *justgrep.DiskCache
+
+	// warm is set for justgrep warm, limitRate (bytes per second) and offPeak limit its downloads
+	warm         bool
+	limitRateRaw *string
+	limitRate    int64
+	offPeakRaw   *string
+	offPeak      *offPeakWindow
 
-	channel      *string
+	top           *string
+	topN          *int
+	approx        *bool
+	tokenizerName *string
+	stopwords     *string
+	tokenizer     justgrep.Tokenizer
+
+	aroundWindow *time.Duration
+	around       *aroundContext
+	modlog       *modlogWriter
+	squash       *bool
+	squashWindow *time.Duration
+
+	rank         *bool
+	focusTimeRaw *string
+	focusTime    time.Time
+
+	report   *string
+	withUser *string
+	window   *time.Duration
+	gap      *time.Duration
+
+	channel *string
+	// channels is -channel split and normalized
+	channels     []string
 	messageRegex *string
-	maxResults   *int
+	strict       *bool
+	presets      presetFlag
+	presetFiles  presetFlag
+	regexFile    *string
+	patterns     *justgrep.PatternSet
+	// patternLines are the lines of -regex-file the patterns are on
+	patternLines  []int
+	patternCounts *patternHits
+	// presetPatterns has the regexes of -preset, to tell which of them matched
+	presetPatterns *justgrep.PatternSet
+	systemMsgRegex *string
+	hasLink        *bool
+	linkDomain     *string
+	maxResults     *int
+	maxPerUser     *int
+
+	distinctUsers *bool
+	justUsers     *bool
 
 	msgOnly *bool
 
@@ -60,8 +182,14 @@ type arguments struct {
 
 	startTime time.Time
 	endTime   time.Time
+	// startEarliest is set by -start earliest, startTime is then found for every channel separately
+	startEarliest bool
 
-	verbose      *bool
+	verbose *bool
+	// display shows progress with -v
+	display *progressDisplay
+	// events is where -progress-json events are written, stderr if it's nil
+	events       io.Writer
 	recursive    *bool
 	progressJson *bool
 
@@ -69,9 +197,120 @@ type arguments struct {
 	messageTypesRaw *string
 
 	noEnv *bool
+
+	apiFormat    justgrep.APIFormat
+	apiFormatRaw *string
+
+	refine *string
+	runDir *string
+
+	literal  *string
+	twoPhase *bool
+
+	fixedSteps *bool
+	shards     *int
+	jobs       *int
+	perfPreset *string
+	gomaxprocs *int
+
+	anyPerChannel *bool
+
+	format    *string
+	schema    string
+	schemaRaw *string
+	// template is -template or -template-file, for -format template
+	templateText *string
+	templateFile *string
+	template     *template.Template
+
+	markdownStyle   *string
+	markdownMaxSize *int
+
+	outputPath *string
+	sinceLast  *bool
+	// lastWritten is when the newest message of every channel in the -o file was sent, for -since-last.
+	// lastWrittenSize is the size of its complete lines.
+	lastWritten     map[string]time.Time
+	lastWrittenSize int64
+
+	upload          *string
+	uploadOver      *string
+	uploadToken     *string
+	uploader        justgrep.Uploader
+	uploadThreshold int64
+
+	encryptTo recipientFlag
+	agePath   string
+
+	orderChannels *string
+
+	auditLogRaw  *string
+	auditLogPath string
+	audit        *auditLog
+
+	summaryFilePath *string
+	summaryFile     *summaryFile
+
+	flushEvery    *string
+	flushLines    int
+	flushInterval time.Duration
+
+	debugHTTPPath *string
+	debugHTTP     *debugHTTP
+
+	sessionPath *string
+	session     *session
+	userAgent   *string
+
+	caCert             *string
+	clientCert         *string
+	clientKey          *string
+	insecureSkipVerify *bool
+	resolve            resolveFlag
+	ipVersion          *int
+
+	debugFilterPath *string
+	debugFilter     *debugFilter
+
+	pprofAddr  *string
+	cpuProfile *string
+	memProfile *string
+	profiling  *profiling
+
+	vodIDRaw     *string
+	vodURL       *string
+	vodID        string
+	vodStart     *string
+	vodStartTime time.Time
+	vod          *justgrep.VOD
+
+	// channelRanges has the time range of every channel if any channel had one in -channel
+	channelRanges map[string]timeRange
+	incidents     incidentFlag
+
+	// bench is set for justgrep bench, benchCorpus is the file it searches or empty for the built-in corpus
+	bench       bool
+	benchCorpus string
+
+	stdinFormat  *string
+	fieldMapping justgrep.FieldMapping
+	mapRaw       *string
+
+	onParseErrorRaw *string
+	// fetchOptions has the -on-parse-error policy, the decoders of -invalid-utf8 and -annotate-source
+	fetchOptions justgrep.FetchOptions
+	// parseErrorStopsSearch is set by -on-parse-error abort
+	parseErrorStopsSearch bool
+	invalidUTF8           *string
+
+	onError *string
 }
 
 func parseTime(input string) (output time.Time, err error) {
+	output, err = time.Parse("2006-01-02", input)
+	if err == nil {
+		return
+	}
 	output, err = time.Parse("2006-01-02 15:04:05", input)
 	if err == nil {
 		return
@@ -90,6 +329,140 @@ func parseTime(input string) (output time.Time, err error) {
 
 func (args *arguments) validateAndProcessFlags() (valid bool) {
 	valid = true
+	if err := args.applyPerfPreset(); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		valid = false
+	}
+	if !args.validatePresetFlags() {
+		valid = false
+	}
+	if !args.validateRegexFileFlags() {
+		valid = false
+	}
+	if !args.validateGroupFlags() {
+		valid = false
+	}
+	if !args.validateTemplateFlags() {
+		valid = false
+	}
+	if !args.validateOutputFlags() {
+		valid = false
+	}
+	if !args.validateSinceLastFlags() {
+		valid = false
+	}
+	if !args.validateCacheFlags() {
+		valid = false
+	}
+	if !args.validateUserFlags() {
+		valid = false
+	}
+	if !args.validateReportFlags() {
+		valid = false
+	}
+	if !args.validateAroundFlags() {
+		valid = false
+	}
+	if !args.validateSquashFlags() {
+		valid = false
+	}
+	if !args.validateUploadFlags() {
+		valid = false
+	}
+	if !args.validateEncryptFlags() {
+		valid = false
+	}
+	if !args.validateAuditFlags() {
+		valid = false
+	}
+	if !args.validateOrderFlags() {
+		valid = false
+	}
+	switch *args.onError {
+	case onErrorSkipDay, onErrorSkipChannel, onErrorAbort:
+	default:
+		_, _ = fmt.Fprintf(
+			os.Stderr,
+			"-on-error: unknown policy %q, expected %s, %s or %s\n",
+			*args.onError,
+			onErrorSkipDay,
+			onErrorSkipChannel,
+			onErrorAbort,
+		)
+		valid = false
+	}
+	if *args.rankInstances != rankOrder && *args.rankInstances != rankLatency {
+		_, _ = fmt.Fprintf(
+			os.Stderr,
+			"-rank-instances: unknown ranking %q, expected %s or %s\n",
+			*args.rankInstances,
+			rankOrder,
+			rankLatency,
+		)
+		valid = false
+	}
+	if *args.onParseErrorRaw == parseErrorSkipFile {
+		// the rest of the log file is lost, the search goes on
+		args.fetchOptions.OnInvalidLine = justgrep.InvalidLineAbort
+	} else if policy, err := justgrep.ParseInvalidLinePolicy(*args.onParseErrorRaw); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "-on-parse-error: %s, expected %s\n", err, parseErrorSkipFile)
+		valid = false
+	} else {
+		args.fetchOptions.OnInvalidLine = policy
+		args.parseErrorStopsSearch = policy == justgrep.InvalidLineAbort
+	}
+	args.fetchOptions.RecordSources = *args.annotateSource
+	args.fetchOptions.LineDecoders = justgrep.DefaultLineDecoders()
+	switch *args.invalidUTF8 {
+	case "keep":
+	case "repair":
+		args.fetchOptions.LineDecoders = append(args.fetchOptions.LineDecoders, justgrep.RepairUTF8)
+	case "reject":
+		args.fetchOptions.LineDecoders = append(args.fetchOptions.LineDecoders, justgrep.RejectInvalidUTF8)
+	default:
+		_, _ = fmt.Fprintf(
+			os.Stderr,
+			"-invalid-utf8: unknown policy %q, expected keep, repair or reject\n",
+			*args.invalidUTF8,
+		)
+		valid = false
+	}
+	if args.bench {
+		if *args.refine != "" {
+			_, _ = fmt.Fprintln(os.Stderr, "justgrep bench searches its corpus, -refine can't be used with it.")
+			valid = false
+		}
+		if *args.stdinFormat != "" && !args.validateStdinFlags() {
+			valid = false
+		}
+		if *args.stdinFormat == "ndjson" && args.benchCorpus == "" {
+			_, _ = fmt.Fprintln(os.Stderr, "The built-in corpus has raw IRC lines, pass an ndjson corpus file.")
+			valid = false
+		}
+		if !valid {
+			return
+		}
+		return args.validateOfflineFlags("justgrep bench")
+	}
+	if *args.refine != "" && *args.stdinFormat != "" {
+		_, _ = fmt.Fprintln(os.Stderr, "Passing both -refine and -stdin-format doesn't make sense.")
+		return false
+	}
+	if *args.refine != "" {
+		if !valid {
+			return
+		}
+		return args.validateOfflineFlags("-refine")
+	}
+	if *args.stdinFormat != "" {
+		if !args.validateStdinFlags() {
+			valid = false
+		}
+		if !valid {
+			return
+		}
+		return args.validateOfflineFlags("-stdin-format")
+	}
 	if *args.channel == "" && !*args.recursive {
 		_, _ = fmt.Fprintln(os.Stderr, "You need to pass the -channel or -r (recursive) arguments.")
 		valid = false
@@ -98,25 +471,94 @@ func (args *arguments) validateAndProcessFlags() (valid bool) {
 		_, _ = fmt.Fprintln(os.Stderr, "Passing both -r (run on all channels) and -channel does not make sense.")
 		valid = false
 	}
-	if *args.start == "" {
+	if *args.channel != "" {
+		channels, ranges, err := parseChannelRanges(*args.channel)
+		args.channels = channels
+		args.channelRanges = ranges
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-channel: %s\n", err)
+			valid = false
+		}
+	}
+	if *args.start == "" && !args.hasAllStarts() && !args.incidents.hasStarts() {
 		_, _ = fmt.Fprintln(os.Stderr, "You need to pass the -start argument.")
 		valid = false
 	}
+	if len(args.channelRanges) != 0 {
+		if *args.start == startEarliest {
+			_, _ = fmt.Fprintln(os.Stderr, "-start earliest can't be used with time ranges in -channel.")
+			valid = false
+		}
+		if *args.report == reportGaps {
+			_, _ = fmt.Fprintln(os.Stderr, "-report gaps needs the same time range for all channels.")
+			valid = false
+		}
+	}
 	if *args.verbose && *args.progressJson {
 		_, _ = fmt.Fprintln(os.Stderr, "Passing both -v and -progress-json doesn't make sense because they use stderr.")
 		valid = false
 	}
+	if *args.twoPhase && *args.literal == "" {
+		_, _ = fmt.Fprintln(os.Stderr, "-two-phase needs a literal to look for in the first phase, pass it with -F.")
+		valid = false
+	}
+	if *args.shards < 1 {
+		_, _ = fmt.Fprintln(os.Stderr, "-shards needs to be at least 1.")
+		valid = false
+	}
+	if *args.shards > 1 && (*args.twoPhase || *args.maxResults != 0 || *args.anyPerChannel) {
+		_, _ = fmt.Fprintln(os.Stderr, "-shards can't be used with -two-phase, -max or -any-per-channel.")
+		valid = false
+	}
+	if *args.shards > 1 && (*args.aroundWindow != 0 || *args.format == formatModlogJson) {
+		// both need the messages of a channel in the order they were sent, shards filter them at the same time
+		_, _ = fmt.Fprintln(os.Stderr, "-shards can't be used with -around or -format modlog-json.")
+		valid = false
+	}
+	if *args.jobs < 1 {
+		_, _ = fmt.Fprintln(os.Stderr, "-jobs needs to be at least 1.")
+		valid = false
+	}
+	if !givenFlags()["jobs"] && *args.shards > *args.jobs {
+		*args.jobs = *args.shards
+	}
+	if *args.maxPerUser < 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "-max-per-user can't be negative.")
+		valid = false
+	}
+	if *args.anyPerChannel && *args.maxResults != 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "Passing both -any-per-channel and -max doesn't make sense.")
+		valid = false
+	}
+	if *args.twoPhase && *args.apiFormatRaw != "raw" {
+		_, _ = fmt.Fprintln(os.Stderr, "-two-phase only works with -api raw.")
+		valid = false
+	}
 	// show missing arguments and that's it
 	if !valid {
 		return
 	}
 
-	startTime, err := parseTime(*args.start)
+	var err error
+	if *args.start == startEarliest {
+		args.startEarliest = true
+		if *args.fixedSteps {
+			_, _ = fmt.Fprintln(os.Stderr, "-start earliest needs to list available logs, it can't be used with -fixed-steps.")
+			valid = false
+		}
+	} else if *args.start != "" {
+		args.startTime, err = parseTime(*args.start)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-start: Invalid time: %s: %s\n", *args.start, err)
+			valid = false
+		}
+	}
+
+	args.apiFormat, err = justgrep.ParseAPIFormat(*args.apiFormatRaw)
 	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "-start: Invalid time: %s: %s\n", *args.start, err)
+		_, _ = fmt.Fprintf(os.Stderr, "-api: %s\n", err)
 		valid = false
 	}
-	args.startTime = startTime
 	if *args.end == "" {
 		args.endTime = time.Now().UTC()
 	} else {
@@ -127,6 +569,246 @@ func (args *arguments) validateAndProcessFlags() (valid bool) {
 		}
 		args.endTime = endTime
 	}
+	if valid {
+		args.applyIncidents()
+		if !args.applyChannelRanges() {
+			valid = false
+		}
+	}
+	return
+}
+
+// validateOutputFlags checks flags deciding how results are printed.
+func (args *arguments) validateOutputFlags() (valid bool) {
+	valid = true
+	switch *args.format {
+	case formatRaw, formatJson, formatChatterino, formatMarkdown:
+	case formatTemplate:
+		if args.template == nil {
+			_, _ = fmt.Fprintln(os.Stderr, "-format template needs -template or -template-file.")
+			valid = false
+		}
+	case formatModlogJson:
+		if !args.validateModlogFlags() {
+			valid = false
+		}
+	case formatLinks:
+		if *args.top != "" || *args.report != "" || *args.rank || *args.aroundWindow != 0 {
+			_, _ = fmt.Fprintln(
+				os.Stderr,
+				"-format links lists links instead of matches, it can't be used with -top, -report, -rank or -around.",
+			)
+			valid = false
+		}
+	case formatHtml:
+		if !args.validateHtmlFlags() {
+			valid = false
+		}
+	case formatJsonlEvents:
+		if *args.verbose {
+			_, _ = fmt.Fprintln(os.Stderr, "-format jsonl-events includes progress, it can't be used with -v.")
+			valid = false
+		} else {
+			*args.progressJson = true
+		}
+		if *args.outputPath != "" {
+			_, _ = fmt.Fprintln(os.Stderr, "-format jsonl-events is written to stdout, it can't be used with -o.")
+			valid = false
+		}
+	default:
+		_, _ = fmt.Fprintf(
+			os.Stderr,
+			"-format: unknown format %q, expected raw, json, jsonl-events, modlog-json, links, html, markdown, "+
+				"chatterino or template\n",
+			*args.format,
+		)
+		valid = false
+	}
+	schema, err := justgrep.ParseMessageSchema(*args.schemaRaw)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "-schema: %s\n", err)
+		valid = false
+	}
+	args.schema = schema
+	if !args.validateMarkdownFlags() {
+		valid = false
+	}
+	if *args.summaryFilePath != "" {
+		args.summaryFile = newSummaryFile(*args.summaryFilePath)
+	}
+
+	if *args.flushEvery != "" {
+		args.flushLines, args.flushInterval, err = parseFlushEvery(*args.flushEvery)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-flush-every: %s\n", err)
+			valid = false
+		}
+	}
+	if *args.memoryCacheRaw != "" {
+		limit, err := parseByteSize(*args.memoryCacheRaw)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-memory-cache: %s\n", err)
+			valid = false
+		} else {
+			args.memoryCache = justgrep.NewMemoryCache(limit)
+		}
+	}
+	if *args.maxMemoryRaw != "" {
+		args.maxMemory, err = parseByteSize(*args.maxMemoryRaw)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-max-memory: %s\n", err)
+			valid = false
+		}
+	}
+	if *args.alertRateRaw != "" {
+		args.alertRate, err = justgrep.ParseRate(*args.alertRateRaw)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-alert-rate: %s\n", err)
+			valid = false
+		}
+	} else if *args.alertOnly {
+		_, _ = fmt.Fprintln(os.Stderr, "-alert-only needs -alert-rate.")
+		valid = false
+	}
+	if *args.alertRateRaw != "" && (*args.groupBy != "" || *args.report != "" || *args.top != "") {
+		_, _ = fmt.Fprintln(os.Stderr, "-alert-rate can't be used together with -group-by, -report or -top.")
+		valid = false
+	}
+	if *args.justUsers {
+		*args.distinctUsers = true
+	}
+	if *args.distinctUsers &&
+		(*args.maxPerUser != 0 || *args.anyPerChannel || *args.groupBy != "" || *args.report != "" || *args.top != "") {
+		_, _ = fmt.Fprintln(
+			os.Stderr,
+			"-distinct-users can't be used together with -max-per-user, -any-per-channel, -group-by, -report "+
+				"or -top.",
+		)
+		valid = false
+	}
+	if *args.justUsers && *args.format == formatChatterino {
+		_, _ = fmt.Fprintln(os.Stderr, "-just-users only prints usernames, it can't be used with -format chatterino.")
+		valid = false
+	}
+	if *args.groupBy != "" && *args.format == formatChatterino && *args.outputPath != "" {
+		_, _ = fmt.Fprintln(os.Stderr, "-group-by can't be used with Chatterino log files.")
+		valid = false
+	}
+
+	if *args.vodIDRaw != "" && *args.vodURL != "" {
+		_, _ = fmt.Fprintln(os.Stderr, "Passing both -vod-id and -vod-url doesn't make sense.")
+		valid = false
+	}
+	vodRaw := *args.vodIDRaw + *args.vodURL
+	if vodRaw != "" {
+		args.vodID, err = justgrep.ParseVODID(vodRaw)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-vod-id/-vod-url: %s\n", err)
+			valid = false
+		}
+	}
+	if *args.vodStart != "" {
+		if vodRaw == "" {
+			_, _ = fmt.Fprintln(os.Stderr, "-vod-start needs -vod-id or -vod-url.")
+			valid = false
+		}
+		args.vodStartTime, err = parseTime(*args.vodStart)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-vod-start: Invalid time: %s: %s\n", *args.vodStart, err)
+			valid = false
+		}
+	}
+	return
+}
+
+// validateUserFlags checks -userid and -any-name and splits the lists of -user, -notuser and -display-name.
+func (args *arguments) validateUserFlags() (valid bool) {
+	valid = true
+	if !*args.userIsRegex {
+		args.userLogins = splitNameList(*args.user)
+		args.notUserLogins = splitNameList(*args.notUser)
+		args.displayNames = splitNameList(*args.displayName)
+	}
+	if *args.anyName && *args.user == "" && *args.notUser == "" &&
+		len(args.userRegexes) == 0 && len(args.notUserRegexes) == 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "-any-name only makes sense with -user or -notuser.")
+		valid = false
+	}
+	if *args.userIDRaw == "" {
+		return
+	}
+	if *args.user != "" {
+		_, _ = fmt.Fprintln(os.Stderr, "Passing both -user and -userid doesn't make sense.")
+		valid = false
+	}
+	if _, err := strconv.ParseUint(*args.userIDRaw, 10, 64); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "-userid: %q isn't a valid user id\n", *args.userIDRaw)
+		valid = false
+	}
+	args.userID = *args.userIDRaw
+	return
+}
+
+// validateStdinFlags checks -stdin-format and -map.
+func (args *arguments) validateStdinFlags() (valid bool) {
+	valid = true
+	switch *args.stdinFormat {
+	case "irc", "packed":
+		if *args.mapRaw != "" {
+			_, _ = fmt.Fprintln(os.Stderr, "-map only makes sense with -stdin-format ndjson.")
+			valid = false
+		}
+	case "ndjson":
+		mapping, err := justgrep.ParseFieldMapping(*args.mapRaw)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-map: %s\n", err)
+			valid = false
+		}
+		args.fieldMapping = mapping
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "-stdin-format: unknown format %q, expected irc, ndjson or packed\n", *args.stdinFormat)
+		valid = false
+	}
+	return
+}
+
+// validateOfflineFlags checks flags for modes which don't download anything, like -refine. -channel and -start are
+// optional for them.
+func (args *arguments) validateOfflineFlags(mode string) (valid bool) {
+	valid = true
+	if *args.channel != "" || *args.recursive {
+		_, _ = fmt.Fprintf(os.Stderr, "%s doesn't download logs, -channel and -r can't be used with it.\n", mode)
+		valid = false
+	}
+	if *args.runDir != "" {
+		_, _ = fmt.Fprintf(os.Stderr, "%s can't be replayed, -run-dir can't be used with it.\n", mode)
+		valid = false
+	}
+	if *args.sinceLast {
+		_, _ = fmt.Fprintf(os.Stderr, "%s doesn't download logs, -since-last can't be used with it.\n", mode)
+		valid = false
+	}
+	if *args.verbose && *args.progressJson {
+		_, _ = fmt.Fprintln(os.Stderr, "Passing both -v and -progress-json doesn't make sense because they use stderr.")
+		valid = false
+	}
+	if *args.start != "" {
+		startTime, err := parseTime(*args.start)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-start: Invalid time: %s: %s\n", *args.start, err)
+			valid = false
+		}
+		args.startTime = startTime
+	}
+	args.endTime = time.Now().UTC()
+	if *args.end != "" {
+		endTime, err := parseTime(*args.end)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-end: Invalid time: %s: %s\n", *args.end, err)
+			valid = false
+		}
+		args.endTime = endTime
+	}
 	return
 }
 
@@ -134,17 +816,146 @@ const progressNextChannel = "nextChannel"
 const progressNextStep = "nextStep"
 const errorWhileFetching = "fetchError"
 const summaryFinished = "summaryFinished"
+const progressStartClamped = "startClamped"
+const progressChannelFinished = "channelFinished"
+
+// statuses of channelFinished events
+const (
+	channelDone    = "done"
+	channelSkipped = "skipped"
+	channelAborted = "aborted"
+)
+
+// values of -on-error
+const (
+	onErrorSkipDay     = "skip-day"
+	onErrorSkipChannel = "skip-channel"
+	onErrorAbort       = "abort"
+)
+
+// parseErrorSkipFile is the -on-parse-error policy which stops reading the log file at an invalid line but keeps
+// searching the others, the other policies are parsed by justgrep.ParseInvalidLinePolicy.
+const parseErrorSkipFile = "skip-file"
 
 var gitCommit = "[unavailable]"
 var httpClient = http.Client{}
 
 const EnvDefaultInstances = "JUSTGREP_DEFAULT_INSTANCES"
+const EnvPreferredInstances = "JUSTGREP_PREFERRED_INSTANCES"
+
+// startEarliest can be passed to -start to search all available logs.
+const startEarliest = "earliest"
 
 func main() {
 	args := &arguments{}
-	args.user = flag.String("user", "", "Target user")
-	args.notUser = flag.String("notuser", "", "Negative match on username")
-	args.userIsRegex = flag.Bool("uregex", false, "Is the -user option a regex?")
+	args.user = flag.String("user", "", "Target user, or a list of users separated with commas")
+	args.userIDRaw = flag.String("userid", "", "Target user id, finds messages sent under any name")
+	args.displayName = flag.String(
+		"display-name",
+		"",
+		"Target display name, compared case-insensitively, a regex with -uregex",
+	)
+	args.anyName = flag.Bool("any-name", false, "Make -user and -notuser match display names as well as logins")
+	flag.Var(&args.userRegexes, "user-regex", "Also match users whose login matches this regex, can be repeated")
+	flag.Var(
+		&args.notUserRegexes,
+		"notuser-regex",
+		"Ignore users whose login matches this regex, can be repeated",
+	)
+	args.nameChanges = flag.Bool("name-changes", false, "Report users who matched under more than one login")
+	args.groupByLogin = flag.Bool("group-by-login", false, "Same as -group-by user")
+	args.groupBy = flag.String(
+		"group-by",
+		"",
+		"Print matches in groups with their counts once the search is done, by channel, user or day",
+	)
+	args.alertRateRaw = flag.String(
+		"alert-rate",
+		"",
+		"Report bursts of matches faster than this rate in a channel, e.g. '10 in 30s'",
+	)
+	args.alertOnly = flag.Bool("alert-only", false, "Only print matches which are part of an -alert-rate burst")
+	args.maxMemoryRaw = flag.String(
+		"max-memory",
+		"",
+		"Move held matches (-group-by-login, -alert-only, Chatterino log files) to disk above this size, e.g. 512MB",
+	)
+	args.memoryCacheRaw = flag.String(
+		"memory-cache",
+		"",
+		"Keep downloaded log files in memory up to this size, so they're downloaded once per run, e.g. 256MB",
+	)
+	args.cacheDir = flag.String(
+		"cache-dir",
+		"",
+		"Read log files kept by `justgrep warm` from this directory and keep log files which can be revalidated, "+
+			EnvCacheDir+" is used if it's not given",
+	)
+	args.limitRateRaw = flag.String("limit-rate", "", "Download at most this much per second in justgrep warm, e.g. 2MB")
+	args.offPeakRaw = flag.String(
+		"off-peak",
+		"",
+		"Only start downloads in justgrep warm between these local times, e.g. 01:00-07:00",
+	)
+	args.top = flag.String("top", "", "Print the most common users, words or channels of matches instead of them")
+	args.topN = flag.Int("top-n", 10, "How many values -top or -report emotes, or matches -rank prints")
+	args.tokenizerName = flag.String(
+		"tokenizer",
+		"whitespace",
+		"How -top words splits messages: whitespace, words, emote-aware or no-emotes",
+	)
+	args.stopwords = flag.String(
+		"stopwords",
+		"",
+		"Leave these words out of -top words: english or a file with one word per line",
+	)
+	args.rank = flag.Bool("rank", false, "Print the most relevant matches, highest score first, instead of all of them")
+	args.aroundWindow = flag.Duration(
+		"around",
+		0,
+		"Also print every message of the channel sent this close to a match, e.g. 30s",
+	)
+	args.squash = flag.Bool(
+		"squash",
+		false,
+		"Print identical consecutive matches of a channel once, annotated with how many times and users sent them",
+	)
+	args.squashWindow = flag.Duration(
+		"squash-window",
+		0,
+		"With -squash, also squash identical matches sent this close to each other with others in between, e.g. 30s",
+	)
+	args.focusTimeRaw = flag.String("focus-time", "", "Rank matches sent close to this time higher, needs -rank")
+	args.approx = flag.Bool("approx", false, "Count -top values and distinct users approximately, in constant memory")
+	args.report = flag.String(
+		"report",
+		"",
+		"Print a report instead of matches: co-occurrence, emotes, gaps, moderation or sessions",
+	)
+	args.gap = flag.Duration(
+		"gap",
+		time.Hour,
+		"Shortest period without matches reported by -report gaps, or separating -report sessions",
+	)
+	args.withUser = flag.String("with-user", "", "Second user for -report co-occurrence")
+	args.window = flag.Duration(
+		"window",
+		10*time.Minute,
+		"Messages closer than this count as sent at the same time for -report co-occurrence, or as sent just "+
+			"before a timeout for -report moderation",
+	)
+	args.currentNames = flag.Bool(
+		"current-names",
+		false,
+		"Annotate matches with the current display name of the sender, needs Twitch credentials",
+	)
+	args.annotateSource = flag.Bool(
+		"annotate-source",
+		false,
+		"Annotate matches with the instance URL, endpoint, log file date and line number they were found at",
+	)
+	args.notUser = flag.String("notuser", "", "Negative match on username, or a list separated with commas")
+	args.userIsRegex = flag.Bool("uregex", false, "Is the -user option a regex? See -user-regex to combine both")
 
 	args.msgOnly = flag.Bool(
 		"msg-only",
@@ -159,15 +970,248 @@ func main() {
 
 	args.channel = flag.String("channel", "", "Target channel")
 	args.messageRegex = flag.String("regex", "", "Message Regex")
+	args.regexFile = flag.String(
+		"regex-file",
+		"",
+		"Match messages matching any of the patterns in this file, one per line. Matches get the line as annotation",
+	)
+	flag.Var(
+		&args.presets,
+		"preset",
+		"Search with a named pattern instead of -regex, NAME or NAME@FILE for word lists, list for all of them. "+
+			"Can be repeated to match any of them",
+	)
+	flag.Var(
+		&args.presetFiles,
+		"preset-file",
+		"Read more presets from this file, lines of a name and a regex. Can be repeated",
+	)
+	args.strict = flag.Bool("strict", false, "Refuse to search if -regex has warnings, like a needless .* at the start")
+	args.systemMsgRegex = flag.String(
+		"system-msg-regex",
+		"",
+		"Only match USERNOTICEs (subs, gift subs, raids) whose system message matches this regex",
+	)
+	args.hasLink = flag.Bool("has-link", false, "Only match messages with a link, also written like 'example dot com'")
+	args.linkDomain = flag.String("link-domain", "", "Only match messages with a link whose domain matches this regex")
 	args.start = flag.String("start", "", "Start time")
 	args.end = flag.String("end", "", "End time")
-	args.url = flag.String("url", "", "Justlog instance URL")
+	flag.Var(&args.urls, "url", "Justlog instance URL, can be repeated or a list separated with commas or spaces")
+	flag.Var(
+		&args.incidents,
+		"incident",
+		"Annotate matches sent during this named time range, e.g. 'before@2023-01-01..2023-02-01', can be repeated",
+	)
+	flag.Var(&args.preferURLs, "prefer-url", "Use this justlog instance if it has the channel, can be repeated")
+	args.dryRun = flag.Bool("dry-run", false, "Print which instance every channel would be searched on and exit")
+	args.rankInstances = flag.String(
+		"rank-instances",
+		rankOrder,
+		"How to pick between instances which have the channel: order (as configured) or latency (fastest first)",
+	)
 	args.maxResults = flag.Int("max", 0, "How many results do you want? 0 for unlimited")
+	args.maxPerUser = flag.Int("max-per-user", 0, "How many results of a single user do you want? 0 for unlimited")
+	args.distinctUsers = flag.Bool("distinct-users", false, "Only print the first match of every user")
+	args.justUsers = flag.Bool("just-users", false, "Only print the names of users with matches, implies -distinct-users")
 
 	args.verbose = flag.Bool("v", false, "Show human-readable progress information")
 	args.progressJson = flag.Bool("progress-json", false, "Send JSON progress updates to stderr, not allowed with -v.")
 	args.recursive = flag.Bool("r", false, "Run search on all channels.")
 
+	args.apiFormatRaw = flag.String("api", "raw", "Which justlog API to use: raw or json")
+
+	args.refine = flag.String(
+		"refine",
+		"",
+		"Search the results of the previous run with this regex instead of downloading logs again",
+	)
+
+	args.literal = flag.String("F", "", "Only match messages containing this literal string, much cheaper than -regex")
+	args.twoPhase = flag.Bool(
+		"two-phase",
+		false,
+		"Find log files containing the -F literal first, then search only those with all filters",
+	)
+
+	args.fixedSteps = flag.Bool(
+		"fixed-steps",
+		false,
+		"Don't ask the instance which log files are available, step back one day or month at a time instead",
+	)
+	args.anyPerChannel = flag.Bool(
+		"any-per-channel",
+		false,
+		"Stop searching a channel at its first match and only print the names of channels with matches",
+	)
+	args.orderChannels = flag.String(
+		"order-channels",
+		"",
+		"Order channels are searched in: smallest-first (by available log files, the default with -r), "+
+			"largest-first, alpha or asis",
+	)
+	args.shards = flag.Int("shards", 1, "Split the time range into this many parts searched at the same time")
+	args.jobs = flag.Int(
+		"jobs",
+		8,
+		"Most requests made to an instance at the same time, fewer are made while it's slow or rate limits",
+	)
+	args.perfPreset = flag.String(
+		"perf-preset",
+		"",
+		"Tune -shards, -memory-cache, -max-memory and the garbage collector for throughput or low-memory",
+	)
+	args.gomaxprocs = flag.Int("gomaxprocs", 0, "How many CPUs justgrep uses at the same time, 0 for all of them")
+
+	args.flushEvery = flag.String(
+		"flush-every",
+		"",
+		"Write buffered matches out after this many lines or this long, e.g. 100 or 5s. "+
+			"By default every line on a terminal and every second otherwise",
+	)
+	args.debugHTTPPath = flag.String(
+		"debug-http",
+		"",
+		"Record every HTTP request into this file, as JSON lines or as a HAR file if it ends with .har",
+	)
+	args.sessionPath = flag.String(
+		"session",
+		"",
+		"Keep the cookies instances set in this file between runs, e.g. for instances behind Cloudflare",
+	)
+	args.userAgent = flag.String("user-agent", justgrep.UserAgent, "User-Agent header sent with every request")
+	args.caCert = flag.String("ca-cert", "", "PEM file with certificates to trust in addition to the system ones")
+	args.clientCert = flag.String("client-cert", "", "PEM file with the client certificate for instances asking for one")
+	args.clientKey = flag.String("client-key", "", "PEM file with the key of -client-cert")
+	args.insecureSkipVerify = flag.Bool(
+		"insecure-skip-verify",
+		false,
+		"Accept any certificate from instances. Anyone in between can read and change the logs",
+	)
+	flag.Var(
+		&args.resolve,
+		"resolve",
+		"Connect to this address for host and port instead of looking it up, as host:port:address. Can be repeated",
+	)
+	args.ipVersion = flag.Int("ip-version", 0, "Only connect to instances over IPv4 with 4 or IPv6 with 6")
+	args.debugFilterPath = flag.String(
+		"debug-filter",
+		"",
+		"Write every message that didn't match and why into this file as JSON lines, - for stderr",
+	)
+	args.pprofAddr = flag.String("pprof-addr", "", "Serve runtime profiles over HTTP at this address, e.g. localhost:6060")
+	args.cpuProfile = flag.String("cpuprofile", "", "Write a CPU profile of the search into this file")
+	args.memProfile = flag.String("memprofile", "", "Write a memory profile into this file once the search is done")
+
+	args.format = flag.String(
+		"format",
+		formatRaw,
+		"Output format: raw IRC lines, json, jsonl-events (matches and progress on stdout), modlog-json "+
+			"(moderation events), links (links in matches and their counts), html (a report with a table and a "+
+			"chart), markdown (a table or quotes, see -markdown-style), chatterino or template (see -template)",
+	)
+	args.markdownStyle = flag.String(
+		"markdown-style",
+		markdownTable,
+		"With -format markdown, print matches as a table or as quote blocks",
+	)
+	args.markdownMaxSize = flag.Int(
+		"markdown-max-size",
+		0,
+		"With -format markdown, stop printing matches before this many characters and say how many were left out, "+
+			"e.g. 2000 for a Discord message",
+	)
+	args.templateText = flag.String(
+		"template",
+		"",
+		"Print every match with this Go template, like '{{.Timestamp | timeformat \"datetime\"}} {{.User}}: {{.Text}}'",
+	)
+	args.templateFile = flag.String("template-file", "", "Print every match with the Go template in this file")
+	args.outputPath = flag.String(
+		"o",
+		"",
+		"Write results into this file instead of stdout, for -format chatterino this is a directory",
+	)
+	args.sinceLast = flag.Bool(
+		"since-last",
+		false,
+		"Append to the file of -o instead of replacing it, searching only after the newest message it has",
+	)
+	args.upload = flag.String(
+		"upload",
+		"",
+		"Upload results over -upload-over to haste, haste=URL, gist or an http(s) URL and print the link instead",
+	)
+	args.uploadOver = flag.String("upload-over", "", "With -upload, only upload results over this size, 64KB by default")
+	args.uploadToken = flag.String(
+		"upload-token",
+		"",
+		"Token for -upload, sent as a bearer token, "+EnvUploadToken+" is used if it's not given",
+	)
+	flag.Var(
+		&args.encryptTo,
+		"encrypt-to",
+		"Encrypt results to this age recipient (age1... or ssh-ed25519 ...) with the age command, can be repeated",
+	)
+	args.summaryFilePath = flag.String(
+		"summary-file",
+		"",
+		"Write a JSON report of the search into this file once it's done: query, per-channel counts, timing, errors "+
+			"and top users",
+	)
+	args.auditLogRaw = flag.String(
+		"audit-log",
+		"",
+		"Append who searched what and how many results they got to this hash-chained log, check it with "+
+			"`justgrep audit FILE`",
+	)
+	args.schemaRaw = flag.String(
+		"schema",
+		"latest",
+		"Version of the JSON message schema for -format json, e.g. v1",
+	)
+
+	args.stdinFormat = flag.String(
+		"stdin-format",
+		"",
+		"Search messages read from stdin instead of downloading logs: irc (raw lines), ndjson (see -map) or packed "+
+			"(see justgrep pack)",
+	)
+	args.onError = flag.String(
+		"on-error",
+		onErrorSkipDay,
+		"What to do when a log file fails to download: skip-day, skip-channel or abort the search",
+	)
+	args.onParseErrorRaw = flag.String(
+		"on-parse-error",
+		parseErrorSkipFile,
+		"What to do with lines that can't be parsed: skip-file (the rest of the log file), skip them, "+
+			"print them raw or abort the search",
+	)
+	args.invalidUTF8 = flag.String(
+		"invalid-utf8",
+		"keep",
+		"What to do with lines that aren't valid UTF-8: keep them, repair them or reject them as unparsable",
+	)
+	args.mapRaw = flag.String(
+		"map",
+		"",
+		"Where to find message fields in -stdin-format ndjson, e.g. 'ts=timestamp,user=login,text=message'",
+	)
+
+	args.vodIDRaw = flag.String("vod-id", "", "Link every match to the moment in this Twitch VOD")
+	args.vodURL = flag.String("vod-url", "", "Same as -vod-id, but takes a link to the VOD")
+	args.vodStart = flag.String(
+		"vod-start",
+		"",
+		"When the VOD started, by default it's looked up using Twitch credentials from the environment",
+	)
+
+	args.runDir = flag.String(
+		"run-dir",
+		"",
+		"Save results and a manifest describing the search into this directory, replay with `justgrep rerun DIR`",
+	)
+
 	args.noEnv = flag.Bool("no-env", false, "Disables reading environment variables like JUSTGREP_DEFAULT_INSTANCES")
 	flag.Usage = func() {
 		fmt.Fprintf(
@@ -177,161 +1221,327 @@ func main() {
 		)
 		fmt.Fprintf(flag.CommandLine.Output(), "Basic usage:\n")
 		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "Replay a search saved with -run-dir: justgrep rerun DIR [options]\n")
+		fmt.Fprintf(
+			flag.CommandLine.Output(),
+			"Pack a search saved with -run-dir into a zip file to share: justgrep bundle DIR [-redact] [-o FILE]\n",
+		)
+		fmt.Fprintf(flag.CommandLine.Output(), "Compare the results of two runs: justgrep diff DIR_A DIR_B\n")
+		fmt.Fprintf(
+			flag.CommandLine.Output(),
+			"Download logs into -cache-dir for later searches: justgrep warm -channel CHANNEL -start TIME [options]\n",
+		)
+		fmt.Fprintf(flag.CommandLine.Output(), "Measure how fast messages are filtered: justgrep bench [FILE] [options]\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Pack raw IRC lines for -stdin-format packed: justgrep pack [FILE]\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Check the chain of an -audit-log: justgrep audit FILE\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Serve searches as MCP tools over stdio: justgrep mcp [-url URL]\n")
+		fmt.Fprintf(
+			flag.CommandLine.Output(),
+			"Answer the /grep Discord command: justgrep discord-bot -token TOKEN -public-key KEY [-listen ADDR]\n",
+		)
+		fmt.Fprintf(
+			flag.CommandLine.Output(),
+			"Answer !grep in Twitch chat: justgrep twitch-bot -login NAME -token TOKEN -join CHANNELS [options]\n",
+		)
 		fmt.Fprintf(flag.CommandLine.Output(), "Check man page for examples and longer explanations\n")
 	}
-	flag.Parse()
-	flagsAreValid := args.validateAndProcessFlags()
-	if !flagsAreValid {
-		os.Exit(1)
+	cliArgs := os.Args[1:]
+	if len(cliArgs) >= 1 && cliArgs[0] == "diff" {
+		if len(cliArgs) != 3 {
+			_, _ = fmt.Fprintln(os.Stderr, "Usage: justgrep diff DIR_A DIR_B")
+			os.Exit(2)
+		}
+		os.Exit(diffRuns(cliArgs[1], cliArgs[2]))
 	}
-
-	var defaultInstancesEnv string
-	defaultInstances := []string{*args.url}
-	instanceListSource := "-url"
-
-	if *args.url == "" && !*args.noEnv {
-		defaultInstancesEnv = os.Getenv(EnvDefaultInstances)
-		defaultInstances = strings.Split(defaultInstancesEnv, " ")
-		instanceListSource = EnvDefaultInstances
+	if len(cliArgs) >= 1 && cliArgs[0] == "audit" {
+		os.Exit(runAudit(cliArgs[1:]))
 	}
-
-	if len(defaultInstances) == 1 && defaultInstances[0] == "" {
-		defaultInstances = []string{"http://localhost:8025"}
-		if *args.verbose {
-			fmt.Fprintf(
+	if len(cliArgs) >= 1 && cliArgs[0] == "mcp" {
+		os.Exit(runMcp(cliArgs[1:]))
+	}
+	if len(cliArgs) >= 1 && cliArgs[0] == "discord-bot" {
+		os.Exit(runDiscordBot(cliArgs[1:]))
+	}
+	if len(cliArgs) >= 1 && cliArgs[0] == "twitch-bot" {
+		os.Exit(runTwitchBot(cliArgs[1:]))
+	}
+	if len(cliArgs) >= 1 && cliArgs[0] == "bundle" {
+		os.Exit(runBundle(cliArgs[1:]))
+	}
+	if len(cliArgs) >= 1 && cliArgs[0] == "pack" {
+		os.Exit(runPack(cliArgs[1:]))
+	}
+	if len(cliArgs) >= 1 && cliArgs[0] == "rerun" {
+		if len(cliArgs) < 2 {
+			_, _ = fmt.Fprintln(os.Stderr, "Usage: justgrep rerun DIR [options]")
+			os.Exit(1)
+		}
+		manifest, err := loadRunManifest(cliArgs[1])
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to load run manifest: %s\n", err)
+			os.Exit(1)
+		}
+		if manifest.Version > runManifestVersion {
+			_, _ = fmt.Fprintf(
 				os.Stderr,
-				"Assuming you wanted to use %s as the justlog instance. Use -url or set the %q env variable.\n",
-				defaultInstances[0],
-				EnvDefaultInstances,
+				"Run manifest version %d is newer than supported version %d, update justgrep.\n",
+				manifest.Version,
+				runManifestVersion,
 			)
+			os.Exit(1)
 		}
+		// options given after the directory override the ones from the manifest
+		cliArgs = append(manifest.Args, cliArgs[2:]...)
 	}
-
-	if *args.recursive && len(defaultInstances) > 1 {
-		instancesSafe := []string{}
-		for _, instance := range defaultInstances {
-			itext := ""
-			u, err := url.Parse(instance)
-			if err != nil {
-				itext = "[failed to url parse, hiding to not show any secrets]"
-			}
-			itext = u.Redacted()
-			instancesSafe = append(instancesSafe, itext)
+	if len(cliArgs) >= 1 && cliArgs[0] == "warm" {
+		args.warm = true
+		cliArgs = cliArgs[1:]
+	}
+	if len(cliArgs) >= 1 && cliArgs[0] == "bench" {
+		args.bench = true
+		cliArgs = cliArgs[1:]
+		if len(cliArgs) >= 1 && !strings.HasPrefix(cliArgs[0], "-") {
+			args.benchCorpus = cliArgs[0]
+			cliArgs = cliArgs[1:]
 		}
-		fmt.Fprintf(os.Stderr, "Please provide a single -url for a search of every channel (-r).\n")
-		fmt.Fprintf(
-			os.Stderr,
-			"Used instance list from %s:\n"+
-				"- %s\n",
-			instanceListSource,
-			strings.Join(instancesSafe, "\n- "),
-		)
+	}
+	_ = flag.CommandLine.Parse(cliArgs)
+	transport, err := justgrep.NewTransport(args.transportOptions())
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to set up connections to instances: %s\n", err)
 		os.Exit(1)
 	}
-
-	justlogUrl := ""
-
-	if *args.recursive {
-		justlogUrl = defaultInstances[0]
-	} else {
-	instanceLoop:
-		for _, instance := range defaultInstances {
-			chns, err := justgrep.GetChannelsFromJustLog(context.Background(), &httpClient, instance)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Fetching channels from %q failed: %s\n", instance, err.Error())
-				continue instanceLoop
-			}
-			for _, chn := range chns {
-				if *args.channel == chn {
-					justlogUrl = instance
-					break instanceLoop
-				}
+	httpClient.Transport = transport
+	instanceStats := justgrep.NewInstanceStatsRecorder()
+	httpClient.Transport = instanceStats.RoundTripper(httpClient.Transport)
+	flagsAreValid := args.validateAndProcessFlags()
+	if !flagsAreValid {
+		os.Exit(1)
+	}
+	limiter := justgrep.NewConcurrencyLimiter(*args.jobs)
+	httpClient.Transport = limiter.RoundTripper(httpClient.Transport)
+	profiles, err := startProfiling(args)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to start profiling: %s\n", err)
+		os.Exit(1)
+	}
+	args.profiling = profiles
+	if args.bench {
+		code := runBench(args)
+		args.profiling.finish()
+		os.Exit(code)
+	}
+	if *args.verbose {
+		args.display = newProgressDisplay()
+		limiter.OnChange = func(instance string, limit int, overloaded bool) {
+			if overloaded {
+				args.display.printf("%s is overloaded, limiting requests to %d at a time\n", instance, limit)
 			}
 		}
-		if justlogUrl == "" {
-			fmt.Fprintf(os.Stderr, "No justlog instance has the channel %q\n", *args.channel)
+	}
+	if *args.debugHTTPPath != "" {
+		debug, err := newDebugHTTP(*args.debugHTTPPath, &httpClient)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to open -debug-http file: %s\n", err)
 			os.Exit(1)
 		}
-		if *args.verbose {
-			fmt.Fprintf(os.Stderr, "Picked justlog: %s\n", justlogUrl)
+		args.debugHTTP = debug
+	}
+	session, err := newSession(*args.sessionPath, &httpClient)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to read -session file: %s\n", err)
+		os.Exit(1)
+	}
+	args.session = session
+	if *args.debugFilterPath != "" {
+		debug, err := newDebugFilter(*args.debugFilterPath)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to open -debug-filter file: %s\n", err)
+			os.Exit(1)
 		}
+		args.debugFilter = debug
+	}
+
+	if args.memoryCache != nil {
+		// outermost, requests answered from memory aren't made to instances
+		httpClient.Transport = args.memoryCache.RoundTripper(httpClient.Transport)
+	}
+	if args.diskCache != nil {
+		httpClient.Transport = args.diskCache.RoundTripper(httpClient.Transport)
+	}
+	if *args.userAgent != justgrep.UserAgent {
+		// outside of everything else, so -debug-http shows the User-Agent that was sent
+		httpClient.Transport = justgrep.UserAgentRoundTripper(httpClient.Transport, *args.userAgent)
 	}
 
-	messageExpr, err := regexp.Compile(*args.messageRegex)
+	vod, err := resolveVOD(args)
 	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Error while compiling your message regex: %s\n", err)
-		return
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to find the start of the VOD: %s\n", err)
+		os.Exit(1)
+	}
+	args.vod = vod
+	helix := newHelixClient(args)
+	if *args.currentNames {
+		if helix == nil {
+			_, _ = fmt.Fprintf(
+				os.Stderr,
+				"-current-names needs Twitch credentials, set %s and either %s or %s.\n",
+				EnvTwitchClientID,
+				EnvTwitchClientSecret,
+				EnvTwitchToken,
+			)
+			os.Exit(1)
+		}
+		args.names = newCurrentNames(helix)
 	}
 
-	var userRegex *regexp.Regexp
-	var negativeRegex *regexp.Regexp
-	matchMode := justgrep.DontMatch
-	if *args.user != "" || *args.notUser != "" {
-		matchMode = justgrep.MatchExact
+	runDir, err := defaultRunDir()
+	if err != nil && *args.verbose {
+		_, _ = fmt.Fprintf(os.Stderr, "Not saving results for -refine: %s\n", err)
+	}
+	progress := &justgrep.ProgressState{
+		TotalResults: justgrep.NewResultCounts(),
+		BeginTime:    time.Now(),
+		Instances:    instanceStats,
+	}
+	if *args.nameChanges {
+		progress.NameChanges = justgrep.NewNameTracker()
 	}
 
-	if *args.userIsRegex {
-		matchMode = justgrep.MatchRegex
-		userRegex, err = regexp.Compile(*args.user)
-		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "Error while compiling your username regex: %s\n", err)
+	if *args.refine != "" {
+		filter, ok := buildFilter(args, *args.refine)
+		if !ok {
 			return
 		}
-		negativeRegex, err = regexp.Compile(*args.notUser)
+		if runDir == "" {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to find previous results: %s\n", err)
+			os.Exit(1)
+		}
+		args.startAudit(args.channels, progress)
+		output := newMatchOutput(args, progress, runDir)
+		err = refineResults(args, runDir, filter, output, progress)
 		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "Error while compiling your negative username regex: %s\n", err)
-			return
+			output.abort()
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to refine previous results: %s\n", err)
+			os.Exit(1)
 		}
+		output.finish()
+		args.finishDebug()
+		printSummary(args, progress)
+		return
 	}
-	args.messageTypes = strings.Split(*args.messageTypesRaw, ",")
-	filter := justgrep.Filter{
-		StartDate: args.startTime,
-		EndDate:   args.endTime,
 
-		HasMessageType: len(*args.messageTypesRaw) != 0,
-		MessageTypes:   args.messageTypes,
-
-		HasMessageRegex: true,
-		MessageRegex:    messageExpr,
-
-		UserMatchType: matchMode,
+	if *args.stdinFormat != "" {
+		filter, ok := buildFilter(args, *args.messageRegex)
+		if !ok {
+			return
+		}
+		decode := justgrep.NewMessage
+		if *args.stdinFormat == "ndjson" {
+			decode = args.fieldMapping.Decode
+		}
+		args.startAudit(args.channels, progress)
+		output := newMatchOutput(args, progress, runDir)
+		source := &justgrep.MessageSource{Endpoint: "stdin"}
+		if *args.stdinFormat == "packed" {
+			err = filterPacked(os.Stdin, source, args.fetchOptions, filter, output, progress)
+		} else {
+			err = filterLines(os.Stdin, source, args.fetchOptions, decode, filter, output, progress)
+			err = skipRestOfFile(args, "stdin", err)
+		}
+		if err != nil {
+			// keep what was found so far, it can be refined
+			output.finish()
+			args.finishDebug()
+			_, _ = fmt.Fprintf(os.Stderr, "Error while reading stdin: %s\n", err)
+			os.Exit(1)
+		}
+		output.finish()
+		args.finishDebug()
+		printSummary(args, progress)
+		return
+	}
 
-		UserName:         strings.ToLower(*args.user),
-		NegativeUserName: strings.ToLower(*args.notUser),
+	instances, ok := configuredInstances(args)
+	if !ok {
+		args.finishDebug()
+		os.Exit(1)
+	}
+	defaultInstances := instanceURLs(instances)
 
-		NegativeUserRegex: negativeRegex,
-		UserRegex:         userRegex,
+	if *args.recursive && len(defaultInstances) > 1 {
+		fmt.Fprintf(os.Stderr, "Please provide a single -url for a search of every channel (-r).\n")
+		fmt.Fprintf(os.Stderr, "Used instance list:\n")
+		for _, instance := range instances {
+			fmt.Fprintf(os.Stderr, "- %s (from %s)\n", redactURL(instance.url), instance.source)
+		}
+		args.finishDebug()
+		os.Exit(1)
+	}
 
-		Count: *args.maxResults,
+	filter, ok := buildFilter(args, *args.messageRegex)
+	if !ok {
+		return
 	}
 	var channelsToSearch []string
+	routes := make(map[string]string)
 	if !*args.recursive {
-		channelsToSearch = strings.Split(*args.channel, ",")
+		channelsToSearch = args.channels
+		var missing []string
+		routes, missing = routeChannels(args, instances, args.channels)
+		if len(missing) != 0 {
+			fmt.Fprintf(os.Stderr, "No justlog instance has the channels %q\n", strings.Join(missing, ","))
+			args.finishDebug()
+			os.Exit(1)
+		}
+		if *args.verbose {
+			for _, instance := range routedInstances(routes, channelsToSearch) {
+				fmt.Fprintf(os.Stderr, "Picked justlog: %s\n", redactURL(instance))
+			}
+		}
 	} else {
-		channelsToSearch, err = justgrep.GetChannelsFromJustLog(context.Background(), &httpClient, justlogUrl)
+		channelsToSearch, err = justgrep.GetChannelsFromJustLog(context.Background(), &httpClient, defaultInstances[0])
 		if err != nil {
 			_, err := fmt.Fprintf(os.Stderr, "Error while fetching channels from justlog: %s", err)
 			if err != nil {
 				return
 			}
+			args.finishDebug()
 			os.Exit(1)
 		}
+		for _, channel := range channelsToSearch {
+			routes[channel] = defaultInstances[0]
+		}
 	}
+	if *args.dryRun {
+		printRoutes(args, routes, channelsToSearch)
+		args.finishDebug()
+		return
+	}
+	resolveUser(args, helix)
 	// fix name changes and USERNOTICEs not showing up when using per-user log endpoint
-	if *args.user != "" && !(*args.userIsRegex) {
-		filter.UserMatchType = justgrep.DontMatch
+	if args.usesUserLogs() {
+		filter.Users = justgrep.UserMatcher{}
+		filter.UserID = ""
 	}
-
-	progress := &justgrep.ProgressState{
-		TotalResults: make([]int, justgrep.ResultCount),
-		BeginTime:    time.Now(),
+	if args.warm {
+		code := runWarm(args, channelsToSearch, routes)
+		args.finishDebug()
+		os.Exit(code)
 	}
+
+	channelsToSearch, listedAPIs := orderChannels(args, channelsToSearch, routes)
+	args.startAudit(channelsToSearch, progress)
+	output := newMatchOutput(args, progress, runDir, *args.runDir)
+	var earliestStart time.Time
+	aborted := false
+channelLoop:
 	for currentIndex, channel := range channelsToSearch {
 		if *args.verbose {
-			_, _ = fmt.Fprintf(os.Stderr, "Now scanning #%s %d/%d\n", channel, currentIndex+1, len(channelsToSearch))
+			args.display.printf("Now scanning #%s %d/%d\n", channel, currentIndex+1, len(channelsToSearch))
 		}
 		if *args.progressJson {
-			_ = json.NewEncoder(os.Stderr).Encode(
+			args.emitEvent(
 				progressUpdate{
 					Type:              progressNextChannel,
 					Found:             progress.TotalResults[justgrep.ResultOk],
@@ -342,24 +1552,357 @@ func main() {
 				},
 			)
 		}
-		var api justgrep.JustlogAPI
-		if *args.user != "" && !(*args.userIsRegex) {
-			api = &justgrep.UserJustlogAPI{User: *args.user, Channel: channel, URL: justlogUrl}
-		} else {
-			api = &justgrep.ChannelJustlogAPI{Channel: channel, URL: justlogUrl}
+		if parseErrorAbort(args, progress) {
+			break
+		}
+		before := snapshotProgress(progress)
+		channelArgs, channelFilter := args.forChannel(channel, filter)
+		if *args.anyPerChannel {
+			// stop once this channel has one match
+			channelFilter.Count = progress.TotalResults[justgrep.ResultOk] + 1
+		}
+		apis, listed := listedAPIs[channel]
+		if !listed {
+			apis = channelAPIs(args, channel, routes[channel])
+		}
+		earliest, hasEarliest := earliestLogFile(apis)
+		if args.startEarliest && !hasEarliest {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to find the earliest logs of #%s, skipping it\n", channel)
+			reportChannelFinished(args, channel, currentIndex, len(channelsToSearch), channelSkipped, before, progress)
+			continue
+		}
+		// with -since-last, channels already in the output file have a start
+		startEarliest := args.startEarliest && channelArgs.startTime.IsZero()
+		if hasEarliest && (startEarliest || channelArgs.startTime.Before(earliest)) {
+			if startEarliest {
+				if *args.verbose {
+					args.display.printf(
+						"Earliest logs of #%s are from %s\n",
+						channel,
+						earliest.Format("2006-01-02"),
+					)
+				}
+			} else {
+				reportStartClamped(args, channel, earliest, progress)
+			}
+			clampedArgs := &arguments{}
+			*clampedArgs = *channelArgs
+			channelArgs = clampedArgs
+			channelArgs.startTime = earliest
+			channelFilter.StartDate = earliest
+			if earliestStart.IsZero() || earliest.Before(earliestStart) {
+				earliestStart = earliest
+			}
+		}
+		for _, api := range apis {
+			failed := false
+			if *args.twoPhase {
+				candidates, err := findCandidateDates(channelArgs, api, progress)
+				if err != nil {
+					_, _ = fmt.Fprintf(os.Stderr, "Error while scanning logs: %s\n", err)
+				}
+				if len(candidates) == 0 {
+					continue
+				}
+				failed = searchLogs(
+					channelArgs,
+					&candidateDatesAPI{JustlogAPI: api, dates: candidates},
+					candidates[0],
+					channelFilter,
+					progress,
+					output,
+				)
+			} else if *args.shards > 1 {
+				failed = searchSharded(channelArgs, api, channelFilter, progress, output)
+			} else {
+				failed = searchLogs(
+					channelArgs,
+					api,
+					firstLogFile(api, channelArgs.endTime),
+					channelFilter,
+					progress,
+					output,
+				)
+			}
+			if failed && *args.onError == onErrorAbort {
+				aborted = true
+				reportChannelFinished(args, channel, currentIndex, len(channelsToSearch), channelAborted, before, progress)
+				break channelLoop
+			}
+			if failed {
+				progress.SkippedChannels++
+				reportChannelFinished(args, channel, currentIndex, len(channelsToSearch), channelSkipped, before, progress)
+				continue channelLoop
+			}
+		}
+		reportChannelFinished(args, channel, currentIndex, len(channelsToSearch), channelDone, before, progress)
+	}
+	output.finish()
+	if args.startEarliest {
+		// the oldest searched log file, for the manifest
+		args.startTime = earliestStart
+	}
+	if *args.runDir != "" {
+		manifest := newRunManifest(args, defaultInstances, routes, channelsToSearch, progress)
+		err = manifest.save(*args.runDir)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to save run manifest: %s\n", err)
+		}
+	}
+	args.finishDebug()
+	printSummary(args, progress)
+	if aborted || parseErrorAbort(args, progress) {
+		os.Exit(1)
+	}
+}
+
+// emitEvent writes a -progress-json event.
+func (args *arguments) emitEvent(event interface{}) {
+	if args.events == nil {
+		_ = json.NewEncoder(os.Stderr).Encode(event)
+		return
+	}
+	_ = json.NewEncoder(args.events).Encode(event)
+}
+
+// finishDebug writes and closes the -debug-http and -debug-filter files and the profiles.
+func (args *arguments) finishDebug() {
+	args.debugHTTP.finish()
+	args.debugFilter.finish()
+	args.profiling.finish()
+	args.audit.finish()
+	args.session.finish()
+}
+
+// reportFetchError shows that downloading the log file of channel for date failed.
+func reportFetchError(args *arguments, channel string, date time.Time, err error, progress *justgrep.ProgressState) {
+	progress.FetchErrors++
+	args.summaryFile.fetchError(channel, date, err)
+	if *args.progressJson {
+		args.emitEvent(
+			errorReport{
+				Type:     errorWhileFetching,
+				Error:    err.Error(),
+				Channel:  channel,
+				Date:     date.Format("2006-01-02"),
+				Progress: *progress,
+			},
+		)
+		return
+	}
+	action := "skipping them"
+	switch *args.onError {
+	case onErrorSkipChannel:
+		action = "skipping the rest of the channel"
+	case onErrorAbort:
+		action = "stopping the search"
+	}
+	args.display.printf(
+		"Error while fetching logs of #%s for %s, %s: %s\n",
+		channel,
+		date.Format("2006-01-02"),
+		action,
+		err,
+	)
+}
+
+// parseErrorAbort reports whether the search has to stop because of a line that couldn't be parsed.
+func parseErrorAbort(args *arguments, progress *justgrep.ProgressState) bool {
+	return args.parseErrorStopsSearch && progress.InvalidLines != 0
+}
+
+// channelAPIs returns the APIs to download logs of a channel with. These are either the logs of the whole channel or
+// of the searched users.
+func channelAPIs(args *arguments, channel string, justlogUrl string) []justgrep.JustlogAPI {
+	var apis []justgrep.JustlogAPI
+	if args.userID != "" {
+		apis = append(
+			apis,
+			&justgrep.UserJustlogAPI{
+				User:    args.userID,
+				IsId:    true,
+				Channel: channel,
+				URL:     justlogUrl,
+				Format:  args.apiFormat,
+			},
+		)
+	} else if args.usesUserLogs() {
+		apis = append(
+			apis,
+			&justgrep.UserJustlogAPI{
+				User:    args.singleLogin(),
+				Channel: channel,
+				URL:     justlogUrl,
+				Format:  args.apiFormat,
+			},
+		)
+	} else {
+		apis = append(apis, &justgrep.ChannelJustlogAPI{Channel: channel, URL: justlogUrl, Format: args.apiFormat})
+	}
+	if *args.withUser != "" {
+		apis = append(
+			apis,
+			&justgrep.UserJustlogAPI{
+				User:    *args.withUser,
+				Channel: channel,
+				URL:     justlogUrl,
+				Format:  args.apiFormat,
+			},
+		)
+	}
+	if *args.fixedSteps {
+		return apis
+	}
+	for i, api := range apis {
+		available, err := justgrep.NewAvailableLogsAPI(context.Background(), &httpClient, api)
+		if err != nil {
+			if *args.verbose {
+				_, _ = fmt.Fprintf(
+					os.Stderr,
+					"Unable to list available logs of #%s, stepping back by a fixed offset: %s\n",
+					channel,
+					err,
+				)
+			}
+			continue
+		}
+		apis[i] = available
+	}
+	return apis
+}
+
+// reportStartClamped warns that -start is older than the logs of channel, so the search of it starts at earliest.
+func reportStartClamped(args *arguments, channel string, earliest time.Time, progress *justgrep.ProgressState) {
+	if *args.progressJson {
+		args.emitEvent(
+			startClampedReport{
+				Type:           progressStartClamped,
+				Channel:        channel,
+				RequestedStart: args.startTime,
+				Start:          earliest,
+				Progress:       *progress,
+			},
+		)
+		return
+	}
+	args.display.printf(
+		"Warning: the oldest logs of #%s are from %s, later than -start, searching from there.\n",
+		channel,
+		earliest.Format("2006-01-02"),
+	)
+}
+
+// snapshotProgress copies the counts of progress, so the ones of a single channel can be reported once it's done.
+func snapshotProgress(progress *justgrep.ProgressState) justgrep.ProgressState {
+	snapshot := *progress
+	snapshot.TotalResults = justgrep.NewResultCounts()
+	snapshot.TotalResults.Add(progress.TotalResults)
+	return snapshot
+}
+
+// reportChannelFinished shows what searching channel found, before is progress from before it was searched.
+func reportChannelFinished(
+	args *arguments,
+	channel string,
+	index int,
+	count int,
+	status string,
+	before justgrep.ProgressState,
+	progress *justgrep.ProgressState,
+) {
+	results := justgrep.NewResultCounts()
+	for result, total := range progress.TotalResults {
+		results[result] = total - before.TotalResults[result]
+	}
+	args.summaryFile.channelFinished(
+		channelSummary{
+			Channel:     channel,
+			Status:      status,
+			Results:     results,
+			CountLines:  progress.CountLines - before.CountLines,
+			CountBytes:  progress.CountBytes - before.CountBytes,
+			FetchErrors: progress.FetchErrors - before.FetchErrors,
+			FinishedAt:  time.Now(),
+		},
+	)
+	if *args.progressJson {
+		args.emitEvent(
+			channelFinishedReport{
+				Type:              progressChannelFinished,
+				Channel:           channel,
+				Status:            status,
+				Results:           results,
+				CountLines:        progress.CountLines - before.CountLines,
+				CountBytes:        progress.CountBytes - before.CountBytes,
+				FetchErrors:       progress.FetchErrors - before.FetchErrors,
+				CurrentChannelNum: index,
+				CountChannels:     count,
+				Progress:          *progress,
+			},
+		)
+		return
+	}
+	if !*args.verbose {
+		return
+	}
+	suffix := ""
+	switch status {
+	case channelSkipped:
+		suffix = ", skipped the rest"
+	case channelAborted:
+		suffix = ", search aborted"
+	}
+	if fetchErrors := progress.FetchErrors - before.FetchErrors; fetchErrors != 0 {
+		suffix = fmt.Sprintf(", %d log files failed%s", fetchErrors, suffix)
+	}
+	args.display.printf(
+		"Finished #%s %d/%d: %d matches in %d lines%s\n",
+		channel,
+		index+1,
+		count,
+		results[justgrep.ResultOk],
+		progress.CountLines-before.CountLines,
+		suffix,
+	)
+}
+
+// earliestLogFile returns the oldest log file available to any of apis. ok is false if none of them know which log
+// files are available.
+func earliestLogFile(apis []justgrep.JustlogAPI) (earliest time.Time, ok bool) {
+	for _, api := range apis {
+		available, isAvailable := api.(*justgrep.AvailableLogsAPI)
+		if !isAvailable || len(available.Dates) == 0 {
+			continue
+		}
+		oldest := available.Dates[len(available.Dates)-1]
+		if !ok || oldest.Before(earliest) {
+			earliest = oldest
+			ok = true
 		}
-		searchLogs(args, api, filter, progress)
+	}
+	return
+}
+
+// printSummary shows the final result counts and statistics on stderr, as text with -v or JSON with -progress-json.
+func printSummary(args *arguments, progress *justgrep.ProgressState) {
+	if progress.NameChanges != nil && !*args.progressJson {
+		printNameChanges(progress.NameChanges)
+	}
+	noResults := justgrep.ExplainNoResults(progress)
+	if noResults != nil && !*args.progressJson {
+		_, _ = fmt.Fprintf(os.Stderr, "No matches. %s\n", noResults.Message)
 	}
 	if *args.verbose {
 		_, _ = fmt.Fprintf(os.Stderr, "Summary:\n")
+		printInstanceStats(progress)
 		if progress.CountLines == 0 {
-			// no lines fetched at all
-			fmt.Fprintf(os.Stderr, "Nothing here. No lines were processed.\n")
+			// explained above
 			return
 		}
 		for result, count := range progress.TotalResults {
-			_, _ = fmt.Fprintf(os.Stderr, " - %s => %d\n", justgrep.FilterResult(result), count)
+			_, _ = fmt.Fprintf(os.Stderr, " - %s => %d\n", justgrep.FilterResult(result).Description(), count)
 		}
+		printPatternHits(args.patternHits())
 		const Mega = 1000.0 * 1000.0
 		const Milli = 0.001
 		timeTaken := time.Now().Sub(progress.BeginTime)
@@ -375,85 +1918,393 @@ func main() {
 			progress.CountBytes/progress.CountLines,
 			timeTaken.Truncate(time.Second),
 		)
+		if progress.InvalidLines != 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "Invalid lines: %d\n", progress.InvalidLines)
+		}
+		if progress.FetchErrors != 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "Log files that failed to download: %d\n", progress.FetchErrors)
+		}
+		if progress.SkippedChannels != 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "Channels skipped after errors: %d\n", progress.SkippedChannels)
+		}
+		if progress.ResumedDownloads != 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "Downloads resumed after errors: %d\n", progress.ResumedDownloads)
+		}
+		if args.memoryCache != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Requests answered from memory: %d\n", args.memoryCache.Hits())
+		}
+		if args.diskCache != nil {
+			_, _ = fmt.Fprintf(
+				os.Stderr,
+				"Requests answered from -cache-dir: %d, after revalidating: %d\n",
+				args.diskCache.Hits(),
+				args.diskCache.Revalidated(),
+			)
+		}
 	}
 	if *args.progressJson {
-		res := make(map[string]int)
+		results := make(map[string]int)
 		for result, count := range progress.TotalResults {
-			res[justgrep.FilterResult(result).String()] = count
+			results[justgrep.FilterResult(result).Description()] = count
 		}
-		_ = json.NewEncoder(os.Stderr).Encode(
+		args.emitEvent(
 			summaryReport{
-				Type:     summaryFinished,
-				Results:  res,
-				Progress: *progress,
+				Type:         summaryFinished,
+				Results:      results,
+				ResultCounts: progress.TotalResults,
+				Progress:     *progress,
+				NoResults:    noResults,
+				PatternHits:  args.patternHits(),
+			},
+		)
+	}
+	args.summaryFile.write(args, progress, noResults)
+}
+
+// printNameChanges shows the logins used by users who matched under more than one of them.
+func printNameChanges(tracker *justgrep.NameTracker) {
+	changes := tracker.Changes()
+	if len(changes) == 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "No name changes found.")
+		return
+	}
+	ids := make([]string, 0, len(changes))
+	for id := range changes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		_, _ = fmt.Fprintf(os.Stderr, "User id %s was known as:\n", id)
+		for _, span := range changes[id] {
+			_, _ = fmt.Fprintf(
+				os.Stderr,
+				" - %s from %s to %s, %d messages\n",
+				span.Login,
+				span.First.Format(time.RFC3339),
+				span.Last.Format(time.RFC3339),
+				span.Messages,
+			)
+		}
+	}
+}
+
+// printInstanceStats shows how every justlog instance behaved during the search.
+func printInstanceStats(progress *justgrep.ProgressState) {
+	if progress.Instances == nil {
+		return
+	}
+	stats := progress.Instances.Snapshot()
+	instances := make([]string, 0, len(stats))
+	for instance := range stats {
+		instances = append(instances, instance)
+	}
+	sort.Strings(instances)
+	for _, instance := range instances {
+		s := stats[instance]
+		_, _ = fmt.Fprintf(
+			os.Stderr,
+			"Instance %s: %d requests, %d retries, %d errors, %.2f MB, latency mean %s p95 %s\n",
+			instance,
+			s.Requests,
+			s.Retries,
+			s.Errors,
+			float64(s.Bytes)/1000/1000,
+			s.MeanLatency.Truncate(time.Millisecond),
+			s.P95Latency.Truncate(time.Millisecond),
+		)
+		for status, count := range s.ErrorsByStatus {
+			_, _ = fmt.Fprintf(os.Stderr, " - errors with status %s => %d\n", status, count)
+		}
+	}
+}
+
+// buildFilter compiles all regular expressions given in the arguments and creates a justgrep.Filter out of them. If any
+// of them fails to compile, an error is printed and ok is false.
+func buildFilter(args *arguments, messageRegex string) (filter justgrep.Filter, ok bool) {
+	messageExpr, err := regexp.Compile(messageRegex)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error while compiling your message regex: %s\n", err)
+		return justgrep.Filter{}, false
+	}
+	// compiled above, there can't be an error
+	warnings, _ := justgrep.LintRegex(messageRegex)
+	for _, warning := range warnings {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	if len(warnings) != 0 && *args.strict {
+		_, _ = fmt.Fprintln(os.Stderr, "Not searching because of the warnings above and -strict.")
+		return justgrep.Filter{}, false
+	}
+
+	var systemMessageExpr *regexp.Regexp
+	if *args.systemMsgRegex != "" {
+		systemMessageExpr, err = regexp.Compile(*args.systemMsgRegex)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error while compiling your system message regex: %s\n", err)
+			return justgrep.Filter{}, false
+		}
+	}
+
+	var linkDomainExpr *regexp.Regexp
+	if *args.linkDomain != "" {
+		linkDomainExpr, err = regexp.Compile(*args.linkDomain)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error while compiling your link domain regex: %s\n", err)
+			return justgrep.Filter{}, false
+		}
+	}
+
+	users, err := compileUserMatcher(args.userLogins, args.userPatterns(*args.user, args.userRegexes), "")
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error while compiling your username regex: %s\n", err)
+		return justgrep.Filter{}, false
+	}
+	notUsers, err := compileUserMatcher(
+		args.notUserLogins,
+		args.userPatterns(*args.notUser, args.notUserRegexes),
+		"",
+	)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error while compiling your negative username regex: %s\n", err)
+		return justgrep.Filter{}, false
+	}
+	displayNames, err := compileUserMatcher(args.displayNames, args.userPatterns(*args.displayName, nil), "(?i)")
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error while compiling your display name regex: %s\n", err)
+		return justgrep.Filter{}, false
+	}
+
+	userID := args.userID
+	if *args.withUser != "" || *args.report == reportModeration {
+		// the report picks messages of both users, or the user's messages and timeouts targeting them
+		users = justgrep.UserMatcher{}
+		userID = ""
+	}
+	args.messageTypes = strings.Split(*args.messageTypesRaw, ",")
+	maxPerUser := *args.maxPerUser
+	if *args.distinctUsers {
+		maxPerUser = 1
+	}
+	filter = justgrep.Filter{
+		StartDate: args.startTime,
+		EndDate:   args.endTime,
+
+		HasMessageType: len(*args.messageTypesRaw) != 0,
+		MessageTypes:   args.messageTypes,
+
+		HasMessageRegex: true,
+		MessageRegex:    messageExpr,
+
+		HasPatterns: args.patterns != nil,
+		Patterns:    args.patterns,
+
+		HasSystemMessageRegex: systemMessageExpr != nil,
+		SystemMessageRegex:    systemMessageExpr,
+
+		HasLink:            *args.hasLink,
+		HasLinkDomainRegex: linkDomainExpr != nil,
+		LinkDomainRegex:    linkDomainExpr,
+
+		Users:             users,
+		NotUsers:          notUsers,
+		MatchDisplayNames: *args.anyName,
+		DisplayNames:      displayNames,
+
+		UserID: userID,
+
+		HasLiteral: *args.literal != "",
+		Literal:    *args.literal,
+
+		Count: *args.maxResults,
+
+		MaxPerUser: maxPerUser,
+		UserCounts: justgrep.NewUserCounts(),
+
+		MatchModerationTargets: args.modlog != nil,
+
+		OnReject: args.onReject(),
+	}
+	filter.OnMatch = args.onMatch(filter)
+	return filter, true
+}
+
+// usesUserLogs returns true if logs of a single user are downloaded instead of the whole channel. -around needs the
+// messages of everyone.
+func (args *arguments) usesUserLogs() bool {
+	return args.around == nil && (args.userID != "" || args.singleLogin() != "")
+}
+
+// onMatch returns the callback for matches of filter for matched_by, -around, -format modlog-json and -summary-file,
+// or nil.
+func (args *arguments) onMatch(filter justgrep.Filter) func(msg *justgrep.Message) {
+	var callbacks []func(msg *justgrep.Message)
+	if args.hasMatchRules(filter) {
+		callbacks = append(
+			callbacks, func(msg *justgrep.Message) {
+				args.recordMatch(filter, msg)
 			},
 		)
 	}
+	if args.around != nil {
+		callbacks = append(callbacks, args.around.matched)
+	} else if args.modlog != nil {
+		callbacks = append(callbacks, args.modlog.matched)
+	}
+	if args.summaryFile != nil {
+		callbacks = append(callbacks, args.summaryFile.matched)
+	}
+	switch len(callbacks) {
+	case 0:
+		return nil
+	case 1:
+		return callbacks[0]
+	}
+	return func(msg *justgrep.Message) {
+		for _, callback := range callbacks {
+			callback(msg)
+		}
+	}
+}
+
+// onReject returns the callback for messages which didn't match of -debug-filter, -around and -format modlog-json,
+// or nil.
+func (args *arguments) onReject() func(msg *justgrep.Message, result justgrep.FilterResult) {
+	debug := args.debugFilter.onReject()
+	var seen func(msg *justgrep.Message)
+	if args.around != nil {
+		seen = args.around.reject
+	} else if args.modlog != nil {
+		seen = args.modlog.reject
+	}
+	if seen == nil {
+		return debug
+	}
+	return func(msg *justgrep.Message, result justgrep.FilterResult) {
+		if debug != nil {
+			debug(msg, result)
+		}
+		seen(msg)
+	}
 }
 
 const progressSize = 50
 
-func makeProgressBar(totalSteps float64, stepsLeft float64) string {
+// compactProgressSize is the size of progress bars drawn in place, they have to share a terminal line.
+const compactProgressSize = 20
+
+// progressText describes the progress of a search which is about to download the log file of channel for nextDate. If
+// compact is set, it's shortened to fit a terminal line.
+func progressText(
+	progress *justgrep.ProgressState,
+	channel string,
+	nextDate time.Time,
+	totalSteps float64,
+	stepsLeft float64,
+	compact bool,
+) string {
+	timeTaken := float64(time.Since(progress.BeginTime) / time.Second)
+	if timeTaken == 0 {
+		timeTaken = 1
+	}
+	if compact {
+		return fmt.Sprintf(
+			"#%s %s %s %d found, %.2f MB/s",
+			channel,
+			nextDate.Format("2006-01-02"),
+			makeProgressBar(totalSteps, stepsLeft, compactProgressSize),
+			progress.TotalResults[justgrep.ResultOk],
+			float64(progress.CountBytes/1000/1000)/timeTaken,
+		)
+	}
+	return fmt.Sprintf(
+		"Found %d matching messages... Downloading #%s at %s %s. %d/s (%.2f MB/s before compression). "+
+			"Processed %.2f MB (%d lines and counting)",
+		progress.TotalResults[justgrep.ResultOk],
+		channel,
+		nextDate.Format("2006-01-02"),
+		makeProgressBar(totalSteps, stepsLeft, progressSize),
+		progress.CountLines/int(timeTaken),
+		float64(progress.CountBytes/1000/1000)/timeTaken,
+
+		float64(progress.CountBytes/1000/1000),
+		progress.CountLines,
+	)
+}
+
+func makeProgressBar(totalSteps float64, stepsLeft float64, size int) string {
 	var fracDone float64
 	if totalSteps == 0 {
 		fracDone = 0
 		stepsLeft = 1
 		totalSteps = 2
 	} else {
-		fracDone = 1 - stepsLeft/totalSteps
+		fracDone = math.Min(math.Max(1-stepsLeft/totalSteps, 0), 1)
 	}
-	done := strings.Repeat("=", int(math.Floor(progressSize*fracDone)))
-	left := strings.Repeat(" ", int(math.Ceil(progressSize*(1-fracDone))))
+	done := strings.Repeat("=", int(math.Floor(float64(size)*fracDone)))
+	left := strings.Repeat(" ", int(math.Ceil(float64(size)*(1-fracDone))))
 	return fmt.Sprintf("[%s>%s] %.2f%%", done, left, fracDone*100)
 }
 
+// firstLogFile returns the date of the first log file to download when searching back from end.
+func firstLogFile(api justgrep.JustlogAPI, end time.Time) time.Time {
+	if available, ok := api.(*justgrep.AvailableLogsAPI); ok {
+		return available.FirstLogFile(end)
+	}
+	return end
+}
+
+// apiChannel returns the name of the channel an API is downloading logs of.
+func apiChannel(api justgrep.JustlogAPI) string {
+	switch api := api.(type) {
+	case *justgrep.UserJustlogAPI:
+		return api.Channel
+	case *justgrep.ChannelJustlogAPI:
+		return api.Channel
+	case *candidateDatesAPI:
+		return apiChannel(api.JustlogAPI)
+	case *justgrep.AvailableLogsAPI:
+		return apiChannel(api.JustlogAPI)
+	default:
+		return fmt.Sprintf("[unknown] (%T)", api)
+	}
+}
+
+// searchLogs searches log files from nextDate back to -start. It returns true if it stopped because a log file failed
+// to download and -on-error isn't skip-day. Downloads it started have ended when it returns, nothing counts into
+// progress after that.
 func searchLogs(
 	args *arguments,
 	api justgrep.JustlogAPI,
+	nextDate time.Time,
 	filter justgrep.Filter,
 	progress *justgrep.ProgressState,
-) {
-	nextDate := args.endTime
+	output messageSink,
+) (failed bool) {
 	ctx, cancel := context.WithCancel(context.Background())
-	var channel string
+	channel := apiChannel(api)
 	step := api.GetApproximateOffset()
-	switch api.(type) {
-	default:
-		channel = fmt.Sprintf("[unknown] (%t)", api)
+	if step == 0 {
 		step = time.Hour * 24
-	case *justgrep.UserJustlogAPI:
-		channel = api.(*justgrep.UserJustlogAPI).Channel
-	case *justgrep.ChannelJustlogAPI:
-		channel = api.(*justgrep.ChannelJustlogAPI).Channel
 	}
 	totalSteps := float64(args.endTime.Sub(args.startTime) / step)
 
 	defer cancel()
-	for {
+	bar := 0
+	if *args.verbose {
+		bar = args.display.bar()
+		defer args.display.done(bar)
+	}
+	firstFile := true
+	for !nextDate.IsZero() {
 		stepsLeft := float64(nextDate.Sub(args.startTime) / step)
 		if *args.verbose {
-			nowTime := time.Now()
-			timeTaken := float64(nowTime.Sub(progress.BeginTime) / time.Second)
-			if timeTaken == 0 {
-				timeTaken = 1
-			}
-			_, _ = fmt.Fprintf(
-				os.Stderr,
-				"Found %d matching messages... Downloading #%s at %s %s. %d/s (%.2f MB/s before compression). "+
-					"Processed %.2f MB (%d lines and counting)\n",
-				progress.TotalResults[justgrep.ResultOk],
-				channel,
-				nextDate.Format("2006-01-02"),
-				makeProgressBar(totalSteps, stepsLeft),
-				progress.CountLines/int(timeTaken),
-				float64(progress.CountBytes/1000/1000)/timeTaken,
-
-				float64(progress.CountBytes/1000/1000),
-				progress.CountLines,
+			args.display.update(
+				bar,
+				progressText(progress, channel, nextDate, totalSteps, stepsLeft, args.display.compact()),
 			)
 		}
 		if *args.progressJson {
-			_ = json.NewEncoder(os.Stderr).Encode(
+			args.emitEvent(
 				progressUpdate{
 					Type:       progressNextStep,
 					Found:      progress.TotalResults[justgrep.ResultOk],
@@ -466,37 +2317,69 @@ func searchLogs(
 			)
 		}
 		download := make(chan *justgrep.Message)
+		currentDate := nextDate
 		var err error
-		nextDate, err = justgrep.FetchForDate(ctx, api, nextDate, download, progress, &httpClient)
+		if firstFile {
+			// the first log file can contain a lot of messages after -end, skip them if possible
+			nextDate, err = args.fetchOptions.FetchForDateFrom(
+				ctx,
+				api,
+				nextDate,
+				args.endTime,
+				download,
+				progress,
+				&httpClient,
+			)
+			firstFile = false
+		} else {
+			nextDate, err = args.fetchOptions.FetchForDate(ctx, api, nextDate, download, progress, &httpClient)
+		}
 		if err != nil {
-			if *args.progressJson {
-				_ = json.NewEncoder(os.Stderr).Encode(
-					errorReport{
-						Type:     errorWhileFetching,
-						Error:    err.Error(),
-						Progress: *progress,
-					},
-				)
-			} else {
-				_, _ = fmt.Fprintf(os.Stderr, "Error while fetching logs: %s\n", err)
+			reportFetchError(args, channel, currentDate, err, progress)
+			if *args.onError != onErrorSkipDay {
+				return true
 			}
-			break
+			// the rest of the logs might still be fine
+			nextDate = api.NextLogFile(currentDate)
+			if !currentDate.After(args.startTime) {
+				break
+			}
+			continue
 		}
 
 		filtered := make(chan *justgrep.Message)
-		var results []int
+		resultsChan := make(chan justgrep.ResultCounts, 1)
+		errChan := make(chan error, 1)
 		go func() {
-			results = filter.StreamFilter(cancel, download, filtered, progress)
+			results, err := filter.StreamFilter(cancel, download, filtered, progress)
+			resultsChan <- results
+			errChan <- err
 		}()
 		for msg := range filtered {
-			fmt.Println(msg.Raw)
+			output.emit(msg)
 		}
-
-		for result, count := range results {
-			progress.TotalResults[result] += count
+		results := <-resultsChan
+		// the filter can stop before the download did, wait for it to stop counting into progress
+		for range download {
+		}
+		progress.TotalResults.Add(results)
+		if err := <-errChan; err != nil {
+			// matches from before the error have been printed already
+			reportFetchError(args, channel, currentDate, err, progress)
+			if *args.onError != onErrorSkipDay {
+				return true
+			}
+		}
+		if parseErrorAbort(args, progress) {
+			break
 		}
 		if results[justgrep.ResultDateBeforeStart] != 0 || results[justgrep.ResultMaxCountReached] != 0 {
 			break
 		}
+		// after the first one, dates point to the beginning of log files, older files can't contain anything newer
+		if !currentDate.After(args.startTime) {
+			break
+		}
 	}
+	return false
 }
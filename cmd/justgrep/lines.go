@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"unsafe"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+var errNotMappable = errors.New("file can't be memory-mapped")
+
+// lineScanner reads lines like bufio.Scanner with justgrep.ScanLines does.
+type lineScanner interface {
+	Scan() bool
+	Text() string
+	Err() error
+}
+
+// newLineScanner reads lines from reader. Regular files are memory-mapped if the platform supports it, so lines don't
+// have to be copied out of a buffer.
+func newLineScanner(reader io.Reader) lineScanner {
+	if file, ok := reader.(*os.File); ok {
+		data, err := mapFile(file)
+		if err == nil {
+			return &mappedLines{data: data}
+		}
+	}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, lineBufferSize), 1024*1024)
+	scanner.Split(justgrep.ScanLines)
+	return scanner
+}
+
+// mapFile maps the contents of file into memory if it's a regular file which isn't empty. The mapping is never
+// released, strings returned by mappedLines point into it and may be kept until justgrep exits.
+func mapFile(file *os.File) ([]byte, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if !info.Mode().IsRegular() || size == 0 || int64(int(size)) != size {
+		return nil, errNotMappable
+	}
+	return mmap(file, int(size))
+}
+
+// mappedLines splits memory-mapped data into lines without copying it.
+type mappedLines struct {
+	data []byte
+	pos  int
+	line []byte
+}
+
+func (m *mappedLines) Scan() bool {
+	if m.pos >= len(m.data) {
+		m.line = nil
+		return false
+	}
+	// all data is there, so it's always at EOF
+	advance, line, _ := justgrep.ScanLines(m.data[m.pos:], true)
+	m.pos += advance
+	m.line = line
+	return true
+}
+
+func (m *mappedLines) Text() string {
+	if len(m.line) == 0 {
+		return ""
+	}
+	// the mapping is read-only and never released, the string can't change
+	return *(*string)(unsafe.Pointer(&m.line))
+}
+
+func (m *mappedLines) Err() error {
+	return nil
+}
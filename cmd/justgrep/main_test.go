@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mm2PL/justgrep/justgreptest"
+)
+
+// envRunMain makes the test binary run main instead of the tests, runJustgrep starts it like the justgrep binary.
+const envRunMain = "JUSTGREP_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(envRunMain) != "" {
+		os.Args = append([]string{"justgrep"}, os.Args[1:]...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func assert(t *testing.T, what string, have interface{}, expect interface{}) {
+	t.Helper()
+	if have != expect {
+		t.Errorf("assertion on %s failed: have %q, expected %q", what, have, expect)
+	}
+}
+
+// testLogStart is midnight of the first day testLogLines has messages for.
+var testLogStart = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testLogLine returns a PRIVMSG of user to #channel.
+func testLogLine(channel string, id string, user int, sent time.Time, text string) string {
+	return fmt.Sprintf(
+		"@display-name=user%d;id=%s;room-id=1;tmi-sent-ts=%d;user-id=%d :user%d!user%d@user%d.tmi.twitch.tv "+
+			"PRIVMSG #%s :%s",
+		user,
+		id,
+		sent.UnixNano()/int64(time.Millisecond),
+		user,
+		user,
+		user,
+		user,
+		channel,
+		text,
+	)
+}
+
+// testLogLines returns messages of #pajlada and #forsen, one every hour for days days from testLogStart, sent by
+// user0 to user3 in turns. Every fourth message contains "pajaS".
+func testLogLines(days int) []string {
+	var lines []string
+	for _, channel := range []string{"pajlada", "forsen"} {
+		for hour := 0; hour < days*24; hour++ {
+			text := fmt.Sprintf("hello day %d hour %d", hour/24+1, hour%24)
+			if hour%4 == 0 {
+				text = fmt.Sprintf("hello pajaS day %d hour %d", hour/24+1, hour%24)
+			}
+			lines = append(
+				lines,
+				testLogLine(
+					channel,
+					fmt.Sprintf("%s-%d", channel, hour),
+					hour%4,
+					testLogStart.Add(time.Duration(hour)*time.Hour),
+					text,
+				),
+			)
+		}
+	}
+	return lines
+}
+
+// newTestServer starts a justgreptest.Server with days days of testLogLines.
+func newTestServer(t *testing.T, days int) *justgreptest.Server {
+	server, err := justgreptest.NewServer(testLogLines(days)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+// justgrepResult is the output of a justgrep run.
+type justgrepResult struct {
+	stdout string
+	stderr string
+	code   int
+}
+
+// lines returns the lines printed to stdout.
+func (r justgrepResult) lines() []string {
+	if r.stdout == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(r.stdout, "\n"), "\n")
+}
+
+// runJustgrep runs justgrep with cliArgs in dir, or in a new temporary directory if dir is empty. The user cache
+// directory, where results are kept for -refine, is in dir too, so runs in the same dir see each other's results.
+func runJustgrep(t *testing.T, dir string, cliArgs ...string) justgrepResult {
+	t.Helper()
+	if dir == "" {
+		dir = t.TempDir()
+	}
+	cmd := exec.Command(os.Args[0], cliArgs...)
+	cmd.Dir = dir
+	cache := filepath.Join(dir, "cache")
+	cmd.Env = append(
+		os.Environ(),
+		envRunMain+"=1",
+		EnvCacheDir+"=",
+		// os.UserCacheDir on Linux, macOS and Windows
+		"XDG_CACHE_HOME="+cache,
+		"HOME="+dir,
+		"LocalAppData="+cache,
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	result := justgrepResult{stdout: stdout.String(), stderr: stderr.String()}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(result.stderr, "WARNING: DATA RACE") {
+		t.Fatalf("justgrep %s raced:\n%s", strings.Join(cliArgs, " "), result.stderr)
+	}
+	return result
+}
+
+// testSearchArgs returns the options for searching #channel of server between the first and last of days, followed by
+// extra.
+func testSearchArgs(server *justgreptest.Server, channel string, days int, extra ...string) []string {
+	return append(
+		[]string{
+			"-no-env",
+			"-url", server.URL,
+			"-channel", channel,
+			"-start", testLogStart.Format(time.RFC3339),
+			"-end", testLogStart.AddDate(0, 0, days).Add(-time.Second).Format(time.RFC3339),
+		},
+		extra...,
+	)
+}
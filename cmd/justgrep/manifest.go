@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const runManifestFile = "manifest.json"
+const runManifestVersion = 1
+
+// runManifest describes a search well enough to replay it with `justgrep rerun DIR`.
+type runManifest struct {
+	Version int `json:"version"`
+
+	// Args are the effective command line arguments, with times, the instance and channels resolved.
+	Args      []string `json:"args"`
+	Instances []string `json:"instances"`
+	// Instance is the instance of the first channel, Routes has the instance of every channel.
+	Instance string            `json:"instance"`
+	Routes   map[string]string `json:"routes"`
+	Channels []string          `json:"channels"`
+
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	JustgrepCommit string `json:"justgrep_commit"`
+	GoVersion      string `json:"go_version"`
+
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+
+	ResultFile string                 `json:"result_file"`
+	Results    justgrep.ResultCounts  `json:"results"`
+	Progress   justgrep.ProgressState `json:"progress"`
+}
+
+// redactURL hides passwords in instance URLs, manifests are meant to be shared.
+func redactURL(instance string) string {
+	u, err := url.Parse(instance)
+	if err != nil {
+		return "[failed to url parse, hiding to not show any secrets]"
+	}
+	return u.Redacted()
+}
+
+// effectiveArgs rebuilds the command line so that replaying it searches exactly the same logs: relative or implicit
+// times are replaced with absolute ones, -r is replaced with the list of channels that were searched and -url lists
+// the instances they were searched on.
+func effectiveArgs(args *arguments, instances []string, channels []string) []string {
+	redactedInstances := make([]string, len(instances))
+	for i, instance := range instances {
+		redactedInstances[i] = redactURL(instance)
+	}
+	specs := make([]string, len(channels))
+	for i, channel := range channels {
+		specs[i] = args.channelSpec(channel)
+	}
+	output := make([]string, 0, 16)
+	flag.CommandLine.Visit(
+		func(f *flag.Flag) {
+			switch f.Name {
+			case "start", "end", "url", "prefer-url", "rank-instances", "channel", "r", "run-dir", "no-env":
+				return
+			case "pprof-addr", "cpuprofile", "memprofile":
+				// diagnostics of this run
+				return
+			case "upload-token":
+				// secret, it can be given with the environment variable again
+				return
+			}
+			output = append(output, "-"+f.Name+"="+f.Value.String())
+		},
+	)
+	return append(
+		output,
+		"-url="+strings.Join(redactedInstances, ","),
+		"-channel="+strings.Join(specs, ","),
+		"-start="+args.startTime.Format(time.RFC3339Nano),
+		"-end="+args.endTime.Format(time.RFC3339Nano),
+	)
+}
+
+func newRunManifest(
+	args *arguments,
+	instances []string,
+	routes map[string]string,
+	channels []string,
+	progress *justgrep.ProgressState,
+) *runManifest {
+	redactedInstances := make([]string, len(instances))
+	for i, instance := range instances {
+		redactedInstances[i] = redactURL(instance)
+	}
+	redactedRoutes := make(map[string]string, len(routes))
+	for channel, instance := range routes {
+		redactedRoutes[channel] = redactURL(instance)
+	}
+	used := routedInstances(routes, channels)
+	instance := ""
+	if len(used) != 0 {
+		instance = redactURL(used[0])
+	}
+	return &runManifest{
+		Version:   runManifestVersion,
+		Args:      effectiveArgs(args, used, channels),
+		Instances: redactedInstances,
+		Instance:  instance,
+		Routes:    redactedRoutes,
+		Channels:  channels,
+
+		Start: args.startTime,
+		End:   args.endTime,
+
+		JustgrepCommit: gitCommit,
+		GoVersion:      runtime.Version(),
+
+		StartedAt:  progress.BeginTime,
+		FinishedAt: time.Now(),
+
+		ResultFile: runResultsFile,
+		Results:    progress.TotalResults,
+		Progress:   *progress,
+	}
+}
+
+func (m *runManifest) save(dir string) error {
+	file, err := os.Create(filepath.Join(dir, runManifestFile))
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(m)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func loadRunManifest(dir string) (*runManifest, error) {
+	file, err := os.Open(filepath.Join(dir, runManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	manifest := &runManifest{}
+	err = json.NewDecoder(file).Decode(manifest)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRerun(t *testing.T) {
+	server := newTestServer(t, 2)
+	dir := t.TempDir()
+	runDir := filepath.Join(dir, "run")
+	search := runJustgrep(
+		t,
+		dir,
+		"-no-env",
+		"-url", server.URL,
+		"-channel", "pajlada",
+		// without -end, the search goes until now
+		"-start", "2021-01-01",
+		"-regex", "pajaS",
+		"-run-dir", runDir,
+		// never reached, nothing is uploaded
+		"-upload", "http://127.0.0.1:1/upload",
+		"-upload-over", "1GB",
+		"-upload-token", "s3cret",
+		"-cpuprofile", filepath.Join(dir, "cpu.prof"),
+		"-memprofile", filepath.Join(dir, "mem.prof"),
+	)
+	if search.code != 0 || len(search.lines()) != 12 {
+		t.Fatalf("expected 12 matches, got %d, exit code %d: %s", len(search.lines()), search.code, search.stderr)
+	}
+
+	manifest, err := loadRunManifest(runDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := strings.Join(manifest.Args, " ")
+	for _, left := range []string{"s3cret", "-upload-token", "-cpuprofile", "-memprofile", "-run-dir", "-no-env"} {
+		if strings.Contains(args, left) {
+			t.Errorf("expected %s to be left out of the manifest: %s", left, args)
+		}
+	}
+	for _, kept := range []string{
+		"-regex=pajaS",
+		"-url=" + server.URL,
+		"-channel=pajlada",
+		"-start=2021-01-01T00:00:00Z",
+		"-end=" + manifest.End.Format(time.RFC3339Nano),
+	} {
+		if !strings.Contains(args, kept) {
+			t.Errorf("expected %s in the manifest: %s", kept, args)
+		}
+	}
+	if manifest.End.Before(time.Now().Add(-time.Minute)) || manifest.Results[0] != 12 {
+		t.Errorf("unexpected manifest end %s or results %v", manifest.End, manifest.Results)
+	}
+
+	// messages sent after the first run aren't found again
+	err = server.Add(testLogLine("pajlada", "new", 0, time.Now(), "new pajaS"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again := runJustgrep(
+		t,
+		dir,
+		"-no-env",
+		"-url", server.URL,
+		"-channel", "pajlada",
+		"-start", "2021-01-01",
+		"-regex", "pajaS",
+	)
+	if len(again.lines()) != 13 {
+		t.Fatalf("expected a new search to find the new match, got %d matches: %s", len(again.lines()), again.stderr)
+	}
+	rerun := runJustgrep(t, dir, "rerun", runDir, "-no-env")
+	if rerun.code != 0 {
+		t.Fatalf("rerun failed with exit code %d: %s", rerun.code, rerun.stderr)
+	}
+	assert(t, "rerun matches", rerun.stdout, search.stdout)
+
+	// options after the directory override the ones of the manifest
+	narrowed := runJustgrep(t, dir, "rerun", runDir, "-no-env", "-regex", "pajaS day 2 ")
+	if narrowed.code != 0 || len(narrowed.lines()) != 6 {
+		t.Fatalf("expected 6 matches rerunning with -regex, got %d: %s", len(narrowed.lines()), narrowed.stderr)
+	}
+
+	missing := runJustgrep(t, dir, "rerun", filepath.Join(dir, "missing"))
+	if missing.code != 1 || !strings.Contains(missing.stderr, "Unable to load run manifest") {
+		t.Errorf("expected rerunning a missing run to fail, got exit code %d: %s", missing.code, missing.stderr)
+	}
+}
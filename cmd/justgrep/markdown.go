@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const formatMarkdown = "markdown"
+
+// values of -markdown-style
+const (
+	markdownTable = "table"
+	markdownQuote = "quote"
+)
+
+// markdownFooterSize is kept free below -markdown-max-size for the footer saying how many matches were left out.
+const markdownFooterSize = 40
+
+// markdownWriter prints matches as Markdown for pasting into tickets and chats, GitHub and Discord both render it.
+// With a size limit, matches which don't fit anymore are only counted and mentioned at the end.
+type markdownWriter struct {
+	out   io.Writer
+	style string
+	// maxSize is in characters, 0 for no limit
+	maxSize int
+
+	size    int
+	rows    int
+	omitted int
+}
+
+// validateMarkdownFlags checks -markdown-style and -markdown-max-size.
+func (args *arguments) validateMarkdownFlags() (valid bool) {
+	valid = true
+	if *args.format != formatMarkdown {
+		if givenFlags()["markdown-style"] || *args.markdownMaxSize != 0 {
+			_, _ = fmt.Fprintln(os.Stderr, "-markdown-style and -markdown-max-size need -format markdown.")
+			valid = false
+		}
+		return
+	}
+	if *args.markdownStyle != markdownTable && *args.markdownStyle != markdownQuote {
+		_, _ = fmt.Fprintf(
+			os.Stderr,
+			"-markdown-style: unknown style %q, expected table or quote\n",
+			*args.markdownStyle,
+		)
+		valid = false
+	}
+	if *args.markdownMaxSize < 0 || (*args.markdownMaxSize != 0 && *args.markdownMaxSize < 2*markdownFooterSize) {
+		_, _ = fmt.Fprintf(
+			os.Stderr,
+			"-markdown-max-size has to be at least %d characters, or 0 for no limit.\n",
+			2*markdownFooterSize,
+		)
+		valid = false
+	}
+	if *args.groupBy != "" {
+		_, _ = fmt.Fprintln(os.Stderr, "-format markdown can't be used with -group-by.")
+		valid = false
+	}
+	return
+}
+
+// markdownEscaper escapes what Markdown would format, so chat messages show up as they were sent and can't ping
+// anyone when pasted into Discord.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	"*", `\*`,
+	"_", `\_`,
+	"~", `\~`,
+	"|", `\|`,
+	"<", `\<`,
+	">", `\>`,
+	"[", `\[`,
+	"]", `\]`,
+	"#", `\#`,
+	// a zero width space after @ stops @everyone and mentions from pinging
+	"@", "@\u200b",
+)
+
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+// markdownText returns the text of msg shown in Markdown, with its annotations.
+func markdownText(msg *justgrep.Message) string {
+	text := msg.Text()
+	if msg.Invalid != nil {
+		text = msg.Raw
+	}
+	return escapeMarkdown(text) + escapeMarkdown(formatAnnotations(msg, " (", ")"))
+}
+
+func (w *markdownWriter) write(msg *justgrep.Message) {
+	if w.omitted != 0 {
+		w.omitted++
+		return
+	}
+	var block string
+	timestamp := msg.Timestamp.UTC().Format("2006-01-02 15:04:05")
+	switch w.style {
+	case markdownQuote:
+		if w.rows != 0 {
+			block = "\n"
+		}
+		block += fmt.Sprintf(
+			"> **%s** in #%s at %s UTC\n> %s\n",
+			escapeMarkdown(chatterinoUser(msg)),
+			escapeMarkdown(msg.Channel()),
+			timestamp,
+			markdownText(msg),
+		)
+	default:
+		if w.rows == 0 {
+			block = "| Time (UTC) | Channel | User | Message |\n| --- | --- | --- | --- |\n"
+		}
+		block += fmt.Sprintf(
+			"| %s | %s | %s | %s |\n",
+			timestamp,
+			escapeMarkdown(msg.Channel()),
+			escapeMarkdown(chatterinoUser(msg)),
+			markdownText(msg),
+		)
+	}
+	size := utf8.RuneCountInString(block)
+	if w.maxSize != 0 && w.size+size > w.maxSize-markdownFooterSize {
+		w.omitted = 1
+		return
+	}
+	w.size += size
+	w.rows++
+	_, _ = fmt.Fprint(w.out, block)
+}
+
+// finish mentions the matches which didn't fit.
+func (w *markdownWriter) finish() {
+	if w.omitted == 0 {
+		return
+	}
+	more := "matches"
+	if w.omitted == 1 {
+		more = "match"
+	}
+	if w.rows == 0 {
+		_, _ = fmt.Fprintf(w.out, "_%d %s, too long to show_\n", w.omitted, more)
+		return
+	}
+	_, _ = fmt.Fprintf(w.out, "\n_…and %d more %s_\n", w.omitted, more)
+}
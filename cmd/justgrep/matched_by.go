@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// hasMatchRules checks if matches of filter are told apart by MatchedBy: it has patterns of -regex-file or -preset, or
+// user rules.
+func (args *arguments) hasMatchRules(filter justgrep.Filter) bool {
+	return args.patterns != nil ||
+		args.presetPatterns != nil ||
+		!filter.Users.IsEmpty() ||
+		!filter.DisplayNames.IsEmpty() ||
+		filter.UserID != ""
+}
+
+// recordMatch sets MatchedBy of a message which matched filter. The line of the -regex-file pattern which matched is
+// annotated as "pattern" and counted, with several presets the one which matched is annotated as "preset".
+func (args *arguments) recordMatch(filter justgrep.Filter, msg *justgrep.Message) {
+	matchedBy := &justgrep.MatchedBy{User: filter.UserRule(msg)}
+	// the text the filter matched patterns against
+	text := msg.Raw
+	if msg.Invalid == nil && len(msg.Args) != 0 {
+		text = msg.Args[len(msg.Args)-1]
+	}
+	if args.patterns != nil {
+		if index := args.patterns.Match(text); index != -1 {
+			msg.Annotate("pattern", strconv.Itoa(args.patternLines[index]))
+			args.patternCounts.add(index)
+			matchedBy.Pattern = &index
+			matchedBy.PatternName = args.patterns.Pattern(index)
+		}
+	} else if args.presetPatterns != nil {
+		if index := args.presetPatterns.Match(text); index != -1 {
+			if len(args.presets) > 1 {
+				msg.Annotate("preset", args.presets[index])
+			}
+			matchedBy.Pattern = &index
+			matchedBy.PatternName = args.presets[index]
+		}
+	}
+	msg.MatchedBy = matchedBy
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// justgrep mcp serves the Model Context Protocol over stdio: JSON-RPC 2.0 messages, one per line. Searches run
+// justgrep itself with flags built from the arguments of tool calls, so they behave exactly like the CLI.
+
+const mcpProtocolVersion = "2024-11-05"
+
+// mcpMaxResults is the most matches a search tool call returns, more don't fit in the context of an assistant.
+const mcpMaxResults = 1000
+const mcpDefaultResults = 100
+
+const (
+	jsonRpcParseError     = -32700
+	jsonRpcInvalidRequest = -32600
+	jsonRpcMethodNotFound = -32601
+	jsonRpcInvalidParams  = -32602
+)
+
+type mcpMessage struct {
+	JsonRpc string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *mcpError       `json:"error,omitempty"`
+}
+
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type mcpTool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	InputSchema interface{} `json:"inputSchema"`
+}
+
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError"`
+}
+
+// mcpSchema is a JSON schema of an object with the given properties.
+func mcpSchema(required []string, properties map[string]string) map[string]interface{} {
+	described := make(map[string]interface{}, len(properties))
+	for name, description := range properties {
+		kind := "string"
+		if name == "max_results" {
+			kind = "integer"
+		}
+		described[name] = map[string]string{"type": kind, "description": description}
+	}
+	return map[string]interface{}{"type": "object", "properties": described, "required": required}
+}
+
+var mcpTimeDescription = "RFC 3339 time like 2021-01-01T00:00:00Z, a date, or relative like 24h or 7d (ago) or now"
+
+var mcpTools = []mcpTool{
+	{
+		Name: "search",
+		Description: "Search the chat logs of Twitch channels. Returns matching messages as lines of time, channel, " +
+			"user and text.",
+		InputSchema: mcpSchema(
+			[]string{"channels", "start"},
+			map[string]string{
+				"channels": "Channel names separated with commas",
+				"regex":    "Only messages whose text matches this RE2 regular expression",
+				"literal":  "Only messages containing this text, cheaper than regex",
+				"user":     "Only messages of these users, separated with commas",
+				"start":    mcpTimeDescription,
+				"end":      mcpTimeDescription + ", defaults to now",
+				"max_results": fmt.Sprintf(
+					"How many messages to return, %d by default, %d at most",
+					mcpDefaultResults,
+					mcpMaxResults,
+				),
+				"url": "Justlog instance to search, the one justgrep mcp was started with by default",
+			},
+		),
+	},
+	{
+		Name:        "list_channels",
+		Description: "List the channels a justlog instance logs.",
+		InputSchema: mcpSchema(
+			nil,
+			map[string]string{"url": "Justlog instance, the one justgrep mcp was started with by default"},
+		),
+	},
+	{
+		Name: "user_report",
+		Description: "Summarize the activity of a user in channels. report is sessions (when they were chatting) " +
+			"or moderation (their timeouts and bans with the messages before them). Returns JSON lines.",
+		InputSchema: mcpSchema(
+			[]string{"user", "channels", "report", "start"},
+			map[string]string{
+				"user":     "Login of the user",
+				"channels": "Channel names separated with commas",
+				"report":   "sessions or moderation",
+				"start":    mcpTimeDescription,
+				"end":      mcpTimeDescription + ", defaults to now",
+				"url":      "Justlog instance to search, the one justgrep mcp was started with by default",
+			},
+		),
+	},
+}
+
+type mcpServer struct {
+	selfSearch
+
+	lock sync.Mutex
+	out  *json.Encoder
+	// running has the cancel functions of tool calls by request id
+	running map[string]context.CancelFunc
+	calls   sync.WaitGroup
+}
+
+func (s *mcpServer) send(msg mcpMessage) {
+	msg.JsonRpc = "2.0"
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_ = s.out.Encode(msg)
+}
+
+func (s *mcpServer) reply(id json.RawMessage, result interface{}) {
+	s.send(mcpMessage{ID: id, Result: result})
+}
+
+func (s *mcpServer) fail(id json.RawMessage, code int, message string) {
+	s.send(mcpMessage{ID: id, Error: &mcpError{Code: code, Message: message}})
+}
+
+// handle answers a single message. Tool calls run in their own goroutine, so they can be cancelled.
+func (s *mcpServer) handle(msg mcpMessage) {
+	switch msg.Method {
+	case "initialize":
+		s.reply(
+			msg.ID,
+			map[string]interface{}{
+				"protocolVersion": mcpProtocolVersion,
+				"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+				"serverInfo":      map[string]string{"name": "justgrep", "version": gitCommit},
+			},
+		)
+	case "ping":
+		s.reply(msg.ID, map[string]interface{}{})
+	case "tools/list":
+		s.reply(msg.ID, map[string]interface{}{"tools": mcpTools})
+	case "tools/call":
+		params := struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+			Meta      struct {
+				ProgressToken interface{} `json:"progressToken"`
+			} `json:"_meta"`
+		}{}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			s.fail(msg.ID, jsonRpcInvalidParams, err.Error())
+			return
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		s.lock.Lock()
+		s.running[string(msg.ID)] = cancel
+		s.lock.Unlock()
+		s.calls.Add(1)
+		go func() {
+			defer s.calls.Done()
+			defer func() {
+				s.lock.Lock()
+				delete(s.running, string(msg.ID))
+				s.lock.Unlock()
+				cancel()
+			}()
+			result, err := s.call(ctx, params.Name, mcpArguments(params.Arguments), params.Meta.ProgressToken)
+			if err != nil {
+				s.fail(msg.ID, jsonRpcInvalidParams, err.Error())
+				return
+			}
+			if ctx.Err() == nil {
+				// cancelled requests aren't answered
+				s.reply(msg.ID, result)
+			}
+		}()
+	case "notifications/cancelled":
+		params := struct {
+			RequestID json.RawMessage `json:"requestId"`
+		}{}
+		_ = json.Unmarshal(msg.Params, &params)
+		s.lock.Lock()
+		cancel := s.running[string(params.RequestID)]
+		s.lock.Unlock()
+		if cancel != nil {
+			cancel()
+		}
+	default:
+		if len(msg.ID) == 0 {
+			// other notifications, like notifications/initialized, don't need anything
+			return
+		}
+		s.fail(msg.ID, jsonRpcMethodNotFound, fmt.Sprintf("unknown method %q", msg.Method))
+	}
+}
+
+// mcpArguments converts the arguments of a tool call to strings, like flags are.
+func mcpArguments(raw map[string]interface{}) map[string]string {
+	arguments := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch value := value.(type) {
+		case string:
+			arguments[name] = value
+		case float64:
+			arguments[name] = strconv.FormatFloat(value, 'f', -1, 64)
+		case nil:
+		default:
+			arguments[name] = fmt.Sprint(value)
+		}
+	}
+	return arguments
+}
+
+func (s *mcpServer) call(
+	ctx context.Context,
+	name string,
+	arguments map[string]string,
+	progressToken interface{},
+) (*mcpToolResult, error) {
+	switch name {
+	case "search":
+		flags, err := searchArgs(arguments)
+		if err != nil {
+			return nil, err
+		}
+		limit := mcpDefaultResults
+		if arguments["max_results"] != "" {
+			limit, err = strconv.Atoi(arguments["max_results"])
+			if err != nil || limit < 1 || limit > mcpMaxResults {
+				return nil, errors.New(fmt.Sprintf("max_results needs to be between 1 and %d", mcpMaxResults))
+			}
+		}
+		flags = append(flags, "-max="+strconv.Itoa(limit), "-format=json")
+		flags = append(flags, s.instanceArgs(arguments["url"])...)
+		return s.runTool(
+			ctx, flags, func(line string) string {
+				return summarizeMatch(line).String()
+			}, progressToken,
+		)
+	case "user_report":
+		if arguments["report"] != reportSessions && arguments["report"] != reportModeration {
+			return nil, errors.New("report needs to be sessions or moderation")
+		}
+		if arguments["user"] == "" {
+			return nil, errors.New("user is required")
+		}
+		flags, err := searchArgs(arguments)
+		if err != nil {
+			return nil, err
+		}
+		flags = append(flags, "-report="+arguments["report"], "-format=json")
+		return s.runTool(ctx, append(flags, s.instanceArgs(arguments["url"])...), nil, progressToken)
+	case "list_channels":
+		normalized, err := justgrep.NormalizeInstanceURL(s.instance(arguments["url"]))
+		if err != nil {
+			return nil, err
+		}
+		channels, err := justgrep.GetChannelsFromJustLog(ctx, &httpClient, normalized)
+		if err != nil {
+			return &mcpToolResult{Content: []mcpContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+		}
+		return &mcpToolResult{Content: []mcpContent{{Type: "text", Text: strings.Join(channels, "\n")}}}, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown tool %q", name))
+	}
+}
+
+// runTool runs justgrep with flags and returns what it printed, every line passed through format if it's set. If
+// the client asked for progress, every printed line is reported as it's found.
+func (s *mcpServer) runTool(
+	ctx context.Context,
+	flags []string,
+	format func(line string) string,
+	progressToken interface{},
+) (*mcpToolResult, error) {
+	var lines []string
+	err := s.run(
+		ctx, flags, func(line string) {
+			if format != nil {
+				line = format(line)
+			}
+			lines = append(lines, line)
+			if progressToken == nil {
+				return
+			}
+			s.send(
+				mcpMessage{
+					Method: "notifications/progress",
+					Params: mustMarshal(
+						map[string]interface{}{"progressToken": progressToken, "progress": len(lines), "message": line},
+					),
+				},
+			)
+		},
+	)
+	if err != nil {
+		return &mcpToolResult{Content: []mcpContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+	}
+	text := strings.Join(lines, "\n")
+	if len(lines) == 0 {
+		text = "Nothing found."
+	}
+	return &mcpToolResult{Content: []mcpContent{{Type: "text", Text: text}}}, nil
+}
+
+func mustMarshal(value interface{}) json.RawMessage {
+	output, err := json.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	return output
+}
+
+// serve reads requests from input until it ends and writes responses to output. It returns the exit code.
+func (s *mcpServer) serve(input io.Reader, output io.Writer) int {
+	s.out = json.NewEncoder(output)
+	s.running = make(map[string]context.CancelFunc)
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var msg mcpMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			s.fail(json.RawMessage("null"), jsonRpcParseError, err.Error())
+			continue
+		}
+		if msg.JsonRpc != "2.0" || msg.Method == "" {
+			s.fail(msg.ID, jsonRpcInvalidRequest, "expected a JSON-RPC 2.0 request")
+			continue
+		}
+		s.handle(msg)
+	}
+	// clients close stdin once they're done, tool calls which are still running are answered before exiting
+	s.calls.Wait()
+	if err := scanner.Err(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to read requests: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runMcp is justgrep mcp [-url URL] [-no-env]. It returns the exit code.
+func runMcp(cliArgs []string) int {
+	flags := flag.NewFlagSet("justgrep mcp", flag.ContinueOnError)
+	server := &mcpServer{}
+	server.register(flags)
+	if err := flags.Parse(cliArgs); err != nil {
+		return 2
+	}
+	if err := server.findExecutable(); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return server.serve(os.Stdin, os.Stdout)
+}
@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package main
+
+import "os"
+
+// mmap isn't supported here, files are read with bufio.Scanner instead.
+func mmap(file *os.File, size int) ([]byte, error) {
+	return nil, errNotMappable
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const formatModlogJson = "modlog-json"
+
+// modlogRecord is a moderation event written by -format modlog-json.
+type modlogRecord struct {
+	Type            string    `json:"type"`
+	Time            time.Time `json:"time"`
+	Channel         string    `json:"channel"`
+	Action          string    `json:"action"`
+	Target          string    `json:"target,omitempty"`
+	TargetID        string    `json:"target_id,omitempty"`
+	DurationSeconds int64     `json:"duration_seconds,omitempty"`
+	Moderator       string    `json:"moderator,omitempty"`
+	MessageID       string    `json:"message_id,omitempty"`
+	Text            string    `json:"text,omitempty"`
+	// Preceding is the last message the target sent before the event
+	Preceding interface{} `json:"preceding,omitempty"`
+}
+
+// modlogWriter writes moderation events for -format modlog-json. The filter tells it about every message, so it knows
+// the last message of every user, even the ones which didn't match. Matches are written by another goroutine than the
+// filter's, so the message preceding an event is looked up when the event is filtered.
+type modlogWriter struct {
+	lock sync.Mutex
+	// last has the newest message of every user by channel and login
+	last map[string]*justgrep.Message
+	// preceding has the message before every event which wasn't written yet
+	preceding map[*justgrep.Message]*justgrep.Message
+}
+
+func newModlogWriter() *modlogWriter {
+	return &modlogWriter{
+		last:      make(map[string]*justgrep.Message),
+		preceding: make(map[*justgrep.Message]*justgrep.Message),
+	}
+}
+
+func modlogKey(channel string, login string) string {
+	return channel + " " + login
+}
+
+// seen receives a message which isn't a moderation event.
+func (w *modlogWriter) seen(msg *justgrep.Message) {
+	if msg.User == "" || msg.Action == "CLEARCHAT" || msg.Action == "CLEARMSG" {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.last[modlogKey(msg.Channel(), msg.User)] = msg
+}
+
+// matched receives a match from the filter.
+func (w *modlogWriter) matched(msg *justgrep.Message) {
+	event, ok := justgrep.NewModerationEvent(msg)
+	if !ok {
+		w.seen(msg)
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	// log files are searched from the newest one, the last message can be from a newer file
+	last := w.last[modlogKey(event.Channel, event.Target)]
+	if event.Target != "" && last != nil && !last.Timestamp.After(event.Time) {
+		w.preceding[msg] = last
+	}
+}
+
+// reject receives a message which didn't match.
+func (w *modlogWriter) reject(msg *justgrep.Message) {
+	w.seen(msg)
+}
+
+// write writes msg if it's a moderation event, other matches are skipped.
+func (w *modlogWriter) write(output *matchOutput, msg *justgrep.Message) {
+	event, ok := justgrep.NewModerationEvent(msg)
+	if !ok {
+		return
+	}
+	w.lock.Lock()
+	preceding := w.preceding[msg]
+	delete(w.preceding, msg)
+	w.lock.Unlock()
+
+	record := modlogRecord{
+		Type:            "moderation",
+		Time:            event.Time,
+		Channel:         event.Channel,
+		Action:          event.Action,
+		Target:          event.Target,
+		TargetID:        event.TargetID,
+		DurationSeconds: int64(event.Duration / time.Second),
+		Moderator:       event.Moderator,
+		MessageID:       event.MessageID,
+		Text:            event.Text,
+	}
+	if preceding != nil {
+		record.Preceding, _ = justgrep.WithSchema(preceding, output.schema)
+	}
+	_ = output.json.Encode(record)
+}
+
+// validateModlogFlags checks flags which don't work with -format modlog-json, it only writes moderation events.
+func (args *arguments) validateModlogFlags() (valid bool) {
+	valid = true
+	if *args.top != "" || *args.report != "" || *args.rank || *args.alertRateRaw != "" || *args.groupBy != "" {
+		_, _ = fmt.Fprintln(
+			os.Stderr,
+			"-format modlog-json writes moderation events, it can't be used with -top, -report, -rank, -alert-rate "+
+				"or -group-by.",
+		)
+		valid = false
+	}
+	if *args.justUsers || *args.anyPerChannel || *args.aroundWindow != 0 {
+		_, _ = fmt.Fprintln(
+			os.Stderr,
+			"-format modlog-json can't be used with -just-users, -any-per-channel or -around.",
+		)
+		valid = false
+	}
+	if *args.shards > 1 {
+		_, _ = fmt.Fprintln(os.Stderr, "-format modlog-json can't be used with -shards.")
+		valid = false
+	}
+	args.modlog = newModlogWriter()
+	return
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// packLines parses raw IRC lines from reader and writes them to writer as packed messages, which can be searched
+// with -stdin-format packed without parsing them again. Lines which aren't valid IRC messages are skipped.
+func packLines(reader io.Reader, writer io.Writer) (messages int, invalid int, err error) {
+	packed := justgrep.NewPackedWriter(writer)
+	scanner := newLineScanner(reader)
+	for scanner.Scan() {
+		line, err := justgrep.DecodeLine(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var msg *justgrep.Message
+		if err == nil {
+			msg, err = justgrep.NewMessage(line)
+		}
+		if err != nil {
+			invalid++
+			continue
+		}
+		err = packed.Write(msg)
+		if err != nil {
+			return messages, invalid, err
+		}
+		messages++
+	}
+	if err := scanner.Err(); err != nil {
+		return messages, invalid, err
+	}
+	return messages, invalid, packed.Flush()
+}
+
+// runPack is justgrep pack [FILE], it packs the lines of FILE or stdin to stdout. It returns the exit code.
+func runPack(cliArgs []string) int {
+	if len(cliArgs) > 1 {
+		_, _ = fmt.Fprintln(os.Stderr, "Usage: justgrep pack [FILE] > PACKED_FILE")
+		return 2
+	}
+	input := os.Stdin
+	if len(cliArgs) == 1 && cliArgs[0] != "-" {
+		file, err := os.Open(cliArgs[0])
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to open %s: %s\n", cliArgs[0], err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+	messages, invalid, err := packLines(input, os.Stdout)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to pack messages: %s\n", err)
+		return 1
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Packed %d messages, skipped %d invalid lines\n", messages, invalid)
+	return 0
+}
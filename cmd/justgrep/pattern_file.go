@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// validateRegexFileFlags reads the patterns of -regex-file.
+func (args *arguments) validateRegexFileFlags() (valid bool) {
+	if *args.regexFile == "" {
+		return true
+	}
+	if *args.messageRegex != "" {
+		_, _ = fmt.Fprintln(os.Stderr, "-regex-file can't be used with -regex or -preset, add them to the file instead.")
+		return false
+	}
+	file, err := os.Open(*args.regexFile)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "-regex-file: %s\n", err)
+		return false
+	}
+	defer file.Close()
+	patterns, lines, err := justgrep.ReadPatterns(file)
+	if err == nil {
+		args.patterns, err = justgrep.NewPatternSet(patterns)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "-regex-file: %s\n", err)
+		return false
+	}
+	args.patternLines = lines
+	args.patternCounts = &patternHits{counts: make([]int, len(patterns))}
+	return true
+}
+
+// patternHits counts the matches of every pattern of -regex-file, by the pattern which matched first.
+type patternHits struct {
+	lock   sync.Mutex
+	counts []int
+}
+
+// patternHit is the number of matches of a pattern in the summary.
+type patternHit struct {
+	Line    int    `json:"line"`
+	Pattern string `json:"pattern"`
+	Count   int    `json:"count"`
+}
+
+func (h *patternHits) add(index int) {
+	h.lock.Lock()
+	h.counts[index]++
+	h.lock.Unlock()
+}
+
+// patternHits returns the patterns which matched, the most matched first.
+func (args *arguments) patternHits() []patternHit {
+	if args.patterns == nil {
+		return nil
+	}
+	args.patternCounts.lock.Lock()
+	defer args.patternCounts.lock.Unlock()
+	var hits []patternHit
+	for index, count := range args.patternCounts.counts {
+		if count != 0 {
+			hits = append(
+				hits,
+				patternHit{Line: args.patternLines[index], Pattern: args.patterns.Pattern(index), Count: count},
+			)
+		}
+	}
+	sort.SliceStable(
+		hits, func(i, j int) bool {
+			return hits[i].Count > hits[j].Count
+		},
+	)
+	return hits
+}
+
+// printPatternHits shows how often the patterns of -regex-file matched.
+func printPatternHits(hits []patternHit) {
+	if len(hits) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintln(os.Stderr, "Matches by pattern:")
+	for _, hit := range hits {
+		_, _ = fmt.Fprintf(os.Stderr, " - line %d %s => %d\n", hit.Line, hit.Pattern, hit.Count)
+	}
+}
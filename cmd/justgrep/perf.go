@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// perfPreset has values of performance related flags set together by -perf-preset. Empty values are left alone.
+type perfPreset struct {
+	// shards is only used by searches -shards works with
+	shards      int
+	memoryCache string
+	maxMemory   string
+	// lineBuffer is the initial size of the buffer lines of stdin and -refine results are read with
+	lineBuffer int
+	// gcPercent is used unless GOGC is set in the environment
+	gcPercent int
+}
+
+var perfPresets = map[string]perfPreset{
+	// more memory for fewer pauses and downloads
+	"throughput": {
+		shards:      4,
+		memoryCache: "256MB",
+		lineBuffer:  1024 * 1024,
+		gcPercent:   400,
+	},
+	// held matches go to disk early and the heap is collected often
+	"low-memory": {
+		shards:     1,
+		maxMemory:  "32MB",
+		lineBuffer: 4 * 1024,
+		gcPercent:  50,
+	},
+}
+
+// lineBufferSize is the initial size of the buffer used by newLineScanner.
+var lineBufferSize = 64 * 1024
+
+// givenFlags returns the names of flags which were passed on the command line.
+func givenFlags() map[string]bool {
+	given := make(map[string]bool)
+	flag.CommandLine.Visit(
+		func(f *flag.Flag) {
+			given[f.Name] = true
+		},
+	)
+	return given
+}
+
+// applyPerfPreset sets the flags of -perf-preset which weren't passed explicitly, then applies -gomaxprocs.
+func (args *arguments) applyPerfPreset() error {
+	if *args.gomaxprocs < 0 {
+		return errors.New("-gomaxprocs can't be negative")
+	}
+	if *args.gomaxprocs != 0 {
+		runtime.GOMAXPROCS(*args.gomaxprocs)
+	}
+	if *args.perfPreset == "" {
+		return nil
+	}
+	preset, ok := perfPresets[*args.perfPreset]
+	if !ok {
+		names := make([]string, 0, len(perfPresets))
+		for name := range perfPresets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return errors.New(
+			fmt.Sprintf("-perf-preset: unknown preset %q, expected %s", *args.perfPreset, strings.Join(names, " or ")),
+		)
+	}
+	given := givenFlags()
+	shardable := !*args.twoPhase && *args.maxResults == 0 && !*args.anyPerChannel && *args.aroundWindow == 0 &&
+		!*args.squash
+	if !given["shards"] && shardable {
+		*args.shards = preset.shards
+	}
+	if !given["memory-cache"] && preset.memoryCache != "" {
+		*args.memoryCacheRaw = preset.memoryCache
+	}
+	if !given["max-memory"] && preset.maxMemory != "" {
+		*args.maxMemoryRaw = preset.maxMemory
+	}
+	lineBufferSize = preset.lineBuffer
+	if os.Getenv("GOGC") == "" {
+		debug.SetGCPercent(preset.gcPercent)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// presetFlag is -preset and -preset-file, which can be repeated.
+type presetFlag []string
+
+func (f *presetFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *presetFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// userPresetsFile is where presets are read from without -preset-file.
+func userPresetsFile() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "justgrep", "presets.txt")
+}
+
+// loadPresets returns the built-in presets with the ones from the user's pattern files, which replace built-in
+// presets of the same name.
+func (args *arguments) loadPresets() (map[string]justgrep.Preset, error) {
+	presets := make(map[string]justgrep.Preset)
+	for _, preset := range justgrep.BuiltinPresets {
+		presets[preset.Name] = preset
+	}
+	files := append([]string(nil), args.presetFiles...)
+	if userFile := userPresetsFile(); userFile != "" {
+		if _, err := os.Stat(userFile); err == nil {
+			files = append([]string{userFile}, files...)
+		}
+	}
+	for _, path := range files {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		filePresets, err := justgrep.ReadPresets(file)
+		_ = file.Close()
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: %s", path, err))
+		}
+		for _, preset := range filePresets {
+			presets[preset.Name] = preset
+		}
+	}
+	return presets, nil
+}
+
+// presetRegex returns the regex of a -preset value, NAME or NAME@FILE for word lists.
+func presetRegex(presets map[string]justgrep.Preset, value string) (string, error) {
+	name, path := value, ""
+	if at := strings.Index(value, "@"); at != -1 {
+		name, path = value[:at], value[at+1:]
+	}
+	preset, ok := presets[name]
+	if !ok {
+		return "", errors.New(fmt.Sprintf("unknown preset %q, see -preset list", name))
+	}
+	if !preset.WordList {
+		if path != "" {
+			return "", errors.New(fmt.Sprintf("%s isn't a word list, it doesn't take a file", name))
+		}
+		return preset.Regex, nil
+	}
+	if path == "" {
+		return "", errors.New(fmt.Sprintf("%s needs a word list, as %s@FILE", name, name))
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	words, err := justgrep.ReadStopwords(file)
+	if err != nil {
+		return "", err
+	}
+	regex, err := justgrep.WordListRegex(words, preset.Substitutions)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("%s: %s", path, err))
+	}
+	return regex, nil
+}
+
+// printPresets is -preset list.
+func printPresets(presets map[string]justgrep.Preset) {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		preset := presets[name]
+		if preset.WordList {
+			name += "@FILE"
+		}
+		fmt.Printf("%-22s %s\n", name, preset.Description)
+	}
+}
+
+// validatePresetFlags turns -preset into -regex, matching messages which match any of the presets.
+func (args *arguments) validatePresetFlags() (valid bool) {
+	if len(args.presets) == 0 {
+		if len(args.presetFiles) != 0 {
+			_, _ = fmt.Fprintln(os.Stderr, "-preset-file needs -preset.")
+			return false
+		}
+		return true
+	}
+	presets, err := args.loadPresets()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to read presets: %s\n", err)
+		return false
+	}
+	if len(args.presets) == 1 && args.presets[0] == "list" {
+		printPresets(presets)
+		os.Exit(0)
+	}
+	if *args.messageRegex != "" {
+		_, _ = fmt.Fprintln(os.Stderr, "-preset can't be used with -regex, add the regex to a -preset-file instead.")
+		return false
+	}
+	valid = true
+	var regexes []string
+	for _, value := range args.presets {
+		regex, err := presetRegex(presets, value)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-preset: %s\n", err)
+			valid = false
+			continue
+		}
+		regexes = append(regexes, "(?:"+regex+")")
+	}
+	if !valid {
+		return
+	}
+	args.presetPatterns, err = justgrep.NewPatternSet(regexes)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "-preset: %s\n", err)
+		return false
+	}
+	*args.messageRegex = strings.Join(regexes, "|")
+	return
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// profiling collects the profiles asked for with -cpuprofile and -memprofile and serves -pprof-addr.
+type profiling struct {
+	cpuFile *os.File
+	memPath string
+}
+
+// startProfiling starts the CPU profile and the pprof HTTP server. It returns nil if no profiles were asked for.
+func startProfiling(args *arguments) (*profiling, error) {
+	if *args.pprofAddr == "" && *args.cpuProfile == "" && *args.memProfile == "" {
+		return nil, nil
+	}
+	if *args.pprofAddr != "" {
+		listener, err := net.Listen("tcp", *args.pprofAddr)
+		if err != nil {
+			return nil, err
+		}
+		if *args.verbose {
+			_, _ = fmt.Fprintf(os.Stderr, "Serving pprof at http://%s/debug/pprof/\n", listener.Addr())
+		}
+		// net/http/pprof registers its handlers on http.DefaultServeMux
+		go func() {
+			_ = http.Serve(listener, nil)
+		}()
+	}
+	p := &profiling{memPath: *args.memProfile}
+	if *args.cpuProfile != "" {
+		file, err := os.Create(*args.cpuProfile)
+		if err != nil {
+			return nil, err
+		}
+		err = pprof.StartCPUProfile(file)
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		p.cpuFile = file
+	}
+	return p, nil
+}
+
+// finish stops the CPU profile and writes the heap profile. It does nothing on a nil profiling.
+func (p *profiling) finish() {
+	if p == nil {
+		return
+	}
+	if p.cpuFile != nil {
+		pprof.StopCPUProfile()
+		err := p.cpuFile.Close()
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to write the CPU profile: %s\n", err)
+		}
+		p.cpuFile = nil
+	}
+	if p.memPath != "" {
+		file, err := os.Create(p.memPath)
+		if err == nil {
+			// up to date statistics of what's still in use
+			runtime.GC()
+			err = pprof.WriteHeapProfile(file)
+			closeErr := file.Close()
+			if err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to write the memory profile: %s\n", err)
+		}
+		p.memPath = ""
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// terminalWidth returns how many columns the terminal f is connected to has. If it can't be found out, COLUMNS is
+// used, or 80.
+func terminalWidth(f *os.File) int {
+	if width := ioctlWidth(f); width > 0 {
+		return width
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return 80
+}
+
+// progressDisplay shows -v progress. If it's drawn in place, every running search has a line which is updated, other
+// messages are printed above these lines. Otherwise every update is printed on its own line. It's safe for concurrent
+// use, a nil *progressDisplay prints messages to stderr.
+type progressDisplay struct {
+	lock    sync.Mutex
+	out     *os.File
+	inPlace bool
+
+	// bars has the text of every line, nil for lines which were finished
+	bars []*string
+	// drawn is how many lines were drawn last time, the cursor is below them
+	drawn int
+}
+
+// newProgressDisplay draws progress in place if stderr is a terminal which doesn't show matches at the same time and
+// understands escape sequences.
+func newProgressDisplay() *progressDisplay {
+	inPlace := isTerminal(os.Stderr) && !isTerminal(os.Stdout) && enableVirtualTerminal(os.Stderr)
+	return &progressDisplay{out: os.Stderr, inPlace: inPlace}
+}
+
+// compact returns true if lines have to fit the width of a terminal.
+func (d *progressDisplay) compact() bool {
+	return d != nil && d.inPlace
+}
+
+// bar reserves a line for a search and returns its index.
+func (d *progressDisplay) bar() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.bars = append(d.bars, nil)
+	return len(d.bars) - 1
+}
+
+// update sets the text of a line.
+func (d *progressDisplay) update(bar int, text string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if !d.inPlace {
+		_, _ = fmt.Fprintln(d.out, text)
+		return
+	}
+	d.bars[bar] = &text
+	d.redraw("")
+}
+
+// done removes the line of a finished search.
+func (d *progressDisplay) done(bar int) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.bars[bar] = nil
+	if d.inPlace {
+		d.redraw("")
+	}
+}
+
+// printf prints a message, above the progress lines if they're drawn in place.
+func (d *progressDisplay) printf(format string, a ...interface{}) {
+	if d == nil {
+		_, _ = fmt.Fprintf(os.Stderr, format, a...)
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if !d.inPlace {
+		_, _ = fmt.Fprintf(d.out, format, a...)
+		return
+	}
+	d.redraw(fmt.Sprintf(format, a...))
+}
+
+// redraw clears the lines drawn last time, prints message and draws the lines again. The lock must be held.
+func (d *progressDisplay) redraw(message string) {
+	builder := strings.Builder{}
+	if d.drawn != 0 {
+		// back to the first line, clear everything below
+		builder.WriteString("\r\x1b[" + strconv.Itoa(d.drawn) + "A")
+	}
+	builder.WriteString("\x1b[J")
+	builder.WriteString(message)
+	// longer lines would wrap, which would break going back up
+	width := terminalWidth(d.out) - 1
+	d.drawn = 0
+	for _, text := range d.bars {
+		if text == nil {
+			continue
+		}
+		line := *text
+		if len(line) > width {
+			line = line[:width]
+		}
+		builder.WriteString(line + "\n")
+		d.drawn++
+	}
+	_, _ = fmt.Fprint(d.out, builder.String())
+}
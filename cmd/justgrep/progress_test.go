@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestChannelFinishedCountsAddUp(t *testing.T) {
+	server := newTestServer(t, 4)
+	for _, extra := range [][]string{
+		// the filter stops the download of the first log file early
+		{"-any-per-channel"},
+		{"-shards", "2"},
+	} {
+		cliArgs := append(testSearchArgs(server, "pajlada,forsen", 4, "-regex", "pajaS", "-progress-json"), extra...)
+		result := runJustgrep(t, "", cliArgs...)
+		if result.code != 0 {
+			t.Fatalf("%s: exit code %d: %s", extra, result.code, result.stderr)
+		}
+		finished := 0
+		countLines := 0
+		total := -1
+		for _, line := range strings.Split(result.stderr, "\n") {
+			var event channelFinishedReport
+			if json.Unmarshal([]byte(line), &event) != nil || event.Type != progressChannelFinished {
+				continue
+			}
+			finished++
+			countLines += event.CountLines
+			total = event.Progress.CountLines
+		}
+		if finished != 2 {
+			t.Fatalf("%s: expected 2 channelFinished events, got %d: %s", extra, finished, result.stderr)
+		}
+		if countLines != total {
+			t.Errorf("%s: lines of the channels add up to %d, but %d were searched", extra, countLines, total)
+		}
+	}
+}
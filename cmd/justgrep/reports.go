@@ -0,0 +1,650 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const reportCoOccurrence = "co-occurrence"
+const reportGaps = "gaps"
+const reportModeration = "moderation"
+const reportSessions = "sessions"
+
+// report replaces printing matches with a summary of them, printed once the search is done.
+type report interface {
+	observe(msg *justgrep.Message)
+	write(output *matchOutput)
+}
+
+// newReport creates the report selected with -report, nil is returned if there isn't one.
+func newReport(args *arguments) report {
+	if *args.format == formatLinks {
+		return &linksReport{counts: make(map[string]uint64)}
+	}
+	if *args.format == formatHtml {
+		return newHtmlReport(args)
+	}
+	if *args.top != "" {
+		return newTopReport(*args.top, *args.topN, *args.approx, args.tokenizer)
+	}
+	if *args.rank {
+		return newRankReport(args)
+	}
+	switch *args.report {
+	case reportCoOccurrence:
+		return &coOccurrenceReport{
+			userID:   args.userID,
+			user:     args.singleLogin(),
+			withUser: strings.ToLower(*args.withUser),
+			window:   *args.window,
+			activity: make(map[string]*[2][]time.Time),
+		}
+	case reportGaps:
+		report := &gapsReport{
+			start:      args.startTime,
+			end:        args.endTime,
+			threshold:  *args.gap,
+			timestamps: make(map[string][]time.Time),
+		}
+		if *args.end == "" && (*args.refine != "" || *args.stdinFormat != "") {
+			// offline searches end at the newest match unless -end is given
+			report.end = time.Time{}
+		}
+		if *args.channel != "" {
+			// channels without any messages are one big gap
+			for _, channel := range args.channels {
+				report.timestamps[channel] = nil
+			}
+		}
+		return report
+	case reportSessions:
+		return &sessionsReport{gap: *args.gap, timestamps: make(map[string][]time.Time)}
+	case reportEmotes:
+		return newEmotesReport(*args.topN)
+	case reportModeration:
+		return &moderationReport{
+			userID:     args.userID,
+			user:       args.singleLogin(),
+			window:     *args.window,
+			clearChats: make(map[string][]*justgrep.Message),
+			messages:   make(map[string][]*justgrep.Message),
+		}
+	default:
+		return nil
+	}
+}
+
+// validateReportFlags checks -report and the flags used by reports.
+func (args *arguments) validateReportFlags() (valid bool) {
+	valid = true
+	switch *args.report {
+	case "":
+	case reportCoOccurrence:
+		if (args.singleLogin() == "" && *args.userIDRaw == "") || *args.withUser == "" {
+			_, _ = fmt.Fprintln(os.Stderr, "-report co-occurrence needs a -user or -userid and a -with-user.")
+			valid = false
+		}
+		if *args.window <= 0 {
+			_, _ = fmt.Fprintln(os.Stderr, "-window needs to be positive.")
+			valid = false
+		}
+	case reportGaps:
+		if *args.gap <= 0 {
+			_, _ = fmt.Fprintln(os.Stderr, "-gap needs to be positive.")
+			valid = false
+		}
+	case reportSessions:
+		if args.singleLogin() == "" && *args.userIDRaw == "" {
+			_, _ = fmt.Fprintln(os.Stderr, "-report sessions needs a -user or -userid.")
+			valid = false
+		}
+		if *args.gap <= 0 {
+			_, _ = fmt.Fprintln(os.Stderr, "-gap needs to be positive.")
+			valid = false
+		}
+	case reportEmotes:
+	case reportModeration:
+		if args.singleLogin() == "" && *args.userIDRaw == "" {
+			_, _ = fmt.Fprintln(os.Stderr, "-report moderation needs a -user or -userid.")
+			valid = false
+		}
+		if *args.window <= 0 {
+			_, _ = fmt.Fprintln(os.Stderr, "-window needs to be positive.")
+			valid = false
+		}
+	default:
+		_, _ = fmt.Fprintf(
+			os.Stderr,
+			"-report: unknown report %q, expected %s, %s, %s, %s or %s\n",
+			*args.report,
+			reportCoOccurrence,
+			reportEmotes,
+			reportGaps,
+			reportModeration,
+			reportSessions,
+		)
+		valid = false
+	}
+	switch *args.top {
+	case "":
+		if *args.approx {
+			_, _ = fmt.Fprintln(os.Stderr, "-approx only makes sense with -top.")
+			valid = false
+		}
+	case topUsers, topWords, topChannels:
+		if *args.report != "" {
+			_, _ = fmt.Fprintln(os.Stderr, "Passing both -top and -report doesn't make sense.")
+			valid = false
+		}
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "-top: unknown value %q, expected users, words or channels\n", *args.top)
+		valid = false
+	}
+	if !args.processTokenizerFlags() {
+		valid = false
+	}
+	if (*args.top != "" || *args.rank || *args.report == reportEmotes) && *args.topN < 1 {
+		_, _ = fmt.Fprintln(os.Stderr, "-top-n needs to be at least 1.")
+		valid = false
+	}
+	if !args.validateRankFlags() {
+		valid = false
+	}
+	if *args.withUser != "" && *args.report != reportCoOccurrence {
+		_, _ = fmt.Fprintln(os.Stderr, "-with-user only makes sense with -report co-occurrence.")
+		valid = false
+	}
+	return
+}
+
+// processTokenizerFlags picks the tokenizer used by -top words from -tokenizer and -stopwords.
+func (args *arguments) processTokenizerFlags() (valid bool) {
+	if *args.top != topWords && (givenFlags()["tokenizer"] || *args.stopwords != "") {
+		_, _ = fmt.Fprintln(os.Stderr, "-tokenizer and -stopwords only make sense with -top words.")
+		return false
+	}
+	tokenizer, ok := justgrep.Tokenizers[*args.tokenizerName]
+	if !ok {
+		_, _ = fmt.Fprintf(
+			os.Stderr,
+			"-tokenizer: unknown value %q, expected whitespace, words, emote-aware or no-emotes\n",
+			*args.tokenizerName,
+		)
+		return false
+	}
+	switch *args.stopwords {
+	case "":
+	case "english":
+		tokenizer = justgrep.NewStopwordTokenizer(tokenizer, justgrep.EnglishStopwords)
+	default:
+		file, err := os.Open(*args.stopwords)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-stopwords: %s\n", err)
+			return false
+		}
+		stopwords, err := justgrep.ReadStopwords(file)
+		_ = file.Close()
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-stopwords: %s\n", err)
+			return false
+		}
+		tokenizer = justgrep.NewStopwordTokenizer(tokenizer, stopwords)
+	}
+	args.tokenizer = tokenizer
+	return true
+}
+
+// coOccurrenceReport finds when -user and -with-user were active in the same channel at the same time.
+type coOccurrenceReport struct {
+	userID   string
+	user     string
+	withUser string
+	window   time.Duration
+
+	// activity has timestamps of messages sent by both users, by channel
+	activity map[string]*[2][]time.Time
+}
+
+type coOccurrenceRecord struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	justgrep.CoOccurrence
+}
+
+func (r *coOccurrenceReport) observe(msg *justgrep.Message) {
+	user := -1
+	if (r.userID != "" && msg.Tags["user-id"] == r.userID) || msg.User == r.user {
+		user = 0
+	} else if msg.User == r.withUser {
+		user = 1
+	}
+	if user == -1 {
+		return
+	}
+	channel := msg.Channel()
+	activity, ok := r.activity[channel]
+	if !ok {
+		activity = &[2][]time.Time{}
+		r.activity[channel] = activity
+	}
+	activity[user] = append(activity[user], msg.Timestamp)
+}
+
+func (r *coOccurrenceReport) write(output *matchOutput) {
+	channels := make([]string, 0, len(r.activity))
+	for channel := range r.activity {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	user := r.user
+	if user == "" {
+		user = "user " + r.userID
+	}
+	for _, channel := range channels {
+		activity := r.activity[channel]
+		for _, found := range justgrep.FindCoOccurrences(activity[0], activity[1], r.window) {
+			if isJsonFormat(output.format) {
+				_ = output.json.Encode(coOccurrenceRecord{Type: reportCoOccurrence, Channel: channel, CoOccurrence: found})
+				continue
+			}
+			_, _ = fmt.Fprintf(
+				output.out,
+				"#%s %s - %s: %s sent %d, %s sent %d messages\n",
+				channel,
+				found.Start.Format(time.RFC3339),
+				found.End.Format(time.RFC3339),
+				user,
+				found.Messages[0],
+				r.withUser,
+				found.Messages[1],
+			)
+		}
+	}
+}
+
+// gapsReport finds periods without any matches, without filters these are periods with nothing logged.
+type gapsReport struct {
+	start     time.Time
+	end       time.Time
+	threshold time.Duration
+
+	// timestamps has timestamps of matches by channel
+	timestamps map[string][]time.Time
+}
+
+type gapRecord struct {
+	Type     string `json:"type"`
+	Channel  string `json:"channel"`
+	Duration string `json:"duration"`
+	justgrep.Gap
+}
+
+func (r *gapsReport) observe(msg *justgrep.Message) {
+	channel := msg.Channel()
+	r.timestamps[channel] = append(r.timestamps[channel], msg.Timestamp)
+}
+
+func (r *gapsReport) write(output *matchOutput) {
+	channels := make([]string, 0, len(r.timestamps))
+	for channel := range r.timestamps {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	for _, channel := range channels {
+		timestamps := r.timestamps[channel]
+		start, end := r.start, r.end
+		// offline searches don't need -start and -end, use the oldest and newest match
+		for _, timestamp := range timestamps {
+			if r.start.IsZero() && (start.IsZero() || timestamp.Before(start)) {
+				start = timestamp
+			}
+			if r.end.IsZero() && timestamp.After(end) {
+				end = timestamp
+			}
+		}
+		for _, gap := range justgrep.FindGaps(timestamps, start, end, r.threshold) {
+			if isJsonFormat(output.format) {
+				_ = output.json.Encode(
+					gapRecord{Type: reportGaps, Channel: channel, Duration: gap.Duration().String(), Gap: gap},
+				)
+				continue
+			}
+			_, _ = fmt.Fprintf(
+				output.out,
+				"#%s nothing from %s to %s (%s)\n",
+				channel,
+				gap.Start.Format(time.RFC3339),
+				gap.End.Format(time.RFC3339),
+				gap.Duration(),
+			)
+		}
+	}
+}
+
+// sessionsReport splits the matches of -user into sessions separated by -gap.
+type sessionsReport struct {
+	gap time.Duration
+
+	// timestamps has timestamps of matches by channel
+	timestamps map[string][]time.Time
+}
+
+type sessionRecord struct {
+	Type     string `json:"type"`
+	Channel  string `json:"channel"`
+	Duration string `json:"duration"`
+	justgrep.Session
+}
+
+func (r *sessionsReport) observe(msg *justgrep.Message) {
+	channel := msg.Channel()
+	r.timestamps[channel] = append(r.timestamps[channel], msg.Timestamp)
+}
+
+func (r *sessionsReport) write(output *matchOutput) {
+	channels := make([]string, 0, len(r.timestamps))
+	for channel := range r.timestamps {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	for _, channel := range channels {
+		for _, session := range justgrep.FindSessions(r.timestamps[channel], r.gap) {
+			if isJsonFormat(output.format) {
+				_ = output.json.Encode(
+					sessionRecord{
+						Type:     reportSessions,
+						Channel:  channel,
+						Duration: session.Duration().String(),
+						Session:  session,
+					},
+				)
+				continue
+			}
+			_, _ = fmt.Fprintf(
+				output.out,
+				"#%s active from %s to %s (%s), %d messages\n",
+				channel,
+				session.Start.Format(time.RFC3339),
+				session.End.Format(time.RFC3339),
+				session.Duration(),
+				session.Messages,
+			)
+		}
+	}
+}
+
+// moderationReport lists timeouts and bans of -user with the messages they sent just before them.
+type moderationReport struct {
+	userID string
+	user   string
+	window time.Duration
+
+	// clearChats has timeouts and bans of the user by channel, messages has the messages they sent
+	clearChats map[string][]*justgrep.Message
+	messages   map[string][]*justgrep.Message
+}
+
+type moderationRecord struct {
+	Type     string        `json:"type"`
+	Channel  string        `json:"channel"`
+	Time     time.Time     `json:"time"`
+	Action   string        `json:"action"`
+	Duration string        `json:"duration,omitempty"`
+	Messages []interface{} `json:"messages"`
+}
+
+// isUser returns true if login or userID belong to the user of the report.
+func (r *moderationReport) isUser(login string, userID string) bool {
+	if r.userID != "" {
+		return userID == r.userID
+	}
+	return login == r.user
+}
+
+func (r *moderationReport) observe(msg *justgrep.Message) {
+	channel := msg.Channel()
+	if login, userID, ok := justgrep.ModerationTarget(msg); ok {
+		if r.isUser(login, userID) {
+			r.clearChats[channel] = append(r.clearChats[channel], msg)
+		}
+		return
+	}
+	if r.isUser(msg.User, msg.Tags["user-id"]) {
+		r.messages[channel] = append(r.messages[channel], msg)
+	}
+}
+
+func (r *moderationReport) write(output *matchOutput) {
+	channels := make([]string, 0, len(r.clearChats))
+	for channel := range r.clearChats {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	for _, channel := range channels {
+		for _, action := range justgrep.FindModerationActions(r.clearChats[channel], r.messages[channel], r.window) {
+			kind := "ban"
+			duration := ""
+			if !action.Ban {
+				kind = "timeout"
+				duration = action.Duration.String()
+			}
+			if isJsonFormat(output.format) {
+				record := moderationRecord{
+					Type:     reportModeration,
+					Channel:  channel,
+					Time:     action.Time,
+					Action:   kind,
+					Duration: duration,
+					Messages: make([]interface{}, len(action.Messages)),
+				}
+				for i, msg := range action.Messages {
+					record.Messages[i], _ = justgrep.WithSchema(msg, output.schema)
+				}
+				_ = output.json.Encode(record)
+				continue
+			}
+			_, _ = fmt.Fprintf(
+				output.out,
+				"#%s %s %s, %d messages before\n",
+				channel,
+				action.Time.Format(time.RFC3339),
+				strings.TrimSpace(kind+" "+duration),
+				len(action.Messages),
+			)
+			for _, msg := range action.Messages {
+				_, _ = fmt.Fprintf(output.out, "    %s %s\n", msg.Timestamp.Format(time.RFC3339), msg.Text())
+			}
+		}
+	}
+}
+
+const formatLinks = "links"
+
+// linksReport counts the links in matches for -format links.
+type linksReport struct {
+	counts map[string]uint64
+}
+
+func (r *linksReport) observe(msg *justgrep.Message) {
+	for _, link := range justgrep.ExtractLinks(msg.Text()) {
+		r.counts[link.URL]++
+	}
+}
+
+func (r *linksReport) write(output *matchOutput) {
+	counts := make([]justgrep.Count, 0, len(r.counts))
+	for url, count := range r.counts {
+		counts = append(counts, justgrep.Count{Value: url, Count: count})
+	}
+	justgrep.SortCounts(counts)
+	for _, count := range counts {
+		_, _ = fmt.Fprintf(output.out, "%d %s\n", count.Count, count.Value)
+	}
+}
+
+const topUsers = "users"
+const topWords = "words"
+const topChannels = "channels"
+
+// topReport counts the most common users, words or channels of matches and how many distinct users matched. With
+// -approx, counting uses sketches which take constant memory.
+type topReport struct {
+	what      string
+	n         int
+	approx    bool
+	tokenizer justgrep.Tokenizer
+
+	counts      map[string]uint64
+	users       map[string]struct{}
+	approxTop   *justgrep.ApproximateTopK
+	approxUsers *justgrep.HyperLogLog
+}
+
+type topRecord struct {
+	Type          string           `json:"type"`
+	What          string           `json:"what"`
+	Approximate   bool             `json:"approximate"`
+	DistinctUsers uint64           `json:"distinct_users"`
+	Top           []justgrep.Count `json:"top"`
+}
+
+func newTopReport(what string, n int, approx bool, tokenizer justgrep.Tokenizer) *topReport {
+	report := &topReport{what: what, n: n, approx: approx, tokenizer: tokenizer}
+	if approx {
+		report.approxTop = justgrep.NewApproximateTopK(n)
+		report.approxUsers = justgrep.NewHyperLogLog(14)
+	} else {
+		report.counts = make(map[string]uint64)
+		report.users = make(map[string]struct{})
+	}
+	return report
+}
+
+// values returns what's counted in msg.
+func (r *topReport) values(msg *justgrep.Message) []string {
+	switch r.what {
+	case topUsers:
+		return []string{msg.User}
+	case topChannels:
+		return []string{msg.Channel()}
+	default:
+		return r.tokenizer.Tokens(msg)
+	}
+}
+
+func (r *topReport) observe(msg *justgrep.Message) {
+	for _, value := range r.values(msg) {
+		if value == "" {
+			continue
+		}
+		if r.approx {
+			r.approxTop.Add(value)
+		} else {
+			r.counts[value]++
+		}
+	}
+	if msg.User == "" {
+		return
+	}
+	if r.approx {
+		r.approxUsers.Add(msg.User)
+	} else {
+		r.users[msg.User] = struct{}{}
+	}
+}
+
+func (r *topReport) write(output *matchOutput) {
+	record := topRecord{Type: "top", What: r.what, Approximate: r.approx}
+	if r.approx {
+		record.DistinctUsers = r.approxUsers.Count()
+		record.Top = r.approxTop.Top()
+	} else {
+		record.DistinctUsers = uint64(len(r.users))
+		record.Top = make([]justgrep.Count, 0, len(r.counts))
+		for value, count := range r.counts {
+			record.Top = append(record.Top, justgrep.Count{Value: value, Count: count})
+		}
+		justgrep.SortCounts(record.Top)
+		if len(record.Top) > r.n {
+			record.Top = record.Top[:r.n]
+		}
+	}
+	if isJsonFormat(output.format) {
+		_ = output.json.Encode(record)
+		return
+	}
+	approximately := ""
+	if r.approx {
+		approximately = "about "
+	}
+	_, _ = fmt.Fprintf(output.out, "Distinct users: %s%d\n", approximately, record.DistinctUsers)
+	for i, count := range record.Top {
+		_, _ = fmt.Fprintf(output.out, "%3d. %s %s%d\n", i+1, count.Value, approximately, count.Count)
+	}
+}
+
+// rankReport prints the matches with the highest scores of -rank.
+type rankReport struct {
+	ranker *justgrep.Ranker
+	top    *justgrep.TopRanked
+}
+
+func newRankReport(args *arguments) *rankReport {
+	messageRegex := *args.messageRegex
+	if *args.refine != "" {
+		messageRegex = *args.refine
+	}
+	// the regex was compiled for the filter already
+	regex, _ := regexp.Compile(messageRegex)
+	return &rankReport{
+		ranker: &justgrep.Ranker{Regex: regex, Literal: *args.literal, FocusTime: args.focusTime},
+		top:    justgrep.NewTopRanked(*args.topN),
+	}
+}
+
+// validateRankFlags checks -rank and -focus-time.
+func (args *arguments) validateRankFlags() (valid bool) {
+	valid = true
+	if *args.focusTimeRaw != "" {
+		focusTime, err := parseTime(*args.focusTimeRaw)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-focus-time: Invalid time: %s: %s\n", *args.focusTimeRaw, err)
+			valid = false
+		}
+		args.focusTime = focusTime
+		if !*args.rank {
+			_, _ = fmt.Fprintln(os.Stderr, "-focus-time only makes sense with -rank.")
+			valid = false
+		}
+	}
+	if !*args.rank {
+		return
+	}
+	if *args.top != "" || *args.report != "" {
+		_, _ = fmt.Fprintln(os.Stderr, "-rank prints matches, it can't be used with -top or -report.")
+		valid = false
+	}
+	if *args.justUsers || *args.anyPerChannel {
+		_, _ = fmt.Fprintln(os.Stderr, "-rank prints matches, it can't be used with -just-users or -any-per-channel.")
+		valid = false
+	}
+	return
+}
+
+func (r *rankReport) observe(msg *justgrep.Message) {
+	r.top.Add(msg, r.ranker.Score(msg))
+}
+
+func (r *rankReport) write(output *matchOutput) {
+	for _, ranked := range r.top.Sorted() {
+		ranked.Message.Annotate("score", strconv.FormatFloat(ranked.Score, 'f', 2, 64))
+		output.print(ranked.Message)
+	}
+}
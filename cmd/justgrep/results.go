@@ -0,0 +1,635 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const runResultsFile = "results.txt"
+
+// defaultRunDir returns the directory where the results of the last search are kept for -refine.
+func defaultRunDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "justgrep", "last-run"), nil
+}
+
+// runWriter saves matched raw lines into a run directory. Lines are written into a temporary file which replaces
+// the previous results only once commit() is called, so an interrupted search doesn't clobber the last good run.
+type runWriter struct {
+	dir    string
+	file   *os.File
+	writer *bufio.Writer
+}
+
+func newRunWriter(dir string) (*runWriter, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(dir, runResultsFile+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &runWriter{dir: dir, file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+func (w *runWriter) writeMessage(msg *justgrep.Message) error {
+	_, err := w.writer.WriteString(msg.Raw + "\n")
+	return err
+}
+
+func (w *runWriter) commit() error {
+	err := w.writer.Flush()
+	if err != nil {
+		_ = w.file.Close()
+		return err
+	}
+	err = w.file.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(w.file.Name(), filepath.Join(w.dir, runResultsFile))
+}
+
+// abort throws away everything written so far.
+func (w *runWriter) abort() {
+	_ = w.file.Close()
+	_ = os.Remove(w.file.Name())
+}
+
+const formatRaw = "raw"
+const formatJson = "json"
+const formatJsonlEvents = "jsonl-events"
+
+// isJsonFormat returns true if format prints JSON objects.
+func isJsonFormat(format string) bool {
+	return format == formatJson || format == formatJsonlEvents
+}
+
+// matchEvent is a match in the -format jsonl-events stream.
+type matchEvent struct {
+	Type    string      `json:"type"`
+	Message interface{} `json:"message"`
+}
+
+// matchOutput receives every matched message of a search.
+type matchOutput struct {
+	format string
+	schema string
+	json   *json.Encoder
+
+	template       *template.Template
+	templateFailed bool
+
+	// out is where results are printed, buffering writes to file if it was opened with -o or to stdout
+	out        io.Writer
+	file       *os.File
+	buffered   *flushWriter
+	chatterino *chatterinoWriter
+	markdown   *markdownWriter
+
+	// annotators add annotations to messages before they're printed
+	annotators []func(msg *justgrep.Message)
+
+	names *justgrep.NameTracker
+	// channels has channels which had a match, if only their names are printed
+	channels map[string]bool
+	// justUsers is set if only names of users are printed, the filter makes sure every user matches once
+	justUsers bool
+	report    report
+	alerts    *rateAlerts
+	// groups has matches by -group-by if they're grouped, printing them is delayed until finish()
+	groups  *spillStore
+	groupBy string
+	budget  *memoryBudget
+	// around prints the messages around matches for -around
+	around *aroundContext
+	modlog *modlogWriter
+	squash *squashWriter
+	// upload holds results printed to stdout for -upload
+	upload *uploadWriter
+	// encrypt encrypts results for -encrypt-to
+	encrypt *ageWriter
+
+	runs []*runWriter
+}
+
+func (o *matchOutput) emit(msg *justgrep.Message) {
+	for _, annotate := range o.annotators {
+		annotate(msg)
+	}
+	if o.names != nil {
+		o.names.Observe(msg)
+	}
+	if o.channels != nil {
+		o.printChannel(msg)
+	} else if o.justUsers {
+		o.printUser(msg)
+	} else if o.report != nil {
+		o.report.observe(msg)
+	} else if o.alerts != nil && !o.alerts.observe(msg) {
+		// held until the search is done
+	} else if o.groups != nil {
+		o.groups.add(groupKey(o.groupBy, msg), msg)
+	} else if o.around != nil {
+		o.around.match(msg)
+	} else if o.modlog != nil {
+		o.modlog.write(o, msg)
+	} else if o.squash != nil {
+		o.squash.write(o, msg)
+	} else {
+		o.print(msg)
+	}
+	o.saveToRuns(msg)
+}
+
+// print writes msg in the selected format.
+func (o *matchOutput) print(msg *justgrep.Message) {
+	switch o.format {
+	case formatJson:
+		// schema was validated together with the flags
+		value, _ := justgrep.WithSchema(msg, o.schema)
+		_ = o.json.Encode(value)
+	case formatJsonlEvents:
+		value, _ := justgrep.WithSchema(msg, o.schema)
+		_ = o.json.Encode(matchEvent{Type: "match", Message: value})
+	case formatChatterino:
+		o.chatterino.write(msg)
+	case formatTemplate:
+		o.printTemplate(msg)
+	case formatMarkdown:
+		o.markdown.write(msg)
+	default:
+		_, _ = fmt.Fprintln(o.out, formatAnnotations(msg, "", " ")+msg.Raw)
+	}
+}
+
+type channelRecord struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+}
+
+// printChannel prints the channel of msg if it's the first match in it.
+func (o *matchOutput) printChannel(msg *justgrep.Message) {
+	channel := msg.Channel()
+	if o.channels[channel] {
+		return
+	}
+	o.channels[channel] = true
+	if isJsonFormat(o.format) {
+		_ = o.json.Encode(channelRecord{Type: "channel", Channel: channel})
+		return
+	}
+	_, _ = fmt.Fprintln(o.out, channel)
+}
+
+type userRecord struct {
+	Type   string `json:"type"`
+	User   string `json:"user"`
+	UserID string `json:"user_id,omitempty"`
+}
+
+// printUser prints the login msg was sent with. Messages without a user are skipped.
+func (o *matchOutput) printUser(msg *justgrep.Message) {
+	if msg.User == "" {
+		return
+	}
+	if isJsonFormat(o.format) {
+		_ = o.json.Encode(userRecord{Type: "user", User: msg.User, UserID: msg.Tags["user-id"]})
+		return
+	}
+	_, _ = fmt.Fprintln(o.out, msg.User)
+}
+
+func (o *matchOutput) saveToRuns(msg *justgrep.Message) {
+	for i := 0; i < len(o.runs); i++ {
+		run := o.runs[i]
+		err := run.writeMessage(msg)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to save results into %s, disabling: %s\n", run.dir, err)
+			run.abort()
+			o.runs = append(o.runs[:i], o.runs[i+1:]...)
+			i--
+		}
+	}
+}
+
+// finish saves the results of the run if saving is enabled.
+func (o *matchOutput) finish() {
+	if o.report != nil {
+		o.report.write(o)
+	}
+	if o.alerts != nil {
+		o.alerts.write(o)
+	}
+	if o.groups != nil {
+		o.printGroups()
+	}
+	if o.squash != nil {
+		o.squash.finish(o)
+	}
+	if o.markdown != nil {
+		o.markdown.finish()
+	}
+	if o.chatterino != nil {
+		err := o.chatterino.finish()
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to write Chatterino logs: %s\n", err)
+		}
+	}
+	o.closeFile()
+	for _, run := range o.runs {
+		err := run.commit()
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to save results into %s: %s\n", run.dir, err)
+		}
+	}
+	o.runs = nil
+}
+
+func (o *matchOutput) closeFile() {
+	err := o.buffered.close()
+	if o.upload != nil {
+		if uploadErr := o.upload.finish(); err == nil {
+			err = uploadErr
+		}
+	}
+	if o.encrypt != nil {
+		if encryptErr := o.encrypt.close(); err == nil {
+			err = encryptErr
+		}
+	}
+	if err != nil && o.file == nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to write results: %s\n", err)
+	}
+	if o.file == nil {
+		return
+	}
+	if closeErr := o.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to write results into %s: %s\n", o.file.Name(), err)
+	}
+	o.file = nil
+}
+
+// abort throws away the results of the run without replacing the previously saved ones.
+func (o *matchOutput) abort() {
+	if o.groups != nil {
+		o.groups.close()
+	}
+	if o.alerts != nil {
+		o.alerts.held.close()
+	}
+	if o.chatterino != nil {
+		o.chatterino.files.close()
+	}
+	o.closeFile()
+	for _, run := range o.runs {
+		run.abort()
+	}
+	o.runs = nil
+}
+
+// newMatchOutput creates a matchOutput which prints results to stdout or the -o file, and saves them into dirs. Empty
+// dirs are skipped. If a directory can't be used, results aren't saved there.
+func newMatchOutput(args *arguments, progress *justgrep.ProgressState, dirs ...string) *matchOutput {
+	output := &matchOutput{
+		format: *args.format,
+		schema: args.schema,
+		out:    os.Stdout,
+		names:  progress.NameChanges,
+		report: newReport(args),
+		budget: &memoryBudget{limit: args.maxMemory},
+	}
+	if *args.anyPerChannel {
+		output.channels = make(map[string]bool)
+	}
+	output.justUsers = *args.justUsers
+	output.template = args.template
+	if *args.alertRateRaw != "" {
+		output.alerts = newRateAlerts(args.alertRate, *args.alertOnly, output.budget)
+	}
+	if *args.groupBy != "" {
+		output.groups = newSpillStore(output.budget)
+		output.groupBy = *args.groupBy
+	}
+	if args.around != nil {
+		output.around = args.around
+		args.around.output = output
+	}
+	output.modlog = args.modlog
+	if *args.squash {
+		output.squash = &squashWriter{squasher: justgrep.NewSquasher(*args.squashWindow)}
+	}
+	if *args.format != formatChatterino && *args.outputPath != "" {
+		mode := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if *args.sinceLast {
+			mode = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		file, err := os.OpenFile(*args.outputPath, mode, 0o666)
+		if err == nil && *args.sinceLast {
+			// drops a line cut off by an interrupted run
+			err = file.Truncate(args.lastWrittenSize)
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to open output file: %s\n", err)
+			os.Exit(1)
+		}
+		output.file = file
+	}
+	lines, interval := args.flushLines, args.flushInterval
+	if *args.flushEvery == "" {
+		if output.file != nil {
+			lines, interval = defaultFlushEvery(output.file)
+		} else {
+			lines, interval = defaultFlushEvery(os.Stdout)
+		}
+	}
+	if len(args.encryptTo) != 0 {
+		destination := output.file
+		if destination == nil {
+			destination = os.Stdout
+		}
+		encrypt, err := newAgeWriter(args.agePath, args.encryptTo, destination)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to start age: %s\n", err)
+			os.Exit(1)
+		}
+		output.encrypt = encrypt
+		output.buffered = newFlushWriter(encrypt, lines, interval)
+	} else if output.file != nil {
+		output.buffered = newFlushWriter(output.file, lines, interval)
+	} else if args.uploader != nil {
+		output.upload = &uploadWriter{
+			out:       os.Stdout,
+			uploader:  args.uploader,
+			name:      uploadName(*args.format),
+			threshold: args.uploadThreshold,
+		}
+		output.buffered = newFlushWriter(output.upload, lines, interval)
+	} else {
+		output.buffered = newFlushWriter(os.Stdout, lines, interval)
+	}
+	output.out = output.buffered
+	switch {
+	case output.upload != nil:
+		flushOnInterrupt(output.buffered, output.upload.dump)
+	case output.encrypt != nil:
+		flushOnInterrupt(
+			output.buffered, func() {
+				_ = output.encrypt.close()
+			},
+		)
+	default:
+		flushOnInterrupt(output.buffered)
+	}
+	if *args.format == formatChatterino {
+		// -o is a directory for per-day log files
+		output.chatterino = newChatterinoWriter(*args.outputPath, output.out, output.budget)
+	}
+	if *args.format == formatMarkdown {
+		output.markdown = &markdownWriter{out: output.out, style: *args.markdownStyle, maxSize: *args.markdownMaxSize}
+	}
+	output.json = json.NewEncoder(output.out)
+	if *args.format == formatJsonlEvents {
+		// progress events are written together with matches
+		args.events = output.buffered
+	}
+	if args.names != nil {
+		output.annotators = append(output.annotators, args.names.annotate)
+	}
+	if *args.annotateSource {
+		output.annotators = append(output.annotators, annotateSource)
+	}
+	if len(args.incidents) != 0 {
+		output.annotators = append(
+			output.annotators, func(msg *justgrep.Message) {
+				annotateIncidents(args.incidents, msg)
+			},
+		)
+	}
+	if args.vod != nil {
+		output.annotators = append(
+			output.annotators, func(msg *justgrep.Message) {
+				annotateVOD(args.vod, msg)
+			},
+		)
+	}
+	for _, dir := range dirs {
+		if dir == "" || output.encrypt != nil {
+			// encrypted results aren't saved unencrypted for -refine
+			continue
+		}
+		run, err := newRunWriter(dir)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Not saving results into %s: %s\n", dir, err)
+			continue
+		}
+		output.runs = append(output.runs, run)
+	}
+	return output
+}
+
+// refineResults runs filter on the results saved by the previous run instead of downloading anything.
+func refineResults(
+	args *arguments,
+	dir string,
+	filter justgrep.Filter,
+	output *matchOutput,
+	progress *justgrep.ProgressState,
+) error {
+	path := filepath.Join(dir, runResultsFile)
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	source := &justgrep.MessageSource{URL: path, Endpoint: "file"}
+	err = filterLines(file, source, args.fetchOptions, justgrep.NewMessage, filter, output, progress)
+	err = skipRestOfFile(args, path, err)
+	if *args.verbose {
+		_, _ = fmt.Fprintf(os.Stderr, "Refined results from %s\n", dir)
+	}
+	return err
+}
+
+// invalidLineError is returned by filterLines for the line which ended reading because of -on-parse-error.
+type invalidLineError struct {
+	line int
+	err  error
+}
+
+func (e invalidLineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.err)
+}
+
+// skipRestOfFile handles err of reading name with filterLines. Like for downloaded log files, with -on-parse-error
+// skip-file an invalid line only ends reading that file and isn't an error.
+func skipRestOfFile(args *arguments, name string, err error) error {
+	if _, ok := err.(invalidLineError); !ok || args.parseErrorStopsSearch {
+		return err
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Skipped the rest of %s after %s\n", name, err)
+	return nil
+}
+
+// filterLines runs filter on every line from reader, decoding them with decode. Unlike searchLogs, lines don't need
+// to be sorted. Lines are read according to options, if it records sources messages get a copy of source with their
+// line number.
+func filterLines(
+	reader io.Reader,
+	source *justgrep.MessageSource,
+	options justgrep.FetchOptions,
+	decode func(line string) (*justgrep.Message, error),
+	filter justgrep.Filter,
+	output *matchOutput,
+	progress *justgrep.ProgressState,
+) error {
+	if !options.RecordSources {
+		source = nil
+	}
+	scanner := newLineScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line, err := options.DecodeLine(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var msg *justgrep.Message
+		if err == nil {
+			msg, err = decode(line)
+		}
+		progress.CountLines += 1
+		if err != nil {
+			progress.InvalidLines += 1
+			switch options.OnInvalidLine {
+			case justgrep.InvalidLineSkip:
+				continue
+			case justgrep.InvalidLineRaw:
+				msg = justgrep.NewInvalidMessage(line, err)
+			default:
+				return invalidLineError{line: progress.CountLines, err: err}
+			}
+		}
+		msg.Source = source.At(lineNumber)
+		if !filterMessage(msg, filter, output, progress) {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+// filterPacked runs filter on every message of a stream written by justgrep pack, which doesn't need to be parsed.
+func filterPacked(
+	reader io.Reader,
+	source *justgrep.MessageSource,
+	options justgrep.FetchOptions,
+	filter justgrep.Filter,
+	output *matchOutput,
+	progress *justgrep.ProgressState,
+) error {
+	if !options.RecordSources {
+		source = nil
+	}
+	packed, err := justgrep.NewPackedReader(reader)
+	if err != nil {
+		return err
+	}
+	for number := 1; ; number++ {
+		msg, err := packed.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		progress.CountLines += 1
+		msg.Source = source.At(number)
+		if !filterMessage(msg, filter, output, progress) {
+			return nil
+		}
+	}
+}
+
+// filterMessage runs filter on msg and emits it if it matched. It returns false once -max-count was reached.
+func filterMessage(
+	msg *justgrep.Message,
+	filter justgrep.Filter,
+	output *matchOutput,
+	progress *justgrep.ProgressState,
+) bool {
+	progress.CountBytes += len(msg.Raw)
+	if filter.Count != 0 && progress.TotalResults[justgrep.ResultOk] >= filter.Count {
+		progress.TotalResults[justgrep.ResultMaxCountReached] = 1
+		return false
+	}
+	result := filter.Filter(msg)
+	progress.TotalResults[result]++
+	if result == justgrep.ResultOk {
+		if filter.OnMatch != nil {
+			filter.OnMatch(msg)
+		}
+		output.emit(msg)
+	} else if filter.OnReject != nil {
+		filter.OnReject(msg, result)
+	}
+	return true
+}
+
+// annotateSource adds where msg was read from to its annotations: source_url, source_endpoint, source_date and
+// source_line, if they're known.
+func annotateSource(msg *justgrep.Message) {
+	source := msg.Source
+	if source == nil {
+		return
+	}
+	if source.URL != "" {
+		msg.Annotate("source_url", source.URL)
+	}
+	msg.Annotate("source_endpoint", source.Endpoint)
+	if !source.Date.IsZero() {
+		if source.Endpoint == "user" {
+			msg.Annotate("source_date", source.Date.Format("2006-01"))
+		} else {
+			msg.Annotate("source_date", source.Date.Format("2006-01-02"))
+		}
+	}
+	if source.Line != 0 {
+		msg.Annotate("source_line", strconv.Itoa(source.Line))
+	}
+}
+
+// formatAnnotations formats annotations of msg as "key=value" pairs separated with spaces, sorted by key. If msg has
+// annotations, the output is wrapped in prefix and suffix.
+func formatAnnotations(msg *justgrep.Message, prefix string, suffix string) string {
+	if len(msg.Annotations) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(msg.Annotations))
+	for key := range msg.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + msg.Annotations[key]
+	}
+	return prefix + strings.Join(pairs, " ") + suffix
+}
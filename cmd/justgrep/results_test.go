@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRefine(t *testing.T) {
+	server := newTestServer(t, 2)
+	dir := t.TempDir()
+	search := runJustgrep(t, dir, testSearchArgs(server, "pajlada", 2, "-regex", "pajaS")...)
+	if search.code != 0 || len(search.lines()) != 12 {
+		t.Fatalf("expected 12 matches, got %d, exit code %d: %s", len(search.lines()), search.code, search.stderr)
+	}
+
+	refined := runJustgrep(t, dir, "-no-env", "-refine", "day 1 ")
+	if refined.code != 0 || len(refined.lines()) != 6 {
+		t.Fatalf("expected 6 refined matches, got %d: %s", len(refined.lines()), refined.stderr)
+	}
+	for _, line := range refined.lines() {
+		if !strings.Contains(search.stdout, line+"\n") || !strings.Contains(line, "day 1 ") {
+			t.Errorf("unexpected refined match %q", line)
+		}
+	}
+
+	// the refined results replaced the saved ones
+	again := runJustgrep(t, dir, "-no-env", "-refine", "hour (4|20)$")
+	if again.code != 0 || len(again.lines()) != 2 {
+		t.Fatalf("expected 2 matches refining again, got %d: %s", len(again.lines()), again.stderr)
+	}
+	assert(t, "newest refined match", strings.HasSuffix(again.lines()[0], "day 1 hour 20"), true)
+
+	// other filters still apply
+	user := runJustgrep(t, dir, "-no-env", "-refine", "pajaS", "-user", "user1")
+	if user.code != 0 || len(user.lines()) != 0 {
+		t.Fatalf("expected no matches of user1, got %d: %s", len(user.lines()), user.stderr)
+	}
+
+	channel := runJustgrep(t, dir, "-no-env", "-refine", "pajaS", "-channel", "pajlada")
+	if channel.code == 0 {
+		t.Errorf("expected -refine with -channel to be rejected")
+	}
+}
+
+func TestRefineWithoutResults(t *testing.T) {
+	result := runJustgrep(t, "", "-no-env", "-refine", "pajaS")
+	if result.code != 1 || !strings.Contains(result.stderr, "Unable to refine previous results") {
+		t.Fatalf("expected refining without results to fail, got exit code %d: %s", result.code, result.stderr)
+	}
+}
+
+func TestRefineInvalidLines(t *testing.T) {
+	lines := testLogLines(1)[:3]
+	saved := lines[0] + "\n@a=b :prefix \n" + lines[1] + "\n" + lines[2] + "\n"
+	tests := []struct {
+		policy  string
+		code    int
+		matches int
+	}{
+		{"skip", 0, 3},
+		{"raw", 0, 4},
+		// the match before the invalid line was printed already
+		{"abort", 1, 1},
+		{"skip-file", 0, 1},
+		// the default
+		{"", 0, 1},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		runDir := filepath.Join(dir, "cache", "justgrep", "last-run")
+		err := os.MkdirAll(runDir, 0o700)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(runDir, runResultsFile), []byte(saved), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cliArgs := []string{"-no-env", "-refine", "."}
+		if test.policy != "" {
+			cliArgs = append(cliArgs, "-on-parse-error", test.policy)
+		}
+		result := runJustgrep(t, dir, cliArgs...)
+		assert(t, test.policy+" exit code", result.code, test.code)
+		assert(t, test.policy+" matches", len(result.lines()), test.matches)
+		if test.code != 0 {
+			// failed runs don't replace the saved results
+			content, err := ioutil.ReadFile(filepath.Join(runDir, runResultsFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert(t, test.policy+" saved results", string(content), saved)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// selfSearch runs searches for modes like justgrep mcp by running justgrep itself with flags built from structured
+// arguments, so searches behave exactly like on the command line and one failing can't take the mode down.
+type selfSearch struct {
+	executable string
+	urls       instanceFlag
+	noEnv      bool
+}
+
+// register adds the flags used by every search, -url and -no-env, to flags.
+func (s *selfSearch) register(flags *flag.FlagSet) {
+	flags.Var(&s.urls, "url", "Justlog instance searched by default, can be repeated")
+	flags.BoolVar(
+		&s.noEnv,
+		"no-env",
+		false,
+		"Disables reading environment variables like JUSTGREP_DEFAULT_INSTANCES",
+	)
+}
+
+// findExecutable finds the justgrep executable to run searches with.
+func (s *selfSearch) findExecutable() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to find the justgrep executable: %s", err))
+	}
+	s.executable = executable
+	return nil
+}
+
+// instanceArgs returns the flags selecting the justlog instance: url if it's set, otherwise the -url flags.
+func (s *selfSearch) instanceArgs(url string) []string {
+	var output []string
+	if url != "" {
+		output = append(output, "-url="+url)
+	} else {
+		for _, instance := range s.urls {
+			output = append(output, "-url="+instance)
+		}
+	}
+	if s.noEnv {
+		output = append(output, "-no-env")
+	}
+	return output
+}
+
+// instance returns url if it's set, otherwise the first configured instance.
+func (s *selfSearch) instance(url string) string {
+	if url != "" {
+		return url
+	}
+	if len(s.urls) != 0 {
+		return s.urls[0]
+	}
+	if !s.noEnv {
+		if instances := splitInstanceList(os.Getenv(EnvDefaultInstances)); len(instances) != 0 {
+			return instances[0]
+		}
+	}
+	return defaultInstance
+}
+
+// searchTime turns relative times, "now" or how long ago like 24h or 7d, into RFC 3339 times which -start and -end
+// accept. Other values are returned as they are.
+func searchTime(value string, now time.Time) string {
+	if value == "now" {
+		return now.UTC().Format(time.RFC3339)
+	}
+	if ago, err := parseChatDuration(value); err == nil {
+		return now.UTC().Add(-ago).Format(time.RFC3339)
+	}
+	return value
+}
+
+// searchArgs returns the flags of a search described by arguments: channels, start, end, regex, literal and user.
+// start and end can be relative, see searchTime.
+func searchArgs(arguments map[string]string) ([]string, error) {
+	if arguments["channels"] == "" || arguments["start"] == "" {
+		return nil, errors.New("channels and start are required")
+	}
+	now := time.Now()
+	output := []string{"-channel=" + arguments["channels"], "-start=" + searchTime(arguments["start"], now)}
+	if arguments["end"] != "" {
+		output = append(output, "-end="+searchTime(arguments["end"], now))
+	}
+	for _, name := range []string{"regex", "user"} {
+		if arguments[name] != "" {
+			output = append(output, "-"+name+"="+arguments[name])
+		}
+	}
+	if arguments["literal"] != "" {
+		output = append(output, "-F="+arguments["literal"])
+	}
+	return output, nil
+}
+
+// run runs justgrep with flags and passes every line it prints to onLine as it's printed. If the search fails, the
+// error has what justgrep printed to stderr.
+func (s *selfSearch) run(ctx context.Context, flags []string, onLine func(line string)) error {
+	command := exec.CommandContext(ctx, s.executable, flags...)
+	var stderr bytes.Buffer
+	command.Stderr = &stderr
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = command.Start()
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		onLine(scanner.Text())
+	}
+	err = command.Wait()
+	if err != nil {
+		if text := strings.TrimSpace(stderr.String()); text != "" {
+			return errors.New(text)
+		}
+		return err
+	}
+	return nil
+}
+
+// matchSummary is what's shown of a match printed with -format json.
+type matchSummary struct {
+	Timestamp time.Time `json:"timestamp"`
+	Channel   string    `json:"channel"`
+	User      string    `json:"user"`
+	Action    string    `json:"action"`
+	Text      string    `json:"text"`
+}
+
+// summarizeMatch decodes a match printed with -format json. Lines which can't be decoded are kept as the text.
+func summarizeMatch(line string) matchSummary {
+	var match matchSummary
+	if err := json.Unmarshal([]byte(line), &match); err != nil {
+		return matchSummary{Text: line}
+	}
+	if match.User == "" {
+		// messages like CLEARCHATs don't have a sender
+		match.User = match.Action
+	}
+	return match
+}
+
+// String formats the match as a line of time, channel, user and text.
+func (m matchSummary) String() string {
+	if m.Channel == "" && m.Timestamp.IsZero() {
+		return m.Text
+	}
+	return fmt.Sprintf("%s #%s %s: %s", m.Timestamp.UTC().Format(time.RFC3339), m.Channel, m.User, m.Text)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchTime(t *testing.T) {
+	now := time.Date(2021, 1, 8, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	tests := []struct {
+		value  string
+		expect string
+	}{
+		{"now", "2021-01-08T11:00:00Z"},
+		{"24h", "2021-01-07T11:00:00Z"},
+		{"90m", "2021-01-08T09:30:00Z"},
+		{"7d", "2021-01-01T11:00:00Z"},
+		{"2021-01-01", "2021-01-01"},
+		{"2021-01-01T00:00:00Z", "2021-01-01T00:00:00Z"},
+		{"earliest", "earliest"},
+		// not a valid duration, left to -start to reject
+		{"-24h", "-24h"},
+	}
+	for _, test := range tests {
+		assert(t, test.value, searchTime(test.value, now), test.expect)
+	}
+}
+
+func TestSearchArgs(t *testing.T) {
+	flags, err := searchArgs(
+		map[string]string{"channels": "pajlada", "start": "24h", "end": "now", "literal": "pajaS", "user": "user0"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flags) != 5 {
+		t.Fatalf("unexpected flags %q", flags)
+	}
+	assert(t, "channel", flags[0], "-channel=pajlada")
+	for i, expect := range []struct {
+		name string
+		ago  time.Duration
+	}{{"-start=", 24 * time.Hour}, {"-end=", 0}} {
+		value := strings.TrimPrefix(flags[i+1], expect.name)
+		parsed, err := parseTime(value)
+		if err != nil {
+			t.Errorf("%s%s isn't accepted: %s", expect.name, value, err)
+			continue
+		}
+		if ago := time.Since(parsed) - expect.ago; ago < -time.Minute || ago > time.Minute {
+			t.Errorf("expected %s to be %s ago, got %s", flags[i+1], expect.ago, value)
+		}
+	}
+	assert(t, "user", flags[3], "-user=user0")
+	assert(t, "literal", flags[4], "-F=pajaS")
+
+	_, err = searchArgs(map[string]string{"channels": "pajlada"})
+	assert(t, "missing start", err != nil, true)
+}
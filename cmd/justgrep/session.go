@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// session keeps the cookies instances set for -session, see justgrep.SessionJar. Without -session cookies are only
+// kept while justgrep runs.
+type session struct {
+	path string
+	jar  *justgrep.SessionJar
+}
+
+// newSession loads the jar in path, if there's one, and makes client use it.
+func newSession(path string, client *http.Client) (*session, error) {
+	s := &session{path: path, jar: justgrep.NewSessionJar()}
+	client.Jar = s.jar
+	if path == "" {
+		return s, nil
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	s.jar, err = justgrep.LoadSessionJar(file)
+	if err != nil {
+		return nil, err
+	}
+	client.Jar = s.jar
+	return s, nil
+}
+
+// finish saves the jar into -session. It does nothing on a nil session.
+func (s *session) finish() {
+	if s == nil || s.path == "" {
+		return
+	}
+	// cookies are credentials
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err == nil {
+		err = s.jar.Save(file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to save -session file: %s\n", err)
+	}
+}
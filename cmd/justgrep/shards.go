@@ -0,0 +1,128 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// messageSink receives matched messages of a search.
+type messageSink interface {
+	emit(msg *justgrep.Message)
+}
+
+// shardBuffer holds the matches of a shard until the matches of all newer shards were printed.
+type shardBuffer struct {
+	lock     sync.Mutex
+	cond     *sync.Cond
+	messages []*justgrep.Message
+	done     bool
+}
+
+func newShardBuffer() *shardBuffer {
+	buffer := &shardBuffer{}
+	buffer.cond = sync.NewCond(&buffer.lock)
+	return buffer
+}
+
+func (b *shardBuffer) emit(msg *justgrep.Message) {
+	b.lock.Lock()
+	b.messages = append(b.messages, msg)
+	b.lock.Unlock()
+	b.cond.Signal()
+}
+
+func (b *shardBuffer) finish() {
+	b.lock.Lock()
+	b.done = true
+	b.lock.Unlock()
+	b.cond.Signal()
+}
+
+// drain passes messages to output as they arrive until the shard is done.
+func (b *shardBuffer) drain(output messageSink) {
+	for {
+		b.lock.Lock()
+		for len(b.messages) == 0 && !b.done {
+			b.cond.Wait()
+		}
+		messages, done := b.messages, b.done
+		b.messages = nil
+		b.lock.Unlock()
+		for _, msg := range messages {
+			output.emit(msg)
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// mergeProgress adds counters of a finished shard to the progress of the whole search.
+func mergeProgress(into *justgrep.ProgressState, from *justgrep.ProgressState) {
+	into.TotalResults.Add(from.TotalResults)
+	into.CountLines += from.CountLines
+	into.InvalidLines += from.InvalidLines
+	into.FetchErrors += from.FetchErrors
+	into.ResumedDownloads += from.ResumedDownloads
+	into.CountBytes += from.CountBytes
+	into.SkippedBytes += from.SkippedBytes
+}
+
+// searchSharded splits the searched time range into -shards parts and searches them at the same time. Matches are
+// printed in the same order as without sharding: matches of the newest part are printed while it's searched, matches
+// of older parts are held until all newer parts are done.
+func searchSharded(
+	args *arguments,
+	api justgrep.JustlogAPI,
+	filter justgrep.Filter,
+	progress *justgrep.ProgressState,
+	output messageSink,
+) (failed bool) {
+	count := *args.shards
+	shardLength := args.endTime.Sub(args.startTime) / time.Duration(count)
+	buffers := make([]*shardBuffer, count)
+	progresses := make([]*justgrep.ProgressState, count)
+	shardFailed := make([]bool, count)
+	for i := 0; i < count; i++ {
+		shardArgs := *args
+		shardArgs.endTime = args.endTime.Add(-time.Duration(i) * shardLength)
+		shardArgs.startTime = shardArgs.endTime.Add(-shardLength)
+		if i != 0 {
+			// don't match messages sent exactly at the boundary twice
+			shardArgs.endTime = shardArgs.endTime.Add(-time.Nanosecond)
+		}
+		if i == count-1 {
+			shardArgs.startTime = args.startTime
+		}
+		shardFilter := filter
+		shardFilter.StartDate = shardArgs.startTime
+		shardFilter.EndDate = shardArgs.endTime
+
+		buffers[i] = newShardBuffer()
+		progresses[i] = &justgrep.ProgressState{
+			TotalResults: justgrep.NewResultCounts(),
+			BeginTime:    progress.BeginTime,
+			Instances:    progress.Instances,
+		}
+		go func(i int, buffer *shardBuffer, shardProgress *justgrep.ProgressState) {
+			defer buffer.finish()
+			shardFailed[i] = searchLogs(
+				&shardArgs,
+				api,
+				firstLogFile(api, shardArgs.endTime),
+				shardFilter,
+				shardProgress,
+				buffer,
+			)
+		}(i, buffers[i], progresses[i])
+	}
+	for i, buffer := range buffers {
+		buffer.drain(output)
+		mergeProgress(progress, progresses[i])
+		// drain returns after the shard finished
+		failed = failed || shardFailed[i]
+	}
+	return failed
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShardsPrintInOrder(t *testing.T) {
+	server := newTestServer(t, 8)
+	plain := runJustgrep(t, "", testSearchArgs(server, "pajlada", 8, "-regex", "pajaS")...)
+	if plain.code != 0 || len(plain.lines()) != 8*6 {
+		t.Fatalf("expected %d matches without -shards, got %d: %s", 8*6, len(plain.lines()), plain.stderr)
+	}
+
+	dir := t.TempDir()
+	summaryPath := filepath.Join(dir, "summary.json")
+	sharded := runJustgrep(
+		t,
+		"",
+		testSearchArgs(
+			server,
+			"pajlada",
+			8,
+			"-regex", "pajaS",
+			"-shards", "4",
+			"-summary-file", summaryPath,
+			"-debug-filter", filepath.Join(dir, "rejected.jsonl"),
+		)...,
+	)
+	if sharded.code != 0 {
+		t.Fatalf("exit code %d: %s", sharded.code, sharded.stderr)
+	}
+	assert(t, "matches with -shards", sharded.stdout, plain.stdout)
+
+	content, err := ioutil.ReadFile(summaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary struct {
+		TopUsers []userCount `json:"top_users"`
+	}
+	err = json.Unmarshal(content, &summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every fourth message was sent by user0 and matched
+	if len(summary.TopUsers) != 1 || summary.TopUsers[0].User != "user0" || summary.TopUsers[0].Matches != 8*6 {
+		t.Fatalf("unexpected top users in the summary file: %+v", summary.TopUsers)
+	}
+}
+
+func TestShardsRejectOrderedOptions(t *testing.T) {
+	server := newTestServer(t, 1)
+	for _, extra := range [][]string{
+		{"-around", "1m"},
+		{"-format", "modlog-json"},
+		{"-max", "5"},
+	} {
+		result := runJustgrep(t, "", testSearchArgs(server, "pajlada", 1, append(extra, "-shards", "2")...)...)
+		if result.code == 0 || !strings.Contains(result.stderr, "-shards can't be used with") {
+			t.Fatalf("expected -shards with %s to be rejected, got exit code %d: %s", extra, result.code, result.stderr)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// validateSinceLastFlags checks -since-last and reads the newest message of every channel already in the -o file,
+// searches of those channels start right after it.
+func (args *arguments) validateSinceLastFlags() (valid bool) {
+	if !*args.sinceLast {
+		return true
+	}
+	valid = true
+	if *args.outputPath == "" || (*args.format != formatRaw && *args.format != formatJson) {
+		_, _ = fmt.Fprintln(os.Stderr, "-since-last appends to the file of -o, it needs -format raw or json.")
+		valid = false
+	}
+	if *args.top != "" || *args.report != "" || *args.rank || *args.aroundWindow != 0 || *args.groupBy != "" ||
+		*args.alertRateRaw != "" || *args.justUsers || *args.anyPerChannel || *args.squash ||
+		len(args.encryptTo) != 0 {
+		_, _ = fmt.Fprintln(
+			os.Stderr,
+			"-since-last needs to read back the messages it wrote, it can't be used with -top, -report, -rank, "+
+				"-around, -group-by, -alert-rate, -just-users, -any-per-channel, -squash or -encrypt-to.",
+		)
+		valid = false
+	}
+	if !valid {
+		return
+	}
+	file, err := os.Open(*args.outputPath)
+	if errors.Is(err, os.ErrNotExist) {
+		// the first run
+		return true
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "-since-last: Unable to open the output file: %s\n", err)
+		return false
+	}
+	defer file.Close()
+	args.lastWritten, args.lastWrittenSize, err = readLastWritten(file)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "-since-last: Unable to read the output file: %s\n", err)
+		return false
+	}
+	return true
+}
+
+// writtenMessage parses a line printed with -format raw or json, it returns nil for lines without a message.
+func writtenMessage(line string) *justgrep.Message {
+	if strings.HasPrefix(line, "{") {
+		msg := &justgrep.Message{}
+		// every schema has the fields of Message
+		if json.Unmarshal([]byte(line), msg) != nil {
+			return nil
+		}
+		return msg
+	}
+	msg, err := justgrep.NewMessage(line)
+	if err == nil && msg.Channel() != "" {
+		return msg
+	}
+	// annotations come before the raw line, they parse as the command of a message without a channel
+	start := strings.Index(line, " @")
+	if start == -1 {
+		return nil
+	}
+	msg, err = justgrep.NewMessage(line[start+1:])
+	if err != nil {
+		return nil
+	}
+	return msg
+}
+
+// readLastWritten returns when the newest message of every channel in reader was sent and the size of the complete
+// lines. A line without a newline at the end was cut off by an interrupted run, it's overwritten when appending.
+func readLastWritten(reader io.Reader) (map[string]time.Time, int64, error) {
+	lastWritten := make(map[string]time.Time)
+	var size int64
+	buffered := bufio.NewReader(reader)
+	for {
+		line, err := buffered.ReadString('\n')
+		if err == io.EOF {
+			return lastWritten, size, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		size += int64(len(line))
+		msg := writtenMessage(strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"))
+		if msg == nil || msg.Channel() == "" || msg.Timestamp.IsZero() {
+			continue
+		}
+		if msg.Timestamp.After(lastWritten[msg.Channel()]) {
+			lastWritten[msg.Channel()] = msg.Timestamp
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadLastWritten(t *testing.T) {
+	lines := testLogLines(1)
+	pajladaLast := testLogStart.Add(2 * time.Hour)
+	forsenLast := testLogStart.Add(time.Hour)
+	content := strings.Join(
+		[]string{
+			lines[0],
+			// annotations before the raw line
+			"incident=raid " + lines[2],
+			"",
+			"not a message",
+			`{"args":["#forsen","hello"],"timestamp":"` + forsenLast.Format(time.RFC3339) + `"}`,
+			lines[1] + "\r",
+		},
+		"\n",
+	) + "\n"
+	// cut off by an interrupted run
+	partial := lines[3][:40]
+
+	lastWritten, size, err := readLastWritten(strings.NewReader(content + partial))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "size", size, int64(len(content)))
+	assert(t, "channels", len(lastWritten), 2)
+	assert(t, "pajlada", lastWritten["pajlada"].Equal(pajladaLast), true)
+	assert(t, "forsen", lastWritten["forsen"].Equal(forsenLast), true)
+
+	lastWritten, size, err = readLastWritten(strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "empty size", size, int64(0))
+	assert(t, "empty channels", len(lastWritten), 0)
+}
+
+func TestSinceLast(t *testing.T) {
+	server := newTestServer(t, 2)
+	dir := t.TempDir()
+	output := filepath.Join(dir, "out.txt")
+	export := func() string {
+		result := runJustgrep(
+			t,
+			dir,
+			"-no-env",
+			"-url", server.URL,
+			"-channel", "pajlada",
+			// without -end, every run searches until now
+			"-start", "2021-01-01",
+			"-regex", "pajaS",
+			"-o", output,
+			"-since-last",
+		)
+		if result.code != 0 {
+			t.Fatalf("export failed with exit code %d: %s", result.code, result.stderr)
+		}
+		content, err := ioutil.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+
+	first := export()
+	if strings.Count(first, "\n") != 12 {
+		t.Fatalf("expected 12 matches in the first export, got %q", first)
+	}
+	assert(t, "nothing new", export(), first)
+
+	err := server.Add(testLogLine("pajlada", "new", 0, time.Now().Add(-time.Minute), "new pajaS"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	appended := export()
+	assert(t, "kept the previous export", strings.HasPrefix(appended, first), true)
+	added := strings.TrimPrefix(appended, first)
+	if strings.Count(added, "\n") != 1 || !strings.Contains(added, "new pajaS") {
+		t.Fatalf("expected only the new match to be appended, got %q", added)
+	}
+
+	// an interrupted run left half a line
+	cut := len(appended) - len(added)/2
+	err = os.Truncate(output, int64(cut))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "partial line replaced", export(), appended)
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// parseByteSize parses sizes like "512MB", "2GiB" or "1000".
+func parseByteSize(input string) (int64, error) {
+	original := input
+	input = strings.TrimSpace(input)
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+		{"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000},
+		{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+		{"B", 1},
+	}
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(input, unit.suffix) {
+			multiplier = unit.multiplier
+			input = strings.TrimSpace(strings.TrimSuffix(input, unit.suffix))
+			break
+		}
+	}
+	value, err := strconv.ParseInt(input, 10, 64)
+	if err != nil || value < 0 {
+		return 0, errors.New(fmt.Sprintf("invalid size %q", original))
+	}
+	return value * multiplier, nil
+}
+
+// memoryBudget limits how much memory held matches can take, shared by all spillStores. A limit of 0 means no limit.
+type memoryBudget struct {
+	limit int64
+	used  int64
+}
+
+// approximateSize guesses how much memory a parsed message takes.
+func approximateSize(msg *justgrep.Message) int64 {
+	// the raw line, tags and args mostly reference copies of its parts, plus maps and slices
+	return int64(3*len(msg.Raw)) + 256
+}
+
+// spillStore holds matches by key until the search is done. When the memory budget is exceeded, messages are sorted
+// and written into a temporary file, which is merged back with the rest when reading.
+type spillStore struct {
+	budget *memoryBudget
+
+	memory map[string][]*justgrep.Message
+	size   int64
+	runs   []*spillRun
+	stats  map[string]*spillStats
+}
+
+// spillStats describes the messages stored under one key.
+type spillStats struct {
+	count int
+	first time.Time
+	last  time.Time
+}
+
+// spillRun is a temporary file with spilled messages, stored as JSON lines.
+type spillRun struct {
+	file *os.File
+	// segments are where the messages of every key are, each segment is sorted chronologically
+	segments map[string]spillSegment
+}
+
+type spillSegment struct {
+	offset int64
+	length int64
+}
+
+// spilledMessage keeps what's needed to restore a message, the rest is parsed from the raw line.
+type spilledMessage struct {
+	Raw         string              `json:"raw"`
+	Timestamp   time.Time           `json:"timestamp"`
+	Annotations map[string]string   `json:"annotations,omitempty"`
+	MatchedBy   *justgrep.MatchedBy `json:"matched_by,omitempty"`
+}
+
+func newSpillStore(budget *memoryBudget) *spillStore {
+	return &spillStore{
+		budget: budget,
+		memory: make(map[string][]*justgrep.Message),
+		stats:  make(map[string]*spillStats),
+	}
+}
+
+func (s *spillStore) add(key string, msg *justgrep.Message) {
+	stats, ok := s.stats[key]
+	if !ok {
+		stats = &spillStats{first: msg.Timestamp, last: msg.Timestamp}
+		s.stats[key] = stats
+	}
+	stats.count++
+	if msg.Timestamp.Before(stats.first) {
+		stats.first = msg.Timestamp
+	}
+	if msg.Timestamp.After(stats.last) {
+		stats.last = msg.Timestamp
+	}
+
+	s.memory[key] = append(s.memory[key], msg)
+	size := approximateSize(msg)
+	s.size += size
+	s.budget.used += size
+	if s.budget.limit != 0 && s.budget.used > s.budget.limit {
+		err := s.spill()
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to move matches to disk, keeping them in memory: %s\n", err)
+			s.budget.limit = 0
+		}
+	}
+}
+
+// keys returns every key messages were stored under.
+func (s *spillStore) keys() []string {
+	output := make([]string, 0, len(s.stats))
+	for key := range s.stats {
+		output = append(output, key)
+	}
+	sort.Strings(output)
+	return output
+}
+
+func sortMessages(messages []*justgrep.Message) {
+	sort.SliceStable(
+		messages, func(i, j int) bool {
+			return messages[i].Timestamp.Before(messages[j].Timestamp)
+		},
+	)
+}
+
+// spill writes every message held in memory into a new run.
+func (s *spillStore) spill() error {
+	file, err := os.CreateTemp("", "justgrep-spill-*.jsonl")
+	if err != nil {
+		return err
+	}
+	run := &spillRun{file: file, segments: make(map[string]spillSegment, len(s.memory))}
+	writer := bufio.NewWriter(file)
+	offset := int64(0)
+	for key, messages := range s.memory {
+		sortMessages(messages)
+		segmentStart := offset
+		for _, msg := range messages {
+			line, err := json.Marshal(
+				spilledMessage{
+					Raw:         msg.Raw,
+					Timestamp:   msg.Timestamp,
+					Annotations: msg.Annotations,
+					MatchedBy:   msg.MatchedBy,
+				},
+			)
+			if err != nil {
+				return err
+			}
+			_, _ = writer.Write(line)
+			_ = writer.WriteByte('\n')
+			offset += int64(len(line)) + 1
+		}
+		run.segments[key] = spillSegment{offset: segmentStart, length: offset - segmentStart}
+	}
+	err = writer.Flush()
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return err
+	}
+	s.runs = append(s.runs, run)
+	s.memory = make(map[string][]*justgrep.Message)
+	s.budget.used -= s.size
+	s.size = 0
+	return nil
+}
+
+// source is a chronologically sorted stream of messages merged by each.
+type source struct {
+	// index orders sources by age, which keeps the order of messages sent at the same time
+	index   int
+	next    *justgrep.Message
+	memory  []*justgrep.Message
+	scanner *bufio.Scanner
+}
+
+func (src *source) advance() error {
+	src.next = nil
+	if src.scanner == nil {
+		if len(src.memory) != 0 {
+			src.next = src.memory[0]
+			src.memory = src.memory[1:]
+		}
+		return nil
+	}
+	if !src.scanner.Scan() {
+		return src.scanner.Err()
+	}
+	spilled := spilledMessage{}
+	err := json.Unmarshal(src.scanner.Bytes(), &spilled)
+	if err != nil {
+		return err
+	}
+	msg, err := justgrep.NewMessage(spilled.Raw)
+	if err != nil {
+		// kept with -on-parse-error raw
+		msg = justgrep.NewInvalidMessage(spilled.Raw, err)
+	}
+	msg.Timestamp = spilled.Timestamp
+	msg.Annotations = spilled.Annotations
+	msg.MatchedBy = spilled.MatchedBy
+	src.next = msg
+	return nil
+}
+
+type sourceHeap []*source
+
+func (h sourceHeap) Len() int { return len(h) }
+func (h sourceHeap) Less(i, j int) bool {
+	if h[i].next.Timestamp.Equal(h[j].next.Timestamp) {
+		return h[i].index < h[j].index
+	}
+	return h[i].next.Timestamp.Before(h[j].next.Timestamp)
+}
+func (h sourceHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *sourceHeap) Push(x interface{}) { *h = append(*h, x.(*source)) }
+func (h *sourceHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// each calls handle with every message stored under key, oldest first.
+func (s *spillStore) each(key string, handle func(msg *justgrep.Message)) error {
+	sources := make([]*source, 0, len(s.runs)+1)
+	for i, run := range s.runs {
+		segment, ok := run.segments[key]
+		if !ok {
+			continue
+		}
+		scanner := bufio.NewScanner(io.NewSectionReader(run.file, segment.offset, segment.length))
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		sources = append(sources, &source{index: i, scanner: scanner})
+	}
+	memory := s.memory[key]
+	sortMessages(memory)
+	sources = append(sources, &source{index: len(s.runs), memory: memory})
+	h := make(sourceHeap, 0, len(sources))
+	for _, src := range sources {
+		err := src.advance()
+		if err != nil {
+			return err
+		}
+		if src.next != nil {
+			h = append(h, src)
+		}
+	}
+	heap.Init(&h)
+	for len(h) != 0 {
+		src := h[0]
+		handle(src.next)
+		err := src.advance()
+		if err != nil {
+			return err
+		}
+		if src.next == nil {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+	return nil
+}
+
+// close removes the temporary files.
+func (s *spillStore) close() {
+	for _, run := range s.runs {
+		_ = run.file.Close()
+		_ = os.Remove(run.file.Name())
+	}
+	s.runs = nil
+	s.budget.used -= s.size
+	s.size = 0
+	s.memory = make(map[string][]*justgrep.Message)
+	s.stats = make(map[string]*spillStats)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// squashWriter prints identical matches once for -squash, annotated with how many times they were sent and by how many
+// users.
+type squashWriter struct {
+	squasher *justgrep.Squasher
+}
+
+func (w *squashWriter) write(output *matchOutput, msg *justgrep.Message) {
+	for _, group := range w.squasher.Add(msg) {
+		w.print(output, group)
+	}
+}
+
+func (w *squashWriter) print(output *matchOutput, group *justgrep.SquashedMessage) {
+	if group.Count > 1 {
+		group.First.Annotate("squashed", "x"+strconv.Itoa(group.Count))
+		group.First.Annotate("squashed_users", strconv.Itoa(len(group.Users)))
+	}
+	output.print(group.First)
+}
+
+// finish prints the groups which were still open when the search ended.
+func (w *squashWriter) finish(output *matchOutput) {
+	for _, group := range w.squasher.Flush() {
+		w.print(output, group)
+	}
+}
+
+// validateSquashFlags checks flags which don't work with -squash, it changes how matches are printed.
+func (args *arguments) validateSquashFlags() (valid bool) {
+	valid = true
+	if *args.squashWindow < 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "-squash-window can't be negative.")
+		return false
+	}
+	if !*args.squash {
+		if *args.squashWindow != 0 {
+			_, _ = fmt.Fprintln(os.Stderr, "-squash-window only makes sense with -squash.")
+			valid = false
+		}
+		return
+	}
+	if *args.top != "" || *args.report != "" || *args.rank || *args.alertRateRaw != "" || *args.groupBy != "" {
+		_, _ = fmt.Fprintln(
+			os.Stderr,
+			"-squash prints matches as they're found, it can't be used with -top, -report, -rank, -alert-rate or "+
+				"-group-by.",
+		)
+		valid = false
+	}
+	if *args.justUsers || *args.anyPerChannel || *args.aroundWindow != 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "-squash can't be used with -just-users, -any-per-channel or -around.")
+		valid = false
+	}
+	if *args.shards > 1 {
+		_, _ = fmt.Fprintln(os.Stderr, "-squash can't be used with -shards.")
+		valid = false
+	}
+	switch *args.format {
+	case formatModlogJson, formatLinks, formatHtml:
+		_, _ = fmt.Fprintf(os.Stderr, "-squash can't be used with -format %s.\n", *args.format)
+		valid = false
+	}
+	return
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const summaryFileVersion = 1
+
+// summaryTopUsers is how many users with the most matches -summary-file lists.
+const summaryTopUsers = 10
+
+// summaryFile collects what -summary-file reports while searching. It's safe for concurrent use.
+type summaryFile struct {
+	path string
+
+	lock     sync.Mutex
+	channels []channelSummary
+	errors   []summaryError
+	users    map[string]int
+}
+
+type channelSummary struct {
+	Channel string `json:"channel"`
+	// Status is done, skipped or aborted, like in channelFinished events
+	Status      string                `json:"status"`
+	Results     justgrep.ResultCounts `json:"results"`
+	CountLines  int                   `json:"count_lines"`
+	CountBytes  int                   `json:"count_bytes"`
+	FetchErrors int                   `json:"fetch_errors"`
+	FinishedAt  time.Time             `json:"finished_at"`
+}
+
+type summaryError struct {
+	Channel string `json:"channel"`
+	Date    string `json:"date"`
+	Error   string `json:"error"`
+}
+
+type userCount struct {
+	User    string `json:"user"`
+	Matches int    `json:"matches"`
+}
+
+type summaryQuery struct {
+	// Args are the given options, with credentials and secrets left out like in the audit log
+	Args     []string  `json:"args"`
+	Channels []string  `json:"channels,omitempty"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+// summaryFileReport is what -summary-file contains.
+type summaryFileReport struct {
+	Version int          `json:"version"`
+	Query   summaryQuery `json:"query"`
+
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+
+	Results  justgrep.ResultCounts  `json:"results"`
+	Progress justgrep.ProgressState `json:"progress"`
+	Channels []channelSummary       `json:"channels"`
+	Errors   []summaryError         `json:"errors"`
+	// TopUsers are the users with the most matches, most first
+	TopUsers    []userCount                    `json:"top_users"`
+	NoResults   *justgrep.NoResultsExplanation `json:"no_results,omitempty"`
+	PatternHits []patternHit                   `json:"pattern_hits,omitempty"`
+}
+
+func newSummaryFile(path string) *summaryFile {
+	return &summaryFile{path: path, users: make(map[string]int)}
+}
+
+// matched counts a match of its sender.
+func (s *summaryFile) matched(msg *justgrep.Message) {
+	if msg.User == "" {
+		return
+	}
+	s.lock.Lock()
+	s.users[msg.User]++
+	s.lock.Unlock()
+}
+
+func (s *summaryFile) channelFinished(summary channelSummary) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	s.channels = append(s.channels, summary)
+	s.lock.Unlock()
+}
+
+func (s *summaryFile) fetchError(channel string, date time.Time, err error) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	s.errors = append(s.errors, summaryError{Channel: channel, Date: date.Format("2006-01-02"), Error: err.Error()})
+	s.lock.Unlock()
+}
+
+// topUsers returns the users with the most matches, ties ordered by login.
+func (s *summaryFile) topUsers() []userCount {
+	counts := make([]userCount, 0, len(s.users))
+	for user, matches := range s.users {
+		counts = append(counts, userCount{User: user, Matches: matches})
+	}
+	sort.Slice(
+		counts, func(i, j int) bool {
+			if counts[i].Matches != counts[j].Matches {
+				return counts[i].Matches > counts[j].Matches
+			}
+			return counts[i].User < counts[j].User
+		},
+	)
+	if len(counts) > summaryTopUsers {
+		counts = counts[:summaryTopUsers]
+	}
+	return counts
+}
+
+// write writes the report once the search is done, failures are only shown.
+func (s *summaryFile) write(
+	args *arguments,
+	progress *justgrep.ProgressState,
+	noResults *justgrep.NoResultsExplanation,
+) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	finishedAt := time.Now()
+	report := summaryFileReport{
+		Version: summaryFileVersion,
+		Query: summaryQuery{
+			Args:     auditArgs(),
+			Channels: args.channels,
+			Start:    args.startTime,
+			End:      args.endTime,
+		},
+		StartedAt:       progress.BeginTime,
+		FinishedAt:      finishedAt,
+		DurationSeconds: finishedAt.Sub(progress.BeginTime).Seconds(),
+		Results:         progress.TotalResults,
+		Progress:        *progress,
+		Channels:        s.channels,
+		Errors:          s.errors,
+		TopUsers:        s.topUsers(),
+		NoResults:       noResults,
+		PatternHits:     args.patternHits(),
+	}
+	if report.Channels == nil {
+		report.Channels = []channelSummary{}
+	}
+	if report.Errors == nil {
+		report.Errors = []summaryError{}
+	}
+	file, err := os.Create(s.path)
+	if err == nil {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to write -summary-file: %s\n", err)
+	}
+}
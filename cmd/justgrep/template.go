@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const formatTemplate = "template"
+
+// validateTemplateFlags parses -template or -template-file, which print every match with a Go template. Colors are
+// only used on a terminal, unless NO_COLOR is set.
+func (args *arguments) validateTemplateFlags() (valid bool) {
+	if *args.templateText == "" && *args.templateFile == "" {
+		return true
+	}
+	if *args.templateText != "" && *args.templateFile != "" {
+		_, _ = fmt.Fprintln(os.Stderr, "-template and -template-file can't be used together.")
+		return false
+	}
+	if givenFlags()["format"] && *args.format != formatTemplate {
+		_, _ = fmt.Fprintln(os.Stderr, "-template prints matches itself, it can't be used with -format.")
+		return false
+	}
+	name, text := "template", *args.templateText
+	if *args.templateFile != "" {
+		data, err := ioutil.ReadFile(*args.templateFile)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-template-file: %s\n", err)
+			return false
+		}
+		name, text = filepath.Base(*args.templateFile), string(data)
+	}
+	colors := *args.outputPath == "" && isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == ""
+	tmpl, err := justgrep.ParseTemplate(name, text, colors)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error in your template: %s\n", err)
+		return false
+	}
+	args.template = tmpl
+	*args.format = formatTemplate
+	return true
+}
+
+// printTemplate prints msg with the template, followed by a newline. Only the first error is shown, templates fail
+// the same way for most messages.
+func (o *matchOutput) printTemplate(msg *justgrep.Message) {
+	err := o.template.Execute(o.out, msg)
+	if err != nil && !o.templateFailed {
+		_, _ = fmt.Fprintf(os.Stderr, "Error in your template: %s\n", err)
+		o.templateFailed = true
+	}
+	_, _ = fmt.Fprintln(o.out)
+}
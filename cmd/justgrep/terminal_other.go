@@ -0,0 +1,22 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows)
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly,!windows
+
+package main
+
+import "os"
+
+// ioctlWidth can't ask terminals for their width on this platform, COLUMNS is used instead.
+func ioctlWidth(f *os.File) int {
+	return 0
+}
+
+// isTerminal returns true if f is connected to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// enableVirtualTerminal does nothing, terminals understand escape sequences already.
+func enableVirtualTerminal(f *os.File) bool {
+	return true
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const enableVirtualTerminalProcessing = 0x0004
+
+var (
+	kernel32                       = syscall.NewLazyDLL("kernel32.dll")
+	procSetConsoleMode             = kernel32.NewProc("SetConsoleMode")
+	procGetConsoleScreenBufferInfo = kernel32.NewProc("GetConsoleScreenBufferInfo")
+)
+
+// isTerminal returns true if f is a console. NUL is a character device too, so checking the mode isn't enough.
+func isTerminal(f *os.File) bool {
+	var mode uint32
+	return syscall.GetConsoleMode(syscall.Handle(f.Fd()), &mode) == nil
+}
+
+// enableVirtualTerminal makes the console f is connected to understand escape sequences, which older versions of
+// Windows don't. It returns false if that's not possible.
+func enableVirtualTerminal(f *os.File) bool {
+	handle := syscall.Handle(f.Fd())
+	var mode uint32
+	if syscall.GetConsoleMode(handle, &mode) != nil {
+		return false
+	}
+	if mode&enableVirtualTerminalProcessing != 0 {
+		return true
+	}
+	ok, _, _ := procSetConsoleMode.Call(uintptr(handle), uintptr(mode|enableVirtualTerminalProcessing))
+	return ok != 0
+}
+
+// ioctlWidth asks the console f is connected to for its width, 0 if that fails.
+func ioctlWidth(f *os.File) int {
+	var info struct {
+		sizeX, sizeY                           int16
+		cursorX, cursorY                       int16
+		attributes                             uint16
+		windowLeft, windowTop                  int16
+		windowRight, windowBottom              int16
+		maximumWindowSizeX, maximumWindowSizeY int16
+	}
+	ok, _, _ := procGetConsoleScreenBufferInfo.Call(f.Fd(), uintptr(unsafe.Pointer(&info)))
+	if ok == 0 {
+		return 0
+	}
+	return int(info.windowRight-info.windowLeft) + 1
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// resolveFlag is -resolve, which can be repeated.
+type resolveFlag []string
+
+func (f *resolveFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *resolveFlag) Set(value string) error {
+	_, _, err := justgrep.ParseResolve(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, value)
+	return nil
+}
+
+// transportOptions are the options of the connections made to instances.
+func (args *arguments) transportOptions() justgrep.TransportOptions {
+	options := justgrep.TransportOptions{
+		CACert:             *args.caCert,
+		ClientCert:         *args.clientCert,
+		ClientKey:          *args.clientKey,
+		InsecureSkipVerify: *args.insecureSkipVerify,
+		IPVersion:          *args.ipVersion,
+	}
+	if len(args.resolve) != 0 {
+		options.Resolve = make(map[string]string, len(args.resolve))
+		for _, value := range args.resolve {
+			// checked by Set, later overrides of the same host win
+			hostPort, address, _ := justgrep.ParseResolve(value)
+			options.Resolve[hostPort] = address
+		}
+	}
+	return options
+}
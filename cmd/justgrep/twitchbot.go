@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// justgrep twitch-bot joins Twitch chats and answers a command like "!grep from:someone some text" with a summary of
+// the matches. Searches are restricted: only the joined channels can be searched, only for literal text and only up to
+// -max-range back, every user and channel has a cooldown and at most twitchBotMaxSearches run at the same time.
+
+const TwitchIRCAddress = "irc.chat.twitch.tv:6697"
+const EnvTwitchBotToken = "JUSTGREP_TWITCH_BOT_TOKEN"
+
+const twitchBotMaxResults = 1000
+const twitchBotMaxSearches = 2
+const twitchBotSearchTimeout = time.Minute
+
+// twitchBotMaxReply is how long replies are at most, Twitch allows 500 characters.
+const twitchBotMaxReply = 450
+
+const twitchBotUsage = "[#channel] [from:user] [since:24h] text"
+
+type twitchBot struct {
+	selfSearch
+	login           string
+	token           string
+	address         string
+	noTLS           bool
+	channels        []string
+	command         string
+	roles           map[string]bool
+	users           map[string]bool
+	userCooldown    time.Duration
+	channelCooldown time.Duration
+	maxRange        time.Duration
+
+	running chan struct{}
+
+	connLock sync.Mutex
+	conn     net.Conn
+
+	lock        sync.Mutex
+	lastUser    map[string]time.Time
+	lastChannel map[string]time.Time
+	busy        map[string]bool
+}
+
+// send writes an IRC line to the current connection, lines sent while reconnecting are dropped.
+func (b *twitchBot) send(line string) {
+	b.connLock.Lock()
+	defer b.connLock.Unlock()
+	if b.conn == nil {
+		return
+	}
+	_ = b.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := b.conn.Write([]byte(line + "\r\n"))
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to send to Twitch chat: %s\n", err)
+	}
+}
+
+// errLoginFailed is returned by connect when Twitch refuses the token, reconnecting wouldn't help then.
+var errLoginFailed = errors.New("twitch: login failed, check -login and -token")
+
+// connect connects to chat and handles messages until the connection is lost.
+func (b *twitchBot) connect() error {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if b.noTLS {
+		conn, err = dialer.Dial("tcp", b.address)
+	} else {
+		conn, err = tls.DialWithDialer(dialer, "tcp", b.address, nil)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	b.connLock.Lock()
+	b.conn = conn
+	b.connLock.Unlock()
+	defer func() {
+		b.connLock.Lock()
+		b.conn = nil
+		b.connLock.Unlock()
+	}()
+
+	b.send("CAP REQ :twitch.tv/tags twitch.tv/commands")
+	b.send("PASS oauth:" + strings.TrimPrefix(b.token, "oauth:"))
+	b.send("NICK " + b.login)
+	joins := make([]string, 0, len(b.channels))
+	for _, channel := range b.channels {
+		joins = append(joins, "#"+channel)
+	}
+	b.send("JOIN " + strings.Join(joins, ","))
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for {
+		// Twitch sends a PING every five minutes or so
+		_ = conn.SetReadDeadline(time.Now().Add(10 * time.Minute))
+		if !scanner.Scan() {
+			break
+		}
+		msg, err := justgrep.NewMessage(strings.TrimSuffix(scanner.Text(), "\r"))
+		if err != nil {
+			continue
+		}
+		switch msg.Action {
+		case "PING":
+			b.send("PONG :" + strings.Join(msg.Args, " "))
+		case "RECONNECT":
+			return errors.New("twitch: asked to reconnect")
+		case "NOTICE":
+			if len(msg.Args) == 2 && strings.Contains(msg.Args[1], "authentication failed") {
+				return errLoginFailed
+			}
+		case "PRIVMSG":
+			b.handle(msg)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("twitch: connection closed")
+}
+
+// permitted checks if the sender of msg may use the command, by their name or a role from -permit.
+func (b *twitchBot) permitted(msg *justgrep.Message) bool {
+	if b.roles["everyone"] || b.users[strings.ToLower(msg.User)] {
+		return true
+	}
+	for _, badge := range strings.Split(msg.Tags["badges"], ",") {
+		role := strings.SplitN(badge, "/", 2)[0]
+		if role == "broadcaster" || (role != "" && b.roles[role]) {
+			return true
+		}
+	}
+	return b.roles["moderator"] && msg.Tags["mod"] == "1"
+}
+
+// take checks and starts the cooldowns of user and channel, it returns false if either is still cooling down or user
+// has a search running.
+func (b *twitchBot) take(user string, channel string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	if b.busy[user] ||
+		now.Sub(b.lastUser[user]) < b.userCooldown ||
+		now.Sub(b.lastChannel[channel]) < b.channelCooldown {
+		return false
+	}
+	b.busy[user] = true
+	b.lastUser[user] = now
+	b.lastChannel[channel] = now
+	return true
+}
+
+func (b *twitchBot) done(user string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.busy, user)
+}
+
+// handle runs a search for a chat message with the command. Messages without permission or during a cooldown are
+// ignored without a reply, so the bot can't be used to spam chat.
+func (b *twitchBot) handle(msg *justgrep.Message) {
+	if len(msg.Args) != 2 {
+		return
+	}
+	channel := strings.TrimPrefix(msg.Args[0], "#")
+	words := strings.Fields(msg.Args[1])
+	user := strings.ToLower(msg.User)
+	if len(words) == 0 || words[0] != b.command || user == strings.ToLower(b.login) || !b.permitted(msg) {
+		return
+	}
+	select {
+	case b.running <- struct{}{}:
+	default:
+		return
+	}
+	if !b.take(user, channel) {
+		<-b.running
+		return
+	}
+	go func() {
+		defer func() {
+			b.done(user)
+			<-b.running
+		}()
+		reply := b.search(channel, words[1:])
+		reply = strings.NewReplacer("\r", " ", "\n", " ").Replace(reply)
+		b.send(fmt.Sprintf("@reply-parent-msg-id=%s PRIVMSG #%s :@%s %s", msg.Tags["id"], channel, msg.User, reply))
+	}()
+}
+
+// parseChatDuration parses durations like 30m, 24h and 7d.
+func parseChatDuration(text string) (time.Duration, error) {
+	if strings.HasSuffix(text, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(text, "d"))
+		if err != nil || days < 0 {
+			return 0, errors.New(fmt.Sprintf("invalid duration %s", text))
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(text)
+	if err != nil || duration < 0 {
+		return 0, errors.New(fmt.Sprintf("invalid duration %s", text))
+	}
+	return duration, nil
+}
+
+// parseChatQuery parses the words after the command into search arguments, see searchArgs, and how far back it
+// searches. Searches are in channel by default.
+func (b *twitchBot) parseChatQuery(channel string, words []string) (map[string]string, time.Duration, error) {
+	var channels, users, text []string
+	since := 24 * time.Hour
+	if since > b.maxRange {
+		since = b.maxRange
+	}
+	for _, word := range words {
+		switch {
+		case strings.HasPrefix(word, "#") && len(word) > 1:
+			name := strings.ToLower(word[1:])
+			joined := false
+			for _, candidate := range b.channels {
+				joined = joined || candidate == name
+			}
+			if !joined {
+				return nil, 0, errors.New(fmt.Sprintf("I can only search channels I'm in, not %s", word))
+			}
+			channels = append(channels, name)
+		case strings.HasPrefix(word, "from:") && len(word) > len("from:"):
+			users = append(users, strings.TrimPrefix(strings.ToLower(word[len("from:"):]), "@"))
+		case strings.HasPrefix(word, "since:"):
+			duration, err := parseChatDuration(word[len("since:"):])
+			if err != nil {
+				return nil, 0, err
+			}
+			if duration > b.maxRange {
+				return nil, 0, errors.New(fmt.Sprintf("I can only search %s back", formatChatDuration(b.maxRange)))
+			}
+			since = duration
+		default:
+			text = append(text, word)
+		}
+	}
+	if len(text) == 0 && len(users) == 0 {
+		return nil, 0, errors.New("usage: " + b.command + " " + twitchBotUsage)
+	}
+	if len(channels) == 0 {
+		channels = []string{channel}
+	}
+	arguments := map[string]string{
+		"channels": strings.Join(channels, ","),
+		"start":    time.Now().UTC().Add(-since).Format(time.RFC3339),
+		"user":     strings.Join(users, ","),
+		"literal":  strings.Join(text, " "),
+	}
+	return arguments, since, nil
+}
+
+// formatChatDuration formats durations like parseChatDuration parses them.
+func formatChatDuration(duration time.Duration) string {
+	if duration >= 24*time.Hour && duration%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", duration/(24*time.Hour))
+	}
+	if duration < time.Minute {
+		return "0m"
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(duration.String(), "0s"), "0m")
+}
+
+// search runs the search of a command and returns the reply, without the mention of the user.
+func (b *twitchBot) search(channel string, words []string) string {
+	arguments, since, err := b.parseChatQuery(channel, words)
+	if err != nil {
+		return err.Error()
+	}
+	flags, err := searchArgs(arguments)
+	if err != nil {
+		return err.Error()
+	}
+	flags = append(flags, "-max="+strconv.Itoa(twitchBotMaxResults), "-format=json")
+	flags = append(flags, b.instanceArgs("")...)
+	count := 0
+	var newest matchSummary
+	ctx, cancel := context.WithTimeout(context.Background(), twitchBotSearchTimeout)
+	err = b.run(
+		ctx, flags, func(line string) {
+			count++
+			if match := summarizeMatch(line); match.Timestamp.After(newest.Timestamp) {
+				newest = match
+			}
+		},
+	)
+	cancel()
+	if err != nil {
+		return "search failed: " + shorten(strings.SplitN(err.Error(), "\n", 2)[0], 200)
+	}
+	where := "#" + strings.ReplaceAll(arguments["channels"], ",", " #")
+	if count == 0 {
+		return fmt.Sprintf("nothing found in %s in the last %s", where, formatChatDuration(since))
+	}
+	total := strconv.Itoa(count)
+	if count >= twitchBotMaxResults {
+		total += "+"
+	}
+	reply := fmt.Sprintf("%s matches in %s in the last %s", total, where, formatChatDuration(since))
+	if arguments["user"] != "" && !strings.Contains(arguments["user"], ",") {
+		// the justlog frontend shows all messages of the user
+		reply += fmt.Sprintf(
+			", logs: %s/?channel=%s&username=%s",
+			strings.TrimSuffix(b.instance(""), "/"),
+			url.QueryEscape(strings.SplitN(arguments["channels"], ",", 2)[0]),
+			url.QueryEscape(arguments["user"]),
+		)
+	}
+	ago := time.Since(newest.Timestamp).Truncate(time.Minute)
+	if ago >= 24*time.Hour {
+		ago = ago.Truncate(24 * time.Hour)
+	}
+	newestText := fmt.Sprintf(
+		", newest: %s ago %s: %s",
+		formatChatDuration(ago),
+		newest.User,
+		newest.Text,
+	)
+	return shorten(reply+newestText, twitchBotMaxReply)
+}
+
+// runTwitchBot is justgrep twitch-bot [options]. It returns the exit code.
+func runTwitchBot(cliArgs []string) int {
+	flags := flag.NewFlagSet("justgrep twitch-bot", flag.ContinueOnError)
+	bot := &twitchBot{
+		running:     make(chan struct{}, twitchBotMaxSearches),
+		roles:       make(map[string]bool),
+		users:       make(map[string]bool),
+		lastUser:    make(map[string]time.Time),
+		lastChannel: make(map[string]time.Time),
+		busy:        make(map[string]bool),
+	}
+	bot.register(flags)
+	flags.StringVar(&bot.login, "login", "", "Login name of the bot account")
+	flags.StringVar(
+		&bot.token,
+		"token",
+		"",
+		"OAuth token of the bot account, "+EnvTwitchBotToken+" is used if it's not given",
+	)
+	join := flags.String("join", "", "Channels to join and search in, separated with commas")
+	flags.StringVar(&bot.command, "command", "!grep", "Command to answer")
+	permit := flags.String(
+		"permit",
+		"moderator",
+		"Roles which can use the command, separated with commas: moderator, vip, subscriber or everyone",
+	)
+	permitUsers := flags.String("permit-user", "", "Users who can use the command, separated with commas")
+	flags.DurationVar(
+		&bot.userCooldown,
+		"user-cooldown",
+		2*time.Minute,
+		"How long users have to wait between searches",
+	)
+	flags.DurationVar(
+		&bot.channelCooldown,
+		"channel-cooldown",
+		15*time.Second,
+		"How long to wait between searches in a channel",
+	)
+	flags.DurationVar(&bot.maxRange, "max-range", 7*24*time.Hour, "How far back searches can go")
+	flags.StringVar(&bot.address, "irc-address", TwitchIRCAddress, "Twitch chat server to connect to")
+	flags.BoolVar(&bot.noTLS, "irc-no-tls", false, "Connect to -irc-address without TLS")
+	if err := flags.Parse(cliArgs); err != nil {
+		return 2
+	}
+	if bot.token == "" && !bot.noEnv {
+		bot.token = os.Getenv(EnvTwitchBotToken)
+	}
+	for _, channel := range strings.Split(*join, ",") {
+		if channel = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(channel), "#")); channel != "" {
+			bot.channels = append(bot.channels, channel)
+		}
+	}
+	valid := true
+	if bot.login == "" || bot.token == "" || len(bot.channels) == 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "justgrep twitch-bot needs a -login, a -token and channels to -join.")
+		valid = false
+	}
+	for _, role := range strings.Split(*permit, ",") {
+		switch role = strings.TrimSpace(role); role {
+		case "moderator", "vip", "subscriber", "everyone":
+			bot.roles[role] = true
+		case "":
+		default:
+			_, _ = fmt.Fprintf(os.Stderr, "-permit: Unknown role: %s\n", role)
+			valid = false
+		}
+	}
+	for _, user := range strings.Split(*permitUsers, ",") {
+		if user = strings.ToLower(strings.TrimSpace(user)); user != "" {
+			bot.users[user] = true
+		}
+	}
+	if bot.maxRange <= 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "-max-range needs to be positive.")
+		valid = false
+	}
+	if !valid {
+		return 2
+	}
+	if err := bot.findExecutable(); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	wait := 5 * time.Second
+	for {
+		started := time.Now()
+		err := bot.connect()
+		if err == errLoginFailed {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if time.Since(started) > 10*time.Minute {
+			wait = 5 * time.Second
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "Disconnected from Twitch chat: %s, reconnecting in %s\n", err, wait)
+		time.Sleep(wait)
+		if wait < 5*time.Minute {
+			wait *= 2
+		}
+	}
+}
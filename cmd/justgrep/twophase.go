@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const progressCoarseStep = "coarseStep"
+
+// candidateDatesAPI makes searchLogs visit only the log files in which the coarse phase found candidates.
+type candidateDatesAPI struct {
+	justgrep.JustlogAPI
+
+	// dates are sorted newest first, like the log files are visited
+	dates []time.Time
+}
+
+func (api *candidateDatesAPI) NextLogFile(currentDate time.Time) time.Time {
+	for len(api.dates) != 0 && !api.dates[0].Before(currentDate) {
+		api.dates = api.dates[1:]
+	}
+	if len(api.dates) == 0 {
+		return time.Time{}
+	}
+	return api.dates[0]
+}
+
+// findCandidateDates is the first phase of a two-phase search: it walks all log files in the time range and returns
+// the dates of the files which contain the -F literal anywhere. Lines aren't parsed so this is a lot cheaper than a
+// full search.
+func findCandidateDates(
+	args *arguments,
+	api justgrep.JustlogAPI,
+	progress *justgrep.ProgressState,
+) ([]time.Time, error) {
+	channel := apiChannel(api)
+	var candidates []time.Time
+	for date := firstLogFile(api, args.endTime); !date.IsZero(); date = api.NextLogFile(date) {
+		if *args.verbose {
+			args.display.printf(
+				"Coarse scan of #%s at %s, %d candidate log files so far\n",
+				channel,
+				date.Format("2006-01-02"),
+				len(candidates),
+			)
+		}
+		if *args.progressJson {
+			args.emitEvent(
+				progressUpdate{
+					Type:     progressCoarseStep,
+					Found:    len(candidates),
+					Channel:  channel,
+					NextDate: date.Format(time.RFC3339),
+					Progress: *progress,
+				},
+			)
+		}
+		found, err := justgrep.ContainsLiteral(
+			context.Background(),
+			api,
+			date,
+			*args.literal,
+			progress,
+			&httpClient,
+		)
+		if err != nil {
+			return candidates, err
+		}
+		if found {
+			candidates = append(candidates, date)
+		}
+		// after the first one, dates point to the beginning of log files, older files can't contain anything newer
+		if !date.After(args.startTime) {
+			break
+		}
+	}
+	return candidates, nil
+}
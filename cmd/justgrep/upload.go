@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const EnvUploadToken = "JUSTGREP_UPLOAD_TOKEN"
+
+// uploadMaxSize is how much output is held for uploading at most, paste services don't take more anyway.
+const uploadMaxSize = 32 * 1024 * 1024
+
+const uploadTimeout = 2 * time.Minute
+
+// uploadWriter holds results printed to stdout for -upload. If they stay under the threshold they're printed once
+// the search is done, otherwise they're uploaded and only the link is printed.
+type uploadWriter struct {
+	lock      sync.Mutex
+	out       io.Writer
+	uploader  justgrep.Uploader
+	name      string
+	threshold int64
+	held      bytes.Buffer
+	// passthrough is set once results are too big to upload or were printed, they're printed as they come then
+	passthrough bool
+}
+
+func (w *uploadWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.passthrough {
+		return w.out.Write(p)
+	}
+	w.held.Write(p)
+	if w.held.Len() > uploadMaxSize {
+		_, _ = fmt.Fprintf(os.Stderr, "Results are over %d bytes, printing them instead of uploading\n", uploadMaxSize)
+		return len(p), w.release()
+	}
+	return len(p), nil
+}
+
+// release prints the held results and stops holding new ones.
+func (w *uploadWriter) release() error {
+	w.passthrough = true
+	_, err := w.out.Write(w.held.Bytes())
+	w.held = bytes.Buffer{}
+	return err
+}
+
+// dump prints the held results, for when justgrep is interrupted.
+func (w *uploadWriter) dump() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	_ = w.release()
+}
+
+// finish uploads the results if they're over the threshold and prints the link, smaller results are printed. If the
+// upload fails the results are printed too.
+func (w *uploadWriter) finish() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.passthrough {
+		return nil
+	}
+	if int64(w.held.Len()) <= w.threshold {
+		return w.release()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+	link, err := w.uploader.Upload(ctx, w.name, w.held.Bytes())
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to upload results, printing them instead: %s\n", err)
+		return w.release()
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Uploaded %d bytes of results\n", w.held.Len())
+	w.passthrough = true
+	w.held = bytes.Buffer{}
+	_, err = fmt.Fprintln(w.out, link)
+	return err
+}
+
+// uploadName is the file name results are uploaded as, some services highlight them by its extension.
+func uploadName(format string) string {
+	switch format {
+	case formatJson, formatModlogJson:
+		return "justgrep-results.jsonl"
+	case formatLinks:
+		return "justgrep-results.txt"
+	case formatHtml:
+		return "justgrep-report.html"
+	case formatMarkdown:
+		return "justgrep-results.md"
+	}
+	return "justgrep-results.log"
+}
+
+func (args *arguments) validateUploadFlags() (valid bool) {
+	valid = true
+	if *args.upload == "" {
+		if *args.uploadOver != "" || *args.uploadToken != "" {
+			_, _ = fmt.Fprintln(os.Stderr, "-upload-over and -upload-token need -upload.")
+			valid = false
+		}
+		return
+	}
+	if *args.outputPath != "" {
+		_, _ = fmt.Fprintln(os.Stderr, "-upload uploads results printed to stdout, it can't be used with -o.")
+		valid = false
+	} else if *args.format == formatChatterino || *args.format == formatJsonlEvents {
+		_, _ = fmt.Fprintf(os.Stderr, "-upload can't be used with -format %s.\n", *args.format)
+		valid = false
+	}
+	token := *args.uploadToken
+	if token == "" && !*args.noEnv {
+		token = os.Getenv(EnvUploadToken)
+	}
+	uploader, err := justgrep.NewUploader(*args.upload, token, &httpClient)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "-upload: %s\n", err)
+		valid = false
+	}
+	args.uploader = uploader
+	args.uploadThreshold = 64 * 1024
+	if *args.uploadOver != "" {
+		args.uploadThreshold, err = parseByteSize(*args.uploadOver)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-upload-over: %s\n", err)
+			valid = false
+		}
+	}
+	return
+}
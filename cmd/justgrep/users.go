@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// patternFlag is a flag which can be repeated, every value is a regular expression.
+type patternFlag []string
+
+func (f *patternFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *patternFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// splitNameList splits a list of user names separated with commas or spaces.
+func splitNameList(list string) []string {
+	return strings.FieldsFunc(
+		list, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		},
+	)
+}
+
+// userPatterns returns the regexes users are matched with: value of a name flag if -uregex was passed, and extra.
+func (args *arguments) userPatterns(value string, extra []string) []string {
+	if !*args.userIsRegex || value == "" {
+		return extra
+	}
+	return append([]string{value}, extra...)
+}
+
+// compileUserMatcher compiles patterns, prefixed with flags like "(?i)", into a UserMatcher with names.
+func compileUserMatcher(names []string, patterns []string, flags string) (justgrep.UserMatcher, error) {
+	regexes := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		regex, err := regexp.Compile(flags + pattern)
+		if err != nil {
+			return justgrep.UserMatcher{}, err
+		}
+		regexes = append(regexes, regex)
+	}
+	return justgrep.NewUserMatcher(names, regexes), nil
+}
+
+// singleLogin returns the login of the only user searched for, if -user has a single login and nothing else can
+// match. Its logs can be downloaded instead of the whole channel.
+func (args *arguments) singleLogin() string {
+	if len(args.userLogins) != 1 || len(args.userRegexes) != 0 || *args.anyName {
+		return ""
+	}
+	return strings.ToLower(args.userLogins[0])
+}
+
+// resolveUser uses Helix to find the id of -user, so its user logs can be found even if they were renamed since, or
+// the current login of -userid. Failures aren't fatal, the search continues with what was given.
+func resolveUser(args *arguments, helix *justgrep.HelixClient) {
+	if helix == nil {
+		return
+	}
+	var logins, ids []string
+	if args.userID != "" {
+		ids = []string{args.userID}
+	} else if login := args.singleLogin(); login != "" {
+		logins = []string{login}
+	} else {
+		return
+	}
+	users, err := helix.GetUsers(context.Background(), logins, ids)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Unable to look the user up on Twitch: %s\n", err)
+		return
+	}
+	if len(users) == 0 {
+		if *args.verbose {
+			_, _ = fmt.Fprintln(os.Stderr, "User not found on Twitch, they might be banned or renamed.")
+		}
+		return
+	}
+	if args.userID != "" {
+		args.userLogin = users[0].Login
+		if *args.verbose {
+			_, _ = fmt.Fprintf(os.Stderr, "User id %s is currently %s\n", args.userID, users[0].Login)
+		}
+		return
+	}
+	args.userID = users[0].ID
+	if *args.verbose {
+		_, _ = fmt.Fprintf(os.Stderr, "Searching %s by their user id %s\n", users[0].Login, users[0].ID)
+	}
+}
+
+// currentNames finds the current display names of users, for annotating messages sent under old names.
+type currentNames struct {
+	helix *justgrep.HelixClient
+
+	lock     sync.Mutex
+	names    map[string]string
+	disabled bool
+}
+
+func newCurrentNames(helix *justgrep.HelixClient) *currentNames {
+	return &currentNames{helix: helix, names: make(map[string]string)}
+}
+
+// annotate adds the current display name of the sender to msg.
+func (c *currentNames) annotate(msg *justgrep.Message) {
+	id := msg.Tags["user-id"]
+	if id == "" {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	name, ok := c.names[id]
+	if !ok && !c.disabled {
+		users, err := c.helix.GetUsers(context.Background(), nil, []string{id})
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to look up current user names, disabling: %s\n", err)
+			c.disabled = true
+			return
+		}
+		if len(users) != 0 {
+			name = users[0].DisplayName
+		}
+		// remember users which weren't found too
+		c.names[id] = name
+	}
+	if name != "" {
+		msg.Annotate("current_name", name)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const EnvTwitchClientID = "JUSTGREP_TWITCH_CLIENT_ID"
+const EnvTwitchClientSecret = "JUSTGREP_TWITCH_CLIENT_SECRET"
+const EnvTwitchToken = "JUSTGREP_TWITCH_TOKEN"
+
+// newHelixClient creates a Helix client from the credentials in the environment, nil is returned if there are none.
+func newHelixClient(args *arguments) *justgrep.HelixClient {
+	if *args.noEnv {
+		return nil
+	}
+	client := &justgrep.HelixClient{
+		ClientID:     os.Getenv(EnvTwitchClientID),
+		ClientSecret: os.Getenv(EnvTwitchClientSecret),
+		Token:        os.Getenv(EnvTwitchToken),
+		HTTP:         &httpClient,
+	}
+	if client.ClientID == "" || (client.Token == "" && client.ClientSecret == "") {
+		return nil
+	}
+	return client
+}
+
+// resolveVOD returns the VOD selected with -vod-id or -vod-url, or nil if there isn't one. The start of the VOD is
+// taken from -vod-start or asked for from Helix.
+func resolveVOD(args *arguments) (*justgrep.VOD, error) {
+	if args.vodID == "" {
+		return nil, nil
+	}
+	if *args.vodStart != "" {
+		return &justgrep.VOD{ID: args.vodID, Start: args.vodStartTime}, nil
+	}
+	helix := newHelixClient(args)
+	if helix == nil {
+		return nil, errors.New(
+			fmt.Sprintf(
+				"pass -vod-start or set %s and either %s or %s to look the VOD up",
+				EnvTwitchClientID,
+				EnvTwitchClientSecret,
+				EnvTwitchToken,
+			),
+		)
+	}
+	video, err := helix.GetVideo(context.Background(), args.vodID)
+	if err != nil {
+		return nil, err
+	}
+	return justgrep.NewVODFromHelix(video)
+}
+
+// annotateVOD adds a link to the moment in the VOD msg was sent at, if the VOD covers it.
+func annotateVOD(vod *justgrep.VOD, msg *justgrep.Message) {
+	if link, ok := vod.Link(msg.Timestamp); ok {
+		msg.Annotate("vod", link)
+	}
+}
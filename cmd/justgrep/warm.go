@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+const EnvCacheDir = "JUSTGREP_CACHE_DIR"
+
+// offPeakWindow is the time of day -off-peak allows downloads in, as durations since local midnight. It goes past
+// midnight if end is before start.
+type offPeakWindow struct {
+	start time.Duration
+	end   time.Duration
+}
+
+func parseClock(input string) (time.Duration, error) {
+	clock, err := time.Parse("15:04", strings.TrimSpace(input))
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("invalid time of day %q, expected HH:MM", input))
+	}
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
+
+// parseOffPeak parses a window like 01:00-07:00.
+func parseOffPeak(input string) (*offPeakWindow, error) {
+	split := strings.Split(input, "-")
+	if len(split) != 2 {
+		return nil, errors.New(fmt.Sprintf("invalid window %q, expected HH:MM-HH:MM", input))
+	}
+	start, err := parseClock(split[0])
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClock(split[1])
+	if err != nil {
+		return nil, err
+	}
+	if start == end {
+		return nil, errors.New("the window is empty, it starts when it ends")
+	}
+	return &offPeakWindow{start: start, end: end}, nil
+}
+
+// until returns how long it is from now until the window opens, 0 if it's open.
+func (w *offPeakWindow) until(now time.Time) time.Duration {
+	year, month, day := now.Date()
+	sinceMidnight := now.Sub(time.Date(year, month, day, 0, 0, 0, 0, now.Location()))
+	open := sinceMidnight >= w.start && sinceMidnight < w.end
+	if w.end < w.start {
+		open = sinceMidnight >= w.start || sinceMidnight < w.end
+	}
+	if open {
+		return 0
+	}
+	wait := w.start - sinceMidnight
+	if wait < 0 {
+		wait += 24 * time.Hour
+	}
+	return wait
+}
+
+// rateLimitedReader reads at most rate bytes per second on average.
+type rateLimitedReader struct {
+	reader io.Reader
+	rate   int64
+	start  time.Time
+	read   int64
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+	// small reads keep the rate even, instead of bursts followed by long pauses
+	if limit := r.rate / 10; limit > 0 && int64(len(p)) > limit {
+		p = p[:limit]
+	}
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	ahead := time.Duration(float64(r.read)/float64(r.rate)*float64(time.Second)) - time.Since(r.start)
+	if ahead > 0 {
+		time.Sleep(ahead)
+	}
+	return n, err
+}
+
+// validateCacheFlags opens -cache-dir and checks the options of justgrep warm.
+func (args *arguments) validateCacheFlags() (valid bool) {
+	valid = true
+	cacheDir := *args.cacheDir
+	if cacheDir == "" && !*args.noEnv {
+		cacheDir = os.Getenv(EnvCacheDir)
+	}
+	if cacheDir != "" {
+		cache, err := justgrep.NewDiskCache(cacheDir)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-cache-dir: %s\n", err)
+			valid = false
+		}
+		args.diskCache = cache
+	}
+	if !args.warm {
+		if *args.limitRateRaw != "" || *args.offPeakRaw != "" {
+			_, _ = fmt.Fprintln(os.Stderr, "-limit-rate and -off-peak are only used by justgrep warm.")
+			valid = false
+		}
+		return
+	}
+	if cacheDir == "" {
+		_, _ = fmt.Fprintf(os.Stderr, "justgrep warm needs -cache-dir or %s to know where to keep logs.\n", EnvCacheDir)
+		valid = false
+	}
+	if *args.outputPath != "" || *args.runDir != "" || *args.sinceLast || *args.twoPhase {
+		_, _ = fmt.Fprintln(
+			os.Stderr,
+			"justgrep warm only downloads logs, it can't be used with -o, -run-dir, -since-last or -two-phase.",
+		)
+		valid = false
+	}
+	if *args.limitRateRaw != "" {
+		rate, err := parseByteSize(*args.limitRateRaw)
+		if err == nil && rate <= 0 {
+			err = errors.New("has to be more than 0")
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-limit-rate: %s\n", err)
+			valid = false
+		}
+		args.limitRate = rate
+	}
+	if *args.offPeakRaw != "" {
+		window, err := parseOffPeak(*args.offPeakRaw)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "-off-peak: %s\n", err)
+			valid = false
+		}
+		args.offPeak = window
+	}
+	return
+}
+
+// warmStats counts the log files justgrep warm went through.
+type warmStats struct {
+	downloaded int
+	bytes      int64
+	cached     int
+	// current are log files still being written to, they aren't cached
+	current int
+	missing int
+	failed  int
+}
+
+// isCurrentLogFile checks if url is the log file justlog is writing to, or was until recently, messages sent right
+// before midnight may still be coming in.
+func isCurrentLogFile(api justgrep.JustlogAPI, url string) bool {
+	now := time.Now().UTC()
+	return url == api.MakeURL(now) || url == api.MakeURL(now.Add(-time.Hour))
+}
+
+// warmLogFile downloads url into the disk cache.
+func (args *arguments) warmLogFile(url string, stats *warmStats) {
+	if args.offPeak != nil {
+		if wait := args.offPeak.until(time.Now()); wait != 0 {
+			_, _ = fmt.Fprintf(
+				os.Stderr,
+				"Waiting for -off-peak until %s\n",
+				time.Now().Add(wait).Format("2006-01-02 15:04"),
+			)
+			time.Sleep(wait)
+		}
+	}
+	req, err := http.NewRequestWithContext(context.Background(), "GET", url, nil)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%s: %s\n", redactURL(url), err)
+		stats.failed++
+		return
+	}
+	req.Header.Set("User-Agent", justgrep.UserAgent)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%s: %s\n", redactURL(url), err)
+		stats.failed++
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		// no messages were logged that day
+		stats.missing++
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		_, _ = fmt.Fprintf(os.Stderr, "%s: justlog instance responded with %d\n", redactURL(url), resp.StatusCode)
+		stats.failed++
+		return
+	}
+	var body io.Reader = resp.Body
+	if args.limitRate != 0 {
+		body = &rateLimitedReader{reader: body, rate: args.limitRate}
+	}
+	size, err := args.diskCache.Store(url, body)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%s: %s\n", redactURL(url), err)
+		stats.failed++
+		return
+	}
+	stats.downloaded++
+	stats.bytes += size
+	if *args.verbose {
+		_, _ = fmt.Fprintf(os.Stderr, "Cached %s (%d bytes)\n", redactURL(url), size)
+	}
+}
+
+// runWarm is justgrep warm, it downloads the log files a search with the same options would search into the disk
+// cache, without filtering them. It returns the exit code.
+func runWarm(args *arguments, channels []string, routes map[string]string) int {
+	stats := &warmStats{}
+	for _, channel := range channels {
+		channelArgs, _ := args.forChannel(channel, justgrep.Filter{})
+		apis := channelAPIs(args, channel, routes[channel])
+		start := channelArgs.startTime
+		if args.startEarliest {
+			earliest, ok := earliestLogFile(apis)
+			if !ok {
+				_, _ = fmt.Fprintf(os.Stderr, "Unable to find the earliest logs of #%s, skipping it\n", channel)
+				continue
+			}
+			start = earliest
+		}
+		if *args.verbose {
+			_, _ = fmt.Fprintf(os.Stderr, "Warming #%s\n", channel)
+		}
+		for _, api := range apis {
+			for date := channelArgs.endTime; !date.IsZero(); date = api.NextLogFile(date) {
+				url := api.MakeURL(date)
+				switch {
+				case isCurrentLogFile(api, url):
+					stats.current++
+				case args.diskCache.Has(url):
+					stats.cached++
+				default:
+					args.warmLogFile(url, stats)
+				}
+				if !date.After(start) {
+					break
+				}
+			}
+		}
+	}
+	_, _ = fmt.Fprintf(
+		os.Stderr,
+		"Cached %d log files (%.2f MB), %d were cached already, %d are still being written, %d had no logs, "+
+			"%d failed\n",
+		stats.downloaded,
+		float64(stats.bytes)/1000/1000,
+		stats.cached,
+		stats.current,
+		stats.missing,
+		stats.failed,
+	)
+	if stats.failed != 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,161 @@
+package justgrep
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// slowResponse is how much slower than the fastest response seen a response has to be to count as the instance being
+// overloaded. Responses faster than minSlowResponse never count, so small differences on fast instances don't.
+const slowResponse = 4
+const minSlowResponse = time.Second
+
+// ConcurrencyLimiter limits how many requests are made to each instance at the same time. The limit adapts to how
+// the instance responds: it starts at 1 and grows by one with every quick response until the first sign of overload,
+// after that by one every Limit responses (additive increase). 429 and 5xx responses, network errors and responses
+// much slower than usual halve it (multiplicative decrease), at most once per response time. It never goes above Max.
+// It's safe for concurrent use.
+type ConcurrencyLimiter struct {
+	Max int
+	// OnChange is called with the new limit whenever the limit of an instance changes by a whole request. It's
+	// called with the lock held, so it mustn't make requests.
+	OnChange func(instance string, limit int, overloaded bool)
+
+	lock      sync.Mutex
+	instances map[string]*instanceLimit
+}
+
+type instanceLimit struct {
+	limit        float64
+	inFlight     int
+	slowStart    bool
+	fastest      time.Duration
+	lastDecrease time.Time
+	wake         *sync.Cond
+}
+
+func NewConcurrencyLimiter(max int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{Max: max, instances: make(map[string]*instanceLimit)}
+}
+
+// acquire waits until a request can be made to instance, the lock must be held.
+func (l *ConcurrencyLimiter) acquire(instance string) *instanceLimit {
+	state, ok := l.instances[instance]
+	if !ok {
+		state = &instanceLimit{limit: 1, slowStart: true, wake: sync.NewCond(&l.lock)}
+		l.instances[instance] = state
+	}
+	for state.inFlight >= int(state.limit) {
+		state.wake.Wait()
+	}
+	state.inFlight++
+	return state
+}
+
+// adjust changes the limit after a response which took latency, the lock must be held.
+func (l *ConcurrencyLimiter) adjust(instance string, state *instanceLimit, latency time.Duration, overloaded bool) {
+	if !overloaded && latency > minSlowResponse && state.fastest != 0 && latency > state.fastest*slowResponse {
+		overloaded = true
+	}
+	if state.fastest == 0 || latency < state.fastest {
+		state.fastest = latency
+	}
+	before := int(state.limit)
+	if overloaded {
+		state.slowStart = false
+		// requests sent together fail together, count them as one
+		if time.Since(state.lastDecrease) < latency {
+			return
+		}
+		state.lastDecrease = time.Now()
+		state.limit /= 2
+		if state.limit < 1 {
+			state.limit = 1
+		}
+	} else if state.slowStart {
+		state.limit++
+	} else {
+		state.limit += 1 / state.limit
+	}
+	if state.limit > float64(l.Max) {
+		state.limit = float64(l.Max)
+	}
+	if int(state.limit) != before {
+		state.wake.Broadcast()
+		if l.OnChange != nil {
+			l.OnChange(instance, int(state.limit), overloaded)
+		}
+	}
+}
+
+// release ends a request, the lock must be held.
+func (l *ConcurrencyLimiter) release(state *instanceLimit) {
+	state.inFlight--
+	state.wake.Signal()
+}
+
+// RoundTripper wraps base to limit the requests made through it. A request counts until its body is closed or read
+// to the end, which is when instances are done with it.
+func (l *ConcurrencyLimiter) RoundTripper(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &limitedRoundTripper{base: base, limiter: l}
+}
+
+type limitedRoundTripper struct {
+	base    http.RoundTripper
+	limiter *ConcurrencyLimiter
+}
+
+func (t *limitedRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	instance := req.URL.Scheme + "://" + req.URL.Host
+	l := t.limiter
+	l.lock.Lock()
+	state := l.acquire(instance)
+	l.lock.Unlock()
+
+	begin := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	latency := time.Since(begin)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if err != nil {
+		// cancelled requests say nothing about the instance
+		l.adjust(instance, state, latency, req.Context().Err() == nil)
+		l.release(state)
+		return resp, err
+	}
+	l.adjust(instance, state, latency, resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500)
+	resp.Body = &limitedBody{
+		ReadCloser: resp.Body,
+		release: func() {
+			l.lock.Lock()
+			defer l.lock.Unlock()
+			l.release(state)
+		},
+	}
+	return resp, nil
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	b.once.Do(b.release)
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,83 @@
+package justgrep
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	var lock sync.Mutex
+	status := http.StatusOK
+	inFlight, mostInFlight := 0, 0
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				lock.Lock()
+				inFlight++
+				if inFlight > mostInFlight {
+					mostInFlight = inFlight
+				}
+				code := status
+				lock.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				lock.Lock()
+				inFlight--
+				lock.Unlock()
+				w.WriteHeader(code)
+			},
+		),
+	)
+	defer server.Close()
+	setStatus := func(code int) {
+		lock.Lock()
+		defer lock.Unlock()
+		status = code
+	}
+
+	limiter := NewConcurrencyLimiter(4)
+	var limits []int
+	limiter.OnChange = func(instance string, limit int, overloaded bool) {
+		limits = append(limits, limit)
+	}
+	client := &http.Client{Transport: limiter.RoundTripper(nil)}
+	get := func() {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	// the first request is made alone
+	get()
+	assert(t, "limits after the first request", fmt.Sprint(limits), "[2]")
+	var wait sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			get()
+		}()
+	}
+	wait.Wait()
+	assert(t, "most requests at the same time", mostInFlight <= 4, true)
+	assert(t, "last limit", limits[len(limits)-1], 4)
+
+	setStatus(http.StatusTooManyRequests)
+	get()
+	assert(t, "limit after 429", limits[len(limits)-1], 2)
+	setStatus(http.StatusOK)
+	limits = nil
+	for i := 0; i < 3; i++ {
+		get()
+	}
+	// 2, 2.5, 2.9, 3.24
+	assert(t, "limits after growing additively", fmt.Sprint(limits), "[3]")
+}
@@ -0,0 +1,53 @@
+package justgrep
+
+import (
+	"sort"
+	"time"
+)
+
+// CoOccurrence is a period during which two users were active at the same time.
+type CoOccurrence struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Messages counts messages sent during the period by the first and second user
+	Messages [2]int `json:"messages"`
+}
+
+type activity struct {
+	timestamp time.Time
+	user      int
+}
+
+// FindCoOccurrences finds periods where both users a and b sent messages, given when they sent them. Messages closer
+// than window to each other belong to the same period, only periods with messages from both users are returned.
+func FindCoOccurrences(a []time.Time, b []time.Time, window time.Duration) []CoOccurrence {
+	all := make([]activity, 0, len(a)+len(b))
+	for _, timestamp := range a {
+		all = append(all, activity{timestamp: timestamp, user: 0})
+	}
+	for _, timestamp := range b {
+		all = append(all, activity{timestamp: timestamp, user: 1})
+	}
+	sort.SliceStable(
+		all, func(i, j int) bool {
+			return all[i].timestamp.Before(all[j].timestamp)
+		},
+	)
+
+	var output []CoOccurrence
+	var current CoOccurrence
+	for i, act := range all {
+		if i == 0 || act.timestamp.Sub(current.End) > window {
+			if current.Messages[0] != 0 && current.Messages[1] != 0 {
+				output = append(output, current)
+			}
+			current = CoOccurrence{Start: act.timestamp}
+		}
+		current.End = act.timestamp
+		current.Messages[act.user]++
+	}
+	if current.Messages[0] != 0 && current.Messages[1] != 0 {
+		output = append(output, current)
+	}
+	return output
+}
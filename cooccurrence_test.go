@@ -0,0 +1,26 @@
+package justgrep
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindCoOccurrences(t *testing.T) {
+	base := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes ...int) []time.Time {
+		output := make([]time.Time, len(minutes))
+		for i, minute := range minutes {
+			output[i] = base.Add(time.Duration(minute) * time.Minute)
+		}
+		return output
+	}
+	found := FindCoOccurrences(at(0, 3, 30, 100), at(5, 31, 200), 5*time.Minute)
+	assert(t, "count", len(found), 2)
+	assert(t, "first start", found[0].Start, base)
+	assert(t, "first end", found[0].End, base.Add(5*time.Minute))
+	assert(t, "first messages", found[0].Messages, [2]int{2, 1})
+	assert(t, "second start", found[1].Start, base.Add(30*time.Minute))
+	assert(t, "second messages", found[1].Messages, [2]int{1, 1})
+
+	assert(t, "without b", len(FindCoOccurrences(at(0, 1), nil, time.Hour)), 0)
+}
@@ -0,0 +1,260 @@
+package justgrep
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DiskCache keeps log files on disk between runs, so searching them again doesn't download them again. Files are
+// added with Store once they don't change anymore: justlog keeps appending to the log file of the current day or
+// month. Its RoundTripper also keeps responses which came with an ETag or Last-Modified header, they are only used
+// after the server confirmed they didn't change with a conditional request. Files are named after the hash of their
+// URL, requests with credentials (an Authorization or Cookie header) aren't answered from it. It's safe for
+// concurrent use.
+type DiskCache struct {
+	dir string
+
+	lock        sync.Mutex
+	hits        int
+	revalidated int
+}
+
+// NewDiskCache uses dir as a cache, creating it if it doesn't exist.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+// Hits returns how many requests were answered from the cache.
+func (c *DiskCache) Hits() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.hits
+}
+
+// Revalidated returns how many requests were answered from the cache after the server confirmed the cached response
+// didn't change.
+func (c *DiskCache) Revalidated() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.revalidated
+}
+
+func (c *DiskCache) path(url string) string {
+	hash := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(hash[:]))
+}
+
+// Has checks if the response to url is cached.
+func (c *DiskCache) Has(url string) bool {
+	_, err := os.Stat(c.path(url))
+	return err == nil
+}
+
+// Store caches body as the response to url. The file is only added once body was read to the end, so an interrupted
+// download doesn't leave half of it in the cache. It returns how many bytes were read.
+func (c *DiskCache) Store(url string, body io.Reader) (int64, error) {
+	file, err := ioutil.TempFile(c.dir, "download-*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(file, body)
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return size, err
+	}
+	err = file.Close()
+	if err == nil {
+		err = os.Rename(file.Name(), c.path(url))
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return size, err
+	}
+	// the complete file is used from now on
+	_ = os.Remove(c.path(url) + revalidatedSuffix)
+	return size, nil
+}
+
+func (c *DiskCache) get(url string) *cachedResponse {
+	body, err := ioutil.ReadFile(c.path(url))
+	if err != nil {
+		return nil
+	}
+	c.lock.Lock()
+	c.hits++
+	c.lock.Unlock()
+	return &cachedResponse{url: url, header: http.Header{}, body: body}
+}
+
+// RoundTripper wraps base to answer requests from the cache. Range requests are answered from cached files too.
+func (c *DiskCache) RoundTripper(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &diskCacheRoundTripper{base: base, cache: c}
+}
+
+type diskCacheRoundTripper struct {
+	base  http.RoundTripper
+	cache *DiskCache
+}
+
+func (t *diskCacheRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || hasCredentials(req) {
+		return t.base.RoundTrip(req)
+	}
+	url := req.URL.String()
+	rangeHeader := req.Header.Get("Range")
+	if _, _, ok := parseByteRange(rangeHeader); rangeHeader != "" && !ok {
+		// multiple or suffix ranges
+		return t.base.RoundTrip(req)
+	}
+	if entry := t.cache.get(url); entry != nil {
+		return entry.response(req)
+	}
+	if rangeHeader != "" || req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return t.base.RoundTrip(req)
+	}
+	entry, validators := t.cache.getRevalidated(url)
+	if entry != nil {
+		conditional := req.Clone(req.Context())
+		if validators.ETag != "" {
+			conditional.Header.Set("If-None-Match", validators.ETag)
+		}
+		if validators.LastModified != "" {
+			conditional.Header.Set("If-Modified-Since", validators.LastModified)
+		}
+		resp, err := t.base.RoundTrip(conditional)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusNotModified {
+			_ = resp.Body.Close()
+			t.cache.lock.Lock()
+			t.cache.revalidated++
+			t.cache.lock.Unlock()
+			return entry.response(req)
+		}
+		resp.Request = req
+		return t.cache.keepRevalidated(url, resp), nil
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	return t.cache.keepRevalidated(url, resp), nil
+}
+
+// revalidatedSuffix is added to the names of files kept with their validators, they need to be revalidated before
+// they are used. They start with a line of JSON with the validators, followed by the body.
+const revalidatedSuffix = ".revalidate"
+
+// diskCacheValidators are the headers of a response used to ask the server if it changed.
+type diskCacheValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// getRevalidated returns the response to url kept with its validators.
+func (c *DiskCache) getRevalidated(url string) (*cachedResponse, diskCacheValidators) {
+	var validators diskCacheValidators
+	content, err := ioutil.ReadFile(c.path(url) + revalidatedSuffix)
+	if err != nil {
+		return nil, validators
+	}
+	newline := bytes.IndexByte(content, '\n')
+	if newline == -1 || json.Unmarshal(content[:newline], &validators) != nil {
+		return nil, validators
+	}
+	header := http.Header{}
+	if validators.ETag != "" {
+		header.Set("ETag", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		header.Set("Last-Modified", validators.LastModified)
+	}
+	return &cachedResponse{url: url, header: header, body: content[newline+1:]}, validators
+}
+
+// keepRevalidated makes the body of resp be kept in the cache once it was read to the end, if resp has validators.
+func (c *DiskCache) keepRevalidated(url string, resp *http.Response) *http.Response {
+	validators := diskCacheValidators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	if resp.StatusCode != http.StatusOK || (validators.ETag == "" && validators.LastModified == "") {
+		return resp
+	}
+	header, err := json.Marshal(validators)
+	if err != nil {
+		return resp
+	}
+	file, err := ioutil.TempFile(c.dir, "download-*.tmp")
+	if err != nil {
+		return resp
+	}
+	writer := bufio.NewWriter(file)
+	_, _ = writer.Write(append(header, '\n'))
+	resp.Body = &diskCachingBody{
+		ReadCloser: resp.Body,
+		file:       file,
+		writer:     writer,
+		path:       c.path(url) + revalidatedSuffix,
+	}
+	return resp
+}
+
+// diskCachingBody copies everything read from the body into a temporary file, which is moved into the cache once the
+// body was read to the end.
+type diskCachingBody struct {
+	io.ReadCloser
+	file   *os.File
+	writer *bufio.Writer
+	path   string
+	// failed is set once writing failed, nothing is kept then
+	failed bool
+	done   bool
+}
+
+func (b *diskCachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.failed && !b.done {
+		_, writeErr := b.writer.Write(p[:n])
+		b.failed = writeErr != nil
+	}
+	if err == io.EOF && !b.failed && !b.done {
+		b.done = true
+		writeErr := b.writer.Flush()
+		if closeErr := b.file.Close(); writeErr == nil {
+			writeErr = closeErr
+		}
+		if writeErr == nil {
+			writeErr = os.Rename(b.file.Name(), b.path)
+		}
+		if writeErr != nil {
+			_ = os.Remove(b.file.Name())
+		}
+	}
+	return n, err
+}
+
+func (b *diskCachingBody) Close() error {
+	if !b.done {
+		// read only partly, or writing failed
+		b.done = true
+		_ = b.file.Close()
+		_ = os.Remove(b.file.Name())
+	}
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,203 @@
+package justgrep
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiskCache(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				requests[r.URL.Path]++
+				_, _ = w.Write([]byte(strings.Repeat(r.URL.Path[1:], 10)))
+			},
+		),
+	)
+	defer server.Close()
+
+	cache, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: cache.RoundTripper(nil)}
+	get := func(path string, rangeHeader string) (int, string) {
+		req, err := http.NewRequest("GET", server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	// responses aren't cached by the round tripper
+	get("/a", "")
+	get("/a", "")
+	assert(t, "requests of /a", requests["/a"], 2)
+	assert(t, "has /a", cache.Has(server.URL+"/a"), false)
+
+	size, err := cache.Store(server.URL+"/a", strings.NewReader("stored"))
+	assert(t, "store error", err, nil)
+	assert(t, "stored size", size, int64(6))
+	assert(t, "has /a after storing", cache.Has(server.URL+"/a"), true)
+	_, body := get("/a", "")
+	assert(t, "cached body", body, "stored")
+	status, body := get("/a", "bytes=4-")
+	assert(t, "range status", status, http.StatusPartialContent)
+	assert(t, "range body", body, "ed")
+	assert(t, "requests of /a after storing", requests["/a"], 2)
+	assert(t, "hits", cache.Hits(), 2)
+
+	// cookies of the session jar, the stored file could be for another session
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jar.SetCookies(serverURL, []*http.Cookie{{Name: "session", Value: "s3cret"}})
+	client.Jar = jar
+	_, body = get("/a", "")
+	assert(t, "body with cookie", body, "aaaaaaaaaa")
+	assert(t, "hits with cookie", cache.Hits(), 2)
+	client.Jar = nil
+
+	// an interrupted download isn't stored
+	_, err = cache.Store(server.URL+"/b", io.MultiReader(strings.NewReader("part"), &failingReader{}))
+	assert(t, "interrupted store fails", err != nil, true)
+	assert(t, "has /b", cache.Has(server.URL+"/b"), false)
+	files, err := os.ReadDir(cache.dir)
+	assert(t, "read dir error", err, nil)
+	assert(t, "files in the cache", len(files), 1)
+}
+
+type failingReader struct{}
+
+func (r *failingReader) Read([]byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+func TestDiskCacheRevalidation(t *testing.T) {
+	content := map[string]string{"/today": "message 1\n", "/month": "message 1\n"}
+	version := 1
+	requests := make(map[string]int)
+	notModified := 0
+	lastModified := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				requests[r.URL.Path]++
+				if r.URL.Path == "/month" {
+					// only Last-Modified
+					since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+					if err == nil && !lastModified.After(since) {
+						notModified++
+						w.WriteHeader(http.StatusNotModified)
+						return
+					}
+					w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+					_, _ = w.Write([]byte(content[r.URL.Path]))
+					return
+				}
+				etag := fmt.Sprintf(`"%d"`, version)
+				if r.Header.Get("If-None-Match") == etag {
+					notModified++
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set("ETag", etag)
+				_, _ = w.Write([]byte(content[r.URL.Path]))
+			},
+		),
+	)
+	defer server.Close()
+
+	cache, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: cache.RoundTripper(nil)}
+	get := func(path string, readAll bool) string {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		assert(t, path+" status", resp.StatusCode, http.StatusOK)
+		if !readAll {
+			return ""
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	assert(t, "first download", get("/today", true), "message 1\n")
+	assert(t, "revalidated", get("/today", true), "message 1\n")
+	assert(t, "requests", requests["/today"], 2)
+	assert(t, "not modified", notModified, 1)
+	assert(t, "revalidated count", cache.Revalidated(), 1)
+	// kept files aren't complete
+	assert(t, "has /today", cache.Has(server.URL+"/today"), false)
+	assert(t, "hits", cache.Hits(), 0)
+
+	content["/today"] += "message 2\n"
+	version++
+	assert(t, "changed", get("/today", true), "message 1\nmessage 2\n")
+	assert(t, "revalidated after changing", get("/today", true), "message 1\nmessage 2\n")
+	assert(t, "not modified after changing", notModified, 2)
+
+	// an interrupted download doesn't replace the kept response
+	content["/today"] += "message 3\n"
+	version++
+	get("/today", false)
+	version--
+	assert(t, "kept after an interrupted download", get("/today", true), "message 1\nmessage 2\n")
+	assert(t, "not modified after an interrupted download", notModified, 3)
+
+	assert(t, "first download with Last-Modified", get("/month", true), "message 1\n")
+	assert(t, "revalidated with Last-Modified", get("/month", true), "message 1\n")
+	assert(t, "not modified with Last-Modified", notModified, 4)
+
+	// complete files don't need revalidating
+	_, err = cache.Store(server.URL+"/today", strings.NewReader("complete"))
+	assert(t, "store error", err, nil)
+	before := requests["/today"]
+	assert(t, "stored", get("/today", true), "complete")
+	assert(t, "requests after storing", requests["/today"], before)
+	files, err := os.ReadDir(cache.dir)
+	assert(t, "read dir error", err, nil)
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	// the complete /today and the kept /month
+	assert(t, "files in the cache", len(names), 2)
+	for _, name := range names {
+		assert(t, name+" is a temporary file", strings.HasSuffix(name, ".tmp"), false)
+	}
+}
@@ -0,0 +1,230 @@
+package justgrep
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const EmoteProviderTwitch = "twitch"
+const EmoteProvider7TV = "7tv"
+const EmoteProviderBTTV = "bttv"
+const EmoteProviderFFZ = "ffz"
+
+const SevenTVURL = "https://7tv.io/v3"
+const BTTVURL = "https://api.betterttv.net/3"
+const FFZURL = "https://api.frankerfacez.com/v1"
+
+type Emote struct {
+	Provider string `json:"provider"`
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+}
+
+// EmoteClient fetches the emotes of third party providers: 7TV, BTTV and FFZ.
+type EmoteClient struct {
+	// SevenTVURL, BTTVURL and FFZURL default to the consts of the same names
+	SevenTVURL string
+	BTTVURL    string
+	FFZURL     string
+
+	HTTP *http.Client
+}
+
+func (c *EmoteClient) httpClient() *http.Client {
+	if c.HTTP == nil {
+		return http.DefaultClient
+	}
+	return c.HTTP
+}
+
+func orDefault(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// get decodes the response from url into output. If there's nothing at url, false is returned without an error,
+// providers respond like that for channels which don't use them.
+func (c *EmoteClient) get(ctx context.Context, url string, output interface{}) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, errors.New(fmt.Sprintf("emotes: request to %s failed: %s", url, resp.Status))
+	}
+	return true, json.NewDecoder(resp.Body).Decode(output)
+}
+
+type sevenTVEmote struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type bttvEmote struct {
+	ID   string `json:"id"`
+	Code string `json:"code"`
+}
+
+type ffzSet struct {
+	Emoticons []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"emoticons"`
+}
+
+func sevenTVEmotes(emotes []sevenTVEmote) []Emote {
+	output := make([]Emote, 0, len(emotes))
+	for _, emote := range emotes {
+		output = append(output, Emote{Provider: EmoteProvider7TV, ID: emote.ID, Name: emote.Name})
+	}
+	return output
+}
+
+func bttvEmotes(emotes []bttvEmote) []Emote {
+	output := make([]Emote, 0, len(emotes))
+	for _, emote := range emotes {
+		output = append(output, Emote{Provider: EmoteProviderBTTV, ID: emote.ID, Name: emote.Code})
+	}
+	return output
+}
+
+func ffzEmotes(sets map[string]ffzSet) []Emote {
+	var output []Emote
+	for _, set := range sets {
+		for _, emote := range set.Emoticons {
+			output = append(output, Emote{Provider: EmoteProviderFFZ, ID: strconv.Itoa(emote.ID), Name: emote.Name})
+		}
+	}
+	return output
+}
+
+// GlobalEmotes fetches the emotes every channel has. If a provider fails, the emotes of the others are still returned
+// along with the first error.
+func (c *EmoteClient) GlobalEmotes(ctx context.Context) ([]Emote, error) {
+	var emotes []Emote
+	var firstErr error
+	keep := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	sevenTV := struct {
+		Emotes []sevenTVEmote `json:"emotes"`
+	}{}
+	if _, err := c.get(ctx, orDefault(c.SevenTVURL, SevenTVURL)+"/emote-sets/global", &sevenTV); err != nil {
+		keep(err)
+	}
+	emotes = append(emotes, sevenTVEmotes(sevenTV.Emotes)...)
+
+	var bttv []bttvEmote
+	if _, err := c.get(ctx, orDefault(c.BTTVURL, BTTVURL)+"/cached/emotes/global", &bttv); err != nil {
+		keep(err)
+	}
+	emotes = append(emotes, bttvEmotes(bttv)...)
+
+	ffz := struct {
+		Sets map[string]ffzSet `json:"sets"`
+	}{}
+	if _, err := c.get(ctx, orDefault(c.FFZURL, FFZURL)+"/set/global", &ffz); err != nil {
+		keep(err)
+	}
+	emotes = append(emotes, ffzEmotes(ffz.Sets)...)
+	return emotes, firstErr
+}
+
+// ChannelEmotes fetches the emotes a channel added, channelID is the Twitch user id of the channel. Providers the
+// channel doesn't use are skipped. If a provider fails, the emotes of the others are still returned along with the
+// first error.
+func (c *EmoteClient) ChannelEmotes(ctx context.Context, channelID string) ([]Emote, error) {
+	var emotes []Emote
+	var firstErr error
+	keep := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	sevenTV := struct {
+		EmoteSet struct {
+			Emotes []sevenTVEmote `json:"emotes"`
+		} `json:"emote_set"`
+	}{}
+	if _, err := c.get(ctx, orDefault(c.SevenTVURL, SevenTVURL)+"/users/twitch/"+channelID, &sevenTV); err != nil {
+		keep(err)
+	}
+	emotes = append(emotes, sevenTVEmotes(sevenTV.EmoteSet.Emotes)...)
+
+	bttv := struct {
+		ChannelEmotes []bttvEmote `json:"channelEmotes"`
+		SharedEmotes  []bttvEmote `json:"sharedEmotes"`
+	}{}
+	if _, err := c.get(ctx, orDefault(c.BTTVURL, BTTVURL)+"/cached/users/twitch/"+channelID, &bttv); err != nil {
+		keep(err)
+	}
+	emotes = append(emotes, bttvEmotes(bttv.ChannelEmotes)...)
+	emotes = append(emotes, bttvEmotes(bttv.SharedEmotes)...)
+
+	ffz := struct {
+		Sets map[string]ffzSet `json:"sets"`
+	}{}
+	if _, err := c.get(ctx, orDefault(c.FFZURL, FFZURL)+"/room/id/"+channelID, &ffz); err != nil {
+		keep(err)
+	}
+	emotes = append(emotes, ffzEmotes(ffz.Sets)...)
+	return emotes, firstErr
+}
+
+// EmoteSet finds emotes by their name. Names are case-sensitive, like in chat.
+type EmoteSet map[string]Emote
+
+// Add adds emotes to the set, replacing emotes with the same name. Channel emotes should be added after global ones,
+// since they take precedence in chat.
+func (s EmoteSet) Add(emotes []Emote) {
+	for _, emote := range emotes {
+		s[emote.Name] = emote
+	}
+}
+
+// Find returns the emotes used in msg: Twitch emotes from the emotes tag and words that are in the set.
+func (s EmoteSet) Find(msg *Message) []Emote {
+	text := []rune(msg.Text())
+	var output []Emote
+	previous := 0
+	findWords := func(part []rune) {
+		for _, word := range strings.Fields(string(part)) {
+			if emote, ok := s[word]; ok {
+				output = append(output, emote)
+			}
+		}
+	}
+	for _, emote := range parseEmotes(msg.Tags["emotes"]) {
+		if emote.start < previous || emote.end >= len(text) {
+			continue
+		}
+		findWords(text[previous:emote.start])
+		output = append(
+			output,
+			Emote{Provider: EmoteProviderTwitch, ID: emote.id, Name: string(text[emote.start : emote.end+1])},
+		)
+		previous = emote.end + 1
+	}
+	findWords(text[previous:])
+	return output
+}
@@ -0,0 +1,75 @@
+package justgrep
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+)
+
+func TestEmoteClient(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/7tv/emote-sets/global":
+					_, _ = w.Write([]byte(`{"emotes":[{"id":"a","name":"EZ"}]}`))
+				case "/7tv/users/twitch/11":
+					_, _ = w.Write([]byte(`{"emote_set":{"emotes":[{"id":"b","name":"Clap"}]}}`))
+				case "/bttv/cached/emotes/global":
+					_, _ = w.Write([]byte(`[{"id":"c","code":"LULW"}]`))
+				case "/bttv/cached/users/twitch/11":
+					_, _ = w.Write([]byte(`{"channelEmotes":[{"id":"d","code":"pepeD"}],"sharedEmotes":[]}`))
+				case "/ffz/set/global":
+					w.WriteHeader(http.StatusInternalServerError)
+				case "/ffz/room/id/11":
+					_, _ = w.Write([]byte(`{"sets":{"5":{"emoticons":[{"id":7,"name":"OMEGALUL"}]}}}`))
+				default:
+					http.NotFound(w, r)
+				}
+			},
+		),
+	)
+	defer server.Close()
+
+	client := &EmoteClient{SevenTVURL: server.URL + "/7tv", BTTVURL: server.URL + "/bttv", FFZURL: server.URL + "/ffz"}
+	names := func(emotes []Emote) []string {
+		output := make([]string, 0, len(emotes))
+		for _, emote := range emotes {
+			output = append(output, emote.Provider+":"+emote.ID+":"+emote.Name)
+		}
+		sort.Strings(output)
+		return output
+	}
+
+	global, err := client.GlobalEmotes(context.Background())
+	if err == nil {
+		t.Errorf("expected the error of FFZ")
+	}
+	assertStrSlc(t, "global", names(global), []string{"7tv:a:EZ", "bttv:c:LULW"})
+
+	channel, err := client.ChannelEmotes(context.Background(), "11")
+	assert(t, "error", err, nil)
+	assertStrSlc(t, "channel", names(channel), []string{"7tv:b:Clap", "bttv:d:pepeD", "ffz:7:OMEGALUL"})
+
+	// channels without third party emotes aren't an error
+	channel, err = client.ChannelEmotes(context.Background(), "12")
+	assert(t, "error", err, nil)
+	assert(t, "emotes", len(channel), 0)
+}
+
+func TestEmoteSetFind(t *testing.T) {
+	set := EmoteSet{}
+	set.Add([]Emote{{Provider: EmoteProviderBTTV, ID: "1", Name: "Clap"}, {Provider: EmoteProviderBTTV, Name: "EZ"}})
+	set.Add([]Emote{{Provider: EmoteProvider7TV, ID: "2", Name: "Clap"}})
+	msg, err := NewMessage("@emotes=25:5-9;tmi-sent-ts=1000 :a!a@a.tmi.twitch.tv PRIVMSG #x :Clap Kappa clap Clap EZ")
+	assert(t, "error", err, nil)
+
+	emotes := set.Find(msg)
+	have := make([]string, 0, len(emotes))
+	for _, emote := range emotes {
+		have = append(have, emote.Provider+":"+emote.ID+":"+emote.Name)
+	}
+	assertStrSlc(t, "emotes", have, []string{"7tv:2:Clap", "twitch:25:Kappa", "7tv:2:Clap", "bttv::EZ"})
+}
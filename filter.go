@@ -2,19 +2,16 @@ package justgrep
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-type UserMatchType uint8
-
-const (
-	DontMatch UserMatchType = iota
-	MatchRegex
-	MatchExact
-)
-
 type Filter struct {
 	// StartDate < EndDate
 	StartDate time.Time
@@ -26,15 +23,58 @@ type Filter struct {
 	HasMessageRegex bool
 	MessageRegex    *regexp.Regexp
 
-	UserMatchType UserMatchType
+	// Patterns is checked like MessageRegex, one of them has to match.
+	HasPatterns bool
+	Patterns    *PatternSet
+
+	// SystemMessageRegex is matched against the system-msg tag of USERNOTICEs (sub and raid announcements) instead of
+	// the text sent by the user, which is often empty. Messages without the tag don't match.
+	HasSystemMessageRegex bool
+	SystemMessageRegex    *regexp.Regexp
+
+	// HasLink only matches messages with a link in their text, with HasLinkDomainRegex one of the links has to have a
+	// domain matching LinkDomainRegex. See ExtractLinks.
+	HasLink            bool
+	HasLinkDomainRegex bool
+	LinkDomainRegex    *regexp.Regexp
+
+	// Literal is a cheap pre-check, only messages with the raw line containing it are matched against MessageRegex.
+	HasLiteral bool
+	Literal    string
 
-	UserRegex         *regexp.Regexp
-	NegativeUserRegex *regexp.Regexp
-	UserName          string
-	NegativeUserName  string
+	// Users has to match the login of the sender, empty matches every user. Messages of NotUsers never match.
+	Users    UserMatcher
+	NotUsers UserMatcher
+	// MatchDisplayNames makes Users and NotUsers match the display-name tag as well as the login.
+	MatchDisplayNames bool
+
+	// DisplayNames has to match the display-name tag, empty matches every user.
+	DisplayNames UserMatcher
+
+	// UserID is compared with the user-id tag, empty matches every user
+	UserID string
 
 	Count int
+
+	// MaxPerUser limits how many messages of a single user match, 0 for unlimited. It needs UserCounts to be set,
+	// messages are counted there.
+	MaxPerUser int
+	UserCounts *UserCounts
+
+	// MatchModerationTargets makes Users, NotUsers and UserID match the user targeted by CLEARCHATs and CLEARMSGs,
+	// instead of their sender.
+	MatchModerationTargets bool
+
+	// OnReject is called with every message that didn't match and the reason, if set. It has to be safe for concurrent
+	// use if searches run in parallel.
+	OnReject func(msg *Message, result FilterResult)
+	// OnMatch is called with every message that matched before it's passed on, if set. It's called in the same order
+	// as OnReject.
+	OnMatch func(msg *Message)
 }
+
+// FilterResult is the reason a message did or didn't match a Filter. New reasons are added right before ResultCount,
+// so values can change between versions, names returned by String can't.
 type FilterResult uint8
 
 const (
@@ -45,45 +85,146 @@ const (
 	ResultContent
 	ResultUser
 	ResultMaxCountReached
+	ResultMaxPerUserReached
 
 	ResultCount
 )
 
+var filterResultNames = [ResultCount]string{
+	ResultOk:                "ok",
+	ResultDateBeforeStart:   "date_before_start",
+	ResultDateAfterEnd:      "date_after_end",
+	ResultType:              "type",
+	ResultContent:           "content",
+	ResultUser:              "user",
+	ResultMaxCountReached:   "max_count_reached",
+	ResultMaxPerUserReached: "max_per_user_reached",
+}
+
+var filterResultDescriptions = [ResultCount]string{
+	ResultOk:                "ok",
+	ResultDateBeforeStart:   "date before start",
+	ResultDateAfterEnd:      "date after end",
+	ResultType:              "type",
+	ResultContent:           "content",
+	ResultUser:              "user",
+	ResultMaxCountReached:   "limit reached",
+	ResultMaxPerUserReached: "user limit reached",
+}
+
+// String returns the stable name of res, used in JSON.
 func (res FilterResult) String() string {
-	switch res {
-	case ResultOk:
-		return "ok"
-	case ResultDateBeforeStart:
-		return "date before start"
-	case ResultDateAfterEnd:
-		return "date after end"
-	case ResultType:
-		return "type"
-	case ResultContent:
-		return "content"
-	case ResultUser:
-		return "user"
-	case ResultMaxCountReached:
-		return "limit reached"
-	default:
+	if res >= ResultCount {
+		return strconv.FormatInt(int64(res), 10)
+	}
+	return filterResultNames[res]
+}
+
+// Description returns res in words, for people.
+func (res FilterResult) Description() string {
+	if res >= ResultCount {
 		return strconv.FormatInt(int64(res), 10)
 	}
+	return filterResultDescriptions[res]
+}
+
+// ParseFilterResult converts a name returned by FilterResult.String back into a FilterResult.
+func ParseFilterResult(name string) (FilterResult, error) {
+	for res, resName := range filterResultNames {
+		if resName == name {
+			return FilterResult(res), nil
+		}
+	}
+	return ResultCount, errors.New(fmt.Sprintf("unknown filter result %q", name))
+}
+
+func (res FilterResult) MarshalText() ([]byte, error) {
+	if res >= ResultCount {
+		return nil, errors.New(fmt.Sprintf("unknown filter result %d", res))
+	}
+	return []byte(res.String()), nil
+}
+
+func (res *FilterResult) UnmarshalText(text []byte) error {
+	parsed, err := ParseFilterResult(string(text))
+	if err != nil {
+		return err
+	}
+	*res = parsed
+	return nil
+}
+
+// ResultCounts counts messages by FilterResult, it's indexed with them. In JSON it's an object keyed by their names.
+type ResultCounts []int
+
+// NewResultCounts returns ResultCounts with room for every FilterResult.
+func NewResultCounts() ResultCounts {
+	return make(ResultCounts, ResultCount)
+}
+
+// Add adds every count of other to c.
+func (c ResultCounts) Add(other ResultCounts) {
+	for res, count := range other {
+		c[res] += count
+	}
+}
+
+func (c ResultCounts) MarshalJSON() ([]byte, error) {
+	output := make(map[FilterResult]int, len(c))
+	for res, count := range c {
+		output[FilterResult(res)] = count
+	}
+	return json.Marshal(output)
+}
+
+// UnmarshalJSON reads counts written by MarshalJSON. Unknown results, written by newer versions, are ignored. Arrays
+// indexed by FilterResult, like total_results of ProgressState, are read too.
+func (c *ResultCounts) UnmarshalJSON(data []byte) error {
+	var counts []int
+	if json.Unmarshal(data, &counts) == nil {
+		*c = NewResultCounts()
+		for res := 0; res < len(counts) && res < len(*c); res++ {
+			(*c)[res] = counts[res]
+		}
+		return nil
+	}
+	input := make(map[string]int)
+	err := json.Unmarshal(data, &input)
+	if err != nil {
+		return err
+	}
+	*c = NewResultCounts()
+	for name, count := range input {
+		res, err := ParseFilterResult(name)
+		if err != nil {
+			continue
+		}
+		(*c)[res] = count
+	}
+	return nil
 }
 
 // StreamFilter performs Filter on every message from the input channel and puts every message that matched onto the
 // output channel, if the max count of results is reached cancel() is called and results[ResultsMaxCountReached] is set.
 // If the messages are too old, cancel() is called and results[ResultDateBeforeStart] is set.
+// If downloading failed in the middle of the log file, the *FetchError is returned. Messages which matched before it
+// have been put onto output already.
 func (f Filter) StreamFilter(
 	cancel context.CancelFunc,
 	input chan *Message,
 	output chan *Message,
 	progress *ProgressState,
-) []int {
-	results := make([]int, ResultCount)
+) (ResultCounts, error) {
+	results := NewResultCounts()
+	var err error
 	for msg := range input {
 		if msg == nil {
 			break
 		}
+		if msg.fetchErr != nil {
+			err = msg.fetchErr
+			break
+		}
 
 		if f.Count != 0 && progress.TotalResults[ResultOk]+results[ResultOk] >= f.Count {
 			results[ResultMaxCountReached] = 1
@@ -93,7 +234,12 @@ func (f Filter) StreamFilter(
 		result := f.Filter(msg)
 		results[result]++
 		if result == ResultOk {
+			if f.OnMatch != nil {
+				f.OnMatch(msg)
+			}
 			output <- msg
+		} else if f.OnReject != nil {
+			f.OnReject(msg, result)
 		}
 		if result == ResultDateBeforeStart {
 			cancel() // HTTP request is still going, kill it
@@ -101,11 +247,14 @@ func (f Filter) StreamFilter(
 		}
 	}
 	close(output)
-	return results
+	return results, err
 }
 
 // Filter performs all checks necessary to know if a given msg matches the Filter predicates.
 func (f Filter) Filter(msg *Message) FilterResult {
+	if msg.Invalid != nil {
+		return f.filterInvalid(msg)
+	}
 	if msg.Timestamp.After(f.EndDate) {
 		return ResultDateAfterEnd
 	}
@@ -125,28 +274,176 @@ func (f Filter) Filter(msg *Message) FilterResult {
 			return ResultType
 		}
 	}
-	if f.HasMessageRegex && !f.MessageRegex.MatchString(msg.Args[len(msg.Args)-1]) {
+	if f.HasLiteral && !strings.Contains(msg.Raw, f.Literal) {
+		return ResultContent
+	}
+	if f.HasMessageRegex && (len(msg.Args) == 0 || !f.MessageRegex.MatchString(msg.Args[len(msg.Args)-1])) {
+		return ResultContent
+	}
+	if f.HasPatterns && (len(msg.Args) == 0 || !f.Patterns.MatchString(msg.Args[len(msg.Args)-1])) {
+		return ResultContent
+	}
+	if f.HasSystemMessageRegex {
+		systemMessage, ok := msg.Tags["system-msg"]
+		if !ok || !f.SystemMessageRegex.MatchString(systemMessage) {
+			return ResultContent
+		}
+	}
+	if (f.HasLink || f.HasLinkDomainRegex) && !f.matchesLinks(msg) {
 		return ResultContent
 	}
-	switch f.UserMatchType {
-	case DontMatch:
-		break
-	case MatchRegex:
-		if f.UserName != "" && !f.UserRegex.MatchString(msg.User) {
-			return ResultUser
+	if !f.Users.IsEmpty() && !f.matchesUser(msg, f.Users) {
+		return ResultUser
+	}
+	if !f.NotUsers.IsEmpty() && f.matchesUser(msg, f.NotUsers) {
+		return ResultUser
+	}
+	if !f.DisplayNames.IsEmpty() && !f.DisplayNames.Matches(msg.Tags["display-name"]) {
+		return ResultUser
+	}
+	if f.UserID != "" && f.UserID != f.userID(msg) {
+		return ResultUser
+	}
+	if f.MaxPerUser != 0 && !f.UserCounts.take(msg, f.MaxPerUser) {
+		return ResultMaxPerUserReached
+	}
+	return ResultOk
+}
+
+// matchesLinks returns true if msg has a link and, with HasLinkDomainRegex, LinkDomainRegex matches its domain.
+func (f Filter) matchesLinks(msg *Message) bool {
+	for _, link := range ExtractLinks(msg.Text()) {
+		if !f.HasLinkDomainRegex || f.LinkDomainRegex.MatchString(link.Domain) {
+			return true
 		}
+	}
+	return false
+}
 
-		if f.NegativeUserName != "" && f.NegativeUserRegex.MatchString(msg.User) {
-			return ResultUser
+// moderationTarget returns the event of msg if the user filters look at its target.
+func (f Filter) moderationTarget(msg *Message) (ModerationEvent, bool) {
+	if !f.MatchModerationTargets {
+		return ModerationEvent{}, false
+	}
+	return NewModerationEvent(msg)
+}
+
+// userID returns the user id the UserID filter compares.
+func (f Filter) userID(msg *Message) string {
+	if event, ok := f.moderationTarget(msg); ok {
+		return event.TargetID
+	}
+	return msg.Tags["user-id"]
+}
+
+// matchesUser returns true if m matches the login of msg or, with MatchDisplayNames, its display name.
+func (f Filter) matchesUser(msg *Message, m UserMatcher) bool {
+	if event, ok := f.moderationTarget(msg); ok {
+		return m.Matches(event.Target)
+	}
+	if m.Matches(msg.User) {
+		return true
+	}
+	displayName, ok := msg.Tags["display-name"]
+	return f.MatchDisplayNames && ok && m.Matches(displayName)
+}
+
+// MatchedBy tells which of the rules of a filter matched a message, so results can be routed without matching them
+// again.
+type MatchedBy struct {
+	// Pattern is the index of the pattern which matched first, of the patterns given in order, and PatternName its
+	// name or the pattern itself.
+	Pattern     *int   `json:"pattern,omitempty"`
+	PatternName string `json:"pattern_name,omitempty"`
+	// User is the rule which matched the sender, a login, a regex between slashes or "id:" and a user id.
+	User string `json:"user,omitempty"`
+}
+
+// UserRule returns the rule of Users which matched the sender of msg, or of DisplayNames or UserID if Users is empty.
+// It's empty if none of them matched or the filter has no user rules.
+func (f Filter) UserRule(msg *Message) string {
+	if !f.Users.IsEmpty() {
+		if event, ok := f.moderationTarget(msg); ok {
+			return f.Users.Rule(event.Target)
 		}
-	case MatchExact:
-		if f.UserName != "" && f.UserName != msg.User {
-			return ResultUser
+		if rule := f.Users.Rule(msg.User); rule != "" {
+			return rule
 		}
-
-		if f.NegativeUserName != "" && f.NegativeUserName == msg.User {
-			return ResultUser
+		if displayName, ok := msg.Tags["display-name"]; ok && f.MatchDisplayNames {
+			return f.Users.Rule(displayName)
 		}
+		return ""
+	}
+	if !f.DisplayNames.IsEmpty() {
+		return f.DisplayNames.Rule(msg.Tags["display-name"])
+	}
+	if f.UserID != "" && f.UserID == f.userID(msg) {
+		return "id:" + f.UserID
+	}
+	return ""
+}
+
+// UserCounts counts matching messages of every user for Filter.MaxPerUser. Users are told apart by their user-id tag,
+// or their login if it's missing. It's safe for concurrent use, so it can be shared by filters of parallel searches.
+type UserCounts struct {
+	lock   sync.Mutex
+	counts map[string]int
+}
+
+func NewUserCounts() *UserCounts {
+	return &UserCounts{counts: make(map[string]int)}
+}
+
+func userKey(msg *Message) string {
+	if id := msg.Tags["user-id"]; id != "" {
+		return "id:" + id
+	}
+	return "login:" + msg.User
+}
+
+// take counts msg if its user has less than max messages counted. Messages without a user are never limited.
+func (c *UserCounts) take(msg *Message, max int) bool {
+	if msg.User == "" && msg.Tags["user-id"] == "" {
+		return true
+	}
+	key := userKey(msg)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.counts[key] >= max {
+		return false
+	}
+	c.counts[key]++
+	return true
+}
+
+// Count returns how many messages of the sender of msg were counted.
+func (c *UserCounts) Count(msg *Message) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.counts[userKey(msg)]
+}
+
+// filterInvalid checks a line kept with InvalidLineRaw. Only its content can be checked, it's matched against the
+// whole line. Lines can't match filters on users or message types.
+func (f Filter) filterInvalid(msg *Message) FilterResult {
+	if f.HasMessageType {
+		return ResultType
+	}
+	if f.HasLiteral && !strings.Contains(msg.Raw, f.Literal) {
+		return ResultContent
+	}
+	if f.HasMessageRegex && !f.MessageRegex.MatchString(msg.Raw) {
+		return ResultContent
+	}
+	if f.HasPatterns && !f.Patterns.MatchString(msg.Raw) {
+		return ResultContent
+	}
+	if f.HasSystemMessageRegex {
+		// no tags
+		return ResultContent
+	}
+	if !f.Users.IsEmpty() || !f.NotUsers.IsEmpty() || !f.DisplayNames.IsEmpty() || f.UserID != "" {
+		return ResultUser
 	}
 	return ResultOk
 }
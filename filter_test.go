@@ -0,0 +1,251 @@
+package justgrep
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestFilterResultNames(t *testing.T) {
+	seen := make(map[string]bool)
+	for res := ResultOk; res < ResultCount; res++ {
+		name := res.String()
+		if name == "" || seen[name] {
+			t.Errorf("result %d has a missing or duplicate name %q", res, name)
+		}
+		seen[name] = true
+		if res.Description() == "" {
+			t.Errorf("result %s has no description", name)
+		}
+		parsed, err := ParseFilterResult(name)
+		assert(t, "error", err, nil)
+		assert(t, "parsed "+name, parsed, res)
+	}
+	_, err := ParseFilterResult("date before start")
+	if err == nil {
+		t.Errorf("expected descriptions not to be accepted as names")
+	}
+}
+
+func TestResultCountsJSON(t *testing.T) {
+	counts := NewResultCounts()
+	counts[ResultOk] = 3
+	counts[ResultDateBeforeStart] = 1
+	data, err := json.Marshal(counts)
+	assert(t, "error", err, nil)
+	assert(
+		t,
+		"JSON",
+		string(data),
+		`{"content":0,"date_after_end":0,"date_before_start":1,"max_count_reached":0,"max_per_user_reached":0,"ok":3,`+
+			`"type":0,"user":0}`,
+	)
+
+	parsed := ResultCounts{}
+	err = json.Unmarshal([]byte(`{"ok":3,"date_before_start":1,"sampled_out":5}`), &parsed)
+	assert(t, "error", err, nil)
+	assert(t, "length", len(parsed), int(ResultCount))
+	assert(t, "ok", parsed[ResultOk], 3)
+	assert(t, "date before start", parsed[ResultDateBeforeStart], 1)
+
+	other := NewResultCounts()
+	other[ResultOk] = 2
+	parsed.Add(other)
+	assert(t, "ok after Add", parsed[ResultOk], 5)
+}
+
+func TestFilterMaxPerUser(t *testing.T) {
+	filter := Filter{
+		EndDate:    time.Now(),
+		MaxPerUser: 2,
+		UserCounts: NewUserCounts(),
+	}
+	lines := []string{
+		"@tmi-sent-ts=1000;user-id=1 :a!a@a.tmi.twitch.tv PRIVMSG #x :one",
+		"@tmi-sent-ts=1000;user-id=1 :a!a@a.tmi.twitch.tv PRIVMSG #x :two",
+		"@tmi-sent-ts=1000;user-id=2 :b!b@b.tmi.twitch.tv PRIVMSG #x :three",
+		// renamed, still the same user
+		"@tmi-sent-ts=1000;user-id=1 :c!c@c.tmi.twitch.tv PRIVMSG #x :four",
+		"@tmi-sent-ts=1000 :d!d@d.tmi.twitch.tv PRIVMSG #x :five",
+	}
+	expected := []FilterResult{ResultOk, ResultOk, ResultOk, ResultMaxPerUserReached, ResultOk}
+	for i, line := range lines {
+		msg, err := NewMessage(line)
+		assert(t, "error", err, nil)
+		assert(t, "result of "+line, filter.Filter(msg), expected[i])
+	}
+	msg, _ := NewMessage(lines[0])
+	assert(t, "count", filter.UserCounts.Count(msg), 2)
+}
+
+func TestFilterSystemMessage(t *testing.T) {
+	filter := Filter{
+		EndDate:               time.Now(),
+		HasSystemMessageRegex: true,
+		SystemMessageRegex:    regexp.MustCompile("^a gifted a Tier 1 sub"),
+	}
+	lines := []string{
+		`@system-msg=a\sgifted\sa\sTier\s1\ssub\sto\sb!;tmi-sent-ts=1000 :tmi.twitch.tv USERNOTICE #x`,
+		`@system-msg=5\sraiders\sfrom\sa\shave\sjoined!;tmi-sent-ts=1000 :tmi.twitch.tv USERNOTICE #x`,
+		"@tmi-sent-ts=1000 :a!a@a.tmi.twitch.tv PRIVMSG #x :a gifted a Tier 1 sub",
+	}
+	expected := []FilterResult{ResultOk, ResultContent, ResultContent}
+	for i, line := range lines {
+		msg, err := NewMessage(line)
+		assert(t, "error", err, nil)
+		assert(t, "result of "+line, filter.Filter(msg), expected[i])
+	}
+}
+
+func TestFilterDisplayNames(t *testing.T) {
+	lines := []string{
+		"@display-name=WhoAmI;tmi-sent-ts=1000 :whoami!a@a.tmi.twitch.tv PRIVMSG #x :one",
+		"@display-name=정하;tmi-sent-ts=1000 :jeongha!a@a.tmi.twitch.tv PRIVMSG #x :two",
+		"@tmi-sent-ts=1000 :other!a@a.tmi.twitch.tv PRIVMSG #x :three",
+	}
+	filters := map[string]Filter{
+		"display name":       {DisplayNames: NewUserMatcher([]string{"whoami"}, nil)},
+		"display name regex": {DisplayNames: NewUserMatcher(nil, []*regexp.Regexp{regexp.MustCompile("(?i)^who")})},
+		"login only":         {Users: NewUserMatcher([]string{"정하"}, nil)},
+		"any name":           {Users: NewUserMatcher([]string{"정하"}, nil), MatchDisplayNames: true},
+		"negative any name":  {NotUsers: NewUserMatcher([]string{"정하"}, nil), MatchDisplayNames: true},
+	}
+	expected := map[string][]FilterResult{
+		"display name":       {ResultOk, ResultUser, ResultUser},
+		"display name regex": {ResultOk, ResultUser, ResultUser},
+		"login only":         {ResultUser, ResultUser, ResultUser},
+		"any name":           {ResultUser, ResultOk, ResultUser},
+		"negative any name":  {ResultOk, ResultUser, ResultOk},
+	}
+	for name, filter := range filters {
+		filter.EndDate = time.Now()
+		for i, line := range lines {
+			msg, err := NewMessage(line)
+			assert(t, "error", err, nil)
+			assert(t, name+": result of "+line, filter.Filter(msg), expected[name][i])
+		}
+	}
+}
+
+func TestFilterUserSetAndRegex(t *testing.T) {
+	filter := Filter{
+		EndDate:  time.Now(),
+		Users:    NewUserMatcher([]string{"Pajlada", "forsen"}, []*regexp.Regexp{regexp.MustCompile("bot$")}),
+		NotUsers: NewUserMatcher([]string{"supibot"}, []*regexp.Regexp{regexp.MustCompile("^streamelements")}),
+	}
+	results := map[string]FilterResult{
+		"pajlada":           ResultOk,
+		"forsen":            ResultOk,
+		"fossabot":          ResultOk,
+		"supibot":           ResultUser,
+		"streamelementsbot": ResultUser,
+		"someone":           ResultUser,
+	}
+	for user, expected := range results {
+		msg, err := NewMessage("@tmi-sent-ts=1000 :" + user + "!a@a.tmi.twitch.tv PRIVMSG #x :hello")
+		assert(t, "error", err, nil)
+		assert(t, "result of "+user, filter.Filter(msg), expected)
+	}
+}
+
+func TestFilterUserRule(t *testing.T) {
+	filter := Filter{
+		Users:             NewUserMatcher([]string{"pajlada"}, []*regexp.Regexp{regexp.MustCompile("bot$")}),
+		MatchDisplayNames: true,
+	}
+	rules := map[string]string{
+		"@tmi-sent-ts=1000 :pajlada!a@a.tmi.twitch.tv PRIVMSG #x :hi":                      "pajlada",
+		"@tmi-sent-ts=1000 :fossabot!a@a.tmi.twitch.tv PRIVMSG #x :hi":                     "/bot$/",
+		"@display-name=Pajlada;tmi-sent-ts=1000 :other!a@a.tmi.twitch.tv PRIVMSG #x :hi":   "pajlada",
+		"@display-name=Someone;tmi-sent-ts=1000 :someone!a@a.tmi.twitch.tv PRIVMSG #x :hi": "",
+	}
+	for line, expected := range rules {
+		msg, err := NewMessage(line)
+		assert(t, "error", err, nil)
+		assert(t, "rule of "+line, filter.UserRule(msg), expected)
+	}
+
+	filter = Filter{UserID: "103"}
+	msg, err := NewMessage("@user-id=103;tmi-sent-ts=1000 :user3!a@a.tmi.twitch.tv PRIVMSG #x :hello")
+	assert(t, "error", err, nil)
+	assert(t, "rule of a user id", filter.UserRule(msg), "id:103")
+	assert(t, "no rules", Filter{}.UserRule(msg), "")
+}
+
+func TestStreamFilterCallbackOrder(t *testing.T) {
+	var order []string
+	filter := Filter{
+		EndDate:         time.Now(),
+		HasMessageRegex: true,
+		MessageRegex:    regexp.MustCompile("^match"),
+		OnReject: func(msg *Message, result FilterResult) {
+			order = append(order, "reject "+msg.Text())
+		},
+		OnMatch: func(msg *Message) {
+			order = append(order, "match "+msg.Text())
+		},
+	}
+	input := make(chan *Message, 10)
+	output := make(chan *Message, 10)
+	for _, text := range []string{"match 1", "other 2", "other 3", "match 4"} {
+		msg, err := NewMessage("@tmi-sent-ts=1000 :a!a@a.tmi.twitch.tv PRIVMSG #x :" + text)
+		assert(t, "error", err, nil)
+		input <- msg
+	}
+	close(input)
+	_, err := filter.StreamFilter(func() {}, input, output, &ProgressState{TotalResults: NewResultCounts()})
+	assert(t, "error", err, nil)
+	assertStrSlc(t, "callbacks", order, []string{"match match 1", "reject other 2", "reject other 3", "match match 4"})
+}
+
+func TestFilterModerationTargets(t *testing.T) {
+	filter := Filter{
+		EndDate:                time.Now(),
+		Users:                  NewUserMatcher([]string{"user3"}, nil),
+		MatchModerationTargets: true,
+	}
+	results := map[string]FilterResult{
+		"@target-user-id=103;tmi-sent-ts=1000 :tmi.twitch.tv CLEARCHAT #x :user3":          ResultOk,
+		"@target-user-id=104;tmi-sent-ts=1000 :tmi.twitch.tv CLEARCHAT #x :someone":        ResultUser,
+		"@login=user3;target-msg-id=a;tmi-sent-ts=1000 :tmi.twitch.tv CLEARMSG #x :hi":     ResultOk,
+		"@user-id=103;tmi-sent-ts=1000 :user3!user3@user3.tmi.twitch.tv PRIVMSG #x :hello": ResultOk,
+		"@user-id=104;tmi-sent-ts=1000 :other!other@other.tmi.twitch.tv PRIVMSG #x :hello": ResultUser,
+	}
+	for line, expected := range results {
+		msg, err := NewMessage(line)
+		assert(t, "error", err, nil)
+		assert(t, "result of "+line, filter.Filter(msg), expected)
+	}
+
+	filter = Filter{EndDate: time.Now(), UserID: "103", MatchModerationTargets: true}
+	msg, err := NewMessage("@target-user-id=103;tmi-sent-ts=1000 :tmi.twitch.tv CLEARCHAT #x :user3")
+	assert(t, "error", err, nil)
+	assert(t, "result of a CLEARCHAT by user id", filter.Filter(msg), ResultOk)
+}
+
+func TestFilterLinks(t *testing.T) {
+	lines := []string{
+		"@tmi-sent-ts=1000 :a!a@a.tmi.twitch.tv PRIVMSG #x :no link",
+		"@tmi-sent-ts=1000 :a!a@a.tmi.twitch.tv PRIVMSG #x :watch https://youtube.com/watch?v=a",
+		"@tmi-sent-ts=1000 :a!a@a.tmi.twitch.tv PRIVMSG #x :free skins at skins dot ru",
+	}
+	filters := map[string]Filter{
+		"has link":    {HasLink: true},
+		"domain":      {HasLinkDomainRegex: true, LinkDomainRegex: regexp.MustCompile(`\.ru$`)},
+		"link+domain": {HasLink: true, HasLinkDomainRegex: true, LinkDomainRegex: regexp.MustCompile(`youtube`)},
+	}
+	expected := map[string][]FilterResult{
+		"has link":    {ResultContent, ResultOk, ResultOk},
+		"domain":      {ResultContent, ResultContent, ResultOk},
+		"link+domain": {ResultContent, ResultOk, ResultContent},
+	}
+	for name, filter := range filters {
+		filter.EndDate = time.Now()
+		for i, line := range lines {
+			msg, err := NewMessage(line)
+			assert(t, "error", err, nil)
+			assert(t, name+": result of "+line, filter.Filter(msg), expected[name][i])
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package justgrep
+
+import (
+	"sort"
+	"time"
+)
+
+// Gap is a period without any messages.
+type Gap struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func (g Gap) Duration() time.Duration {
+	return g.End.Sub(g.Start)
+}
+
+// FindGaps finds periods between start and end longer than threshold which don't contain any of timestamps.
+// timestamps are sorted in place.
+func FindGaps(timestamps []time.Time, start time.Time, end time.Time, threshold time.Duration) []Gap {
+	sort.Slice(
+		timestamps, func(i, j int) bool {
+			return timestamps[i].Before(timestamps[j])
+		},
+	)
+	var output []Gap
+	previous := start
+	for _, timestamp := range timestamps {
+		if timestamp.Before(start) || timestamp.After(end) {
+			continue
+		}
+		if timestamp.Sub(previous) > threshold {
+			output = append(output, Gap{Start: previous, End: timestamp})
+		}
+		previous = timestamp
+	}
+	if end.Sub(previous) > threshold {
+		output = append(output, Gap{Start: previous, End: end})
+	}
+	return output
+}
+
+// Session is a period of activity, messages in it are never further apart than the gap it was found with.
+type Session struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Messages int       `json:"messages"`
+}
+
+func (s Session) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// FindSessions splits timestamps into sessions separated by periods longer than gap without messages. timestamps are
+// sorted in place.
+func FindSessions(timestamps []time.Time, gap time.Duration) []Session {
+	sort.Slice(
+		timestamps, func(i, j int) bool {
+			return timestamps[i].Before(timestamps[j])
+		},
+	)
+	var output []Session
+	for i, timestamp := range timestamps {
+		if i == 0 || timestamp.Sub(output[len(output)-1].End) > gap {
+			output = append(output, Session{Start: timestamp})
+		}
+		current := &output[len(output)-1]
+		current.End = timestamp
+		current.Messages++
+	}
+	return output
+}
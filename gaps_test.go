@@ -0,0 +1,37 @@
+package justgrep
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindGaps(t *testing.T) {
+	base := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hour int) time.Time {
+		return base.Add(time.Duration(hour) * time.Hour)
+	}
+	gaps := FindGaps([]time.Time{at(10), at(1), at(2), at(30)}, at(0), at(24), 3*time.Hour)
+	assert(t, "count", len(gaps), 2)
+	assert(t, "first", gaps[0], Gap{Start: at(2), End: at(10)})
+	assert(t, "last", gaps[1], Gap{Start: at(10), End: at(24)})
+	assert(t, "duration", gaps[1].Duration(), 14*time.Hour)
+
+	gaps = FindGaps(nil, at(0), at(24), time.Hour)
+	assert(t, "no messages", len(gaps), 1)
+	assert(t, "whole range", gaps[0], Gap{Start: at(0), End: at(24)})
+}
+
+func TestFindSessions(t *testing.T) {
+	base := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minute int) time.Time {
+		return base.Add(time.Duration(minute) * time.Minute)
+	}
+	sessions := FindSessions([]time.Time{at(100), at(0), at(20), at(50), at(200), at(130)}, 30*time.Minute)
+	assert(t, "count", len(sessions), 3)
+	assert(t, "first", sessions[0], Session{Start: at(0), End: at(50), Messages: 3})
+	assert(t, "second", sessions[1], Session{Start: at(100), End: at(130), Messages: 2})
+	assert(t, "last", sessions[2], Session{Start: at(200), End: at(200), Messages: 1})
+	assert(t, "duration", sessions[0].Duration(), 50*time.Minute)
+
+	assert(t, "no messages", len(FindSessions(nil, time.Hour)), 0)
+}
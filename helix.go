@@ -0,0 +1,174 @@
+package justgrep
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const HelixURL = "https://api.twitch.tv/helix"
+const TwitchTokenURL = "https://id.twitch.tv/oauth2/token"
+
+// HelixClient makes requests to Twitch's Helix API. If Token is empty, an app access token is requested with ClientID
+// and ClientSecret before the first request.
+type HelixClient struct {
+	ClientID     string
+	ClientSecret string
+	Token        string
+
+	// BaseURL and TokenURL default to HelixURL and TwitchTokenURL
+	BaseURL  string
+	TokenURL string
+
+	HTTP *http.Client
+
+	lock sync.Mutex
+}
+
+func (c *HelixClient) httpClient() *http.Client {
+	if c.HTTP == nil {
+		return http.DefaultClient
+	}
+	return c.HTTP
+}
+
+// token returns the token used for requests, requesting an app access token if needed.
+func (c *HelixClient) token(ctx context.Context) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.Token != "" {
+		return c.Token, nil
+	}
+	if c.ClientID == "" || c.ClientSecret == "" {
+		return "", errors.New("helix: either a token or a client id and secret are needed")
+	}
+	tokenURL := c.TokenURL
+	if tokenURL == "" {
+		tokenURL = TwitchTokenURL
+	}
+	form := url.Values{}
+	form.Set("client_id", c.ClientID)
+	form.Set("client_secret", c.ClientSecret)
+	form.Set("grant_type", "client_credentials")
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(fmt.Sprintf("helix: requesting an app access token failed: %s", resp.Status))
+	}
+	output := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&output)
+	if err != nil {
+		return "", err
+	}
+	c.Token = output.AccessToken
+	return c.Token, nil
+}
+
+// get makes a GET request to a Helix endpoint and decodes the response into output.
+func (c *HelixClient) get(ctx context.Context, endpoint string, query url.Values, output interface{}) error {
+	token, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = HelixURL
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Client-Id", c.ClientID)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("helix: request to %s failed: %s", endpoint, resp.Status))
+	}
+	return json.NewDecoder(resp.Body).Decode(output)
+}
+
+type HelixVideo struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	UserLogin string    `json:"user_login"`
+	Title     string    `json:"title"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Duration is formatted like "3h8m33s"
+	Duration string `json:"duration"`
+}
+
+// GetVideo fetches information about a single video, for example a VOD.
+func (c *HelixClient) GetVideo(ctx context.Context, id string) (*HelixVideo, error) {
+	query := url.Values{}
+	query.Set("id", id)
+	output := struct {
+		Data []HelixVideo `json:"data"`
+	}{}
+	err := c.get(ctx, "/videos", query, &output)
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Data) == 0 {
+		return nil, errors.New(fmt.Sprintf("helix: video %s not found", id))
+	}
+	return &output.Data[0], nil
+}
+
+type HelixUser struct {
+	ID          string `json:"id"`
+	Login       string `json:"login"`
+	DisplayName string `json:"display_name"`
+}
+
+// helixMaxUsers is how many users can be requested from /users at once.
+const helixMaxUsers = 100
+
+// GetUsers looks users up by their logins or ids. Users which don't exist, for example because they were banned or
+// renamed, are missing from the output.
+func (c *HelixClient) GetUsers(ctx context.Context, logins []string, ids []string) ([]HelixUser, error) {
+	type lookup struct {
+		key    string
+		values []string
+	}
+	users := make([]HelixUser, 0, len(logins)+len(ids))
+	for _, lookup := range []lookup{{"login", logins}, {"id", ids}} {
+		for begin := 0; begin < len(lookup.values); begin += helixMaxUsers {
+			end := begin + helixMaxUsers
+			if end > len(lookup.values) {
+				end = len(lookup.values)
+			}
+			query := url.Values{lookup.key: lookup.values[begin:end]}
+			output := struct {
+				Data []HelixUser `json:"data"`
+			}{}
+			err := c.get(ctx, "/users", query, &output)
+			if err != nil {
+				return nil, err
+			}
+			users = append(users, output.Data...)
+		}
+	}
+	return users, nil
+}
@@ -0,0 +1,82 @@
+package justgrep
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHelixGetVideo(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/token":
+					assert(t, "client_secret", r.FormValue("client_secret"), "secret")
+					_, _ = w.Write([]byte(`{"access_token":"app-token"}`))
+				case "/videos":
+					assert(t, "authorization", r.Header.Get("Authorization"), "Bearer app-token")
+					assert(t, "client id", r.Header.Get("Client-Id"), "id")
+					assert(t, "video id", r.URL.Query().Get("id"), "1234")
+					_, _ = w.Write(
+						[]byte(`{"data":[{"id":"1234","created_at":"2021-01-01T10:00:00Z","duration":"3h8m33s"}]}`),
+					)
+				default:
+					http.NotFound(w, r)
+				}
+			},
+		),
+	)
+	defer server.Close()
+
+	client := &HelixClient{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		BaseURL:      server.URL,
+		TokenURL:     server.URL + "/token",
+	}
+	video, err := client.GetVideo(context.Background(), "1234")
+	assert(t, "error", err, nil)
+	vod, err := NewVODFromHelix(video)
+	assert(t, "error", err, nil)
+	assert(t, "start", vod.Start, time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC))
+	assert(t, "duration", vod.Duration, 3*time.Hour+8*time.Minute+33*time.Second)
+}
+
+func TestHelixGetUsers(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				query := r.URL.Query()
+				if len(query["login"]) > helixMaxUsers || len(query["id"]) > helixMaxUsers {
+					t.Errorf("too many users requested at once")
+				}
+				body := `{"data":[`
+				for i, id := range query["id"] {
+					if i != 0 {
+						body += ","
+					}
+					body += `{"id":"` + id + `","login":"user` + id + `","display_name":"User` + id + `"}`
+				}
+				_, _ = w.Write([]byte(body + "]}"))
+			},
+		),
+	)
+	defer server.Close()
+
+	ids := make([]string, 150)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i)
+	}
+	client := &HelixClient{ClientID: "id", Token: "token", BaseURL: server.URL}
+	users, err := client.GetUsers(context.Background(), nil, ids)
+	assert(t, "error", err, nil)
+	assert(t, "requests", requests, 2)
+	assert(t, "user count", len(users), 150)
+	assert(t, "last user", users[149], HelixUser{ID: "149", Login: "user149", DisplayName: "User149"})
+}
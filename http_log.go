@@ -0,0 +1,257 @@
+package justgrep
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HTTPLogEntry describes a single request made through an HTTPLog.
+type HTTPLogEntry struct {
+	Start  time.Time `json:"start"`
+	Method string    `json:"method"`
+	// URL has any password removed
+	URL string `json:"url"`
+
+	// Status is zero if the request failed without a response, Error says why.
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	// RequestHeaders never contain the Authorization and Cookie headers, ResponseHeaders never contain Set-Cookie.
+	RequestHeaders  http.Header `json:"request_headers,omitempty"`
+	ResponseHeaders http.Header `json:"response_headers,omitempty"`
+
+	// Bytes counts the bytes of the response body that were read before it was closed.
+	Bytes int64 `json:"bytes"`
+
+	// Wait is the time until the response headers arrived, Time also includes reading the body.
+	Wait time.Duration `json:"wait_ns"`
+	Time time.Duration `json:"time_ns"`
+}
+
+// HTTPLog records metadata of every request made through its RoundTripper. An entry is complete once the response
+// body is closed or the request failed. It's safe for concurrent use.
+type HTTPLog struct {
+	// OnEntry is called with every completed entry, if set. Calls are serialized.
+	OnEntry func(entry HTTPLogEntry)
+
+	lock    sync.Mutex
+	entries []HTTPLogEntry
+}
+
+func (l *HTTPLog) add(entry HTTPLogEntry) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.entries = append(l.entries, entry)
+	if l.OnEntry != nil {
+		l.OnEntry(entry)
+	}
+}
+
+// Entries returns the completed entries sorted by the time their requests started.
+func (l *HTTPLog) Entries() []HTTPLogEntry {
+	l.lock.Lock()
+	output := make([]HTTPLogEntry, len(l.entries))
+	copy(output, l.entries)
+	l.lock.Unlock()
+	sort.SliceStable(
+		output, func(i, j int) bool {
+			return output[i].Start.Before(output[j].Start)
+		},
+	)
+	return output
+}
+
+// RoundTripper wraps base to record every request made through it.
+func (l *HTTPLog) RoundTripper(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &logRoundTripper{base: base, log: l}
+}
+
+type logRoundTripper struct {
+	base http.RoundTripper
+	log  *HTTPLog
+}
+
+func (t *logRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry := HTTPLogEntry{
+		Start:          time.Now(),
+		Method:         req.Method,
+		URL:            req.URL.Redacted(),
+		RequestHeaders: req.Header.Clone(),
+	}
+	if entry.RequestHeaders != nil {
+		entry.RequestHeaders.Del("Authorization")
+		entry.RequestHeaders.Del("Cookie")
+	}
+	resp, err := t.base.RoundTrip(req)
+	entry.Wait = time.Since(entry.Start)
+	if err != nil {
+		entry.Error = err.Error()
+		entry.Time = entry.Wait
+		t.log.add(entry)
+		return resp, err
+	}
+	entry.Status = resp.StatusCode
+	entry.ResponseHeaders = resp.Header.Clone()
+	entry.ResponseHeaders.Del("Set-Cookie")
+	resp.Body = &loggedBody{ReadCloser: resp.Body, entry: entry, log: t.log}
+	return resp, nil
+}
+
+type loggedBody struct {
+	io.ReadCloser
+	entry HTTPLogEntry
+	log   *HTTPLog
+	once  sync.Once
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.entry.Bytes += int64(n)
+	return n, err
+}
+
+func (b *loggedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(
+		func() {
+			b.entry.Time = time.Since(b.entry.Start)
+			b.log.add(b.entry)
+		},
+	)
+	return err
+}
+
+// WriteHAR writes the completed entries as an HTTP Archive (HAR 1.2), which browser developer tools can import.
+// Bodies aren't recorded, so their contents are left empty.
+func (l *HTTPLog) WriteHAR(w io.Writer, creatorVersion string) error {
+	entries := l.Entries()
+	har := harLog{Version: "1.2", Creator: harCreator{Name: "justgrep", Version: creatorVersion}}
+	har.Entries = make([]harEntry, 0, len(entries))
+	for _, entry := range entries {
+		har.Entries = append(har.Entries, newHAREntry(entry))
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(map[string]harLog{"log": har})
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func harMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	output := make([]harNameValue, 0, len(header))
+	for name, values := range header {
+		for _, value := range values {
+			output = append(output, harNameValue{Name: name, Value: value})
+		}
+	}
+	sort.SliceStable(
+		output, func(i, j int) bool {
+			return output[i].Name < output[j].Name
+		},
+	)
+	return output
+}
+
+func newHAREntry(entry HTTPLogEntry) harEntry {
+	return harEntry{
+		StartedDateTime: entry.Start,
+		Time:            harMilliseconds(entry.Time),
+		Request: harRequest{
+			Method:      entry.Method,
+			URL:         entry.URL,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(entry.RequestHeaders),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Response: harResponse{
+			Status:      entry.Status,
+			StatusText:  http.StatusText(entry.Status),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(entry.ResponseHeaders),
+			Content: harContent{
+				Size:     entry.Bytes,
+				MimeType: entry.ResponseHeaders.Get("Content-Type"),
+			},
+			HeadersSize: -1,
+			BodySize:    entry.Bytes,
+		},
+		Timings: harTimings{
+			Wait:    harMilliseconds(entry.Wait),
+			Receive: harMilliseconds(entry.Time - entry.Wait),
+		},
+		Comment: entry.Error,
+	}
+}
@@ -0,0 +1,77 @@
+package justgrep
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPLog(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/channels" {
+					http.NotFound(w, r)
+					return
+				}
+				_, _ = w.Write([]byte(`{"channels":[]}`))
+			},
+		),
+	)
+	defer server.Close()
+
+	log := &HTTPLog{}
+	completed := 0
+	log.OnEntry = func(entry HTTPLogEntry) {
+		completed++
+	}
+	client := &http.Client{Transport: log.RoundTripper(nil)}
+	for _, path := range []string{"/channels", "/missing"} {
+		req, err := http.NewRequest("GET", server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	entries := log.Entries()
+	assert(t, "entry count", len(entries), 2)
+	assert(t, "completed count", completed, 2)
+	assert(t, "url", entries[0].URL, server.URL+"/channels")
+	assert(t, "status", entries[0].Status, 200)
+	assert(t, "bytes", entries[0].Bytes, int64(len(`{"channels":[]}`)))
+	assert(t, "authorization", entries[0].RequestHeaders.Get("Authorization"), "")
+	assert(t, "missing status", entries[1].Status, 404)
+
+	buf := &bytes.Buffer{}
+	err := log.WriteHAR(buf, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var har struct {
+		Log struct {
+			Version string `json:"version"`
+			Entries []struct {
+				Response struct {
+					Status int `json:"status"`
+				} `json:"response"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "HAR version", har.Log.Version, "1.2")
+	assert(t, "HAR entry count", len(har.Log.Entries), 2)
+	assert(t, "HAR status", har.Log.Entries[1].Response.Status, 404)
+}
@@ -0,0 +1,165 @@
+package justgrep
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencySamples is how many latencies of every instance are kept to estimate the 95th percentile.
+const latencySamples = 1000
+
+// InstanceStats describes how a single justlog instance behaved during a search.
+type InstanceStats struct {
+	Requests int `json:"requests"`
+	// Retries counts broken downloads which were continued with another request.
+	Retries int   `json:"retries"`
+	Errors  int   `json:"errors"`
+	Bytes   int64 `json:"bytes"`
+
+	// ErrorsByStatus counts failed requests by HTTP status code, requests which failed without a response are counted
+	// as "network".
+	ErrorsByStatus map[string]int `json:"errors_by_status,omitempty"`
+
+	MeanLatency time.Duration `json:"mean_latency_ns"`
+	P95Latency  time.Duration `json:"p95_latency_ns"`
+
+	totalLatency time.Duration
+	// latencies is a uniform sample of at most latencySamples latencies
+	latencies []time.Duration
+}
+
+// InstanceStatsRecorder collects InstanceStats for every instance requests are made to. It's safe for concurrent use.
+type InstanceStatsRecorder struct {
+	lock      sync.Mutex
+	instances map[string]*InstanceStats
+}
+
+func NewInstanceStatsRecorder() *InstanceStatsRecorder {
+	return &InstanceStatsRecorder{instances: make(map[string]*InstanceStats)}
+}
+
+// get returns the stats of an instance, the lock must be held.
+func (r *InstanceStatsRecorder) get(instance string) *InstanceStats {
+	stats, ok := r.instances[instance]
+	if !ok {
+		stats = &InstanceStats{ErrorsByStatus: make(map[string]int)}
+		r.instances[instance] = stats
+	}
+	return stats
+}
+
+// RecordRetry notes that a request to instance had to be repeated.
+func (r *InstanceStatsRecorder) RecordRetry(instance string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.get(instance).Retries++
+}
+
+func (r *InstanceStatsRecorder) recordResponse(instance string, latency time.Duration, status string, failed bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	stats := r.get(instance)
+	stats.Requests++
+	stats.totalLatency += latency
+	if len(stats.latencies) < latencySamples {
+		stats.latencies = append(stats.latencies, latency)
+	} else if i := rand.Intn(stats.Requests); i < latencySamples {
+		// reservoir sampling, every latency has the same chance to be kept
+		stats.latencies[i] = latency
+	}
+	if failed {
+		stats.Errors++
+		stats.ErrorsByStatus[status]++
+	}
+}
+
+func (r *InstanceStatsRecorder) recordBytes(instance string, count int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.get(instance).Bytes += int64(count)
+}
+
+// Snapshot returns a copy of the current stats, keyed by instance.
+func (r *InstanceStatsRecorder) Snapshot() map[string]InstanceStats {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	output := make(map[string]InstanceStats, len(r.instances))
+	for instance, stats := range r.instances {
+		cpy := *stats
+		cpy.ErrorsByStatus = make(map[string]int, len(stats.ErrorsByStatus))
+		for status, count := range stats.ErrorsByStatus {
+			cpy.ErrorsByStatus[status] = count
+		}
+		cpy.latencies = nil
+		if len(stats.latencies) != 0 {
+			sorted := make([]time.Duration, len(stats.latencies))
+			copy(sorted, stats.latencies)
+			sort.Slice(
+				sorted, func(i, j int) bool {
+					return sorted[i] < sorted[j]
+				},
+			)
+			cpy.MeanLatency = stats.totalLatency / time.Duration(stats.Requests)
+			cpy.P95Latency = sorted[(len(sorted)*95+99)/100-1]
+		}
+		output[instance] = cpy
+	}
+	return output
+}
+
+func (r *InstanceStatsRecorder) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.Snapshot())
+}
+
+// RoundTripper wraps base to record statistics about every request made through it.
+func (r *InstanceStatsRecorder) RoundTripper(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &statsRoundTripper{base: base, recorder: r}
+}
+
+type statsRoundTripper struct {
+	base     http.RoundTripper
+	recorder *InstanceStatsRecorder
+}
+
+// statsInstance returns the instance requests to u are counted for, without user info as stats are meant to be shown.
+func statsInstance(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+func (t *statsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	instance := statsInstance(req.URL)
+	begin := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	latency := time.Since(begin)
+	if err != nil {
+		t.recorder.recordResponse(instance, latency, "network", true)
+		return resp, err
+	}
+	t.recorder.recordResponse(instance, latency, strconv.Itoa(resp.StatusCode), resp.StatusCode >= 400)
+	resp.Body = &countingBody{ReadCloser: resp.Body, instance: instance, recorder: t.recorder}
+	return resp, nil
+}
+
+type countingBody struct {
+	io.ReadCloser
+	instance string
+	recorder *InstanceStatsRecorder
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n != 0 {
+		b.recorder.recordBytes(b.instance, n)
+	}
+	return n, err
+}
@@ -0,0 +1,139 @@
+package justgrep
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstanceStatsLatency(t *testing.T) {
+	recorder := NewInstanceStatsRecorder()
+	// 1ms to 100ms, out of order
+	for i := 100; i > 0; i-- {
+		recorder.recordResponse("https://logs.example.com", time.Duration(i)*time.Millisecond, "200", false)
+	}
+	stats := recorder.Snapshot()["https://logs.example.com"]
+	assert(t, "requests", stats.Requests, 100)
+	assert(t, "mean", stats.MeanLatency, 50500*time.Microsecond)
+	assert(t, "p95", stats.P95Latency, 95*time.Millisecond)
+
+	recorder = NewInstanceStatsRecorder()
+	recorder.recordResponse("https://logs.example.com", time.Second, "200", false)
+	stats = recorder.Snapshot()["https://logs.example.com"]
+	assert(t, "single mean", stats.MeanLatency, time.Second)
+	assert(t, "single p95", stats.P95Latency, time.Second)
+}
+
+func TestInstanceStatsBounded(t *testing.T) {
+	recorder := NewInstanceStatsRecorder()
+	for i := 0; i < latencySamples*3; i++ {
+		latency := time.Millisecond
+		if i%10 == 0 {
+			latency = time.Second
+		}
+		recorder.recordResponse("https://logs.example.com", latency, "200", false)
+	}
+	assert(t, "kept latencies", len(recorder.instances["https://logs.example.com"].latencies), latencySamples)
+	stats := recorder.Snapshot()["https://logs.example.com"]
+	assert(t, "requests", stats.Requests, latencySamples*3)
+	// the mean counts every response, not only the sample
+	assert(t, "mean", stats.MeanLatency, 100900*time.Microsecond)
+	assert(t, "p95", stats.P95Latency, time.Second)
+}
+
+func TestInstanceStatsErrors(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/missing":
+					http.NotFound(w, r)
+				case "/broken":
+					w.WriteHeader(http.StatusInternalServerError)
+				default:
+					_, _ = w.Write([]byte("hello"))
+				}
+			},
+		),
+	)
+	defer server.Close()
+
+	recorder := NewInstanceStatsRecorder()
+	client := &http.Client{Transport: recorder.RoundTripper(nil)}
+	for _, path := range []string{"/", "/", "/missing", "/broken", "/missing"} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+	// nothing listens on port 1
+	_, err := client.Get("http://127.0.0.1:1/")
+	assert(t, "network error", err != nil, true)
+	recorder.RecordRetry(server.URL)
+
+	snapshot := recorder.Snapshot()
+	stats := snapshot[server.URL]
+	assert(t, "requests", stats.Requests, 5)
+	assert(t, "errors", stats.Errors, 3)
+	assert(t, "retries", stats.Retries, 1)
+	assert(t, "bytes", stats.Bytes, int64(10+2*len("404 page not found\n")))
+	assert(t, "404", stats.ErrorsByStatus["404"], 2)
+	assert(t, "500", stats.ErrorsByStatus["500"], 1)
+	assert(t, "error kinds", len(stats.ErrorsByStatus), 2)
+	unreachable := snapshot["http://127.0.0.1:1"]
+	assert(t, "network", unreachable.ErrorsByStatus["network"], 1)
+
+	// snapshots are copies
+	stats.ErrorsByStatus["404"] = 0
+	assert(t, "copied", recorder.Snapshot()[server.URL].ErrorsByStatus["404"], 2)
+}
+
+func TestInstanceStatsJSON(t *testing.T) {
+	recorder := NewInstanceStatsRecorder()
+	recorder.recordResponse("https://logs.example.com", 2*time.Millisecond, "200", false)
+	recorder.recordResponse("https://logs.example.com", 4*time.Millisecond, "503", true)
+	recorder.recordBytes("https://logs.example.com", 42)
+
+	marshalled, err := json.Marshal(recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]map[string]interface{}
+	err = json.Unmarshal(marshalled, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := decoded["https://logs.example.com"]
+	var keys []string
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	assert(
+		t,
+		"keys",
+		strings.Join(keys, " "),
+		"bytes errors errors_by_status mean_latency_ns p95_latency_ns requests retries",
+	)
+	assert(t, "requests", stats["requests"], float64(2))
+	assert(t, "bytes", stats["bytes"], float64(42))
+	assert(t, "mean", stats["mean_latency_ns"], float64(3*time.Millisecond))
+	assert(t, "p95", stats["p95_latency_ns"], float64(4*time.Millisecond))
+	assert(t, "errors by status", stats["errors_by_status"].(map[string]interface{})["503"], float64(1))
+
+	// without errors the breakdown is left out
+	recorder = NewInstanceStatsRecorder()
+	recorder.recordResponse("https://logs.example.com", time.Millisecond, "200", false)
+	marshalled, err = json.Marshal(recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "no errors", strings.Contains(string(marshalled), "errors_by_status"), false)
+}
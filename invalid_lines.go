@@ -0,0 +1,74 @@
+package justgrep
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// InvalidLinePolicy decides what happens to lines of log files which can't be parsed.
+type InvalidLinePolicy uint8
+
+const (
+	// InvalidLineAbort stops reading the log file at the first invalid line.
+	InvalidLineAbort InvalidLinePolicy = iota
+	// InvalidLineSkip ignores invalid lines and keeps reading.
+	InvalidLineSkip
+	// InvalidLineRaw passes invalid lines on as messages which only have Raw and Invalid set.
+	InvalidLineRaw
+)
+
+func (p InvalidLinePolicy) String() string {
+	switch p {
+	case InvalidLineAbort:
+		return "abort"
+	case InvalidLineSkip:
+		return "skip"
+	case InvalidLineRaw:
+		return "raw"
+	default:
+		return fmt.Sprintf("InvalidLinePolicy(%d)", p)
+	}
+}
+
+// ParseInvalidLinePolicy converts the name of a policy ("abort", "skip" or "raw") into an InvalidLinePolicy.
+func ParseInvalidLinePolicy(name string) (InvalidLinePolicy, error) {
+	switch name {
+	case "abort", "":
+		return InvalidLineAbort, nil
+	case "skip":
+		return InvalidLineSkip, nil
+	case "raw":
+		return InvalidLineRaw, nil
+	default:
+		return InvalidLineAbort, errors.New(
+			fmt.Sprintf("unknown invalid line policy %q, expected skip, raw or abort", name),
+		)
+	}
+}
+
+// NewInvalidMessage wraps a line which couldn't be parsed because of err, for InvalidLineRaw.
+func NewInvalidMessage(line string, err error) *Message {
+	return &Message{Raw: line, Invalid: err}
+}
+
+// handleInvalidLine counts an invalid line from source and applies policy to it. The returned message, if any, should
+// be passed on. If ok is false, reading has to stop.
+func handleInvalidLine(
+	policy InvalidLinePolicy,
+	source string,
+	line string,
+	err error,
+	progress *ProgressState,
+) (msg *Message, ok bool) {
+	progress.InvalidLines += 1
+	switch policy {
+	case InvalidLineSkip:
+		return nil, true
+	case InvalidLineRaw:
+		return NewInvalidMessage(line, err), true
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "Invalid line in %s: %s\n", source, err)
+		return nil, false
+	}
+}
@@ -0,0 +1,107 @@
+package justgrep
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseInvalidLinePolicy(t *testing.T) {
+	for _, policy := range []InvalidLinePolicy{InvalidLineAbort, InvalidLineSkip, InvalidLineRaw} {
+		parsed, err := ParseInvalidLinePolicy(policy.String())
+		assert(t, "error", err, nil)
+		assert(t, "policy", parsed, policy)
+	}
+	_, err := ParseInvalidLinePolicy("ignore")
+	if err == nil {
+		t.Errorf("expected an unknown policy to be rejected")
+	}
+}
+
+func TestFilterInvalidLine(t *testing.T) {
+	msg := NewInvalidMessage("@broken PRIVMSG #pajlada :hello", errors.New("parser error"))
+	filter := Filter{HasMessageRegex: true, MessageRegex: regexp.MustCompile("hello")}
+	assert(t, "content match", filter.Filter(msg), ResultOk)
+
+	filter.MessageRegex = regexp.MustCompile("bye")
+	assert(t, "content mismatch", filter.Filter(msg), ResultContent)
+
+	filter = Filter{UserID: "1"}
+	assert(t, "user filter", filter.Filter(msg), ResultUser)
+}
+
+func TestFetchOptions(t *testing.T) {
+	lines := "@tmi-sent-ts=1609549200000 :a!a@a.tmi.twitch.tv PRIVMSG #forsen :third\n" +
+		"@broken\n" +
+		"@tmi-sent-ts=1609545600000 :a!a@a.tmi.twitch.tv PRIVMSG #forsen :h\xffi\n"
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(lines))
+			},
+		),
+	)
+	defer server.Close()
+
+	api := &ChannelJustlogAPI{Channel: "forsen", URL: server.URL}
+	date := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		options FetchOptions
+		expect  string
+		invalid int
+	}{
+		{"zero value", FetchOptions{}, "third", 1},
+		{"skip", FetchOptions{OnInvalidLine: InvalidLineSkip}, "third|h\xffi", 1},
+		{"raw", FetchOptions{OnInvalidLine: InvalidLineRaw}, "third|@broken|h\xffi", 1},
+		{
+			"reject invalid UTF-8",
+			FetchOptions{OnInvalidLine: InvalidLineSkip, LineDecoders: []LineDecoder{RejectInvalidUTF8}},
+			"third",
+			2,
+		},
+		{
+			"repair invalid UTF-8",
+			FetchOptions{OnInvalidLine: InvalidLineSkip, LineDecoders: []LineDecoder{RepairUTF8}},
+			"third|h�i",
+			1,
+		},
+	}
+	// every download uses its own options at the same time
+	var wait sync.WaitGroup
+	texts := make([][]string, len(tests))
+	progresses := make([]*ProgressState, len(tests))
+	for i, test := range tests {
+		progresses[i] = &ProgressState{TotalResults: NewResultCounts()}
+		download := make(chan *Message)
+		_, err := test.options.FetchForDate(context.Background(), api, date, download, progresses[i], server.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			for msg := range download {
+				if msg == nil {
+					continue
+				}
+				if msg.Invalid != nil {
+					texts[i] = append(texts[i], msg.Raw)
+					continue
+				}
+				texts[i] = append(texts[i], msg.Text())
+			}
+		}(i)
+	}
+	wait.Wait()
+	for i, test := range tests {
+		assert(t, test.name, strings.Join(texts[i], "|"), test.expect)
+		assert(t, test.name+" invalid lines", progresses[i].InvalidLines, test.invalid)
+	}
+}
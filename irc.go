@@ -17,6 +17,30 @@ type Message struct {
 	Action    string            `json:"action,omitempty"`
 	Tags      map[string]string `json:"tags,omitempty"`
 	Timestamp time.Time         `json:"timestamp"`
+
+	// Annotations hold information added by justgrep, like links to the VOD the message was sent during. They aren't
+	// part of the IRC message.
+	Annotations map[string]string `json:"-"`
+
+	// MatchedBy tells which rules of the filter matched, if it has several.
+	MatchedBy *MatchedBy `json:"-"`
+
+	// Invalid is the parser error of a line kept with InvalidLineRaw, nothing but Raw and Source is set then.
+	Invalid error `json:"-"`
+
+	// Source is where the message was read from, if FetchOptions.RecordSources is set.
+	Source *MessageSource `json:"-"`
+
+	// fetchErr ends a stream of messages from a log file early, see FetchForDate.
+	fetchErr *FetchError
+}
+
+// Annotate sets an annotation of the message.
+func (m *Message) Annotate(key, value string) {
+	if m.Annotations == nil {
+		m.Annotations = make(map[string]string, 1)
+	}
+	m.Annotations[key] = value
 }
 
 func (m Message) Serialize() (output string) {
@@ -95,6 +119,9 @@ func NewMessage(text string) (*Message, error) {
 		}
 		cpy = cpy[idx+1:]
 	}
+	if cpy == "" {
+		return nil, errors.New("parser error: missing command")
+	}
 	if cpy[0] == ':' {
 		prefixIdx := strings.Index(cpy, " ")
 		if prefixIdx == -1 {
@@ -111,32 +138,30 @@ func NewMessage(text string) (*Message, error) {
 	actionIndex := strings.Index(cpy, " ")
 	if actionIndex == -1 {
 		output.Action = cpy
+		cpy = ""
 	} else {
 		output.Action = cpy[:actionIndex]
 		cpy = cpy[actionIndex+1:]
-		for {
-			nextSpace := strings.Index(cpy, " ")
-			if nextSpace == -1 {
-				// has to be last arg!
-				if cpy[0] == ':' {
-					output.Args = append(output.Args, cpy[1:])
-				} else {
-					output.Args = append(output.Args, cpy)
-				}
-				break
-			}
-			currentArg := cpy[:nextSpace]
-			if currentArg[0] == ':' {
-				// last argument.
-				output.Args = append(output.Args, cpy[1:])
-				break
-			}
-			output.Args = append(output.Args, currentArg)
-			cpy = cpy[nextSpace+1:]
-			if cpy == "" {
-				break
-			}
+	}
+	if output.Action == "" {
+		return nil, errors.New("parser error: missing command")
+	}
+	for cpy != "" {
+		if cpy[0] == ':' {
+			// last argument, can contain spaces
+			output.Args = append(output.Args, cpy[1:])
+			break
+		}
+		nextSpace := strings.Index(cpy, " ")
+		if nextSpace == -1 {
+			output.Args = append(output.Args, cpy)
+			break
+		}
+		if nextSpace != 0 {
+			// multiple spaces between arguments don't make empty ones
+			output.Args = append(output.Args, cpy[:nextSpace])
 		}
+		cpy = cpy[nextSpace+1:]
 	}
 	ts, hasTs := output.Tags["tmi-sent-ts"]
 	if hasTs {
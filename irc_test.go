@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"regexp"
 	"testing"
 	"time"
 )
@@ -177,6 +178,69 @@ func TestMessage_Serialize(t *testing.T) {
 	testSerializeMessage(t, `@tag=spaces\sexist\sas\sdo\nnew\rlines\sand\:semicolons TEST`)
 }
 
+func TestNewMessageMalformed(t *testing.T) {
+	for _, line := range []string{
+		"@",
+		"@a=b",
+		"@a=b ",
+		"@a=b :prefix ",
+		":prefix",
+		":prefix ",
+		" ",
+		"@a ",
+		"@tmi-sent-ts=soon PRIVMSG #a :b",
+	} {
+		_, err := NewMessage(line)
+		if err == nil {
+			t.Errorf("expected NewMessage(%q) to fail", line)
+		}
+	}
+}
+
+func TestNewMessageSpaces(t *testing.T) {
+	m, err := NewMessage("PRIVMSG  #pajlada   :two  spaces")
+	assert(t, "error", err, nil)
+	assertStrSlc(t, "Args", m.Args, []string{"#pajlada", "two  spaces"})
+
+	m, err = NewMessage("PRIVMSG #pajlada ")
+	assert(t, "error", err, nil)
+	assertStrSlc(t, "Args", m.Args, []string{"#pajlada"})
+
+	m, err = NewMessage("PING ")
+	assert(t, "error", err, nil)
+	assert(t, "Args", len(m.Args), 0)
+}
+
+// TestNewMessageInvariants runs lines which used to crash the parser or break its invariants through it.
+func TestNewMessageInvariants(t *testing.T) {
+	lines := []string{
+		getTestMessage().Raw,
+		`@tag=spaces\sexist\sas\sdo\nnew\rlines\sand\:semicolons TEST`,
+		":tmi.twitch.tv PING",
+		"@a=b ",
+		"PRIVMSG ",
+		"PRIVMSG a  b",
+		":prefix ",
+		"@a=b :prefix ",
+		"@tmi-sent-ts=-9223372036854775808 PING",
+	}
+	for _, line := range lines {
+		m, err := NewMessage(line)
+		if err != nil {
+			continue
+		}
+		if m.Action == "" {
+			t.Errorf("NewMessage(%q) returned a message without a command", line)
+		}
+		if m.Raw != line {
+			t.Errorf("NewMessage(%q) changed the raw line to %q", line, m.Raw)
+		}
+		// must not panic
+		_ = m.Serialize()
+		_ = Filter{HasMessageRegex: true, MessageRegex: regexp.MustCompile("a")}.Filter(m)
+	}
+}
+
 func BenchmarkMessage_Serialize(b *testing.B) {
 	m := getTestMessage()
 	for i := 0; i < 1000; i++ {
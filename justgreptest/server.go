@@ -0,0 +1,292 @@
+// Package justgreptest provides an in-memory justlog instance for testing code which searches logs.
+package justgreptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+// Server is a justlog compatible HTTP server which serves the IRC lines it was seeded with. It supports the /channels
+// and /list endpoints, channel and user logs in both the raw and JSON formats, the reverse parameter and range
+// requests. Lines are put into log files by their tmi-sent-ts tag and into channels by their first argument.
+type Server struct {
+	*httptest.Server
+
+	lock sync.Mutex
+	// channels maps channel names to their messages, oldest first
+	channels map[string][]*justgrep.Message
+}
+
+// NewServer starts a Server seeded with lines. Call Close when done with it.
+func NewServer(lines ...string) (*Server, error) {
+	server := &Server{channels: make(map[string][]*justgrep.Message)}
+	err := server.Add(lines...)
+	if err != nil {
+		return nil, err
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+	return server, nil
+}
+
+// Add adds more lines to the logs. Lines which aren't valid IRC messages, don't have a channel or a tmi-sent-ts tag
+// are rejected.
+func (s *Server) Add(lines ...string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, line := range lines {
+		msg, err := justgrep.NewMessage(line)
+		if err != nil {
+			return err
+		}
+		if len(msg.Args) == 0 || !strings.HasPrefix(msg.Args[0], "#") {
+			return errors.New(fmt.Sprintf("justgreptest: line %q isn't sent in a channel", line))
+		}
+		if msg.Timestamp.IsZero() {
+			return errors.New(fmt.Sprintf("justgreptest: line %q has no tmi-sent-ts tag", line))
+		}
+		channel := msg.Args[0][1:]
+		s.channels[channel] = append(s.channels[channel], msg)
+	}
+	for _, messages := range s.channels {
+		sort.SliceStable(
+			messages, func(i, j int) bool {
+				return messages[i].Timestamp.Before(messages[j].Timestamp)
+			},
+		)
+	}
+	return nil
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if r.URL.Path == "/channels" {
+		s.serveChannels(w)
+		return
+	}
+	if r.URL.Path == "/list" {
+		s.serveList(w, r)
+		return
+	}
+	// /channel/NAME/YEAR/MONTH/DAY, /channel/NAME/user/LOGIN/YEAR/MONTH or /channel/NAME/userid/ID/YEAR/MONTH
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 5 || parts[0] != "channel" {
+		http.NotFound(w, r)
+		return
+	}
+	messages := s.channels[parts[1]]
+	var numbers []string
+	switch {
+	case len(parts) == 6 && parts[2] == "user":
+		messages = filterMessages(messages, byLogin(parts[3]))
+		numbers = parts[4:]
+	case len(parts) == 6 && parts[2] == "userid":
+		messages = filterMessages(messages, byUserID(parts[3]))
+		numbers = parts[4:]
+	case len(parts) == 5:
+		numbers = parts[2:]
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	date, ok := parseDate(numbers)
+	if !ok {
+		http.Error(w, "invalid date", http.StatusBadRequest)
+		return
+	}
+	var end time.Time
+	if len(numbers) == 3 {
+		end = date.AddDate(0, 0, 1)
+	} else {
+		end = date.AddDate(0, 1, 0)
+	}
+	messages = filterMessages(
+		messages, func(msg *justgrep.Message) bool {
+			return !msg.Timestamp.Before(date) && msg.Timestamp.Before(end)
+		},
+	)
+	if len(messages) == 0 {
+		http.Error(w, "could not load logs", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	if _, reverse := query["reverse"]; reverse {
+		reversed := make([]*justgrep.Message, len(messages))
+		for i, msg := range messages {
+			reversed[len(messages)-1-i] = msg
+		}
+		messages = reversed
+	}
+	if _, isJSON := query["json"]; isJSON {
+		serveJSON(w, messages)
+		return
+	}
+	buf := &bytes.Buffer{}
+	for _, msg := range messages {
+		buf.WriteString(msg.Raw)
+		buf.WriteByte('\n')
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buf.Bytes()))
+}
+
+func (s *Server) serveChannels(w http.ResponseWriter) {
+	type channel struct {
+		UserID string `json:"userID"`
+		Name   string `json:"name"`
+	}
+	output := struct {
+		Channels []channel `json:"channels"`
+	}{Channels: []channel{}}
+	for name, messages := range s.channels {
+		output.Channels = append(output.Channels, channel{UserID: messages[0].Tags["room-id"], Name: name})
+	}
+	sort.Slice(
+		output.Channels, func(i, j int) bool {
+			return output.Channels[i].Name < output.Channels[j].Name
+		},
+	)
+	writeJSON(w, output)
+}
+
+func (s *Server) serveList(w http.ResponseWriter, r *http.Request) {
+	type logFile struct {
+		Year  string `json:"year"`
+		Month string `json:"month"`
+		Day   string `json:"day,omitempty"`
+	}
+	query := r.URL.Query()
+	messages, ok := s.channels[query.Get("channel")]
+	if !ok {
+		http.Error(w, "could not load logs", http.StatusNotFound)
+		return
+	}
+	monthly := false
+	if login := query.Get("user"); login != "" {
+		messages = filterMessages(messages, byLogin(login))
+		monthly = true
+	} else if id := query.Get("userid"); id != "" {
+		messages = filterMessages(messages, byUserID(id))
+		monthly = true
+	}
+	output := struct {
+		AvailableLogs []logFile `json:"availableLogs"`
+	}{AvailableLogs: []logFile{}}
+	seen := make(map[logFile]bool)
+	// newest first, like justlog
+	for i := len(messages) - 1; i >= 0; i-- {
+		date := messages[i].Timestamp.UTC()
+		file := logFile{Year: strconv.Itoa(date.Year()), Month: strconv.Itoa(int(date.Month()))}
+		if !monthly {
+			file.Day = strconv.Itoa(date.Day())
+		}
+		if !seen[file] {
+			seen[file] = true
+			output.AvailableLogs = append(output.AvailableLogs, file)
+		}
+	}
+	writeJSON(w, output)
+}
+
+// messageTypes maps IRC commands onto go-twitch-irc message types used by justlog's JSON API.
+var messageTypes = map[string]int{
+	"WHISPER":         0,
+	"PRIVMSG":         1,
+	"CLEARCHAT":       2,
+	"ROOMSTATE":       3,
+	"USERNOTICE":      4,
+	"USERSTATE":       5,
+	"NOTICE":          6,
+	"GLOBALUSERSTATE": 7,
+	"CLEARMSG":        8,
+}
+
+func serveJSON(w http.ResponseWriter, messages []*justgrep.Message) {
+	type jsonMessage struct {
+		Text        string            `json:"text"`
+		Username    string            `json:"username"`
+		DisplayName string            `json:"displayName"`
+		Channel     string            `json:"channel"`
+		Timestamp   time.Time         `json:"timestamp"`
+		ID          string            `json:"id"`
+		Type        int               `json:"type"`
+		Raw         string            `json:"raw"`
+		Tags        map[string]string `json:"tags"`
+	}
+	output := struct {
+		Messages []jsonMessage `json:"messages"`
+	}{Messages: make([]jsonMessage, 0, len(messages))}
+	for _, msg := range messages {
+		messageType, ok := messageTypes[msg.Action]
+		if !ok {
+			// not representable, justlog doesn't store these
+			continue
+		}
+		output.Messages = append(
+			output.Messages, jsonMessage{
+				Text:        msg.Args[len(msg.Args)-1],
+				Username:    msg.User,
+				DisplayName: msg.Tags["display-name"],
+				Channel:     msg.Args[0][1:],
+				Timestamp:   msg.Timestamp,
+				ID:          msg.Tags["id"],
+				Type:        messageType,
+				Raw:         msg.Raw,
+				Tags:        msg.Tags,
+			},
+		)
+	}
+	writeJSON(w, output)
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func filterMessages(messages []*justgrep.Message, keep func(msg *justgrep.Message) bool) []*justgrep.Message {
+	output := make([]*justgrep.Message, 0, len(messages))
+	for _, msg := range messages {
+		if keep(msg) {
+			output = append(output, msg)
+		}
+	}
+	return output
+}
+
+func byLogin(login string) func(msg *justgrep.Message) bool {
+	login = strings.ToLower(login)
+	return func(msg *justgrep.Message) bool {
+		return msg.User == login
+	}
+}
+
+func byUserID(id string) func(msg *justgrep.Message) bool {
+	return func(msg *justgrep.Message) bool {
+		return msg.Tags["user-id"] == id
+	}
+}
+
+// parseDate converts the year, month and optionally day parts of a log file path into midnight UTC of that date.
+func parseDate(numbers []string) (time.Time, bool) {
+	parsed := []int{0, 1, 1}
+	for i, number := range numbers {
+		value, err := strconv.Atoi(number)
+		if err != nil {
+			return time.Time{}, false
+		}
+		parsed[i] = value
+	}
+	return time.Date(parsed[0], time.Month(parsed[1]), parsed[2], 0, 0, 0, 0, time.UTC), true
+}
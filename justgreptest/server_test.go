@@ -0,0 +1,99 @@
+package justgreptest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mm2PL/justgrep"
+)
+
+var testLines = []string{
+	"@display-name=A;id=1;room-id=11;tmi-sent-ts=1609502400000;user-id=1 :a!a@a.tmi.twitch.tv PRIVMSG #forsen :hello",
+	"@display-name=B;id=2;room-id=11;tmi-sent-ts=1609506000000;user-id=2 :b!b@b.tmi.twitch.tv PRIVMSG #forsen :bye",
+	"@display-name=A;id=3;room-id=11;tmi-sent-ts=1609592400000;user-id=1 :a!a@a.tmi.twitch.tv PRIVMSG #forsen :hello again",
+	"@display-name=A;id=4;room-id=12;tmi-sent-ts=1609592400000;user-id=1 :a!a@a.tmi.twitch.tv PRIVMSG #pajlada :hi",
+}
+
+// search runs the fetch/filter pipeline for date the same way justgrep does.
+func search(t *testing.T, server *Server, api justgrep.JustlogAPI, date time.Time, filter justgrep.Filter) []string {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	progress := &justgrep.ProgressState{TotalResults: justgrep.NewResultCounts()}
+	download := make(chan *justgrep.Message)
+	_, err := justgrep.FetchForDate(ctx, api, date, download, progress, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make(chan *justgrep.Message)
+	go func() {
+		_, err := filter.StreamFilter(cancel, download, results, progress)
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	var ids []string
+	for msg := range results {
+		ids = append(ids, msg.Tags["id"])
+	}
+	return ids
+}
+
+func assertIDs(t *testing.T, what string, have []string, expect ...string) {
+	if len(have) != len(expect) {
+		t.Fatalf("%s: expected ids %v, got %v", what, expect, have)
+	}
+	for i := range have {
+		if have[i] != expect[i] {
+			t.Fatalf("%s: expected ids %v, got %v", what, expect, have)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	server, err := NewServer(testLines...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	channels, err := justgrep.GetChannelsFromJustLog(context.Background(), server.Client(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(channels) != 2 || channels[0] != "forsen" || channels[1] != "pajlada" {
+		t.Fatalf("unexpected channels %v", channels)
+	}
+
+	filter := justgrep.Filter{
+		StartDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC),
+	}
+	day := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, format := range []justgrep.APIFormat{justgrep.APIFormatRaw, justgrep.APIFormatJSON} {
+		api := &justgrep.ChannelJustlogAPI{Channel: "forsen", URL: server.URL, Format: format}
+		assertIDs(t, "channel logs as "+format.String(), search(t, server, api, day, filter), "2", "1")
+	}
+
+	userAPI := &justgrep.UserJustlogAPI{Channel: "forsen", User: "1", IsId: true, URL: server.URL}
+	assertIDs(t, "user logs", search(t, server, userAPI, day, filter), "3", "1")
+
+	available, err := justgrep.NewAvailableLogsAPI(
+		context.Background(),
+		server.Client(),
+		&justgrep.ChannelJustlogAPI{Channel: "forsen", URL: server.URL},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(available.Dates) != 2 || !available.Dates[0].Equal(day.AddDate(0, 0, 1)) {
+		t.Fatalf("unexpected available logs %v", available.Dates)
+	}
+}
+
+func TestServerRejectsLinesOutsideChannels(t *testing.T) {
+	_, err := NewServer("@tmi-sent-ts=1609502400000 :tmi.twitch.tv PING")
+	if err == nil {
+		t.Fatal("expected a line without a channel to be rejected")
+	}
+}
@@ -7,68 +7,262 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
+	"unicode"
 )
 
 type JustlogAPI interface {
 	MakeURL(date time.Time) string
 	NextLogFile(currentDate time.Time) time.Time
 	GetApproximateOffset() time.Duration
+	GetFormat() APIFormat
 }
 
 type ProgressState struct {
-	TotalResults []int `json:"total_results"`
+	TotalResults ResultCounts `json:"total_results"`
 
 	CountLines int `json:"count_lines"`
 	CountBytes int `json:"count_bytes"`
 
+	// InvalidLines counts lines which couldn't be parsed, see FetchOptions.OnInvalidLine.
+	InvalidLines int `json:"invalid_lines"`
+
+	// FetchErrors counts log files which failed to download, at least partially.
+	FetchErrors int `json:"fetch_errors"`
+	// SkippedChannels counts channels which weren't searched to the end because of a failed download.
+	SkippedChannels int `json:"skipped_channels"`
+	// ResumedDownloads counts how often a broken download was continued where it stopped.
+	ResumedDownloads int `json:"resumed_downloads"`
+
+	// SkippedBytes counts bytes which didn't have to be downloaded thanks to seeking within log files.
+	SkippedBytes int64 `json:"skipped_bytes"`
+
+	// Instances has per-instance request statistics if the HTTP client was set up to record them.
+	Instances *InstanceStatsRecorder `json:"instances,omitempty"`
+	// NameChanges has users which changed their login, if matches were checked for that.
+	NameChanges *NameTracker `json:"name_changes,omitempty"`
+
 	BeginTime time.Time `json:"begin_time"`
 }
 
-func fetch(ctx context.Context, url string, client *http.Client, output chan *Message, progress *ProgressState) error {
+// MarshalJSON writes TotalResults as total_results, an array indexed by FilterResult like in older versions, and
+// again as results, an object keyed by the names of the results.
+func (p ProgressState) MarshalJSON() ([]byte, error) {
+	// without the methods of ProgressState
+	type progressFields ProgressState
+	return json.Marshal(
+		struct {
+			progressFields
+			TotalResults []int        `json:"total_results"`
+			Results      ResultCounts `json:"results"`
+		}{
+			progressFields: progressFields(p),
+			TotalResults:   p.TotalResults,
+			Results:        p.TotalResults,
+		},
+	)
+}
+
+// request performs a GET request to a justlog instance, returning an error if it didn't respond with 200 OK.
+// If offset isn't zero, only the part of the response starting at offset is requested and 206 Partial Content is
+// expected instead.
+func request(ctx context.Context, url string, client *http.Client, offset int64) (*http.Response, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	req.Header.Set("User-Agent", UserAgent)
+	expectedStatus := http.StatusOK
+	if offset != 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		expectedStatus = http.StatusPartialContent
+	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if resp.StatusCode != 200 {
+	if resp.StatusCode != expectedStatus {
 		defer resp.Body.Close()
 		scanner := bufio.NewScanner(resp.Body)
 		if scanner.Scan() {
-			return errors.New(fmt.Sprintf("justlog instance responded with %d: %q", resp.StatusCode, scanner.Text()))
+			return nil, errors.New(
+				fmt.Sprintf("justlog instance responded with %d: %q", resp.StatusCode, scanner.Text()),
+			)
 		}
-		return errors.New(fmt.Sprintf("justlog instance responded with unexpected %d status code", resp.StatusCode))
+		return nil, errors.New(
+			fmt.Sprintf("justlog instance responded with unexpected %d status code", resp.StatusCode),
+		)
 	}
+	return resp, nil
+}
 
-	go func() {
-		defer resp.Body.Close()
+// FetchError is an error which happened while downloading the log file at URL.
+type FetchError struct {
+	URL string
+	Err error
+}
 
-		scanner := bufio.NewScanner(resp.Body)
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("%s: %s", e.URL, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// FetchOptions decide how log files are read. The zero value stops reading a log file at its first invalid line,
+// applies DefaultLineDecoders and doesn't record sources. Different downloads can use different options at the same
+// time.
+type FetchOptions struct {
+	// OnInvalidLine is the policy for lines which can't be parsed.
+	OnInvalidLine InvalidLinePolicy
+	// LineDecoders are applied in order to every line of raw log files before it's parsed, DefaultLineDecoders are
+	// used if it's nil.
+	LineDecoders []LineDecoder
+	// RecordSources makes messages remember where they were read from in Message.Source. It's off by default,
+	// because it costs an allocation per message.
+	RecordSources bool
+}
+
+// source describes the log file for date at url if o records sources, otherwise it returns nil.
+func (o FetchOptions) source(date time.Time, url string) *MessageSource {
+	if !o.RecordSources {
+		return nil
+	}
+	return newMessageSource(date, url)
+}
 
-		for scanner.Scan() {
-			msg, err := NewMessage(scanner.Text())
-			progress.CountLines += 1
+// fetch starts downloading url onto output. Messages are sent until the file ends, ctx is cancelled or an error
+// happens. An error that happens in the middle of the file is sent as a message with fetchErr set, after the messages
+// read before it. If source isn't nil, every message gets a copy of it with its line number.
+func (o FetchOptions) fetch(
+	ctx context.Context,
+	url string,
+	format APIFormat,
+	offset int64,
+	source *MessageSource,
+	client *http.Client,
+	output chan *Message,
+	progress *ProgressState,
+) error {
+	resp, err := request(ctx, url, client, offset)
+	if err != nil {
+		return &FetchError{URL: url, Err: err}
+	}
+	// the reader may stop early after cancelling ctx, sending must not block then
+	send := func(msg *Message) bool {
+		select {
+		case output <- msg:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	fail := func(err error) {
+		if ctx.Err() == nil {
+			send(&Message{fetchErr: &FetchError{URL: url, Err: err}})
+		}
+	}
+
+	// line numbers are only known if the file is downloaded from the start
+	lineNumber := 0
+	sourceOf := func() *MessageSource {
+		lineNumber++
+		if offset != 0 {
+			return source.At(0)
+		}
+		return source.At(lineNumber)
+	}
+
+	if format == APIFormatJSON {
+		go func() {
+			defer resp.Body.Close()
+			err := decodeJSONLogs(
+				resp.Body, func(msg *Message, err error) bool {
+					progress.CountLines += 1
+					msgSource := sourceOf()
+					if err != nil {
+						kept, ok := handleInvalidLine(o.OnInvalidLine, url, msg.Raw, err, progress)
+						if kept != nil {
+							kept.Source = msgSource
+							if !send(kept) {
+								return false
+							}
+						}
+						if !ok {
+							send(nil)
+						}
+						return ok && ctx.Err() == nil
+					}
+					progress.CountBytes += len(msg.Raw)
+					msg.Source = msgSource
+					return send(msg)
+				},
+			)
 			if err != nil {
-				output <- nil
-				_, _ = fmt.Fprintf(os.Stderr, "Error while fetching from %s: %s\n", url, err)
+				fail(err)
+			}
+			close(output)
+		}()
+		return nil
+	}
+
+	go func() {
+		lines := newLineReader(resp, offset)
+		defer lines.Close()
+
+	download:
+		for {
+			for lines.Scan() {
+				line, err := o.DecodeLine(lines.Text())
+				var msg *Message
+				if err == nil {
+					msg, err = NewMessage(line)
+				}
+				progress.CountLines += 1
+				msgSource := sourceOf()
+				if err != nil {
+					var ok bool
+					msg, ok = handleInvalidLine(o.OnInvalidLine, url, line, err, progress)
+					if !ok {
+						send(nil)
+						break download
+					}
+					if msg == nil {
+						continue
+					}
+				}
+				msg.Source = msgSource
+				progress.CountBytes += len(msg.Raw)
+				if !send(msg) {
+					break download
+				}
+			}
+			err := lines.Err()
+			if err == nil {
 				break
 			}
-			progress.CountBytes += len(msg.Raw)
-			output <- msg
-			if ctx.Err() != nil {
+			if !lines.resume(ctx, url, client) {
+				fail(err)
 				break
 			}
+			progress.ResumedDownloads++
+			if progress.Instances != nil {
+				progress.Instances.RecordRetry(statsInstance(lines.resp.Request.URL))
+			}
 		}
 		close(output)
 	}()
 	return nil
 }
 
+// FetchForDate starts downloading the log file for date onto output and returns the date of the next log file to
+// download. Errors which happen before anything is downloaded are returned as a *FetchError, later ones are passed on
+// to the reader of output, use Filter.StreamFilter to get them. output is closed when the download is done.
+// It uses the zero FetchOptions, see FetchOptions.FetchForDate.
 func FetchForDate(
 	ctx context.Context,
 	api JustlogAPI,
@@ -76,9 +270,21 @@ func FetchForDate(
 	output chan *Message,
 	progress *ProgressState,
 	client *http.Client,
+) (time.Time, error) {
+	return FetchOptions{}.FetchForDate(ctx, api, date, output, progress, client)
+}
+
+// FetchForDate works like the FetchForDate function, reading the log file according to o.
+func (o FetchOptions) FetchForDate(
+	ctx context.Context,
+	api JustlogAPI,
+	date time.Time,
+	output chan *Message,
+	progress *ProgressState,
+	client *http.Client,
 ) (time.Time, error) {
 	url := api.MakeURL(date)
-	err := fetch(ctx, url, client, output, progress)
+	err := o.fetch(ctx, url, api.GetFormat(), 0, o.source(date, url), client, output, progress)
 	if err != nil {
 		return time.Time{}, err
 	} else {
@@ -86,6 +292,83 @@ func FetchForDate(
 	}
 }
 
+// FetchForDateFrom works like FetchForDate, but skips messages sent after newest without downloading them when the
+// instance supports range requests. Log files are sorted newest first, so the file is binary searched for the first
+// message sent at or before newest. If seeking isn't possible, the whole file is downloaded.
+// It uses the zero FetchOptions, see FetchOptions.FetchForDateFrom.
+func FetchForDateFrom(
+	ctx context.Context,
+	api JustlogAPI,
+	date time.Time,
+	newest time.Time,
+	output chan *Message,
+	progress *ProgressState,
+	client *http.Client,
+) (time.Time, error) {
+	return FetchOptions{}.FetchForDateFrom(ctx, api, date, newest, output, progress, client)
+}
+
+// FetchForDateFrom works like the FetchForDateFrom function, reading the log file according to o.
+func (o FetchOptions) FetchForDateFrom(
+	ctx context.Context,
+	api JustlogAPI,
+	date time.Time,
+	newest time.Time,
+	output chan *Message,
+	progress *ProgressState,
+	client *http.Client,
+) (time.Time, error) {
+	url := api.MakeURL(date)
+	var offset int64
+	if api.GetFormat() == APIFormatRaw {
+		var err error
+		offset, err = seekOffset(ctx, url, client, newest)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to seek in %s, downloading all of it: %s\n", url, err)
+			offset = 0
+		}
+		progress.SkippedBytes += offset
+	}
+	err := o.fetch(ctx, url, api.GetFormat(), offset, o.source(date, url), client, output, progress)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return api.NextLogFile(date), nil
+}
+
+// ContainsLiteral downloads the log file for date and reports whether any line contains literal. Lines aren't parsed,
+// which makes this a lot cheaper than FetchForDate. The download stops as soon as a line matches.
+// Only APIFormatRaw APIs are supported.
+func ContainsLiteral(
+	ctx context.Context,
+	api JustlogAPI,
+	date time.Time,
+	literal string,
+	progress *ProgressState,
+	client *http.Client,
+) (bool, error) {
+	if api.GetFormat() != APIFormatRaw {
+		return false, errors.New("searching for literals is only supported with the raw API")
+	}
+	resp, err := request(ctx, api.MakeURL(date), client, 0)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Split(ScanLines)
+	for scanner.Scan() {
+		line := scanner.Text()
+		progress.CountLines += 1
+		progress.CountBytes += len(line)
+		if strings.Contains(line, literal) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
 type UserJustlogAPI struct {
 	JustlogAPI
 
@@ -93,30 +376,38 @@ type UserJustlogAPI struct {
 	User    string
 	URL     string
 	IsId    bool
+	Format  APIFormat
 }
 
+// NextLogFile returns midnight UTC on the first day of the month before the one containing currentDate.
 func (api UserJustlogAPI) NextLogFile(currentDate time.Time) time.Time {
-	return currentDate.AddDate(0, -1, 0)
+	date := currentDate.UTC()
+	// time.Date normalizes month 0 into December of the previous year
+	return time.Date(date.Year(), date.Month()-1, 1, 0, 0, 0, 0, time.UTC)
 }
 
 func (api UserJustlogAPI) MakeURL(date time.Time) string {
+	// justlog stores logs by UTC dates
+	date = date.UTC()
 	if api.IsId {
 		return fmt.Sprintf(
-			"%s/channel/%s/userid/%s/%d/%d?raw&reverse",
+			"%s/channel/%s/userid/%s/%d/%d?%s&reverse",
 			api.URL,
 			api.Channel,
 			api.User,
 			date.Year(),
 			date.Month(),
+			api.Format,
 		)
 	}
 	return fmt.Sprintf(
-		"%s/channel/%s/user/%s/%d/%d?raw&reverse",
+		"%s/channel/%s/user/%s/%d/%d?%s&reverse",
 		api.URL,
 		api.Channel,
 		api.User,
 		date.Year(),
 		date.Month(),
+		api.Format,
 	)
 }
 
@@ -124,24 +415,33 @@ func (api UserJustlogAPI) GetApproximateOffset() time.Duration {
 	return time.Hour * 24 * 30
 }
 
+func (api UserJustlogAPI) GetFormat() APIFormat {
+	return api.Format
+}
+
 type ChannelJustlogAPI struct {
 	JustlogAPI
 	Channel string
 	URL     string
+	Format  APIFormat
 }
 
+// NextLogFile returns midnight UTC of the day before the one containing currentDate.
 func (api ChannelJustlogAPI) NextLogFile(currentDate time.Time) time.Time {
-	return currentDate.AddDate(0, 0, -1)
+	date := currentDate.UTC()
+	return time.Date(date.Year(), date.Month(), date.Day()-1, 0, 0, 0, 0, time.UTC)
 }
 
 func (api ChannelJustlogAPI) MakeURL(date time.Time) string {
+	date = date.UTC()
 	return fmt.Sprintf(
-		"%s/channel/%s/%d/%d/%d?raw&reverse",
+		"%s/channel/%s/%d/%d/%d?%s&reverse",
 		api.URL,
 		api.Channel,
 		date.Year(),
 		date.Month(),
 		date.Day(),
+		api.Format,
 	)
 }
 
@@ -163,6 +463,15 @@ func GetChannelsFromJustLog(ctx context.Context, client *http.Client, url string
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, errors.New(
+			fmt.Sprintf(
+				"%s/channels responded with unexpected %d status code, is this really a justlog instance?",
+				url,
+				resp.StatusCode,
+			),
+		)
+	}
 	output := channelsResp{}
 	err = json.NewDecoder(resp.Body).Decode(&output)
 	if err != nil {
@@ -179,4 +488,105 @@ func (api ChannelJustlogAPI) GetApproximateOffset() time.Duration {
 	return time.Hour * 24
 }
 
+func (api ChannelJustlogAPI) GetFormat() APIFormat {
+	return api.Format
+}
+
+// NormalizeInstanceURL checks that rawURL can be used as a justlog instance URL and returns it in a canonical form:
+// lowercase scheme and host, no default port, no trailing slashes.
+func NormalizeInstanceURL(rawURL string) (string, error) {
+	trimmed := strings.TrimSpace(rawURL)
+	if trimmed == "" {
+		return "", errors.New("instance URL is empty")
+	}
+	if !strings.Contains(trimmed, "://") {
+		return "", errors.New(
+			fmt.Sprintf("instance URL %q has no scheme, did you mean \"https://%s\"?", rawURL, trimmed),
+		)
+	}
+	u, err := url.Parse(trimmed)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("instance URL %q is invalid: %s", rawURL, err))
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errors.New(
+			fmt.Sprintf("instance URL %q has unsupported scheme %q, use http or https", rawURL, u.Scheme),
+		)
+	}
+	if u.Host == "" {
+		return "", errors.New(fmt.Sprintf("instance URL %q has no host", rawURL))
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", errors.New(
+			fmt.Sprintf("instance URL %q should not contain a query string or fragment", rawURL),
+		)
+	}
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = strings.TrimSuffix(u.Host, ":"+u.Port())
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// InstanceKey returns the same key for URLs which point to the same instance. normalizedURL has to be returned by
+// NormalizeInstanceURL. Instances answering on both http and https serve the same logs, so the scheme is ignored.
+func InstanceKey(normalizedURL string) string {
+	return normalizedURL[strings.Index(normalizedURL, "://")+len("://"):]
+}
+
+// NormalizeChannelName checks that rawName follows the rules for Twitch logins and returns it in the form justlog
+// uses: lowercase, without a leading "#" or surrounding whitespace.
+func NormalizeChannelName(rawName string) (string, error) {
+	name := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(rawName), "#"))
+	if name == "" {
+		return "", errors.New(fmt.Sprintf("channel name %q is empty", rawName))
+	}
+	if len(name) > 25 {
+		return "", errors.New(fmt.Sprintf("channel name %q is longer than 25 characters", rawName))
+	}
+	if name[0] == '_' {
+		return "", errors.New(fmt.Sprintf("channel name %q can't start with an underscore", rawName))
+	}
+	for _, char := range name {
+		if (char < 'a' || char > 'z') && (char < '0' || char > '9') && char != '_' {
+			return "", errors.New(
+				fmt.Sprintf("channel name %q contains %q, only letters, digits and underscores are allowed", rawName, char),
+			)
+		}
+	}
+	return name, nil
+}
+
+// ParseChannelList splits a list of channels separated with commas or whitespace and normalizes every channel with
+// NormalizeChannelName. Duplicates are removed, the first invalid entry is reported.
+func ParseChannelList(list string) ([]string, error) {
+	entries := strings.FieldsFunc(
+		list, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		},
+	)
+	channels := make([]string, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		channel, err := NormalizeChannelName(entry)
+		if err != nil {
+			return nil, err
+		}
+		if seen[channel] {
+			continue
+		}
+		seen[channel] = true
+		channels = append(channels, channel)
+	}
+	if len(channels) == 0 {
+		return nil, errors.New("channel list is empty")
+	}
+	return channels, nil
+}
+
+// UserAgent is sent with every request of this package. Use UserAgentRoundTripper to send another one with a client
+// instead of changing it.
 var UserAgent = "justgrep/1.0 (log-searcher)"
@@ -0,0 +1,304 @@
+package justgrep
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func testNormalizeInstanceURL(t *testing.T, input string, expect string) {
+	have, err := NormalizeInstanceURL(input)
+	assert(t, "error for "+input, err, nil)
+	assert(t, "normalized "+input, have, expect)
+}
+
+func testNormalizeInstanceURLFails(t *testing.T, input string) {
+	_, err := NormalizeInstanceURL(input)
+	if err == nil {
+		t.Errorf("expected NormalizeInstanceURL(%q) to fail", input)
+	}
+}
+
+func TestNormalizeInstanceURL(t *testing.T) {
+	testNormalizeInstanceURL(t, "https://logs.example.com", "https://logs.example.com")
+	testNormalizeInstanceURL(t, "https://logs.example.com/", "https://logs.example.com")
+	testNormalizeInstanceURL(t, " HTTP://Logs.Example.com:8025// ", "http://logs.example.com:8025")
+	testNormalizeInstanceURL(t, "https://example.com/justlog/", "https://example.com/justlog")
+	testNormalizeInstanceURL(t, "https://logs.example.com:443", "https://logs.example.com")
+	testNormalizeInstanceURL(t, "http://logs.example.com:443", "http://logs.example.com:443")
+
+	testNormalizeInstanceURLFails(t, "")
+	testNormalizeInstanceURLFails(t, "logs.example.com")
+	testNormalizeInstanceURLFails(t, "ftp://logs.example.com")
+	testNormalizeInstanceURLFails(t, "https://")
+	testNormalizeInstanceURLFails(t, "https://logs.example.com/?raw")
+}
+
+func TestInstanceKey(t *testing.T) {
+	assert(t, "http and https", InstanceKey("http://logs.example.com"), InstanceKey("https://logs.example.com"))
+	if InstanceKey("https://logs.example.com") == InstanceKey("https://logs.example.com:8025") {
+		t.Errorf("expected instances on different ports to have different keys")
+	}
+	assert(t, "path", InstanceKey("https://example.com/justlog"), "example.com/justlog")
+}
+
+func TestParseChannelList(t *testing.T) {
+	channels, err := ParseChannelList(" #Pajlada, forsen\txqc,,pajlada ")
+	assert(t, "error", err, nil)
+	assert(t, "channels", strings.Join(channels, ","), "pajlada,forsen,xqc")
+
+	for _, list := range []string{"", " , ", "pajlada,paj-lada", "_pajlada", "#", strings.Repeat("a", 26), "pająda"} {
+		_, err := ParseChannelList(list)
+		if err == nil {
+			t.Errorf("expected ParseChannelList(%q) to fail", list)
+		}
+	}
+	_, err = ParseChannelList("forsen,paj.lada")
+	if err == nil || !strings.Contains(err.Error(), `"paj.lada"`) {
+		t.Errorf("expected the error to name the invalid entry, got %v", err)
+	}
+}
+
+func TestDecodeJSONLogs(t *testing.T) {
+	input := `{"messages":[` +
+		`{"text":"-tags","username":"mm2pl","displayName":"Mm2PL","channel":"pajlada","timestamp":"2021-09-19T13:42:15.165Z","id":"1d7e0b34","type":1,"raw":"@display-name=Mm2PL;tmi-sent-ts=1632058935165 :mm2pl!mm2pl@mm2pl.tmi.twitch.tv PRIVMSG #pajlada :-tags","tags":{"display-name":"Mm2PL","tmi-sent-ts":"1632058935165"}},` +
+		`{"text":"hello","username":"pajlada","displayName":"pajlada","channel":"pajlada","timestamp":"2021-09-19T13:40:00Z","id":"abcd","type":1,"raw":"","tags":{}}` +
+		`]}`
+	var messages []*Message
+	err := decodeJSONLogs(
+		strings.NewReader(input), func(msg *Message, err error) bool {
+			assert(t, "message error", err, nil)
+			messages = append(messages, msg)
+			return true
+		},
+	)
+	assert(t, "error", err, nil)
+	assert(t, "message count", len(messages), 2)
+
+	assert(t, "[0].Action", messages[0].Action, "PRIVMSG")
+	assert(t, "[0].User", messages[0].User, "mm2pl")
+	assert(t, "[0].id tag", messages[0].Tags["id"], "1d7e0b34")
+	assertStrSlc(t, "[0].Args", messages[0].Args, []string{"#pajlada", "-tags"})
+
+	assert(t, "[1].Action", messages[1].Action, "PRIVMSG")
+	assert(t, "[1].User", messages[1].User, "pajlada")
+	assert(t, "[1].display-name tag", messages[1].Tags["display-name"], "pajlada")
+	assertStrSlc(t, "[1].Args", messages[1].Args, []string{"#pajlada", "hello"})
+	assert(t, "[1].Timestamp", messages[1].Timestamp.Equal(time.Date(2021, 9, 19, 13, 40, 0, 0, time.UTC)), true)
+}
+
+func TestSeekOffset(t *testing.T) {
+	base := time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
+	var builder strings.Builder
+	var lineStarts []int64
+	var timestamps []time.Time
+	for i := 20000; i > 0; i-- {
+		ts := base.Add(time.Duration(i) * time.Minute)
+		lineStarts = append(lineStarts, int64(builder.Len()))
+		timestamps = append(timestamps, ts)
+		builder.WriteString(
+			fmt.Sprintf(
+				"@tmi-sent-ts=%d :mm2pl!mm2pl@mm2pl.tmi.twitch.tv PRIVMSG #pajlada :message number %d\n",
+				ts.UnixNano()/int64(time.Millisecond),
+				i,
+			),
+		)
+	}
+	content := builder.String()
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				http.ServeContent(w, r, "logs.txt", time.Time{}, strings.NewReader(content))
+			},
+		),
+	)
+	defer server.Close()
+
+	newest := base.Add(5000 * time.Minute)
+	offset, err := seekOffset(context.Background(), server.URL, server.Client(), newest)
+	assert(t, "error", err, nil)
+	if offset == 0 {
+		t.Fatalf("expected seekOffset to skip some lines")
+	}
+	for i, start := range lineStarts {
+		if start < offset && !timestamps[i].After(newest) {
+			t.Errorf("line %d sent at %s was skipped even though it's not after %s", i, timestamps[i], newest)
+		}
+		if start == offset {
+			break
+		}
+	}
+	if int64(len(content))-offset > seekMinSpan*2 {
+		t.Errorf("seekOffset left %d bytes, expected at most %d", int64(len(content))-offset, seekMinSpan*2)
+	}
+}
+
+func TestAvailableLogsAPI(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2021, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	api := &AvailableLogsAPI{
+		JustlogAPI: &ChannelJustlogAPI{Channel: "pajlada"},
+		Dates:      []time.Time{day(5), day(4), day(2), day(1)},
+	}
+	end := time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)
+	assert(t, "FirstLogFile(available)", api.FirstLogFile(end), end)
+	assert(t, "FirstLogFile(gap)", api.FirstLogFile(day(10)), day(5))
+	assert(t, "NextLogFile(end)", api.NextLogFile(end), day(2))
+	assert(t, "NextLogFile(2nd)", api.NextLogFile(day(2)), day(1))
+	assert(t, "NextLogFile(1st)", api.NextLogFile(day(1)), time.Time{})
+}
+
+func TestChannelJustlogAPI_NextLogFile(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	assert(t, "error", err, nil)
+	api := ChannelJustlogAPI{Channel: "pajlada", URL: "https://logs.example.com"}
+
+	// DST started on 2021-03-14 in New York, 23:30 local time is already the next day in UTC
+	date := time.Date(2021, 3, 15, 23, 30, 0, 0, newYork)
+	assert(t, "MakeURL", api.MakeURL(date), "https://logs.example.com/channel/pajlada/2021/3/16?raw&reverse")
+	expected := []string{"2021/3/15", "2021/3/14", "2021/3/13", "2021/3/12"}
+	for _, day := range expected {
+		date = api.NextLogFile(date)
+		assert(t, "MakeURL", api.MakeURL(date), "https://logs.example.com/channel/pajlada/"+day+"?raw&reverse")
+	}
+
+	// DST ended on 2021-11-07
+	date = time.Date(2021, 11, 8, 0, 30, 0, 0, newYork)
+	expected = []string{"2021/11/7", "2021/11/6", "2021/11/5"}
+	for _, day := range expected {
+		date = api.NextLogFile(date)
+		assert(t, "MakeURL", api.MakeURL(date), "https://logs.example.com/channel/pajlada/"+day+"?raw&reverse")
+	}
+
+	date = api.NextLogFile(time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC))
+	assert(t, "NextLogFile across months", date, time.Date(2021, 2, 28, 0, 0, 0, 0, time.UTC))
+	date = api.NextLogFile(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert(t, "NextLogFile across years", date, time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC))
+}
+
+func TestUserJustlogAPI_NextLogFile(t *testing.T) {
+	api := UserJustlogAPI{Channel: "pajlada", User: "mm2pl", URL: "https://logs.example.com"}
+	date := time.Date(2021, 3, 31, 12, 0, 0, 0, time.UTC)
+	expected := []string{"2021/2", "2021/1", "2020/12", "2020/11"}
+	for _, month := range expected {
+		date = api.NextLogFile(date)
+		assert(
+			t,
+			"MakeURL",
+			api.MakeURL(date),
+			"https://logs.example.com/channel/pajlada/user/mm2pl/"+month+"?raw&reverse",
+		)
+	}
+}
+
+func TestFetchErrorKeepsMatches(t *testing.T) {
+	lines := "@tmi-sent-ts=1609545600000 :a!a@a.tmi.twitch.tv PRIVMSG #forsen :second\n" +
+		"@tmi-sent-ts=1609542000000 :a!a@a.tmi.twitch.tv PRIVMSG #forsen :first\n"
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				// promise more than is sent, the client sees the connection break in the middle of the file
+				w.Header().Set("Content-Length", fmt.Sprint(len(lines)+100))
+				_, _ = w.Write([]byte(lines))
+			},
+		),
+	)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	progress := &ProgressState{TotalResults: NewResultCounts()}
+	api := &ChannelJustlogAPI{Channel: "forsen", URL: server.URL}
+	download := make(chan *Message)
+	_, err := FetchForDate(ctx, api, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), download, progress, server.Client())
+	assert(t, "error", err, nil)
+
+	filter := Filter{EndDate: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	filtered := make(chan *Message)
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := filter.StreamFilter(cancel, download, filtered, progress)
+		errChan <- err
+	}()
+	var texts []string
+	for msg := range filtered {
+		texts = append(texts, msg.Text())
+	}
+	assertStrSlc(t, "matches", texts, []string{"second", "first"})
+	err = <-errChan
+	if _, ok := err.(*FetchError); !ok {
+		t.Fatalf("expected a *FetchError, got %v", err)
+	}
+}
+
+func TestFetchResumesBrokenDownload(t *testing.T) {
+	lines := "@tmi-sent-ts=1609549200000 :a!a@a.tmi.twitch.tv PRIVMSG #forsen :third\n" +
+		"@tmi-sent-ts=1609545600000 :a!a@a.tmi.twitch.tv PRIVMSG #forsen :second\n" +
+		"@tmi-sent-ts=1609542000000 :a!a@a.tmi.twitch.tv PRIVMSG #forsen :first\n"
+	var ranges []string
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				ranges = append(ranges, r.Header.Get("Range"))
+				if r.Header.Get("Range") == "" {
+					// break in the middle of the second line
+					w.Header().Set("Content-Length", fmt.Sprint(len(lines)))
+					_, _ = w.Write([]byte(lines[:strings.Index(lines, "second")]))
+					return
+				}
+				http.ServeContent(w, r, "", time.Time{}, strings.NewReader(lines))
+			},
+		),
+	)
+	defer server.Close()
+
+	progress := &ProgressState{TotalResults: NewResultCounts(), Instances: NewInstanceStatsRecorder()}
+	client := &http.Client{Transport: progress.Instances.RoundTripper(nil)}
+	api := &ChannelJustlogAPI{Channel: "forsen", URL: server.URL}
+	download := make(chan *Message)
+	date := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err := FetchForDate(context.Background(), api, date, download, progress, client)
+	assert(t, "error", err, nil)
+	var texts []string
+	for msg := range download {
+		if msg.fetchErr != nil {
+			t.Fatalf("unexpected error: %s", msg.fetchErr)
+		}
+		texts = append(texts, msg.Text())
+	}
+	assertStrSlc(t, "messages", texts, []string{"third", "second", "first"})
+	assertStrSlc(t, "ranges", ranges, []string{"", fmt.Sprintf("bytes=%d-", strings.Index(lines, "\n")+1)})
+	assert(t, "resumed downloads", progress.ResumedDownloads, 1)
+	stats := progress.Instances.Snapshot()[server.URL]
+	assert(t, "requests", stats.Requests, 2)
+	assert(t, "retries", stats.Retries, 1)
+}
+
+func TestProgressStateJSON(t *testing.T) {
+	progress := ProgressState{TotalResults: NewResultCounts(), CountLines: 4}
+	progress.TotalResults[ResultOk] = 3
+	progress.TotalResults[ResultDateBeforeStart] = 1
+	data, err := json.Marshal(progress)
+	assert(t, "error", err, nil)
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	assert(t, "error", err, nil)
+	assert(t, "total_results", string(fields["total_results"]), `[3,1,0,0,0,0,0,0]`)
+	assert(t, "results", strings.Contains(string(fields["results"]), `"date_before_start":1`), true)
+	assert(t, "count_lines", string(fields["count_lines"]), "4")
+
+	parsed := ProgressState{}
+	err = json.Unmarshal(data, &parsed)
+	assert(t, "error", err, nil)
+	assert(t, "parsed ok", parsed.TotalResults[ResultOk], 3)
+	assert(t, "parsed date before start", parsed.TotalResults[ResultDateBeforeStart], 1)
+	assert(t, "parsed count_lines", parsed.CountLines, 4)
+}
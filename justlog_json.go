@@ -0,0 +1,172 @@
+package justgrep
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+type APIFormat uint8
+
+const (
+	// APIFormatRaw uses justlog's ?raw endpoints which return one IRC message per line.
+	APIFormatRaw APIFormat = iota
+	// APIFormatJSON uses justlog's ?json endpoints which return pre-parsed messages.
+	APIFormatJSON
+)
+
+func (f APIFormat) String() string {
+	switch f {
+	case APIFormatRaw:
+		return "raw"
+	case APIFormatJSON:
+		return "json"
+	default:
+		return fmt.Sprintf("APIFormat(%d)", f)
+	}
+}
+
+// ParseAPIFormat converts the name of a format ("raw" or "json") into an APIFormat.
+func ParseAPIFormat(name string) (APIFormat, error) {
+	switch name {
+	case "raw", "":
+		return APIFormatRaw, nil
+	case "json":
+		return APIFormatJSON, nil
+	default:
+		return APIFormatRaw, errors.New(fmt.Sprintf("unknown API format %q, expected raw or json", name))
+	}
+}
+
+// jsonMessageTypes maps go-twitch-irc message types used by justlog onto IRC commands.
+var jsonMessageTypes = map[int]string{
+	0: "WHISPER",
+	1: "PRIVMSG",
+	2: "CLEARCHAT",
+	3: "ROOMSTATE",
+	4: "USERNOTICE",
+	5: "USERSTATE",
+	6: "NOTICE",
+	7: "GLOBALUSERSTATE",
+	8: "CLEARMSG",
+}
+
+type jsonMessage struct {
+	Text        string            `json:"text"`
+	Username    string            `json:"username"`
+	DisplayName string            `json:"displayName"`
+	Channel     string            `json:"channel"`
+	Timestamp   time.Time         `json:"timestamp"`
+	ID          string            `json:"id"`
+	Type        int               `json:"type"`
+	Raw         string            `json:"raw"`
+	Tags        map[string]string `json:"tags"`
+}
+
+// toMessage converts a message from justlog's JSON API into a Message. If justlog sent the raw IRC line it is parsed to
+// fill in the prefix and arguments, otherwise the Message is reconstructed from the structured fields.
+func (jm *jsonMessage) toMessage() (*Message, error) {
+	var msg *Message
+	if jm.Raw != "" {
+		var err error
+		msg, err = NewMessage(jm.Raw)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		action, ok := jsonMessageTypes[jm.Type]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("parser error: unknown justlog message type %d", jm.Type))
+		}
+		msg = &Message{
+			Action: action,
+			Args:   []string{"#" + jm.Channel, jm.Text},
+		}
+		if jm.Username != "" {
+			msg.Prefix = jm.Username + "!" + jm.Username + "@" + jm.Username + ".tmi.twitch.tv"
+		}
+	}
+	if msg.Tags == nil {
+		msg.Tags = make(map[string]string, len(jm.Tags)+2)
+	}
+	for k, v := range jm.Tags {
+		if _, exists := msg.Tags[k]; !exists {
+			msg.Tags[k] = v
+		}
+	}
+	if _, exists := msg.Tags["display-name"]; !exists && jm.DisplayName != "" {
+		msg.Tags["display-name"] = jm.DisplayName
+	}
+	if _, exists := msg.Tags["id"]; !exists && jm.ID != "" {
+		msg.Tags["id"] = jm.ID
+	}
+	if msg.User == "" {
+		msg.User = jm.Username
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = jm.Timestamp
+	}
+	if msg.Raw == "" {
+		msg.Raw = msg.Serialize()
+		msg.Raw = msg.Raw[:len(msg.Raw)-2] // strip \r\n
+	}
+	return msg, nil
+}
+
+// decodeJSONLogs reads a justlog JSON response ({"messages": [...]}) and calls handle for every message without loading
+// the entire response into memory. Decoding stops early if handle returns false. If a message can't be converted, msg
+// only has Raw and Invalid set.
+func decodeJSONLogs(reader io.Reader, handle func(msg *Message, err error) bool) error {
+	decoder := json.NewDecoder(reader)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if key != "messages" {
+			// skip unknown fields
+			var ignored json.RawMessage
+			if err = decoder.Decode(&ignored); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = expectDelim(decoder, '['); err != nil {
+			return err
+		}
+		for decoder.More() {
+			jm := jsonMessage{}
+			if err = decoder.Decode(&jm); err != nil {
+				return err
+			}
+			msg, err := jm.toMessage()
+			if err != nil {
+				// keep the raw line for InvalidLineRaw
+				msg = NewInvalidMessage(jm.Raw, err)
+			}
+			if !handle(msg, err) {
+				return nil
+			}
+		}
+		if err = expectDelim(decoder, ']'); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	tok, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return errors.New(fmt.Sprintf("parser error: unexpected %v in justlog JSON response, expected %v", tok, delim))
+	}
+	return nil
+}
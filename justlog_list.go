@@ -0,0 +1,137 @@
+package justgrep
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// listNumber accepts both numbers and numeric strings, justlog versions differ in how they encode dates in /list.
+type listNumber int
+
+func (n *listNumber) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		parsed, err := strconv.Atoi(text)
+		if err != nil {
+			return err
+		}
+		*n = listNumber(parsed)
+		return nil
+	}
+	var number int
+	if err := json.Unmarshal(data, &number); err != nil {
+		return err
+	}
+	*n = listNumber(number)
+	return nil
+}
+
+type listResp struct {
+	AvailableLogs []struct {
+		Year  listNumber `json:"year"`
+		Month listNumber `json:"month"`
+		Day   listNumber `json:"day"`
+	} `json:"availableLogs"`
+}
+
+// AvailableLogsAPI wraps a JustlogAPI to visit exactly the log files the instance has instead of stepping back by a
+// fixed offset, which wastes requests on gaps in the logs.
+type AvailableLogsAPI struct {
+	JustlogAPI
+
+	// Dates of available log files, newest first. Daily files are at midnight UTC, monthly ones at midnight UTC on
+	// the first day of the month.
+	Dates   []time.Time
+	Monthly bool
+}
+
+// NewAvailableLogsAPI asks the instance which log files are available for api using justlog's /list endpoint.
+func NewAvailableLogsAPI(ctx context.Context, client *http.Client, api JustlogAPI) (*AvailableLogsAPI, error) {
+	query := url.Values{}
+	var baseURL string
+	monthly := false
+	switch api := api.(type) {
+	case *ChannelJustlogAPI:
+		baseURL = api.URL
+		query.Set("channel", api.Channel)
+	case *UserJustlogAPI:
+		baseURL = api.URL
+		query.Set("channel", api.Channel)
+		if api.IsId {
+			query.Set("userid", api.User)
+		} else {
+			query.Set("user", api.User)
+		}
+		monthly = true
+	default:
+		return nil, errors.New(fmt.Sprintf("listing available logs isn't supported for %T", api))
+	}
+
+	resp, err := request(ctx, baseURL+"/list?"+query.Encode(), client, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	output := listResp{}
+	err = json.NewDecoder(resp.Body).Decode(&output)
+	if err != nil {
+		return nil, err
+	}
+	dates := make([]time.Time, 0, len(output.AvailableLogs))
+	for _, log := range output.AvailableLogs {
+		day := int(log.Day)
+		if monthly || day == 0 {
+			day = 1
+		}
+		dates = append(dates, time.Date(int(log.Year), time.Month(log.Month), day, 0, 0, 0, 0, time.UTC))
+	}
+	sort.Slice(
+		dates, func(i, j int) bool {
+			return dates[i].After(dates[j])
+		},
+	)
+	return &AvailableLogsAPI{JustlogAPI: api, Dates: dates, Monthly: monthly}, nil
+}
+
+// fileStart returns the date of the log file containing date.
+func (api *AvailableLogsAPI) fileStart(date time.Time) time.Time {
+	date = date.UTC()
+	if api.Monthly {
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// FirstLogFile returns the newest available log file which can contain messages sent at or before end. If the file
+// containing end is available, end itself is returned. Zero time is returned if there are no such files.
+func (api *AvailableLogsAPI) FirstLogFile(end time.Time) time.Time {
+	start := api.fileStart(end)
+	for _, date := range api.Dates {
+		if date.Equal(start) {
+			return end
+		}
+		if date.Before(start) {
+			return date
+		}
+	}
+	return time.Time{}
+}
+
+// NextLogFile returns the newest available log file older than the one containing currentDate, or zero time if there
+// are none.
+func (api *AvailableLogsAPI) NextLogFile(currentDate time.Time) time.Time {
+	start := api.fileStart(currentDate)
+	for _, date := range api.Dates {
+		if date.Before(start) {
+			return date
+		}
+	}
+	return time.Time{}
+}
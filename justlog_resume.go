@@ -0,0 +1,95 @@
+package justgrep
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+)
+
+// maxResumes is how many times a single broken download of a raw log file is continued.
+const maxResumes = 3
+
+// errorRecordingReader remembers the error which stopped reading, if it wasn't the end of the body.
+type errorRecordingReader struct {
+	io.Reader
+	err error
+}
+
+func (r *errorRecordingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// lineReader reads lines of a raw log file. If the download breaks, it can be continued with a range request right
+// after the last complete line, instead of downloading the whole file again.
+type lineReader struct {
+	resp    *http.Response
+	body    *errorRecordingReader
+	scanner *bufio.Scanner
+
+	// end is the offset in the file right after the last complete line
+	end     int64
+	resumes int
+}
+
+// newLineReader reads the lines of resp, which starts offset bytes into the file.
+func newLineReader(resp *http.Response, offset int64) *lineReader {
+	r := &lineReader{end: offset}
+	r.reset(resp)
+	return r
+}
+
+func (r *lineReader) reset(resp *http.Response) {
+	r.resp = resp
+	r.body = &errorRecordingReader{Reader: resp.Body}
+	r.scanner = bufio.NewScanner(r.body)
+	r.scanner.Split(r.split)
+}
+
+func (r *lineReader) split(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && r.body.err != nil && bytes.IndexAny(data, "\r\n") == -1 {
+		// the download broke in the middle of this line, it's read again after resuming
+		return 0, nil, r.body.err
+	}
+	advance, token, err := ScanLines(data, atEOF)
+	r.end += int64(advance)
+	return advance, token, err
+}
+
+func (r *lineReader) Scan() bool {
+	return r.scanner.Scan()
+}
+
+func (r *lineReader) Text() string {
+	return r.scanner.Text()
+}
+
+func (r *lineReader) Err() error {
+	return r.scanner.Err()
+}
+
+// resume continues a download which broke because of a network error. It returns false if that's not possible: the
+// error wasn't a network error, the instance compressed the file (offsets of the decompressed file don't match),
+// doesn't support range requests or the download was resumed too often already.
+func (r *lineReader) resume(ctx context.Context, url string, client *http.Client) bool {
+	if r.body.err == nil || r.resp.Uncompressed || r.resumes >= maxResumes || ctx.Err() != nil {
+		return false
+	}
+	_ = r.resp.Body.Close()
+	resp, err := request(ctx, url, client, r.end)
+	if err != nil {
+		return false
+	}
+	r.resumes++
+	r.reset(resp)
+	return true
+}
+
+func (r *lineReader) Close() error {
+	return r.resp.Body.Close()
+}
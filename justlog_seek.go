@@ -0,0 +1,115 @@
+package justgrep
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// seekChunkSize is how much is downloaded to find a single message while seeking, it has to fit at least one line.
+const seekChunkSize = 16 * 1024
+
+// seekMinSpan is the size below which seeking stops, streaming the rest is cheaper than making more requests.
+const seekMinSpan = 256 * 1024
+
+// seekOffset binary searches a raw, reversed log file for the first line sent at or before newest and returns its
+// byte offset. 0 is returned if the instance doesn't support range requests.
+func seekOffset(ctx context.Context, url string, client *http.Client, newest time.Time) (int64, error) {
+	length, err := rangeLength(ctx, url, client)
+	if err != nil || length == 0 {
+		return 0, err
+	}
+	// invariant: lo is the start of a line and everything before it was sent after newest
+	lo, hi := int64(0), length
+	for hi-lo > seekMinSpan {
+		mid := lo + (hi-lo)/2
+		lineStart, timestamp, err := timestampAt(ctx, url, client, mid)
+		if err != nil {
+			return 0, err
+		}
+		if lineStart != -1 && lineStart < hi && timestamp.After(newest) {
+			lo = lineStart
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// rangeLength checks if the instance supports range requests for url and returns the length of the file. 0 is
+// returned if ranges aren't supported.
+func rangeLength(ctx context.Context, url string, client *http.Client) (int64, error) {
+	resp, err := rangeRequest(ctx, url, client, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, nil
+	}
+	// Content-Range: bytes 0-0/12345
+	contentRange := resp.Header.Get("Content-Range")
+	slash := strings.LastIndexByte(contentRange, '/')
+	if slash == -1 {
+		return 0, nil
+	}
+	length, err := strconv.ParseInt(contentRange[slash+1:], 10, 64)
+	if err != nil {
+		// unknown length ("*")
+		return 0, nil
+	}
+	return length, nil
+}
+
+// timestampAt finds the first line starting after offset and returns its position and timestamp. If no full line
+// fits in seekChunkSize bytes, lineStart is -1.
+func timestampAt(
+	ctx context.Context,
+	url string,
+	client *http.Client,
+	offset int64,
+) (lineStart int64, timestamp time.Time, err error) {
+	resp, err := rangeRequest(ctx, url, client, offset, offset+seekChunkSize-1)
+	if err != nil {
+		return -1, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return -1, time.Time{}, errors.New(fmt.Sprintf("unexpected %d status code for a range request", resp.StatusCode))
+	}
+	chunk, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return -1, time.Time{}, err
+	}
+	start := bytes.IndexByte(chunk, '\n')
+	if start == -1 {
+		return -1, time.Time{}, nil
+	}
+	start++
+	end := bytes.IndexByte(chunk[start:], '\n')
+	if end == -1 {
+		return -1, time.Time{}, nil
+	}
+	msg, err := NewMessage(string(bytes.TrimRight(chunk[start:start+end], "\r")))
+	if err != nil {
+		// can't tell, treat the line as being too old so no messages are skipped by accident
+		return -1, time.Time{}, nil
+	}
+	return offset + int64(start), msg.Timestamp, nil
+}
+
+func rangeRequest(ctx context.Context, url string, client *http.Client, first int64, last int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", first, last))
+	return client.Do(req)
+}
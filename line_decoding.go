@@ -0,0 +1,90 @@
+package justgrep
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// LineDecoder prepares a line of a log file for parsing. If it returns an error, the line is invalid and handled
+// according to FetchOptions.OnInvalidLine.
+type LineDecoder func(line string) (string, error)
+
+// DefaultLineDecoders returns the decoders used if FetchOptions.LineDecoders isn't set.
+func DefaultLineDecoders() []LineDecoder {
+	return []LineDecoder{StripBOM}
+}
+
+// ErrInvalidUTF8 is returned by RejectInvalidUTF8.
+var ErrInvalidUTF8 = errors.New("line isn't valid UTF-8")
+
+// StripBOM removes a UTF-8 byte order mark, which files saved on Windows start with.
+func StripBOM(line string) (string, error) {
+	return strings.TrimPrefix(line, "\uFEFF"), nil
+}
+
+// RepairUTF8 replaces bytes which aren't valid UTF-8 with U+FFFD.
+func RepairUTF8(line string) (string, error) {
+	if utf8.ValidString(line) {
+		return line, nil
+	}
+	return strings.ToValidUTF8(line, "\uFFFD"), nil
+}
+
+// RejectInvalidUTF8 makes lines which aren't valid UTF-8 invalid.
+func RejectInvalidUTF8(line string) (string, error) {
+	if !utf8.ValidString(line) {
+		return line, ErrInvalidUTF8
+	}
+	return line, nil
+}
+
+// DecodeLine applies DefaultLineDecoders to line.
+func DecodeLine(line string) (string, error) {
+	return FetchOptions{}.DecodeLine(line)
+}
+
+// DecodeLine applies the LineDecoders of o to line.
+func (o FetchOptions) DecodeLine(line string) (string, error) {
+	decoders := o.LineDecoders
+	if decoders == nil {
+		decoders = DefaultLineDecoders()
+	}
+	for _, decode := range decoders {
+		var err error
+		line, err = decode(line)
+		if err != nil {
+			return line, err
+		}
+	}
+	return line, nil
+}
+
+// ScanLines is a bufio.SplitFunc like bufio.ScanLines, but lines can also end with a lone "\r" like in files saved by
+// old versions of justlog.
+func ScanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		// the "\n" of "\r\n" may be in the next read
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
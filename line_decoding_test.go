@@ -0,0 +1,35 @@
+package justgrep
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestScanLines(t *testing.T) {
+	input := "\uFEFFfirst\r\nsecond\rthird\n\nfourth\r"
+	// one byte at a time, so "\r\n" is split across reads
+	scanner := bufio.NewScanner(iotest.OneByteReader(strings.NewReader(input)))
+	scanner.Split(ScanLines)
+	var lines []string
+	for scanner.Scan() {
+		line, err := DecodeLine(scanner.Text())
+		assert(t, "error", err, nil)
+		lines = append(lines, line)
+	}
+	assert(t, "error", scanner.Err(), nil)
+	assert(t, "lines", strings.Join(lines, "|"), "first|second|third||fourth")
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	line, err := RepairUTF8("h\xffi")
+	assert(t, "error", err, nil)
+	assert(t, "repaired", line, "h\uFFFDi")
+
+	_, err = RejectInvalidUTF8("h\xffi")
+	assert(t, "error", err, ErrInvalidUTF8)
+	line, err = RejectInvalidUTF8("héllo")
+	assert(t, "error", err, nil)
+	assert(t, "valid", line, "héllo")
+}
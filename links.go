@@ -0,0 +1,51 @@
+package justgrep
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Link is a URL found in the text of a message.
+type Link struct {
+	// URL is the link as written, with obfuscations like "dot com" undone
+	URL string
+	// Domain is the lowercased host of URL
+	Domain string
+}
+
+// obfuscatedDots matches ways of writing a dot so it isn't recognized as a link: "(.)", "[dot]", " dot " and similar.
+var obfuscatedDots = regexp.MustCompile(`(?i)\s*[(\[{]\s*(?:\.|dot)\s*[)\]}]\s*|\s+dot\s+`)
+
+// linkPattern matches URLs with a scheme and bare domain names, optionally followed by a port and a path.
+var linkPattern = regexp.MustCompile(
+	`(?i)\b(?:(https?)://)?((?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+([a-z]{2,24}))(?::\d{1,5})?(?:/[^\s]*)?`,
+)
+
+// linkTLDs are top level domains of links written without a scheme, so words separated with a dot aren't links.
+var linkTLDs = map[string]bool{
+	"app": true, "be": true, "biz": true, "ca": true, "cc": true, "cn": true, "co": true, "com": true, "de": true,
+	"dev": true, "eu": true, "fm": true, "fr": true, "gg": true, "gl": true, "info": true, "io": true, "it": true,
+	"jp": true, "link": true, "live": true, "ly": true, "me": true, "net": true, "nl": true, "org": true, "pl": true,
+	"ru": true, "se": true, "sh": true, "site": true, "to": true, "tv": true, "uk": true, "us": true, "xyz": true,
+}
+
+// ExtractLinks finds links in text. Links don't need a scheme, but without one only well known top level domains
+// are recognized.
+func ExtractLinks(text string) []Link {
+	if !strings.Contains(text, ".") && !strings.Contains(strings.ToLower(text), "dot") {
+		// fast path for most messages
+		return nil
+	}
+	text = obfuscatedDots.ReplaceAllString(text, ".")
+	var links []Link
+	for _, match := range linkPattern.FindAllStringSubmatchIndex(text, -1) {
+		hasScheme := match[2] != -1
+		tld := strings.ToLower(text[match[6]:match[7]])
+		if !hasScheme && !linkTLDs[tld] {
+			continue
+		}
+		url := strings.TrimRight(text[match[0]:match[1]], ".,!?)]}'\"")
+		links = append(links, Link{URL: url, Domain: strings.ToLower(text[match[4]:match[5]])})
+	}
+	return links
+}
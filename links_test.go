@@ -0,0 +1,40 @@
+package justgrep
+
+import (
+	"testing"
+)
+
+func TestExtractLinks(t *testing.T) {
+	tests := map[string][]Link{
+		"no links here":       nil,
+		"end of sentence.Yes": nil,
+		"check https://Example.com/a?b=c out": {
+			{URL: "https://Example.com/a?b=c", Domain: "example.com"},
+		},
+		"go to clips.twitch.tv/abc, now!": {
+			{URL: "clips.twitch.tv/abc", Domain: "clips.twitch.tv"},
+		},
+		"free skins at scam dot com and scam2 (.) ru/x": {
+			{URL: "scam.com", Domain: "scam.com"},
+			{URL: "scam2.ru/x", Domain: "scam2.ru"},
+		},
+		"visit bit[dot]ly/abc or localhost.internal": {
+			{URL: "bit.ly/abc", Domain: "bit.ly"},
+		},
+		"http://localhost.internal:8080/x is fine with a scheme": {
+			{URL: "http://localhost.internal:8080/x", Domain: "localhost.internal"},
+		},
+	}
+	for text, expected := range tests {
+		links := ExtractLinks(text)
+		if len(links) != len(expected) {
+			t.Errorf("found %v in %q, expected %v", links, text, expected)
+			continue
+		}
+		for i := range links {
+			if links[i] != expected[i] {
+				t.Errorf("link %d of %q is %v, expected %v", i, text, links[i], expected[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package justgrep
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MemoryCache keeps responses downloaded completely in memory, so requesting the same URL again in the same process
+// doesn't download it again. Once the bodies take more than the size limit, the least recently used ones are dropped.
+// Only successful GET requests without credentials (an Authorization or Cookie header) are cached. Range requests are
+// answered from cached responses, but their responses aren't cached themselves. It's safe for concurrent use.
+type MemoryCache struct {
+	limit int64
+
+	lock    sync.Mutex
+	size    int64
+	order   *list.List
+	entries map[string]*list.Element
+
+	hits int
+}
+
+type cachedResponse struct {
+	url    string
+	header http.Header
+	body   []byte
+}
+
+// NewMemoryCache creates a MemoryCache holding at most limit bytes of response bodies.
+func NewMemoryCache(limit int64) *MemoryCache {
+	return &MemoryCache{limit: limit, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Hits returns how many requests were answered from the cache.
+func (c *MemoryCache) Hits() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.hits
+}
+
+// Size returns how many bytes of response bodies are cached.
+func (c *MemoryCache) Size() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.size
+}
+
+func (c *MemoryCache) get(url string) *cachedResponse {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	element, ok := c.entries[url]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(element)
+	c.hits++
+	return element.Value.(*cachedResponse)
+}
+
+func (c *MemoryCache) add(entry *cachedResponse) {
+	size := int64(len(entry.body))
+	if size > c.limit {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if element, ok := c.entries[entry.url]; ok {
+		// downloaded twice at the same time
+		c.size -= int64(len(element.Value.(*cachedResponse).body))
+		c.order.Remove(element)
+	}
+	for c.size+size > c.limit {
+		oldest := c.order.Back()
+		old := c.order.Remove(oldest).(*cachedResponse)
+		delete(c.entries, old.url)
+		c.size -= int64(len(old.body))
+	}
+	c.entries[entry.url] = c.order.PushFront(entry)
+	c.size += size
+}
+
+// RoundTripper wraps base to answer requests from the cache and to cache responses.
+func (c *MemoryCache) RoundTripper(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &cacheRoundTripper{base: base, cache: c}
+}
+
+type cacheRoundTripper struct {
+	base  http.RoundTripper
+	cache *MemoryCache
+}
+
+// hasCredentials reports whether req is sent with credentials. Responses to them can depend on who asked, so they
+// aren't shared through a cache keyed by URL. Cookies come from the session jar of the client.
+func hasCredentials(req *http.Request) bool {
+	return req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != ""
+}
+
+func (t *cacheRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || hasCredentials(req) {
+		return t.base.RoundTrip(req)
+	}
+	url := req.URL.String()
+	rangeHeader := req.Header.Get("Range")
+	if _, _, ok := parseByteRange(rangeHeader); rangeHeader != "" && !ok {
+		// multiple or suffix ranges
+		return t.base.RoundTrip(req)
+	}
+	if entry := t.cache.get(url); entry != nil {
+		return entry.response(req)
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK || rangeHeader != "" {
+		return resp, err
+	}
+	resp.Body = &cachingBody{
+		ReadCloser: resp.Body,
+		cache:      t.cache,
+		entry:      &cachedResponse{url: url, header: resp.Header.Clone()},
+	}
+	return resp, nil
+}
+
+// response answers req with the cached body, or the part of it req asked for with a Range header.
+func (r *cachedResponse) response(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(r.body)),
+		ContentLength: int64(len(r.body)),
+		Request:       req,
+	}
+	rangeHeader := req.Header.Get("Range")
+	if rangeHeader == "" {
+		return resp, nil
+	}
+	// the range was checked already
+	first, last, _ := parseByteRange(rangeHeader)
+	length := int64(len(r.body))
+	if first >= length {
+		resp.Status = "416 Requested Range Not Satisfiable"
+		resp.StatusCode = http.StatusRequestedRangeNotSatisfiable
+		resp.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", len(r.body)))
+		resp.Body = io.NopCloser(strings.NewReader(""))
+		resp.ContentLength = 0
+		return resp, nil
+	}
+	resp.Status = "206 Partial Content"
+	resp.StatusCode = http.StatusPartialContent
+	if last < 0 || last >= length {
+		last = length - 1
+	}
+	resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, length))
+	resp.Body = io.NopCloser(bytes.NewReader(r.body[first : last+1]))
+	resp.ContentLength = last - first + 1
+	resp.Header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	return resp, nil
+}
+
+// parseByteRange parses a Range header with a single range of bytes, "bytes=first-" or "bytes=first-last". last is
+// -1 if the range goes to the end.
+func parseByteRange(header string) (first int64, last int64, ok bool) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	dash := strings.IndexByte(spec, '-')
+	if spec == header || dash <= 0 {
+		return 0, 0, false
+	}
+	first, err := strconv.ParseInt(spec[:dash], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if spec[dash+1:] == "" {
+		return first, -1, true
+	}
+	last, err = strconv.ParseInt(spec[dash+1:], 10, 64)
+	if err != nil || last < first {
+		return 0, 0, false
+	}
+	return first, last, true
+}
+
+// cachingBody copies everything read from the body, it's cached once the body was read to the end.
+type cachingBody struct {
+	io.ReadCloser
+	cache *MemoryCache
+	entry *cachedResponse
+	// tooBig is set once the body is bigger than the cache
+	tooBig bool
+	done   bool
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.tooBig && !b.done {
+		if int64(len(b.entry.body)+n) > b.cache.limit {
+			b.tooBig = true
+			b.entry.body = nil
+		} else {
+			b.entry.body = append(b.entry.body, p[:n]...)
+		}
+	}
+	if err == io.EOF && !b.tooBig && !b.done {
+		b.done = true
+		b.cache.add(b.entry)
+	}
+	return n, err
+}
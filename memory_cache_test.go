@@ -0,0 +1,91 @@
+package justgrep
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMemoryCache(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				requests[r.URL.Path]++
+				_, _ = w.Write([]byte(strings.Repeat(r.URL.Path[1:], 10)))
+			},
+		),
+	)
+	defer server.Close()
+
+	cache := NewMemoryCache(25)
+	client := &http.Client{Transport: cache.RoundTripper(nil)}
+	get := func(path string, rangeHeader string) (int, string) {
+		req, err := http.NewRequest("GET", server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	_, body := get("/a", "")
+	assert(t, "body", body, "aaaaaaaaaa")
+	_, body = get("/a", "")
+	assert(t, "cached body", body, "aaaaaaaaaa")
+	assert(t, "requests of /a", requests["/a"], 1)
+	assert(t, "hits", cache.Hits(), 1)
+
+	status, body := get("/a", "bytes=8-")
+	assert(t, "range status", status, http.StatusPartialContent)
+	assert(t, "range body", body, "aa")
+	status, _ = get("/a", "bytes=10-")
+	assert(t, "unsatisfiable range status", status, http.StatusRequestedRangeNotSatisfiable)
+	assert(t, "requests of /a after ranges", requests["/a"], 1)
+
+	// /b and /c don't fit together with /a, it was used least recently
+	get("/b", "")
+	get("/c", "")
+	assert(t, "size", cache.Size(), int64(20))
+	get("/a", "")
+	assert(t, "requests of /a after eviction", requests["/a"], 2)
+
+	// bigger than the whole cache
+	get("/toolong", "")
+	get("/toolong", "")
+	assert(t, "requests of /toolong", requests["/toolong"], 2)
+
+	// cookies of the session jar, the response could be for this session only
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jar.SetCookies(serverURL, []*http.Cookie{{Name: "session", Value: "s3cret"}})
+	client.Jar = jar
+	_, body = get("/c", "")
+	assert(t, "body with cookie", body, "cccccccccc")
+	assert(t, "requests of /c with cookie", requests["/c"], 2)
+	get("/d", "")
+	client.Jar = nil
+	get("/d", "")
+	assert(t, "requests of /d", requests["/d"], 2)
+}
@@ -0,0 +1,124 @@
+package justgrep
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ModerationAction is a timeout or ban of a user with the messages they sent shortly before it.
+type ModerationAction struct {
+	Time time.Time
+	// Duration is how long a timeout lasts, it's zero for bans
+	Duration time.Duration
+	Ban      bool
+	// Messages were sent by the user before the action, oldest first
+	Messages []*Message
+}
+
+// ModerationTarget returns the login and the user id of who a CLEARCHAT timed out or banned. ok is false for other
+// messages and for CLEARCHATs clearing the whole chat.
+func ModerationTarget(msg *Message) (login string, userID string, ok bool) {
+	if msg.Action != "CLEARCHAT" || len(msg.Args) < 2 {
+		return "", "", false
+	}
+	return msg.Args[1], msg.Tags["target-user-id"], true
+}
+
+// FindModerationActions turns CLEARCHATs targeting a user into ModerationActions, attaching the messages of the user
+// sent at most window before each of them. Messages are only attached to the first action after them. Both slices
+// have to be from the same channel, they don't need to be sorted.
+func FindModerationActions(clearChats []*Message, messages []*Message, window time.Duration) []ModerationAction {
+	byTime := func(list []*Message) []*Message {
+		sorted := make([]*Message, len(list))
+		copy(sorted, list)
+		sort.SliceStable(
+			sorted, func(i, j int) bool {
+				return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+			},
+		)
+		return sorted
+	}
+	clearChats = byTime(clearChats)
+	messages = byTime(messages)
+
+	output := make([]ModerationAction, 0, len(clearChats))
+	next := 0
+	for _, clearChat := range clearChats {
+		action := ModerationAction{Time: clearChat.Timestamp, Ban: true}
+		if seconds, err := strconv.Atoi(clearChat.Tags["ban-duration"]); err == nil {
+			action.Ban = false
+			action.Duration = time.Duration(seconds) * time.Second
+		}
+		for next < len(messages) && !messages[next].Timestamp.After(clearChat.Timestamp) {
+			if clearChat.Timestamp.Sub(messages[next].Timestamp) <= window {
+				action.Messages = append(action.Messages, messages[next])
+			}
+			next++
+		}
+		output = append(output, action)
+	}
+	return output
+}
+
+const (
+	ModerationTimeout = "timeout"
+	ModerationBan     = "ban"
+	// ModerationClear is a CLEARCHAT of the whole chat
+	ModerationClear = "clear"
+	// ModerationDelete is a CLEARMSG deleting a single message
+	ModerationDelete = "delete"
+)
+
+// moderatorTags may have the login of the moderator, Twitch doesn't send it but some loggers add it.
+var moderatorTags = []string{"moderator-login", "created-by"}
+
+// ModerationEvent is a CLEARCHAT or CLEARMSG normalized into a single form.
+type ModerationEvent struct {
+	Time    time.Time
+	Channel string
+	// Action is one of ModerationTimeout, ModerationBan, ModerationClear or ModerationDelete
+	Action   string
+	Target   string
+	TargetID string
+	// Duration is set for timeouts
+	Duration  time.Duration
+	Moderator string
+	// MessageID and Text are the id and the text of a deleted message
+	MessageID string
+	Text      string
+}
+
+// NewModerationEvent converts a CLEARCHAT or CLEARMSG, ok is false for other messages.
+func NewModerationEvent(msg *Message) (event ModerationEvent, ok bool) {
+	event = ModerationEvent{Time: msg.Timestamp, Channel: msg.Channel()}
+	for _, tag := range moderatorTags {
+		if moderator := msg.Tags[tag]; moderator != "" {
+			event.Moderator = moderator
+			break
+		}
+	}
+	switch msg.Action {
+	case "CLEARCHAT":
+		login, userID, targeted := ModerationTarget(msg)
+		if !targeted {
+			event.Action = ModerationClear
+			return event, true
+		}
+		event.Target, event.TargetID = login, userID
+		event.Action = ModerationBan
+		if seconds, err := strconv.Atoi(msg.Tags["ban-duration"]); err == nil {
+			event.Action = ModerationTimeout
+			event.Duration = time.Duration(seconds) * time.Second
+		}
+		return event, true
+	case "CLEARMSG":
+		event.Action = ModerationDelete
+		event.Target = msg.Tags["login"]
+		event.MessageID = msg.Tags["target-msg-id"]
+		event.Text = msg.Text()
+		return event, true
+	default:
+		return ModerationEvent{}, false
+	}
+}
@@ -0,0 +1,88 @@
+package justgrep
+
+import (
+	"testing"
+	"time"
+)
+
+func TestModerationTarget(t *testing.T) {
+	tests := map[string]bool{
+		"@ban-duration=600;room-id=1;target-user-id=103;tmi-sent-ts=1000 :tmi.twitch.tv CLEARCHAT #x :user3": true,
+		"@room-id=1;target-user-id=103;tmi-sent-ts=1000 :tmi.twitch.tv CLEARCHAT #x :user3":                  true,
+		"@room-id=1;tmi-sent-ts=1000 :tmi.twitch.tv CLEARCHAT #x":                                            false,
+		"@user-id=103;tmi-sent-ts=1000 :user3!user3@user3.tmi.twitch.tv PRIVMSG #x :user3":                   false,
+	}
+	for line, expected := range tests {
+		msg, err := NewMessage(line)
+		assert(t, "error", err, nil)
+		login, userID, ok := ModerationTarget(msg)
+		assert(t, "ok of "+line, ok, expected)
+		if ok {
+			assert(t, "login of "+line, login, "user3")
+			assert(t, "user id of "+line, userID, "103")
+		}
+	}
+}
+
+func TestFindModerationActions(t *testing.T) {
+	base := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int, tags map[string]string) *Message {
+		return &Message{Timestamp: base.Add(time.Duration(minutes) * time.Minute), Tags: tags}
+	}
+	messages := []*Message{at(50, nil), at(-30, nil), at(-5, nil), at(-1, nil), at(55, nil), at(0, nil)}
+	clearChats := []*Message{at(60, nil), at(0, map[string]string{"ban-duration": "600"})}
+	actions := FindModerationActions(clearChats, messages, 10*time.Minute)
+
+	if len(actions) != 2 {
+		t.Fatalf("found %d actions, expected 2", len(actions))
+	}
+	assert(t, "first is a ban", actions[0].Ban, false)
+	assert(t, "first duration", actions[0].Duration, 10*time.Minute)
+	assert(t, "first time", actions[0].Time, base)
+	// -30 is too old
+	assertMessageTimes(t, "first messages", actions[0].Messages, []*Message{messages[2], messages[3], messages[5]})
+	assert(t, "second is a ban", actions[1].Ban, true)
+	assertMessageTimes(t, "second messages", actions[1].Messages, []*Message{messages[0], messages[4]})
+}
+
+func assertMessageTimes(t *testing.T, name string, have []*Message, expected []*Message) {
+	t.Helper()
+	if len(have) != len(expected) {
+		t.Fatalf("%s: have %d messages, expected %d", name, len(have), len(expected))
+	}
+	for i := range have {
+		if !have[i].Timestamp.Equal(expected[i].Timestamp) {
+			t.Errorf("%s: message %d was sent at %s, expected %s", name, i, have[i].Timestamp, expected[i].Timestamp)
+		}
+	}
+}
+
+func TestNewModerationEvent(t *testing.T) {
+	tests := map[string]ModerationEvent{
+		"@ban-duration=600;room-id=1;target-user-id=103;tmi-sent-ts=1000 :tmi.twitch.tv CLEARCHAT #x :user3": {
+			Action: ModerationTimeout, Target: "user3", TargetID: "103", Duration: 10 * time.Minute,
+		},
+		"@moderator-login=mod;room-id=1;target-user-id=103;tmi-sent-ts=1000 :tmi.twitch.tv CLEARCHAT #x :user3": {
+			Action: ModerationBan, Target: "user3", TargetID: "103", Moderator: "mod",
+		},
+		"@room-id=1;tmi-sent-ts=1000 :tmi.twitch.tv CLEARCHAT #x": {Action: ModerationClear},
+		"@login=user3;target-msg-id=abc;tmi-sent-ts=1000 :tmi.twitch.tv CLEARMSG #x :bad words": {
+			Action: ModerationDelete, Target: "user3", MessageID: "abc", Text: "bad words",
+		},
+	}
+	for line, expected := range tests {
+		msg, err := NewMessage(line)
+		assert(t, "error", err, nil)
+		event, ok := NewModerationEvent(msg)
+		assert(t, "ok of "+line, ok, true)
+		expected.Time = time.Unix(1, 0)
+		expected.Channel = "x"
+		if event != expected {
+			t.Errorf("event of %s is %+v, expected %+v", line, event, expected)
+		}
+	}
+	msg, err := NewMessage("@tmi-sent-ts=1000 :user3!user3@user3.tmi.twitch.tv PRIVMSG #x :hi")
+	assert(t, "error", err, nil)
+	_, ok := NewModerationEvent(msg)
+	assert(t, "ok of a PRIVMSG", ok, false)
+}
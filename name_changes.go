@@ -0,0 +1,103 @@
+package justgrep
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// NameSpan describes one login of a user, with the first and last message seen under it.
+type NameSpan struct {
+	Login    string    `json:"login"`
+	First    time.Time `json:"first"`
+	Last     time.Time `json:"last"`
+	Messages int       `json:"messages"`
+}
+
+// NameTracker finds users which changed their login by comparing user ids and logins of messages. It's safe for
+// concurrent use.
+type NameTracker struct {
+	lock sync.Mutex
+	// users maps user ids to spans by login
+	users map[string]map[string]*NameSpan
+}
+
+func NewNameTracker() *NameTracker {
+	return &NameTracker{users: make(map[string]map[string]*NameSpan)}
+}
+
+// messageLogin returns the login of the sender of msg, messages from the server like USERNOTICEs carry it in a tag.
+func messageLogin(msg *Message) string {
+	if msg.User != "" {
+		return msg.User
+	}
+	return msg.Tags["login"]
+}
+
+// Observe records the login msg was sent with. Messages without a user id are ignored.
+func (t *NameTracker) Observe(msg *Message) {
+	id := msg.Tags["user-id"]
+	login := messageLogin(msg)
+	if id == "" || login == "" {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	logins, ok := t.users[id]
+	if !ok {
+		logins = make(map[string]*NameSpan, 1)
+		t.users[id] = logins
+	}
+	span, ok := logins[login]
+	if !ok {
+		logins[login] = &NameSpan{Login: login, First: msg.Timestamp, Last: msg.Timestamp, Messages: 1}
+		return
+	}
+	span.Messages++
+	if msg.Timestamp.Before(span.First) {
+		span.First = msg.Timestamp
+	}
+	if msg.Timestamp.After(span.Last) {
+		span.Last = msg.Timestamp
+	}
+}
+
+// Timeline returns the logins used by the user with the given id, ordered by when they were first seen.
+func (t *NameTracker) Timeline(userID string) []NameSpan {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.timeline(userID)
+}
+
+// timeline is Timeline, the lock must be held.
+func (t *NameTracker) timeline(userID string) []NameSpan {
+	logins := t.users[userID]
+	output := make([]NameSpan, 0, len(logins))
+	for _, span := range logins {
+		output = append(output, *span)
+	}
+	sort.Slice(
+		output, func(i, j int) bool {
+			return output[i].First.Before(output[j].First)
+		},
+	)
+	return output
+}
+
+// Changes returns timelines of every user seen with more than one login, keyed by user id.
+func (t *NameTracker) Changes() map[string][]NameSpan {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	output := make(map[string][]NameSpan)
+	for id, logins := range t.users {
+		if len(logins) > 1 {
+			output[id] = t.timeline(id)
+		}
+	}
+	return output
+}
+
+func (t *NameTracker) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Changes())
+}
@@ -0,0 +1,33 @@
+package justgrep
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNameTracker(t *testing.T) {
+	tracker := NewNameTracker()
+	for _, line := range []string{
+		// newer log files come first
+		"@login=new;user-id=5;tmi-sent-ts=1609462800000 :tmi.twitch.tv USERNOTICE #a :resub",
+		"@user-id=5;tmi-sent-ts=1609459200000 :old!old@old.tmi.twitch.tv PRIVMSG #a :hi",
+		"@user-id=5;tmi-sent-ts=1609460000000 :old!old@old.tmi.twitch.tv PRIVMSG #a :again",
+		"@user-id=6;tmi-sent-ts=1609461000000 :other!other@other.tmi.twitch.tv PRIVMSG #a :yo",
+		":nobody!nobody@nobody.tmi.twitch.tv PRIVMSG #a :no tags",
+	} {
+		msg, err := NewMessage(line)
+		assert(t, "error", err, nil)
+		tracker.Observe(msg)
+	}
+
+	changes := tracker.Changes()
+	assert(t, "users with changes", len(changes), 1)
+	timeline := changes["5"]
+	assert(t, "timeline length", len(timeline), 2)
+	assert(t, "old login", timeline[0].Login, "old")
+	assert(t, "old first", timeline[0].First.Equal(time.Unix(1609459200, 0)), true)
+	assert(t, "old last", timeline[0].Last.Equal(time.Unix(1609460000, 0)), true)
+	assert(t, "old messages", timeline[0].Messages, 2)
+	assert(t, "new login", timeline[1].Login, "new")
+	assert(t, "unchanged user", len(tracker.Timeline("6")), 1)
+}
@@ -0,0 +1,171 @@
+package justgrep
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldMapping describes where to find message fields in foreign JSON chat exports. Every value is a path to a JSON
+// field, nested objects are separated with dots, e.g. "author.name".
+type FieldMapping struct {
+	Timestamp   string
+	User        string
+	Text        string
+	Channel     string
+	Action      string
+	ID          string
+	DisplayName string
+}
+
+// ParseFieldMapping parses a mapping in the form of "ts=timestamp,user=login,text=message". Recognized keys are ts,
+// user, text, channel, action, id and display-name. text is required.
+func ParseFieldMapping(spec string) (FieldMapping, error) {
+	mapping := FieldMapping{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		equalsIdx := strings.IndexRune(pair, '=')
+		if equalsIdx == -1 {
+			return mapping, errors.New(fmt.Sprintf("invalid field mapping %q, expected key=field", pair))
+		}
+		key, field := pair[:equalsIdx], pair[equalsIdx+1:]
+		switch key {
+		case "ts", "timestamp":
+			mapping.Timestamp = field
+		case "user":
+			mapping.User = field
+		case "text":
+			mapping.Text = field
+		case "channel":
+			mapping.Channel = field
+		case "action":
+			mapping.Action = field
+		case "id":
+			mapping.ID = field
+		case "display-name":
+			mapping.DisplayName = field
+		default:
+			return mapping, errors.New(fmt.Sprintf("unknown field mapping key %q", key))
+		}
+	}
+	if mapping.Text == "" {
+		return mapping, errors.New("field mapping needs to contain text=...")
+	}
+	return mapping, nil
+}
+
+// lookup finds the value at path in a decoded JSON object.
+func lookup(object map[string]interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return nil, false
+	}
+	var current interface{} = object
+	for _, key := range strings.Split(path, ".") {
+		asMap, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = asMap[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func lookupString(object map[string]interface{}, path string) string {
+	value, ok := lookup(object, path)
+	if !ok || value == nil {
+		return ""
+	}
+	switch value := value.(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// parseForeignTimestamp accepts RFC3339 strings and unix timestamps in seconds or milliseconds.
+func parseForeignTimestamp(value interface{}) (time.Time, error) {
+	switch value := value.(type) {
+	case string:
+		return time.Parse(time.RFC3339, value)
+	case json.Number:
+		if integer, err := value.Int64(); err == nil {
+			if integer > 1e12 {
+				// milliseconds
+				return time.Unix(integer/1000, integer%1000*int64(time.Millisecond)).UTC(), nil
+			}
+			return time.Unix(integer, 0).UTC(), nil
+		}
+		number, err := strconv.ParseFloat(value.String(), 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if number > 1e12 {
+			// milliseconds
+			return time.Unix(0, int64(number*float64(time.Millisecond))).UTC(), nil
+		}
+		return time.Unix(0, int64(number*float64(time.Second))).UTC(), nil
+	default:
+		return time.Time{}, errors.New(fmt.Sprintf("unsupported timestamp %v", value))
+	}
+}
+
+// Decode converts a single line of a JSON-lines export into a Message. The Message gets a synthetic Raw IRC line, so
+// it can be printed and saved like messages downloaded from justlog.
+func (fm FieldMapping) Decode(line string) (*Message, error) {
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+	object := map[string]interface{}{}
+	err := decoder.Decode(&object)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("parser error: invalid JSON: %s", err))
+	}
+	if _, ok := lookup(object, fm.Text); !ok {
+		return nil, errors.New(fmt.Sprintf("parser error: text field %q is missing", fm.Text))
+	}
+
+	msg := &Message{
+		Action: "PRIVMSG",
+		Tags:   make(map[string]string, 3),
+	}
+	if action := lookupString(object, fm.Action); action != "" {
+		msg.Action = strings.ToUpper(action)
+	}
+	if user := lookupString(object, fm.User); user != "" {
+		msg.User = strings.ToLower(user)
+		msg.Prefix = msg.User + "!" + msg.User + "@" + msg.User + ".tmi.twitch.tv"
+	}
+	// raw lines can't contain line breaks
+	text := strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(lookupString(object, fm.Text))
+	if channel := lookupString(object, fm.Channel); channel != "" {
+		msg.Args = []string{"#" + strings.TrimPrefix(strings.ToLower(channel), "#"), text}
+	} else {
+		msg.Args = []string{text}
+	}
+	if id := lookupString(object, fm.ID); id != "" {
+		msg.Tags["id"] = id
+	}
+	if displayName := lookupString(object, fm.DisplayName); displayName != "" {
+		msg.Tags["display-name"] = displayName
+	}
+	if value, ok := lookup(object, fm.Timestamp); ok {
+		msg.Timestamp, err = parseForeignTimestamp(value)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("parser error: unable to parse time (%s): %s", fm.Timestamp, err))
+		}
+		msg.Tags["tmi-sent-ts"] = strconv.FormatInt(msg.Timestamp.UnixNano()/int64(time.Millisecond), 10)
+	}
+	msg.Raw = strings.TrimSuffix(msg.Serialize(), "\r\n")
+	return msg, nil
+}
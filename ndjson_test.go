@@ -0,0 +1,39 @@
+package justgrep
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFieldMapping_Decode(t *testing.T) {
+	mapping, err := ParseFieldMapping("ts=timestamp,user=author.login,text=message,channel=channel,id=id")
+	assert(t, "error", err, nil)
+
+	msg, err := mapping.Decode(
+		`{"timestamp":"2023-01-01T10:00:00Z","author":{"login":"Mm2PL"},"message":"hello\nworld","channel":"#Pajlada","id":"abc"}`,
+	)
+	assert(t, "error", err, nil)
+	assert(t, "User", msg.User, "mm2pl")
+	assert(t, "Action", msg.Action, "PRIVMSG")
+	assertStrSlc(t, "Args", msg.Args, []string{"#pajlada", "hello world"})
+	assert(t, "id", msg.Tags["id"], "abc")
+	assert(t, "Timestamp", msg.Timestamp.Equal(time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)), true)
+
+	reparsed, err := NewMessage(msg.Raw)
+	assert(t, "reparse error", err, nil)
+	assertStrSlc(t, "reparsed Args", reparsed.Args, msg.Args)
+	assert(t, "reparsed Timestamp", reparsed.Timestamp.Equal(msg.Timestamp), true)
+
+	msg, err = mapping.Decode(`{"timestamp":1672567200123,"message":"unix"}`)
+	assert(t, "error", err, nil)
+	assert(t, "Timestamp (ms)", msg.Timestamp.Equal(time.Date(2023, 1, 1, 10, 0, 0, 123000000, time.UTC)), true)
+
+	_, err = mapping.Decode(`{"timestamp":1672567200}`)
+	if err == nil {
+		t.Errorf("expected a missing text field to fail")
+	}
+	_, err = ParseFieldMapping("user=login")
+	if err == nil {
+		t.Errorf("expected a mapping without text to fail")
+	}
+}
@@ -0,0 +1,109 @@
+package justgrep
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Reasons of NoResultsExplanation
+const (
+	NoResultsNotFound    = "not_found"
+	NoResultsFetchFailed = "fetch_failed"
+	NoResultsNoLines     = "no_lines"
+	NoResultsInvalid     = "invalid_lines"
+	NoResultsDateRange   = "date_range"
+	NoResultsType        = "type"
+	NoResultsContent     = "content"
+	NoResultsUser        = "user"
+)
+
+// NoResultsExplanation is the most likely reason a search found nothing, see ExplainNoResults.
+type NoResultsExplanation struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// ExplainNoResults finds out why a search found nothing from its counters, it returns nil if there are matches.
+//
+// Messages go through the checks of a Filter in a fixed order: date, type, content and then users. When none
+// matched, the last check that rejected any of them is the one that got rid of the rest, e.g. with messages matching
+// the pattern but none from the searched users it's the user filter, not the pattern. Searches which didn't get any
+// lines are explained by their failed downloads, telling apart instances which don't have the logs.
+func ExplainNoResults(progress *ProgressState) *NoResultsExplanation {
+	results := progress.TotalResults
+	if results[ResultOk] != 0 {
+		return nil
+	}
+	if progress.CountLines == 0 {
+		if progress.FetchErrors == 0 {
+			return &NoResultsExplanation{
+				Reason:  NoResultsNoLines,
+				Message: "No lines were read, there are no logs in the searched time range.",
+			}
+		}
+		if progress.Instances != nil && onlyNotFound(progress.Instances) {
+			return &NoResultsExplanation{
+				Reason: NoResultsNotFound,
+				Message: fmt.Sprintf(
+					"The instances don't have the logs, %d log files weren't found (404).",
+					progress.FetchErrors,
+				),
+			}
+		}
+		return &NoResultsExplanation{
+			Reason:  NoResultsFetchFailed,
+			Message: fmt.Sprintf("No lines were read, %d log files failed to download.", progress.FetchErrors),
+		}
+	}
+	if progress.CountLines == progress.InvalidLines {
+		return &NoResultsExplanation{
+			Reason:  NoResultsInvalid,
+			Message: fmt.Sprintf("None of the %d lines read could be parsed.", progress.CountLines),
+		}
+	}
+	valid := progress.CountLines - progress.InvalidLines
+	inRange := valid - results[ResultDateBeforeStart] - results[ResultDateAfterEnd]
+	switch {
+	case results[ResultUser] != 0:
+		return &NoResultsExplanation{
+			Reason: NoResultsUser,
+			Message: fmt.Sprintf(
+				"None of the %d messages left after the other filters are from the searched users.",
+				results[ResultUser],
+			),
+		}
+	case results[ResultContent] != 0:
+		return &NoResultsExplanation{
+			Reason: NoResultsContent,
+			Message: fmt.Sprintf(
+				"None of the %d messages searched matched the pattern.",
+				results[ResultContent],
+			),
+		}
+	case results[ResultType] != 0:
+		return &NoResultsExplanation{
+			Reason:  NoResultsType,
+			Message: fmt.Sprintf("None of the %d lines in the time range are of the searched message types.", inRange),
+		}
+	}
+	return &NoResultsExplanation{
+		Reason:  NoResultsDateRange,
+		Message: fmt.Sprintf("All %d lines read are outside of the searched time range.", valid),
+	}
+}
+
+// onlyNotFound checks if every failed request to the instances was a 404.
+func onlyNotFound(instances *InstanceStatsRecorder) bool {
+	notFound := strconv.Itoa(http.StatusNotFound)
+	found := false
+	for _, stats := range instances.Snapshot() {
+		for status, count := range stats.ErrorsByStatus {
+			if status != notFound && count != 0 {
+				return false
+			}
+			found = found || count != 0
+		}
+	}
+	return found
+}
@@ -0,0 +1,39 @@
+package justgrep
+
+import (
+	"testing"
+)
+
+func TestExplainNoResults(t *testing.T) {
+	explain := func(lines int, fetchErrors int, counts map[FilterResult]int) string {
+		progress := &ProgressState{TotalResults: NewResultCounts(), CountLines: lines, FetchErrors: fetchErrors}
+		for result, count := range counts {
+			progress.TotalResults[result] = count
+		}
+		explanation := ExplainNoResults(progress)
+		if explanation == nil {
+			return ""
+		}
+		return explanation.Reason
+	}
+	assert(t, "matches", explain(10, 0, map[FilterResult]int{ResultOk: 1, ResultContent: 9}), "")
+	assert(t, "no lines", explain(0, 0, nil), NoResultsNoLines)
+	assert(t, "failed downloads", explain(0, 2, nil), NoResultsFetchFailed)
+	progress := &ProgressState{TotalResults: NewResultCounts(), CountLines: 3, InvalidLines: 3}
+	assert(t, "invalid lines", ExplainNoResults(progress).Reason, NoResultsInvalid)
+	outside := map[FilterResult]int{ResultDateAfterEnd: 4, ResultDateBeforeStart: 1}
+	assert(t, "date range", explain(5, 0, outside), NoResultsDateRange)
+	assert(t, "type", explain(5, 0, map[FilterResult]int{ResultDateAfterEnd: 1, ResultType: 4}), NoResultsType)
+	assert(t, "content", explain(5, 0, map[FilterResult]int{ResultType: 1, ResultContent: 4}), NoResultsContent)
+	assert(t, "user", explain(5, 0, map[FilterResult]int{ResultContent: 4, ResultUser: 1}), NoResultsUser)
+
+	progress = &ProgressState{
+		TotalResults: NewResultCounts(),
+		FetchErrors:  1,
+		Instances:    NewInstanceStatsRecorder(),
+	}
+	progress.Instances.recordResponse("https://logs.example.com", 0, "404", true)
+	assert(t, "not found", ExplainNoResults(progress).Reason, NoResultsNotFound)
+	progress.Instances.recordResponse("https://logs.example.com", 0, "500", true)
+	assert(t, "not found and failed", ExplainNoResults(progress).Reason, NoResultsFetchFailed)
+}
@@ -0,0 +1,263 @@
+package justgrep
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PackedMagic starts every stream of packed messages, the last byte is the version of the format.
+const PackedMagic = "JGPK\x01"
+
+// A stream of packed messages is PackedMagic followed by records, each prefixed with its length as an uvarint. A
+// record has:
+//
+//   - a byte of flags, packedHasTimestamp and packedHasTags
+//   - the timestamp in nanoseconds since the Unix epoch as a varint, if it has one
+//   - Raw, as an uvarint length followed by the bytes
+//   - Prefix, User and Action as strings
+//   - the number of Args as an uvarint, followed by the arguments as strings
+//   - the number of Tags as an uvarint, followed by keys and values as strings, if it has tags
+//
+// Strings are an uvarint header followed by the bytes if the lowest bit of the header is 0, the rest of the header is
+// the length. If the lowest bit is 1 the string is part of Raw, which is the case for most of them, and its offset
+// follows as an uvarint. Decoded messages share memory with Raw, so reading them doesn't parse or copy anything.
+const (
+	packedHasTimestamp = 1 << iota
+	packedHasTags
+)
+
+// packedMaxRecord is the longest record read, longer ones come from corrupt streams. Lines are at most a megabyte.
+const packedMaxRecord = 4 * 1024 * 1024
+
+// PackedWriter writes messages in the packed format. Annotations, Source and Invalid aren't written.
+type PackedWriter struct {
+	writer  *bufio.Writer
+	started bool
+	record  []byte
+}
+
+func NewPackedWriter(writer io.Writer) *PackedWriter {
+	return &PackedWriter{writer: bufio.NewWriter(writer)}
+}
+
+func (w *PackedWriter) appendUvarint(value uint64) {
+	var buffer [binary.MaxVarintLen64]byte
+	w.record = append(w.record, buffer[:binary.PutUvarint(buffer[:], value)]...)
+}
+
+func (w *PackedWriter) appendString(raw string, value string) {
+	if value != "" {
+		// references can take a byte or two more than short strings, but they don't need to be copied when reading
+		if offset := strings.Index(raw, value); offset != -1 {
+			w.appendUvarint(uint64(len(value))<<1 | 1)
+			w.appendUvarint(uint64(offset))
+			return
+		}
+	}
+	w.appendUvarint(uint64(len(value)) << 1)
+	w.record = append(w.record, value...)
+}
+
+// Write writes msg to the stream. Tags are written in sorted order, so the output only depends on the messages.
+func (w *PackedWriter) Write(msg *Message) error {
+	if !w.started {
+		w.started = true
+		_, err := w.writer.WriteString(PackedMagic)
+		if err != nil {
+			return err
+		}
+	}
+	w.record = w.record[:0]
+	var flags byte
+	if !msg.Timestamp.IsZero() {
+		flags |= packedHasTimestamp
+	}
+	if msg.Tags != nil {
+		flags |= packedHasTags
+	}
+	w.record = append(w.record, flags)
+	if flags&packedHasTimestamp != 0 {
+		var buffer [binary.MaxVarintLen64]byte
+		w.record = append(w.record, buffer[:binary.PutVarint(buffer[:], msg.Timestamp.UnixNano())]...)
+	}
+	w.appendUvarint(uint64(len(msg.Raw)))
+	w.record = append(w.record, msg.Raw...)
+	w.appendString(msg.Raw, msg.Prefix)
+	w.appendString(msg.Raw, msg.User)
+	w.appendString(msg.Raw, msg.Action)
+	w.appendUvarint(uint64(len(msg.Args)))
+	for _, arg := range msg.Args {
+		w.appendString(msg.Raw, arg)
+	}
+	if flags&packedHasTags != 0 {
+		keys := make([]string, 0, len(msg.Tags))
+		for key := range msg.Tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		w.appendUvarint(uint64(len(keys)))
+		for _, key := range keys {
+			w.appendString(msg.Raw, key)
+			w.appendString(msg.Raw, msg.Tags[key])
+		}
+	}
+
+	var buffer [binary.MaxVarintLen64]byte
+	_, err := w.writer.Write(buffer[:binary.PutUvarint(buffer[:], uint64(len(w.record)))])
+	if err != nil {
+		return err
+	}
+	_, err = w.writer.Write(w.record)
+	return err
+}
+
+// Flush writes buffered messages. Streams without any messages get PackedMagic, so they can be read.
+func (w *PackedWriter) Flush() error {
+	if !w.started {
+		w.started = true
+		_, err := w.writer.WriteString(PackedMagic)
+		if err != nil {
+			return err
+		}
+	}
+	return w.writer.Flush()
+}
+
+// PackedReader reads messages written by PackedWriter.
+type PackedReader struct {
+	reader *bufio.Reader
+	count  int
+}
+
+// NewPackedReader checks that reader has packed messages in a supported version.
+func NewPackedReader(reader io.Reader) (*PackedReader, error) {
+	buffered := bufio.NewReader(reader)
+	magic := make([]byte, len(PackedMagic))
+	_, err := io.ReadFull(buffered, magic)
+	if err != nil || string(magic[:len(magic)-1]) != PackedMagic[:len(PackedMagic)-1] {
+		return nil, errors.New("packed: not a stream of packed messages")
+	}
+	if magic[len(magic)-1] != PackedMagic[len(PackedMagic)-1] {
+		return nil, errors.New(fmt.Sprintf("packed: unsupported version %d", magic[len(magic)-1]))
+	}
+	return &PackedReader{reader: buffered}, nil
+}
+
+// packedRecord decodes a single record.
+type packedRecord struct {
+	data []byte
+	raw  string
+	err  error
+}
+
+func (r *packedRecord) fail() {
+	if r.err == nil {
+		r.err = errors.New("packed: corrupt record")
+	}
+	r.data = nil
+}
+
+func (r *packedRecord) uvarint() uint64 {
+	value, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.data = r.data[n:]
+	return value
+}
+
+func (r *packedRecord) bytes(length uint64) []byte {
+	if length > uint64(len(r.data)) {
+		r.fail()
+		return nil
+	}
+	output := r.data[:length]
+	r.data = r.data[length:]
+	return output
+}
+
+func (r *packedRecord) string() string {
+	header := r.uvarint()
+	length := header >> 1
+	if header&1 == 0 {
+		return string(r.bytes(length))
+	}
+	offset := r.uvarint()
+	if offset > uint64(len(r.raw)) || length > uint64(len(r.raw))-offset {
+		r.fail()
+		return ""
+	}
+	return r.raw[offset : offset+length]
+}
+
+// Next returns the next message, io.EOF is returned after the last one.
+func (r *PackedReader) Next() (*Message, error) {
+	length, err := binary.ReadUvarint(r.reader)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("packed: message %d: %s", r.count+1, err))
+	}
+	r.count++
+	if length > packedMaxRecord {
+		return nil, errors.New(fmt.Sprintf("packed: message %d is too long, %d bytes", r.count, length))
+	}
+	data := make([]byte, length)
+	_, err = io.ReadFull(r.reader, data)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("packed: message %d is truncated", r.count))
+	}
+
+	record := packedRecord{data: data}
+	flags := record.bytes(1)
+	if record.err != nil {
+		return nil, errors.New(fmt.Sprintf("packed: message %d is empty", r.count))
+	}
+	msg := &Message{}
+	if flags[0]&packedHasTimestamp != 0 {
+		nanoseconds, n := binary.Varint(record.data)
+		if n <= 0 {
+			record.fail()
+		} else {
+			record.data = record.data[n:]
+			msg.Timestamp = time.Unix(0, nanoseconds)
+		}
+	}
+	record.raw = string(record.bytes(record.uvarint()))
+	msg.Raw = record.raw
+	msg.Prefix = record.string()
+	msg.User = record.string()
+	msg.Action = record.string()
+	if args := record.uvarint(); args != 0 && args <= uint64(len(record.data)) {
+		msg.Args = make([]string, 0, args)
+		for i := uint64(0); i < args; i++ {
+			msg.Args = append(msg.Args, record.string())
+		}
+	} else if args != 0 {
+		record.fail()
+	}
+	if flags[0]&packedHasTags != 0 {
+		tags := record.uvarint()
+		if tags > uint64(len(record.data)) {
+			record.fail()
+			tags = 0
+		}
+		msg.Tags = make(map[string]string, tags)
+		for i := uint64(0); i < tags; i++ {
+			key := record.string()
+			msg.Tags[key] = record.string()
+		}
+	}
+	if record.err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: message %d", record.err, r.count))
+	}
+	return msg, nil
+}
@@ -0,0 +1,127 @@
+package justgrep
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestPackedRoundTrip(t *testing.T) {
+	lines := []string{
+		"@badge-info=;badges=;color=#FF0000;display-name=Mm2PL;emotes=;id=1234;room-id=11148817;" +
+			"tmi-sent-ts=1620000000123;user-id=117691339 :mm2pl!mm2pl@mm2pl.tmi.twitch.tv PRIVMSG #pajlada :hello world",
+		"@ban-duration=600;room-id=11148817;target-user-id=1;tmi-sent-ts=1620000001000 :tmi.twitch.tv CLEARCHAT #pajlada :a",
+		// escaped tag values aren't part of the raw line
+		`@system-msg=a\sb\sc;time=2021-05-03T00:00:00Z :tmi.twitch.tv USERNOTICE #pajlada`,
+		"PING",
+	}
+	var buffer bytes.Buffer
+	writer := NewPackedWriter(&buffer)
+	var expected []*Message
+	for _, line := range lines {
+		msg, err := NewMessage(line)
+		assert(t, "error", err, nil)
+		expected = append(expected, msg)
+		assert(t, "write error", writer.Write(msg), nil)
+	}
+	assert(t, "flush error", writer.Flush(), nil)
+	if buffer.Len() >= len(lines[0])*2+len(lines[1])*2+len(lines[2])*2+len(lines[3])*2 {
+		t.Errorf("packed messages aren't compact: %d bytes", buffer.Len())
+	}
+
+	reader, err := NewPackedReader(&buffer)
+	assert(t, "error", err, nil)
+	for i, want := range expected {
+		have, err := reader.Next()
+		assert(t, "read error", err, nil)
+		if !have.Timestamp.Equal(want.Timestamp) {
+			t.Errorf("message %d: timestamp %s, expected %s", i, have.Timestamp, want.Timestamp)
+		}
+		have.Timestamp = want.Timestamp
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("message %d: have %#v, expected %#v", i, have, want)
+		}
+	}
+	_, err = reader.Next()
+	assert(t, "end", err, io.EOF)
+}
+
+func TestPackedEmpty(t *testing.T) {
+	var buffer bytes.Buffer
+	assert(t, "flush error", NewPackedWriter(&buffer).Flush(), nil)
+	reader, err := NewPackedReader(&buffer)
+	assert(t, "error", err, nil)
+	_, err = reader.Next()
+	assert(t, "end", err, io.EOF)
+}
+
+func TestPackedInvalid(t *testing.T) {
+	_, err := NewPackedReader(bytes.NewReader([]byte("@tmi-sent-ts=1 :a PRIVMSG #a :b\n")))
+	if err == nil {
+		t.Errorf("expected an error for raw IRC lines")
+	}
+	_, err = NewPackedReader(bytes.NewReader([]byte("JGPK\x09")))
+	if err == nil {
+		t.Errorf("expected an error for an unsupported version")
+	}
+
+	var buffer bytes.Buffer
+	writer := NewPackedWriter(&buffer)
+	msg, err := NewMessage("@tmi-sent-ts=1000 :user!user@user.tmi.twitch.tv PRIVMSG #channel :message text")
+	assert(t, "error", err, nil)
+	assert(t, "write error", writer.Write(msg), nil)
+	assert(t, "flush error", writer.Flush(), nil)
+	packed := buffer.Bytes()
+
+	// a reference pointing past the raw line
+	corrupt := append([]byte(nil), packed...)
+	corrupt[len(corrupt)-1] = 0x7f
+	reader, err := NewPackedReader(bytes.NewReader(corrupt))
+	assert(t, "error", err, nil)
+	_, err = reader.Next()
+	if err == nil {
+		t.Errorf("expected an error for a corrupt record")
+	}
+
+	reader, err = NewPackedReader(bytes.NewReader(packed[:len(packed)-3]))
+	assert(t, "error", err, nil)
+	_, err = reader.Next()
+	if err == nil {
+		t.Errorf("expected an error for a truncated record")
+	}
+}
+
+// TestPackedReaderInvariants reads streams which used to crash the reader, it must return errors instead.
+func TestPackedReaderInvariants(t *testing.T) {
+	var buffer bytes.Buffer
+	writer := NewPackedWriter(&buffer)
+	_ = writer.Write(getTestMessage())
+	_ = writer.Flush()
+	streams := [][]byte{
+		buffer.Bytes(),
+		[]byte(PackedMagic + "\x05\x03\x00\x00\x00\x00"),
+		// a record claiming to be far longer than the stream
+		[]byte(
+			"JGPK\x01\x96ࡦ-\xc2\x02@badge-info=subscriber/15;badges=subscriber/12,glhf-pledge/1;color=#DAA520" +
+				";display-name=Mm2PL;emotes=;flags=;id=1d7e0b34-fe74-4895-92ae-dd912046e637;mod=0;room-id=11148817;" +
+				"subscriber=1;tmi-sent-ts=1632058935165;turbo=0;user-id=117691339;user-type= :mm2pl!mm2pl@mm2pl.tmi" +
+				".twitch.tv PRIVMSG #pajlada :-tags many words asdasd?\xf9\x01\v\xf9\x01\x0f\x99\x02\x02\x11\xa1" +
+				"\x02/\xab\x01\xec\x15\x01\x1b\f\r\x1a7!\v=\x0fC\x19K\vX\r^\x00\vf\x00\x04idIp\x06mod\x020\x0f\x9b" +
+				"\x01\x11\xa3\x01\x15\f\x021\x17\xb9\x01\x1b\xc5\x01\v\xd3\x01\x020\x0f\xdb\x01\x13\xe3\x01\x13\xed" +
+				"\x01\xe3",
+		),
+	}
+	for _, data := range streams {
+		reader, err := NewPackedReader(bytes.NewReader(data))
+		if err != nil {
+			continue
+		}
+		// must not panic
+		for i := 0; i < 100; i++ {
+			if _, err := reader.Next(); err != nil {
+				break
+			}
+		}
+	}
+}
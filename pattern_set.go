@@ -0,0 +1,247 @@
+package justgrep
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// PatternSet matches text against many patterns at once, like grep -f. Patterns which are plain literals are found
+// with an Aho-Corasick automaton, the rest are combined into a single regex, so thousands of patterns cost about as
+// much as a few.
+type PatternSet struct {
+	patterns []string
+
+	literals *ahoCorasick
+
+	// regex is the alternation of the patterns which aren't literals, regexIndexes are the indexes of their patterns
+	regex        *regexp.Regexp
+	groups       *regexp.Regexp
+	regexIndexes []int
+}
+
+// ReadPatterns reads one pattern per line for NewPatternSet, empty lines are left out. Lines are numbered from 1,
+// lineNumbers has the line of every pattern.
+func ReadPatterns(reader io.Reader) (patterns []string, lineNumbers []int, err error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		patterns = append(patterns, line)
+		lineNumbers = append(lineNumbers, number)
+	}
+	return patterns, lineNumbers, scanner.Err()
+}
+
+func NewPatternSet(patterns []string) (*PatternSet, error) {
+	if len(patterns) == 0 {
+		return nil, errors.New("no patterns")
+	}
+	set := &PatternSet{patterns: patterns, literals: newAhoCorasick()}
+	var alternatives []string
+	hasLiterals := false
+	for i, pattern := range patterns {
+		re, err := syntax.Parse(pattern, syntax.Perl)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("pattern %d: %s", i+1, err))
+		}
+		if re.Op == syntax.OpLiteral && re.Flags&syntax.FoldCase == 0 {
+			set.literals.add(string(re.Rune), i)
+			hasLiterals = true
+			continue
+		}
+		// a group of its own, so flags like (?i) stay within the pattern
+		alternatives = append(alternatives, "(?:"+pattern+")")
+		set.regexIndexes = append(set.regexIndexes, i)
+	}
+	if hasLiterals {
+		set.literals.build()
+	} else {
+		set.literals = nil
+	}
+	if len(alternatives) != 0 {
+		var err error
+		set.regex, err = regexp.Compile(strings.Join(alternatives, "|"))
+		if err != nil {
+			return nil, err
+		}
+		// only used to tell which pattern matched, after regex found that one did
+		set.groups = regexp.MustCompile("(" + strings.Join(alternatives, ")|(") + ")")
+	}
+	return set, nil
+}
+
+// Len is the number of patterns.
+func (s *PatternSet) Len() int {
+	return len(s.patterns)
+}
+
+// Pattern returns the pattern with index i.
+func (s *PatternSet) Pattern(i int) string {
+	return s.patterns[i]
+}
+
+// MatchString checks if any of the patterns matches text.
+func (s *PatternSet) MatchString(text string) bool {
+	if s.literals != nil && s.literals.contains(text) {
+		return true
+	}
+	return s.regex != nil && s.regex.MatchString(text)
+}
+
+// Match returns the index of the pattern matching text first, the one whose match starts first and the one which
+// comes first among patterns matching at the same place. It's -1 if none match.
+func (s *PatternSet) Match(text string) int {
+	start, index := -1, -1
+	if s.literals != nil {
+		start, index = s.literals.find(text)
+	}
+	if s.regex == nil {
+		return index
+	}
+	groups := s.groups.FindStringSubmatchIndex(text)
+	if groups == nil {
+		return index
+	}
+	for group := 1; group*2 < len(groups); group++ {
+		if groups[group*2] == -1 {
+			continue
+		}
+		regexIndex := s.regexIndexes[group-1]
+		if index == -1 || groups[group*2] < start || (groups[group*2] == start && regexIndex < index) {
+			return regexIndex
+		}
+		break
+	}
+	return index
+}
+
+// ahoCorasick finds many literals in a single pass over the text.
+type ahoCorasick struct {
+	next []map[byte]int
+	fail []int
+	// output is the index of the pattern ending at a node, -1 if none does, with outputLength its length
+	output       []int
+	outputLength []int
+	// dictionary is the next node on the fail chain with an output, -1 if there is none
+	dictionary []int
+	longest    int
+}
+
+func newAhoCorasick() *ahoCorasick {
+	return &ahoCorasick{next: []map[byte]int{{}}, output: []int{-1}, outputLength: []int{0}}
+}
+
+// add adds a literal, an existing literal keeps its index.
+func (a *ahoCorasick) add(literal string, index int) {
+	node := 0
+	for i := 0; i < len(literal); i++ {
+		child, ok := a.next[node][literal[i]]
+		if !ok {
+			child = len(a.next)
+			a.next = append(a.next, map[byte]int{})
+			a.output = append(a.output, -1)
+			a.outputLength = append(a.outputLength, 0)
+			a.next[node][literal[i]] = child
+		}
+		node = child
+	}
+	if a.output[node] == -1 {
+		a.output[node] = index
+		a.outputLength[node] = len(literal)
+	}
+	if len(literal) > a.longest {
+		a.longest = len(literal)
+	}
+}
+
+// build sets the fail links once all literals are added.
+func (a *ahoCorasick) build() {
+	a.fail = make([]int, len(a.next))
+	a.dictionary = make([]int, len(a.next))
+	a.dictionary[0] = -1
+	queue := make([]int, 0, len(a.next))
+	for _, child := range a.next[0] {
+		a.dictionary[child] = -1
+		queue = append(queue, child)
+	}
+	for len(queue) != 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for c, child := range a.next[node] {
+			fail := a.fail[node]
+			for {
+				if target, ok := a.next[fail][c]; ok && target != child {
+					a.fail[child] = target
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = a.fail[fail]
+			}
+			if a.output[a.fail[child]] != -1 {
+				a.dictionary[child] = a.fail[child]
+			} else {
+				a.dictionary[child] = a.dictionary[a.fail[child]]
+			}
+			queue = append(queue, child)
+		}
+	}
+}
+
+// contains checks if text contains any of the literals, it stops at the first one found.
+func (a *ahoCorasick) contains(text string) bool {
+	node := 0
+	for i := 0; i < len(text); i++ {
+		node = a.step(node, text[i])
+		if a.output[node] != -1 || a.dictionary[node] != -1 {
+			return true
+		}
+	}
+	return false
+}
+
+// step follows the automaton from node with the byte c.
+func (a *ahoCorasick) step(node int, c byte) int {
+	for {
+		if child, ok := a.next[node][c]; ok {
+			return child
+		}
+		if node == 0 {
+			return 0
+		}
+		node = a.fail[node]
+	}
+}
+
+// find returns where the first literal in text starts and its index, -1 and -1 if there is none. Of literals starting
+// at the same place, the one added first wins.
+func (a *ahoCorasick) find(text string) (start int, index int) {
+	start, index = -1, -1
+	node := 0
+	for i := 0; i < len(text); i++ {
+		if start != -1 && i-start >= a.longest {
+			// nothing found later can start earlier
+			break
+		}
+		node = a.step(node, text[i])
+		for output := node; output > 0; output = a.dictionary[output] {
+			if a.output[output] == -1 {
+				continue
+			}
+			matchStart := i + 1 - a.outputLength[output]
+			if start == -1 || matchStart < start || (matchStart == start && a.output[output] < index) {
+				start, index = matchStart, a.output[output]
+			}
+		}
+	}
+	return start, index
+}
@@ -0,0 +1,66 @@
+package justgrep
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPatternSet(t *testing.T) {
+	patterns, lines, err := ReadPatterns(strings.NewReader("forsen\n\n(?i)xqc\nhe\nshe\nhers\n\\d+ viewers\n"))
+	assert(t, "error", err, nil)
+	assert(t, "patterns", len(patterns), 6)
+	assert(t, "line of the last pattern", lines[5], 7)
+	set, err := NewPatternSet(patterns)
+	assert(t, "error", err, nil)
+
+	assert(t, "no match", set.Match("nothing to see"), -1)
+	assert(t, "no match", set.MatchString("nothing to see"), false)
+	assert(t, "literal", set.Match("go forsen"), 0)
+	assert(t, "regex", set.Match("XQC raid"), 1)
+	assert(t, "overlapping literals", set.Match("ushers"), 3)
+	assert(t, "first match in the text", set.Match("100 viewers for forsen"), 5)
+	assert(t, "literal before regex", set.Match("forsen has 100 viewers"), 0)
+	assert(t, "match", set.MatchString("100 viewers"), true)
+
+	set, err = NewPatternSet([]string{"forsen", "xqc", "Pajas"})
+	assert(t, "error", err, nil)
+	assert(t, "only literals, no regex", set.regex == nil, true)
+	assert(t, "literal", set.Match("PAJAS Pajas"), 2)
+
+	_, err = NewPatternSet([]string{"ok", "("})
+	assert(t, "error for an invalid pattern", err != nil, true)
+}
+
+// TestPatternSetMatchesRegex compares the Aho-Corasick automaton with regexes for random literals.
+func TestPatternSetMatchesRegex(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	word := func(length int) string {
+		var builder strings.Builder
+		for i := 0; i < length; i++ {
+			builder.WriteByte("abc"[random.Intn(3)])
+		}
+		return builder.String()
+	}
+	for round := 0; round < 200; round++ {
+		patterns := make([]string, 1+random.Intn(8))
+		for i := range patterns {
+			patterns[i] = word(1 + random.Intn(4))
+		}
+		set, err := NewPatternSet(patterns)
+		assert(t, "error", err, nil)
+		text := word(random.Intn(12))
+		expected, expectedStart := -1, -1
+		for i, pattern := range patterns {
+			start := strings.Index(text, pattern)
+			if start != -1 && (expectedStart == -1 || start < expectedStart) {
+				expected, expectedStart = i, start
+			}
+		}
+		name := fmt.Sprintf("%q in %q", patterns, text)
+		assert(t, name, set.Match(text), expected)
+		assert(t, name, set.MatchString(text), regexp.MustCompile(strings.Join(patterns, "|")).MatchString(text))
+	}
+}
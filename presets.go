@@ -0,0 +1,158 @@
+package justgrep
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Preset is a named search pattern, so teams can share vetted patterns instead of writing them every time.
+type Preset struct {
+	Name        string
+	Description string
+	Regex       string
+	// WordList presets match the words of a list given as name@FILE, see WordListRegex. Regex is empty for them.
+	WordList bool
+	// Substitutions makes WordList presets also match words with look-alike characters and repeated letters.
+	Substitutions bool
+}
+
+// BuiltinPresets are the presets which come with justgrep.
+var BuiltinPresets = []Preset{
+	{
+		Name:        "links",
+		Description: "links with a scheme or with a well known top level domain",
+		Regex:       linkPresetRegex(),
+	},
+	{
+		Name:        "phone-numbers",
+		Description: "phone numbers with a country code (+44 20 7946 0958) or in the North American format",
+		Regex:       `\+\d{1,3}(?:[ .-]?\d{2,4}){3,5}\b|(?:\(\d{3}\) ?|\b\d{3}[ .-])\d{3}[ .-]\d{4}\b`,
+	},
+	{
+		Name:        "emails",
+		Description: "email addresses",
+		Regex:       `(?i)\b[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,24}\b`,
+	},
+	{
+		Name:        "ip-addresses",
+		Description: "IPv4 addresses",
+		Regex:       `\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`,
+	},
+	{
+		Name:        "discord-invites",
+		Description: "Discord invite links",
+		Regex:       `(?i)\b(?:discord(?:app)?\.com/invite|discord\.gg)/[a-z0-9-]+`,
+	},
+	{
+		Name:        "words",
+		Description: "any of the words in FILE, one per line, ignoring case",
+		WordList:    true,
+	},
+	{
+		Name: "slur-list",
+		Description: "any of the words in FILE, one per line, ignoring case, look-alike characters (3 for e, $ for " +
+			"s) and repeated letters",
+		WordList:      true,
+		Substitutions: true,
+	},
+}
+
+// linkPresetRegex matches what ExtractLinks finds, without the checks it does in code.
+func linkPresetRegex() string {
+	tlds := make([]string, 0, len(linkTLDs))
+	for tld := range linkTLDs {
+		tlds = append(tlds, tld)
+	}
+	sort.Strings(tlds)
+	return `(?i)\bhttps?://\S+|\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+(?:` + strings.Join(tlds, "|") +
+		`)\b(?:/\S*)?`
+}
+
+// ReadPresets reads a pattern file. Every line is the name of a preset, whitespace and its regex. Empty lines and
+// lines starting with # are left out, a comment right before a preset is its description.
+func ReadPresets(reader io.Reader) ([]Preset, error) {
+	var presets []Preset
+	description := ""
+	scanner := bufio.NewScanner(reader)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			description = ""
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			description = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+			continue
+		}
+		split := strings.IndexFunc(line, unicode.IsSpace)
+		if split == -1 {
+			return nil, errors.New(fmt.Sprintf("line %d: expected a name and a regex", number))
+		}
+		preset := Preset{
+			Name:        line[:split],
+			Description: description,
+			Regex:       strings.TrimSpace(line[split:]),
+		}
+		if _, err := regexp.Compile(preset.Regex); err != nil {
+			return nil, errors.New(fmt.Sprintf("line %d: %s", number, err))
+		}
+		presets = append(presets, preset)
+		description = ""
+	}
+	return presets, scanner.Err()
+}
+
+// lookAlikes are characters written instead of letters to get around word filters.
+var lookAlikes = map[rune]string{
+	'a': "a4@",
+	'b': "b8",
+	'e': "e3",
+	'g': "g9",
+	'i': "i1!|l",
+	'l': "l1|i",
+	'o': "o0",
+	's': "s5$",
+	't': "t7+",
+	'z': "z2",
+}
+
+// WordListRegex returns a regex matching any of words as whole words, ignoring case. With substitutions letters can
+// also be written as look-alike characters and repeated, so "n00bbb" matches "noob".
+func WordListRegex(words []string, substitutions bool) (string, error) {
+	var alternatives []string
+	for _, word := range words {
+		word = strings.ToLower(word)
+		if !substitutions {
+			alternatives = append(alternatives, regexp.QuoteMeta(word))
+			continue
+		}
+		var pattern strings.Builder
+		for _, r := range word {
+			characters, ok := lookAlikes[r]
+			if !ok {
+				pattern.WriteString(regexp.QuoteMeta(string(r)) + "+")
+				continue
+			}
+			pattern.WriteString("[")
+			for _, c := range characters {
+				if strings.ContainsRune(`\]^-`, c) {
+					pattern.WriteRune('\\')
+				}
+				pattern.WriteRune(c)
+			}
+			pattern.WriteString("]+")
+		}
+		alternatives = append(alternatives, pattern.String())
+	}
+	if len(alternatives) == 0 {
+		return "", errors.New("the word list is empty")
+	}
+	// look-alikes aren't word characters, so \b doesn't work around them
+	return `(?i)(?:^|[^\pL\pN_])(?:` + strings.Join(alternatives, "|") + `)(?:$|[^\pL\pN_])`, nil
+}
@@ -0,0 +1,72 @@
+package justgrep
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinPresets(t *testing.T) {
+	examples := map[string][]string{
+		"links":           {"check out https://example.com/x", "go to forsen.tv now"},
+		"phone-numbers":   {"call +44 20 7946 0958", "it's (555) 123-4567", "555-123-4567"},
+		"emails":          {"mail me at someone@example.com"},
+		"ip-addresses":    {"he's at 192.168.1.20"},
+		"discord-invites": {"join discord.gg/abc123"},
+	}
+	negatives := map[string][]string{
+		"links":         {"i.e. no", "ok.then"},
+		"phone-numbers": {"2021 01 05", "1234567"},
+		"ip-addresses":  {"999.1.1.1"},
+	}
+	for _, preset := range BuiltinPresets {
+		if preset.WordList {
+			continue
+		}
+		regex := regexp.MustCompile(preset.Regex)
+		warnings, _ := LintRegex(preset.Regex)
+		assert(t, preset.Name+" warnings", len(warnings), 0)
+		for _, example := range examples[preset.Name] {
+			assert(t, preset.Name+" matches "+example, regex.MatchString(example), true)
+		}
+		for _, example := range negatives[preset.Name] {
+			assert(t, preset.Name+" doesn't match "+example, regex.MatchString(example), false)
+		}
+	}
+}
+
+func TestReadPresets(t *testing.T) {
+	presets, err := ReadPresets(
+		strings.NewReader("# scam links\nscams   (?i)free\\s+nitro\n\n# ignored\n\nsells (?i)\\bsell(ing)?\\b\n"),
+	)
+	assert(t, "error", err, nil)
+	assert(t, "presets", len(presets), 2)
+	assert(t, "name", presets[0].Name, "scams")
+	assert(t, "description", presets[0].Description, "scam links")
+	assert(t, "regex", presets[0].Regex, `(?i)free\s+nitro`)
+	assert(t, "no description", presets[1].Description, "")
+
+	_, err = ReadPresets(strings.NewReader("broken (\n"))
+	assert(t, "error for an invalid regex", err != nil, true)
+	_, err = ReadPresets(strings.NewReader("nameonly\n"))
+	assert(t, "error without a regex", err != nil, true)
+}
+
+func TestWordListRegex(t *testing.T) {
+	plain, err := WordListRegex([]string{"Noob", "c++"}, false)
+	assert(t, "error", err, nil)
+	regex := regexp.MustCompile(plain)
+	assert(t, "word", regex.MatchString("what a NOOB"), true)
+	assert(t, "part of a word", regex.MatchString("noobs"), false)
+	assert(t, "special characters", regex.MatchString("i like c++ a lot"), true)
+	assert(t, "look-alikes without substitutions", regex.MatchString("n00b"), false)
+
+	substituted, err := WordListRegex([]string{"noob"}, true)
+	assert(t, "error", err, nil)
+	regex = regexp.MustCompile(substituted)
+	assert(t, "look-alikes", regex.MatchString("ok n00bbb"), true)
+	assert(t, "missing letter", regex.MatchString("nob"), false)
+
+	_, err = WordListRegex(nil, false)
+	assert(t, "error for an empty list", err != nil, true)
+}
@@ -0,0 +1,128 @@
+package justgrep
+
+import (
+	"container/heap"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Ranker scores messages by how relevant they probably are: every match of Regex and Literal in the text counts 1,
+// a message sent at FocusTime gets 2 more, falling off with the distance to it, and the badges of the sender add a
+// bit of reputation.
+type Ranker struct {
+	// Regex is nil if matches of a regex aren't counted
+	Regex   *regexp.Regexp
+	Literal string
+	// FocusTime is zero if the time of messages doesn't matter
+	FocusTime time.Time
+}
+
+// focusScale is how far from the focus time a message gets half of the proximity score.
+const focusScale = time.Hour
+
+func (r *Ranker) Score(msg *Message) float64 {
+	text := msg.Text()
+	score := 0.0
+	if r.Regex != nil && r.Regex.String() != "" {
+		score += float64(len(r.Regex.FindAllStringIndex(text, -1)))
+	}
+	if r.Literal != "" {
+		score += float64(strings.Count(text, r.Literal))
+	}
+	if !r.FocusTime.IsZero() {
+		distance := msg.Timestamp.Sub(r.FocusTime)
+		if distance < 0 {
+			distance = -distance
+		}
+		score += 2 / (1 + float64(distance)/float64(focusScale))
+	}
+	return score + reputation(msg)
+}
+
+// reputation guesses how trustworthy the sender of msg is from its badges. First messages in a channel count less.
+func reputation(msg *Message) float64 {
+	score := 0.0
+	for _, badge := range strings.Split(msg.Tags["badges"], ",") {
+		switch strings.SplitN(badge, "/", 2)[0] {
+		case "broadcaster", "moderator", "staff":
+			score += 1
+		case "vip":
+			score += 0.5
+		case "subscriber", "founder":
+			score += 0.25
+		}
+	}
+	if msg.Tags["first-msg"] == "1" {
+		score -= 0.5
+	}
+	return score
+}
+
+// RankedMessage is a message with its score.
+type RankedMessage struct {
+	Message *Message
+	Score   float64
+	// order is when the message was added, older messages win ties
+	order int
+}
+
+// TopRanked keeps the K messages with the highest scores, without holding any others.
+type TopRanked struct {
+	k     int
+	added int
+	// heap has the lowest score first, so it's the one to go
+	heap rankedHeap
+}
+
+func NewTopRanked(k int) *TopRanked {
+	return &TopRanked{k: k}
+}
+
+func (t *TopRanked) Add(msg *Message, score float64) {
+	ranked := RankedMessage{Message: msg, Score: score, order: t.added}
+	t.added++
+	if len(t.heap) < t.k {
+		heap.Push(&t.heap, ranked)
+		return
+	}
+	if t.k == 0 || !t.heap.better(ranked, t.heap[0]) {
+		return
+	}
+	t.heap[0] = ranked
+	heap.Fix(&t.heap, 0)
+}
+
+// Sorted returns the kept messages, highest score first.
+func (t *TopRanked) Sorted() []RankedMessage {
+	output := make([]RankedMessage, len(t.heap))
+	copy(output, t.heap)
+	sort.Slice(
+		output, func(i, j int) bool {
+			return t.heap.better(output[i], output[j])
+		},
+	)
+	return output
+}
+
+type rankedHeap []RankedMessage
+
+// better returns true if a ranks above b.
+func (h rankedHeap) better(a RankedMessage, b RankedMessage) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.order < b.order
+}
+
+func (h rankedHeap) Len() int            { return len(h) }
+func (h rankedHeap) Less(i, j int) bool  { return h.better(h[j], h[i]) }
+func (h rankedHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *rankedHeap) Push(x interface{}) { *h = append(*h, x.(RankedMessage)) }
+func (h *rankedHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,57 @@
+package justgrep
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestRankerScore(t *testing.T) {
+	focus := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	ranker := &Ranker{Regex: regexp.MustCompile("pog"), Literal: "!", FocusTime: focus}
+	message := func(tags map[string]string, text string, at time.Time) *Message {
+		return &Message{Action: "PRIVMSG", Args: []string{"#pajlada", text}, Tags: tags, Timestamp: at}
+	}
+	tests := []struct {
+		name  string
+		msg   *Message
+		score float64
+	}{
+		{"matches at the focus time", message(nil, "pog pog!", focus), 2 + 1 + 2},
+		{"an hour later", message(nil, "pog", focus.Add(time.Hour)), 1 + 1},
+		{"an hour earlier", message(nil, "pog", focus.Add(-time.Hour)), 1 + 1},
+		{"moderator", message(map[string]string{"badges": "moderator/1,subscriber/12"}, "pog", focus), 1 + 2 + 1.25},
+		{"first message", message(map[string]string{"first-msg": "1"}, "pog", focus), 1 + 2 - 0.5},
+	}
+	for _, test := range tests {
+		if score := ranker.Score(test.msg); score != test.score {
+			t.Errorf("%s: score is %f, expected %f", test.name, score, test.score)
+		}
+	}
+
+	// an empty regex matches everything, it doesn't make messages more relevant
+	if score := (&Ranker{Regex: regexp.MustCompile("")}).Score(message(nil, "pog", focus)); score != 0 {
+		t.Errorf("an empty regex scored %f, expected 0", score)
+	}
+}
+
+func TestTopRanked(t *testing.T) {
+	top := NewTopRanked(3)
+	scores := []float64{1, 5, 3, 5, 0, 4}
+	messages := make([]*Message, len(scores))
+	for i, score := range scores {
+		messages[i] = &Message{Raw: string(rune('a' + i))}
+		top.Add(messages[i], score)
+	}
+	sorted := top.Sorted()
+	// the older of the two messages scoring 5 goes first
+	expected := []*Message{messages[1], messages[3], messages[5]}
+	if len(sorted) != len(expected) {
+		t.Fatalf("kept %d messages, expected %d", len(sorted), len(expected))
+	}
+	for i, ranked := range sorted {
+		if ranked.Message != expected[i] {
+			t.Errorf("message %d is %s with score %f, expected %s", i, ranked.Message.Raw, ranked.Score, expected[i].Raw)
+		}
+	}
+}
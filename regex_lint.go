@@ -0,0 +1,178 @@
+package justgrep
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// LintRegex looks for common mistakes in a message regex and returns a warning with a suggestion for each of them.
+// None of them make the regex invalid, that's reported as an error.
+func LintRegex(expr string) ([]string, error) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	var warnings []string
+	warnings = lintDotStar(re, warnings)
+	if re.Op == syntax.OpLiteral && re.Flags&syntax.FoldCase == 0 && looksLikeName(re.Rune, 4) {
+		warnings = append(
+			warnings,
+			fmt.Sprintf(
+				"%q only matches this exact case. If it's a user name, which chat writes in any case, start the "+
+					"pattern with (?i). Emotes are case-sensitive, leave them as they are.",
+				string(re.Rune),
+			),
+		)
+	}
+	seen := make(map[string]bool)
+	walkRegex(
+		re, func(re *syntax.Regexp) {
+			var warning string
+			switch {
+			case re.Op == syntax.OpLiteral && re.Flags&syntax.FoldCase == 0:
+				mention := caseSensitiveMention(re.Rune)
+				if mention != "" {
+					warning = fmt.Sprintf(
+						"%q only matches this exact case, mentions are typed in any case. Use (?i)%s instead.",
+						mention,
+						strings.ToLower(mention),
+					)
+				}
+			case isUnbounded(re) && nestsRepetition(re.Sub[0]):
+				warning = fmt.Sprintf(
+					"%s repeats something that's repeated already. It can't make the search hang, the regex engine "+
+						"always takes linear time, but it does hang backtracking engines (PCRE, JavaScript) and the "+
+						"outer repetition adds nothing. Simplify it.",
+					re,
+				)
+			}
+			if warning != "" && !seen[warning] {
+				seen[warning] = true
+				warnings = append(warnings, warning)
+			}
+		},
+	)
+	return warnings, nil
+}
+
+func walkRegex(re *syntax.Regexp, visit func(re *syntax.Regexp)) {
+	visit(re)
+	for _, sub := range re.Sub {
+		walkRegex(sub, visit)
+	}
+}
+
+func isDotStar(re *syntax.Regexp) bool {
+	return re.Op == syntax.OpStar && (re.Sub[0].Op == syntax.OpAnyCharNotNL || re.Sub[0].Op == syntax.OpAnyChar)
+}
+
+// lintDotStar warns about .* at the start or end of a regex, where it doesn't change which messages match.
+func lintDotStar(re *syntax.Regexp, warnings []string) []string {
+	if isDotStar(re) {
+		return append(warnings, "The pattern is only .* and matches every message, leave -regex out instead.")
+	}
+	if re.Op != syntax.OpConcat {
+		return warnings
+	}
+	first, last := 0, len(re.Sub)-1
+	for first < last && (re.Sub[first].Op == syntax.OpBeginText || re.Sub[first].Op == syntax.OpBeginLine) {
+		first++
+	}
+	for last > first && (re.Sub[last].Op == syntax.OpEndText || re.Sub[last].Op == syntax.OpEndLine) {
+		last--
+	}
+	if first == last && isDotStar(re.Sub[first]) {
+		return append(warnings, "The pattern is only .* and matches every message, leave -regex out instead.")
+	}
+	if isDotStar(re.Sub[first]) {
+		remove := ".*"
+		if first != 0 {
+			remove = "^.*"
+		}
+		warnings = append(
+			warnings,
+			fmt.Sprintf(
+				"%s at the start of the pattern doesn't change which messages match, patterns match anywhere in a "+
+					"message. Remove it.",
+				remove,
+			),
+		)
+	}
+	if isDotStar(re.Sub[last]) {
+		remove := ".*"
+		if last != len(re.Sub)-1 {
+			remove = ".*$"
+		}
+		warnings = append(
+			warnings,
+			fmt.Sprintf(
+				"%s at the end of the pattern doesn't change which messages match, patterns match anywhere in a "+
+					"message. Remove it.",
+				remove,
+			),
+		)
+	}
+	return warnings
+}
+
+func isUnbounded(re *syntax.Regexp) bool {
+	return re.Op == syntax.OpStar || re.Op == syntax.OpPlus || (re.Op == syntax.OpRepeat && re.Max == -1)
+}
+
+// nestsRepetition checks if the body of a repetition is a repetition itself, or an alternation with a branch that is
+// one or that matches nothing, like (a+)+ or (a|b*)*.
+func nestsRepetition(body *syntax.Regexp) bool {
+	for body.Op == syntax.OpCapture {
+		body = body.Sub[0]
+	}
+	if isUnbounded(body) {
+		return true
+	}
+	if body.Op != syntax.OpAlternate {
+		return false
+	}
+	for _, branch := range body.Sub {
+		for branch.Op == syntax.OpCapture {
+			branch = branch.Sub[0]
+		}
+		if isUnbounded(branch) || branch.Op == syntax.OpEmptyMatch || branch.Op == syntax.OpQuest {
+			return true
+		}
+	}
+	return false
+}
+
+// looksLikeName checks if text could be a Twitch login written with capitals.
+func looksLikeName(text []rune, minLength int) bool {
+	if len(text) < minLength || len(text) > 25 {
+		return false
+	}
+	upper := false
+	for _, r := range text {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') {
+			return false
+		}
+		upper = upper || unicode.IsUpper(r)
+	}
+	return upper
+}
+
+// caseSensitiveMention returns the first @mention in text which has capitals, if there's one.
+func caseSensitiveMention(text []rune) string {
+	for i, r := range text {
+		if r != '@' {
+			continue
+		}
+		end := i + 1
+		for end < len(text) && end-i <= 25 && text[end] <= unicode.MaxASCII &&
+			(unicode.IsLetter(text[end]) || unicode.IsDigit(text[end]) || text[end] == '_') {
+			end++
+		}
+		if looksLikeName(text[i+1:end], 3) {
+			return string(text[i:end])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,33 @@
+package justgrep
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintRegex(t *testing.T) {
+	lint := func(expr string) string {
+		warnings, err := LintRegex(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(warnings, "\n")
+	}
+	assert(t, "clean", lint(`(?i)forsen|\bxqc\b`), "")
+	assert(t, "anchored", lint(`^forsen$`), "")
+	assert(t, "anchored .*", strings.Contains(lint(`^.*$`), "every message"), true)
+	assert(t, "only .*", strings.Contains(lint(`.*`), "every message"), true)
+	assert(t, "leading .*", strings.Contains(lint(`.*forsen`), ".* at the start"), true)
+	assert(t, "trailing .*", strings.Contains(lint(`^forsen.*`), ".* at the end"), true)
+	assert(t, "anchored leading .*", strings.Contains(lint(`^.*forsen`), "^.* at the start"), true)
+	assert(t, "name", strings.Contains(lint(`Forsen`), "(?i)"), true)
+	assert(t, "lowercase name", lint(`forsen`), "")
+	assert(t, "mention", strings.Contains(lint(`hi @Forsen!`), "(?i)@forsen"), true)
+	assert(t, "case-insensitive mention", lint(`(?i)hi @Forsen`), "")
+	assert(t, "nested repetition", strings.Contains(lint(`(a+)+b`), "(a+)+"), true)
+	assert(t, "alternation with an empty branch", strings.Contains(lint(`(a|b?)*c`), "repeats"), true)
+	assert(t, "repetition with a separator", lint(`(\w+\s)*x`), "")
+
+	_, err := LintRegex(`(`)
+	assert(t, "invalid", err != nil, true)
+}
@@ -0,0 +1,111 @@
+package justgrep
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Versions of the JSON representation of messages. Once released, a schema version never changes: fields are only
+// added or renamed in new versions, so consumers can keep asking for the version they were written against.
+const (
+	// MessageSchemaV1 has the same fields as a JSON encoded Message.
+	MessageSchemaV1 = "justgrep.message/v1"
+	// MessageSchemaV2 adds channel, display_name, id and text, which otherwise need to be dug out of args and tags.
+	MessageSchemaV2 = "justgrep.message/v2"
+	// MessageSchemaV3 adds annotations.
+	MessageSchemaV3 = "justgrep.message/v3"
+	// MessageSchemaV4 adds matched_by.
+	MessageSchemaV4 = "justgrep.message/v4"
+
+	LatestMessageSchema = MessageSchemaV4
+)
+
+// MessageSchemas lists every supported schema version, oldest first.
+var MessageSchemas = []string{MessageSchemaV1, MessageSchemaV2, MessageSchemaV3, MessageSchemaV4}
+
+// ParseMessageSchema accepts either a full schema name or just its version ("v1") and returns the full name.
+func ParseMessageSchema(name string) (string, error) {
+	if name == "" || name == "latest" {
+		return LatestMessageSchema, nil
+	}
+	for _, schema := range MessageSchemas {
+		if name == schema || "justgrep.message/"+name == schema {
+			return schema, nil
+		}
+	}
+	return "", errors.New(
+		fmt.Sprintf("unknown message schema %q, supported: %s", name, strings.Join(MessageSchemas, ", ")),
+	)
+}
+
+type messageV1 struct {
+	Schema string `json:"schema"`
+	*Message
+}
+
+type messageV2 struct {
+	Schema string `json:"schema"`
+	*Message
+	Channel     string `json:"channel,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	ID          string `json:"id,omitempty"`
+	Text        string `json:"text,omitempty"`
+}
+
+type messageV3 struct {
+	messageV2
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type messageV4 struct {
+	messageV3
+	MatchedBy *MatchedBy `json:"matched_by,omitempty"`
+}
+
+// Channel returns the channel a message was sent to without the leading #, or an empty string if the message has no
+// channel argument.
+func (m *Message) Channel() string {
+	if len(m.Args) == 0 || !strings.HasPrefix(m.Args[0], "#") {
+		return ""
+	}
+	return m.Args[0][1:]
+}
+
+// Text returns the last argument of a message, which is the chat message for PRIVMSGs.
+func (m *Message) Text() string {
+	if len(m.Args) < 2 {
+		return ""
+	}
+	return m.Args[len(m.Args)-1]
+}
+
+func newMessageV2(msg *Message, schema string) messageV2 {
+	return messageV2{
+		Schema:      schema,
+		Message:     msg,
+		Channel:     msg.Channel(),
+		DisplayName: msg.Tags["display-name"],
+		ID:          msg.Tags["id"],
+		Text:        msg.Text(),
+	}
+}
+
+// WithSchema wraps msg in a value which encodes to JSON following the given schema version.
+func WithSchema(msg *Message, schema string) (interface{}, error) {
+	switch schema {
+	case MessageSchemaV1:
+		return messageV1{Schema: schema, Message: msg}, nil
+	case MessageSchemaV2:
+		return newMessageV2(msg, schema), nil
+	case MessageSchemaV3:
+		return messageV3{messageV2: newMessageV2(msg, schema), Annotations: msg.Annotations}, nil
+	case MessageSchemaV4:
+		return messageV4{
+			messageV3: messageV3{messageV2: newMessageV2(msg, schema), Annotations: msg.Annotations},
+			MatchedBy: msg.MatchedBy,
+		}, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown message schema %q", schema))
+	}
+}
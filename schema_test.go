@@ -0,0 +1,67 @@
+package justgrep
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMessageSchema(t *testing.T) {
+	for input, expect := range map[string]string{
+		"":                    LatestMessageSchema,
+		"latest":              LatestMessageSchema,
+		"v1":                  MessageSchemaV1,
+		"justgrep.message/v2": MessageSchemaV2,
+	} {
+		have, err := ParseMessageSchema(input)
+		assert(t, "error for "+input, err, nil)
+		assert(t, "schema for "+input, have, expect)
+	}
+	_, err := ParseMessageSchema("v0")
+	if err == nil {
+		t.Errorf("expected ParseMessageSchema(\"v0\") to fail")
+	}
+}
+
+func TestWithSchema(t *testing.T) {
+	for _, schema := range MessageSchemas {
+		msg := getTestMessage()
+		msg.Annotate("vod", "https://www.twitch.tv/videos/1234?t=0h0m1s")
+		pattern := 2
+		msg.MatchedBy = &MatchedBy{Pattern: &pattern, PatternName: "emails"}
+		value, err := WithSchema(msg, schema)
+		assert(t, "error", err, nil)
+		encoded, err := json.Marshal(value)
+		assert(t, "error", err, nil)
+
+		decoded := map[string]interface{}{}
+		err = json.Unmarshal(encoded, &decoded)
+		assert(t, "error", err, nil)
+		assert(t, schema+" schema", decoded["schema"], schema)
+		assert(t, schema+" raw", decoded["raw"], getTestMessage().Raw)
+		if schema == MessageSchemaV1 {
+			_, hasChannel := decoded["channel"]
+			assert(t, "v1 has channel", hasChannel, false)
+		} else {
+			assert(t, schema+" channel", decoded["channel"], "pajlada")
+			assert(t, schema+" display_name", decoded["display_name"], "Mm2PL")
+			assert(t, schema+" text", decoded["text"], "-tags many words asdasd")
+		}
+		_, hasAnnotations := decoded["annotations"]
+		assert(t, schema+" has annotations", hasAnnotations, schema == MessageSchemaV3 || schema == MessageSchemaV4)
+		_, hasMatchedBy := decoded["matched_by"]
+		assert(t, schema+" has matched_by", hasMatchedBy, schema == MessageSchemaV4)
+	}
+	msg := getTestMessage()
+	pattern := 0
+	msg.MatchedBy = &MatchedBy{Pattern: &pattern, User: "pajlada"}
+	value, err := WithSchema(msg, MessageSchemaV4)
+	assert(t, "error", err, nil)
+	encoded, err := json.Marshal(value)
+	assert(t, "error", err, nil)
+	decoded := struct {
+		MatchedBy map[string]interface{} `json:"matched_by"`
+	}{}
+	assert(t, "error", json.Unmarshal(encoded, &decoded), nil)
+	assert(t, "first pattern", decoded.MatchedBy["pattern"], 0.0)
+	assert(t, "user rule", decoded.MatchedBy["user"], "pajlada")
+}
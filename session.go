@@ -0,0 +1,149 @@
+package justgrep
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SessionJar is an http.CookieJar which can be saved and loaded again, so instances behind Cloudflare, Cloudflare
+// Access and similar don't have to be passed again every run. Matching cookies to requests is left to
+// net/http/cookiejar, SessionJar only remembers the cookies it was given. It's safe for concurrent use.
+type SessionJar struct {
+	jar *cookiejar.Jar
+
+	lock    sync.Mutex
+	cookies map[sessionKey]SessionCookie
+}
+
+type sessionKey struct {
+	host, name, domain, path string
+}
+
+// SessionCookie is a cookie in a saved SessionJar. URL is where it came from, it's needed to add it to a jar again.
+// Cookies without Expires are kept like the rest, they're usually what keeps a session alive.
+type SessionCookie struct {
+	URL      string    `json:"url"`
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Expires  time.Time `json:"expires"`
+	Secure   bool      `json:"secure,omitempty"`
+	HTTPOnly bool      `json:"http_only,omitempty"`
+}
+
+// savedSession is the file format of a SessionJar.
+type savedSession struct {
+	Cookies []SessionCookie `json:"cookies"`
+}
+
+func NewSessionJar() *SessionJar {
+	// cookiejar.New only fails with invalid options
+	jar, _ := cookiejar.New(nil)
+	return &SessionJar{jar: jar, cookies: make(map[sessionKey]SessionCookie)}
+}
+
+// LoadSessionJar reads a jar written by SessionJar.Save. Expired cookies are left out.
+func LoadSessionJar(reader io.Reader) (*SessionJar, error) {
+	var saved savedSession
+	err := json.NewDecoder(reader).Decode(&saved)
+	if err != nil {
+		return nil, err
+	}
+	jar := NewSessionJar()
+	now := time.Now()
+	for _, cookie := range saved.Cookies {
+		if !cookie.Expires.IsZero() && !cookie.Expires.After(now) {
+			continue
+		}
+		u, err := url.Parse(cookie.URL)
+		if err != nil {
+			return nil, err
+		}
+		jar.SetCookies(
+			u,
+			[]*http.Cookie{
+				{
+					Name:     cookie.Name,
+					Value:    cookie.Value,
+					Domain:   cookie.Domain,
+					Path:     cookie.Path,
+					Expires:  cookie.Expires,
+					Secure:   cookie.Secure,
+					HttpOnly: cookie.HTTPOnly,
+				},
+			},
+		)
+	}
+	return jar, nil
+}
+
+func (j *SessionJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	now := time.Now()
+	for _, cookie := range cookies {
+		key := sessionKey{host: u.Host, name: cookie.Name, domain: cookie.Domain, path: cookie.Path}
+		expires := cookie.Expires
+		if cookie.MaxAge > 0 {
+			expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		}
+		if cookie.MaxAge < 0 || (!expires.IsZero() && !expires.After(now)) {
+			delete(j.cookies, key)
+			continue
+		}
+		j.cookies[key] = SessionCookie{
+			URL:      (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String(),
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Expires:  expires,
+			Secure:   cookie.Secure,
+			HTTPOnly: cookie.HttpOnly,
+		}
+	}
+}
+
+func (j *SessionJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// Len is the number of cookies in the jar, including expired ones which weren't replaced yet.
+func (j *SessionJar) Len() int {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return len(j.cookies)
+}
+
+// Save writes the cookies of the jar which didn't expire into writer.
+func (j *SessionJar) Save(writer io.Writer) error {
+	j.lock.Lock()
+	saved := savedSession{Cookies: []SessionCookie{}}
+	now := time.Now()
+	for _, cookie := range j.cookies {
+		if cookie.Expires.IsZero() || cookie.Expires.After(now) {
+			saved.Cookies = append(saved.Cookies, cookie)
+		}
+	}
+	j.lock.Unlock()
+	sort.Slice(
+		saved.Cookies, func(i, k int) bool {
+			a, b := saved.Cookies[i], saved.Cookies[k]
+			if a.URL != b.URL {
+				return a.URL < b.URL
+			}
+			return a.Name < b.Name
+		},
+	)
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(saved)
+}
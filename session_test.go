@@ -0,0 +1,50 @@
+package justgrep
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSessionJar(t *testing.T) {
+	var sent []string
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if cookie, err := r.Cookie("clearance"); err == nil {
+					sent = append(sent, cookie.Value)
+				}
+				if r.URL.Path == "/challenge" {
+					http.SetCookie(w, &http.Cookie{Name: "clearance", Value: "passed", MaxAge: 3600})
+					http.SetCookie(w, &http.Cookie{Name: "tracking", Value: "1", MaxAge: -1})
+				}
+			},
+		),
+	)
+	defer server.Close()
+
+	jar := NewSessionJar()
+	client := &http.Client{Jar: jar}
+	get := func(path string) {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+	}
+	get("/challenge")
+	get("/logs")
+	assert(t, "sent cookies", len(sent), 1)
+	assert(t, "cookies in the jar", jar.Len(), 1)
+
+	var saved bytes.Buffer
+	err := jar.Save(&saved)
+	assert(t, "error", err, nil)
+	loaded, err := LoadSessionJar(&saved)
+	assert(t, "error", err, nil)
+	client.Jar = loaded
+	get("/logs")
+	assert(t, "sent cookies after loading", len(sent), 2)
+	assert(t, "cookie", sent[1], "passed")
+}
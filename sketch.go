@@ -0,0 +1,172 @@
+package justgrep
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// hash64 hashes value with FNV-1a followed by a finalizer mixing all bits, FNV alone has weak low bits.
+func hash64(value string, seed uint64) uint64 {
+	hasher := fnv.New64a()
+	_, _ = hasher.Write([]byte(value))
+	hash := hasher.Sum64() ^ seed
+	hash ^= hash >> 33
+	hash *= 0xff51afd7ed558ccd
+	hash ^= hash >> 33
+	hash *= 0xc4ceb9fe1a85ec53
+	hash ^= hash >> 33
+	return hash
+}
+
+// HyperLogLog estimates the number of distinct values in constant memory. With precision 14 it takes 16KiB and the
+// error is around 1%.
+type HyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+func NewHyperLogLog(precision uint8) *HyperLogLog {
+	if precision < 4 {
+		precision = 4
+	} else if precision > 18 {
+		precision = 18
+	}
+	return &HyperLogLog{precision: precision, registers: make([]uint8, 1<<precision)}
+}
+
+func (h *HyperLogLog) Add(value string) {
+	hash := hash64(value, 0)
+	index := hash >> (64 - h.precision)
+	rank := uint8(bits.LeadingZeros64(hash<<h.precision|1<<(h.precision-1))) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// Count returns the estimated number of distinct values added.
+func (h *HyperLogLog) Count() uint64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, register := range h.registers {
+		sum += 1 / float64(uint64(1)<<register)
+		if register == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros != 0 {
+		// linear counting is more accurate for small cardinalities
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// CountMinSketch estimates how often values were seen in constant memory. Estimates are never too low, with
+// probability 1-delta they're too high by at most epsilon times the total count.
+type CountMinSketch struct {
+	width  uint64
+	counts [][]uint64
+}
+
+func NewCountMinSketch(epsilon float64, delta float64) *CountMinSketch {
+	width := uint64(math.Ceil(math.E / epsilon))
+	depth := int(math.Ceil(math.Log(1 / delta)))
+	counts := make([][]uint64, depth)
+	for i := range counts {
+		counts[i] = make([]uint64, width)
+	}
+	return &CountMinSketch{width: width, counts: counts}
+}
+
+// Add counts value n times and returns its new estimate.
+func (s *CountMinSketch) Add(value string, n uint64) uint64 {
+	estimate := uint64(math.MaxUint64)
+	for i, row := range s.counts {
+		cell := hash64(value, uint64(i+1)) % s.width
+		row[cell] += n
+		if row[cell] < estimate {
+			estimate = row[cell]
+		}
+	}
+	return estimate
+}
+
+func (s *CountMinSketch) Estimate(value string) uint64 {
+	estimate := uint64(math.MaxUint64)
+	for i, row := range s.counts {
+		cell := hash64(value, uint64(i+1)) % s.width
+		if row[cell] < estimate {
+			estimate = row[cell]
+		}
+	}
+	return estimate
+}
+
+// Count is a value with how often it was seen.
+type Count struct {
+	Value string `json:"value"`
+	Count uint64 `json:"count"`
+}
+
+// SortCounts orders counts from most to least common, ties by value.
+func SortCounts(counts []Count) {
+	sort.Slice(
+		counts, func(i, j int) bool {
+			if counts[i].Count == counts[j].Count {
+				return counts[i].Value < counts[j].Value
+			}
+			return counts[i].Count > counts[j].Count
+		},
+	)
+}
+
+// ApproximateTopK finds the most common values using a CountMinSketch, only a few candidates are kept in memory.
+type ApproximateTopK struct {
+	k          int
+	sketch     *CountMinSketch
+	candidates map[string]uint64
+}
+
+func NewApproximateTopK(k int) *ApproximateTopK {
+	return &ApproximateTopK{
+		k:          k,
+		sketch:     NewCountMinSketch(0.0001, 0.001),
+		candidates: make(map[string]uint64, 8*k),
+	}
+}
+
+func (t *ApproximateTopK) Add(value string) {
+	estimate := t.sketch.Add(value, 1)
+	if _, ok := t.candidates[value]; ok || len(t.candidates) < 8*t.k {
+		t.candidates[value] = estimate
+		return
+	}
+	smallest := ""
+	smallestCount := uint64(math.MaxUint64)
+	for candidate, count := range t.candidates {
+		if count < smallestCount {
+			smallest, smallestCount = candidate, count
+		}
+	}
+	if estimate > smallestCount {
+		delete(t.candidates, smallest)
+		t.candidates[value] = estimate
+	}
+}
+
+// Top returns the k most common values with their estimated counts.
+func (t *ApproximateTopK) Top() []Count {
+	output := make([]Count, 0, len(t.candidates))
+	for value := range t.candidates {
+		output = append(output, Count{Value: value, Count: t.sketch.Estimate(value)})
+	}
+	SortCounts(output)
+	if len(output) > t.k {
+		output = output[:t.k]
+	}
+	return output
+}
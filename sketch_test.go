@@ -0,0 +1,48 @@
+package justgrep
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	for _, distinct := range []int{0, 10, 1000, 100000} {
+		hll := NewHyperLogLog(14)
+		for i := 0; i < distinct; i++ {
+			// every value is added twice
+			hll.Add("user" + strconv.Itoa(i))
+			hll.Add("user" + strconv.Itoa(i))
+		}
+		count := float64(hll.Count())
+		if count < float64(distinct)*0.97 || count > float64(distinct)*1.03 {
+			t.Errorf("HyperLogLog estimated %.0f distinct values, expected %d", count, distinct)
+		}
+	}
+}
+
+func TestApproximateTopK(t *testing.T) {
+	top := NewApproximateTopK(3)
+	// value i appears i times for the rare ones, then three common values
+	for i := 0; i < 2000; i++ {
+		for j := 0; j < i%7; j++ {
+			top.Add("rare" + strconv.Itoa(i))
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		top.Add("common1")
+		if i%2 == 0 {
+			top.Add("common2")
+		}
+		if i%4 == 0 {
+			top.Add("common3")
+		}
+	}
+	have := top.Top()
+	assert(t, "length", len(have), 3)
+	for i, value := range []string{"common1", "common2", "common3"} {
+		assert(t, "value "+strconv.Itoa(i), have[i].Value, value)
+	}
+	if have[0].Count < 1000 {
+		t.Errorf("count-min sketch estimate %d is lower than the real count 1000", have[0].Count)
+	}
+}
@@ -0,0 +1,43 @@
+package justgrep
+
+import (
+	"strings"
+	"time"
+)
+
+// MessageSource describes where a message was read from.
+type MessageSource struct {
+	// URL of the log file, or the path of a local file
+	URL string
+	// Endpoint is "channel" or "user" for log files of justlog instances, "stdin" or "file" otherwise
+	Endpoint string
+	// Date of the log file, the first day of the month for user logs, zero for messages which weren't downloaded
+	Date time.Time
+	// Line is the line number of the message in the file, 0 if it's unknown because the start of the file was skipped
+	Line int
+}
+
+// newMessageSource describes the log file for date at url.
+func newMessageSource(date time.Time, url string) *MessageSource {
+	date = date.UTC()
+	source := &MessageSource{URL: url, Date: time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)}
+	// api may be wrapped by AvailableLogsAPI and others, the URL tells which endpoint is used
+	if strings.Contains(url, "/user/") || strings.Contains(url, "/userid/") {
+		source.Endpoint = "user"
+		// user logs are stored by month
+		source.Date = time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	} else {
+		source.Endpoint = "channel"
+	}
+	return source
+}
+
+// At returns a copy of s for line number line. It returns nil if s is nil.
+func (s *MessageSource) At(line int) *MessageSource {
+	if s == nil {
+		return nil
+	}
+	copied := *s
+	copied.Line = line
+	return &copied
+}
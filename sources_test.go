@@ -0,0 +1,42 @@
+package justgrep
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetchRecordsSources(t *testing.T) {
+	lines := "@tmi-sent-ts=1609545600000 :a!a@a.tmi.twitch.tv PRIVMSG #forsen :second\n" +
+		"@tmi-sent-ts=1609542000000 :a!a@a.tmi.twitch.tv PRIVMSG #forsen :first\n"
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(lines))
+			},
+		),
+	)
+	defer server.Close()
+
+	progress := &ProgressState{TotalResults: NewResultCounts()}
+	api := &UserJustlogAPI{Channel: "forsen", User: "a", URL: server.URL}
+	download := make(chan *Message)
+	date := time.Date(2021, 1, 15, 12, 0, 0, 0, time.UTC)
+	options := FetchOptions{RecordSources: true}
+	_, err := options.FetchForDate(context.Background(), api, date, download, progress, server.Client())
+	assert(t, "error", err, nil)
+	line := 0
+	for msg := range download {
+		line++
+		if msg.Source == nil {
+			t.Fatalf("message %d has no source", line)
+		}
+		assert(t, "url", msg.Source.URL, api.MakeURL(date))
+		assert(t, "endpoint", msg.Source.Endpoint, "user")
+		assert(t, "date", msg.Source.Date, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+		assert(t, "line", msg.Source.Line, line)
+	}
+	assert(t, "lines", line, 2)
+}
@@ -0,0 +1,113 @@
+package justgrep
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// chatterinoBypass is appended by Chatterino to repeated messages to get around Twitch's duplicate message check.
+const chatterinoBypass = "\U000E0000"
+
+// squashKey is what identical messages have in common: their text without surrounding spaces and duplicate check
+// bypasses.
+func squashKey(msg *Message) string {
+	return strings.TrimSpace(strings.ReplaceAll(msg.Text(), chatterinoBypass, ""))
+}
+
+// SquashedMessage is a group of identical messages sent to the same channel.
+type SquashedMessage struct {
+	// First is the first message of the group, the others aren't kept
+	First *Message
+	Count int
+	Users map[string]struct{}
+
+	key  string
+	last time.Time
+}
+
+func (s *SquashedMessage) add(msg *Message) {
+	s.Count++
+	if msg.User != "" {
+		s.Users[msg.User] = struct{}{}
+	}
+	s.last = msg.Timestamp
+}
+
+// Squasher collapses identical messages into one SquashedMessage. With a zero Window only consecutive messages of a
+// channel are collapsed, otherwise identical messages sent at most Window apart are, even if other messages were sent
+// in between.
+type Squasher struct {
+	Window time.Duration
+
+	// open has the groups which can still grow by channel, oldest first
+	open map[string][]*SquashedMessage
+}
+
+func NewSquasher(window time.Duration) *Squasher {
+	return &Squasher{Window: window, open: make(map[string][]*SquashedMessage)}
+}
+
+// within returns true if a and b were sent at most Window apart. Messages aren't always added in order, log files
+// are searched from the newest one.
+func (s *Squasher) within(a time.Time, b time.Time) bool {
+	distance := a.Sub(b)
+	if distance < 0 {
+		distance = -distance
+	}
+	return distance <= s.Window
+}
+
+// Add adds msg to a group and returns the groups which can't grow anymore, in the order they started.
+func (s *Squasher) Add(msg *Message) []*SquashedMessage {
+	channel := msg.Channel()
+	key := squashKey(msg)
+	groups := s.open[channel]
+	joined := false
+	if s.Window == 0 {
+		if len(groups) == 1 && groups[0].key == key {
+			groups[0].add(msg)
+			return nil
+		}
+	} else {
+		for _, group := range groups {
+			if group.key == key && s.within(msg.Timestamp, group.last) {
+				group.add(msg)
+				joined = true
+				break
+			}
+		}
+	}
+	var done []*SquashedMessage
+	if s.Window == 0 {
+		done, groups = groups, nil
+	} else {
+		// groups are done in order, so they're printed in the order they started
+		for len(groups) != 0 && !s.within(msg.Timestamp, groups[0].last) {
+			done = append(done, groups[0])
+			groups = groups[1:]
+		}
+	}
+	if !joined {
+		group := &SquashedMessage{First: msg, Users: make(map[string]struct{}), key: key}
+		group.add(msg)
+		groups = append(groups, group)
+	}
+	s.open[channel] = groups
+	return done
+}
+
+// Flush returns the groups which were still open, ordered by the time of their first message.
+func (s *Squasher) Flush() []*SquashedMessage {
+	var done []*SquashedMessage
+	for channel, groups := range s.open {
+		done = append(done, groups...)
+		delete(s.open, channel)
+	}
+	sort.SliceStable(
+		done, func(i, j int) bool {
+			return done[i].First.Timestamp.Before(done[j].First.Timestamp)
+		},
+	)
+	return done
+}
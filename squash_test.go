@@ -0,0 +1,92 @@
+package justgrep
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func squashMessages(t *testing.T, lines ...string) []*Message {
+	messages := make([]*Message, 0, len(lines))
+	for i, line := range lines {
+		// "user channel text", one second apart
+		var user, channel, text string
+		_, err := fmt.Sscanf(line, "%s %s %s", &user, &channel, &text)
+		assert(t, "error", err, nil)
+		msg, err := NewMessage(
+			fmt.Sprintf(
+				"@tmi-sent-ts=%d :%s!%s@%s.tmi.twitch.tv PRIVMSG #%s :%s",
+				(1000+i)*1000,
+				user,
+				user,
+				user,
+				channel,
+				text,
+			),
+		)
+		assert(t, "error", err, nil)
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func describeSquashed(groups []*SquashedMessage) []string {
+	output := make([]string, 0, len(groups))
+	for _, group := range groups {
+		output = append(
+			output,
+			fmt.Sprintf("%s %s x%d users=%d", group.First.Channel(), group.First.Text(), group.Count, len(group.Users)),
+		)
+	}
+	return output
+}
+
+func TestSquasherConsecutive(t *testing.T) {
+	squasher := NewSquasher(0)
+	var done []*SquashedMessage
+	messages := squashMessages(
+		t,
+		"a x spam",
+		"b x spam\U000E0000",
+		"a y spam",
+		"a x spam",
+		"c x hi",
+		"a x spam",
+	)
+	for _, msg := range messages {
+		done = append(done, squasher.Add(msg)...)
+	}
+	done = append(done, squasher.Flush()...)
+	assertStrSlc(
+		t,
+		"groups",
+		describeSquashed(done),
+		[]string{"x spam x3 users=2", "x hi x1 users=1", "y spam x1 users=1", "x spam x1 users=1"},
+	)
+}
+
+func TestSquasherWindow(t *testing.T) {
+	squasher := NewSquasher(2 * time.Second)
+	var done []*SquashedMessage
+	messages := squashMessages(
+		t,
+		"a x spam",
+		"b x hi",
+		"c x spam",
+		"d x spam",
+		"e x other",
+		"f x other",
+		"g x other",
+		"h x spam",
+	)
+	for _, msg := range messages {
+		done = append(done, squasher.Add(msg)...)
+	}
+	done = append(done, squasher.Flush()...)
+	assertStrSlc(
+		t,
+		"groups",
+		describeSquashed(done),
+		[]string{"x spam x3 users=3", "x hi x1 users=1", "x other x3 users=3", "x spam x1 users=1"},
+	)
+}
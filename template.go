@@ -0,0 +1,126 @@
+package justgrep
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// timeLayouts are names timeformat accepts instead of a Go time layout.
+var timeLayouts = map[string]string{
+	"rfc3339":  time.RFC3339,
+	"date":     "2006-01-02",
+	"time":     "15:04:05",
+	"datetime": "2006-01-02 15:04:05",
+	"kitchen":  time.Kitchen,
+}
+
+// ansiColors are the names color accepts besides #RRGGBB.
+var ansiColors = map[string]string{
+	"black":   "30",
+	"red":     "31",
+	"green":   "32",
+	"yellow":  "33",
+	"blue":    "34",
+	"magenta": "35",
+	"cyan":    "36",
+	"white":   "37",
+	"gray":    "90",
+	"bold":    "1",
+	"dim":     "2",
+}
+
+// TemplateFuncs returns the functions available in message templates. Arguments are ordered so the value can be
+// piped in, like {{.Timestamp | timeformat "date"}}. Without colors, color returns the text as it is.
+//
+//   - timeformat LAYOUT TIME formats a time with a Go layout or one of rfc3339, date, time, datetime and kitchen, or
+//     as seconds since 1970 with unix
+//   - truncate LENGTH TEXT shortens text to at most length characters, ending it with … if it was cut
+//   - color NAME TEXT colors text with a name like red or bold, or #RRGGBB like the color tag of users
+//   - jsonescape TEXT escapes text to be put between quotes in JSON
+//   - tagvalue NAME MESSAGE returns a tag of a message, empty if it doesn't have it
+//   - badge NAME MESSAGE returns the version of a badge of the sender, like the months of subscriber, empty if they
+//     don't have it
+func TemplateFuncs(colors bool) template.FuncMap {
+	return template.FuncMap{
+		"timeformat": templateTimeFormat,
+		"truncate":   templateTruncate,
+		"color": func(name string, text string) (string, error) {
+			return templateColor(name, text, colors)
+		},
+		"jsonescape": templateJSONEscape,
+		"tagvalue": func(name string, msg *Message) string {
+			return msg.Tags[name]
+		},
+		"badge": func(name string, msg *Message) string {
+			for _, badge := range strings.Split(msg.Tags["badges"], ",") {
+				split := strings.SplitN(badge, "/", 2)
+				if split[0] == name && len(split) == 2 {
+					return split[1]
+				}
+			}
+			return ""
+		},
+	}
+}
+
+// ParseTemplate parses a message template with TemplateFuncs.
+func ParseTemplate(name string, text string, colors bool) (*template.Template, error) {
+	return template.New(name).Funcs(TemplateFuncs(colors)).Parse(text)
+}
+
+func templateTimeFormat(layout string, t time.Time) string {
+	if layout == "unix" {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	if named, ok := timeLayouts[layout]; ok {
+		layout = named
+	}
+	return t.Format(layout)
+}
+
+func templateTruncate(length int, text string) string {
+	if utf8.RuneCountInString(text) <= length {
+		return text
+	}
+	if length <= 0 {
+		return ""
+	}
+	runes := []rune(text)
+	return string(runes[:length-1]) + "…"
+}
+
+func templateColor(name string, text string, colors bool) (string, error) {
+	if name == "" || !colors {
+		// users who never picked a color have no color tag
+		return text, nil
+	}
+	code, ok := ansiColors[name]
+	if !ok {
+		if len(name) != 7 || name[0] != '#' {
+			return "", errors.New(fmt.Sprintf("unknown color %q, expected a name or #RRGGBB", name))
+		}
+		rgb, err := strconv.ParseUint(name[1:], 16, 32)
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("unknown color %q, expected a name or #RRGGBB", name))
+		}
+		code = fmt.Sprintf("38;2;%d;%d;%d", rgb>>16, rgb>>8&0xff, rgb&0xff)
+	}
+	return "\x1b[" + code + "m" + text + "\x1b[0m", nil
+}
+
+func templateJSONEscape(text string) string {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	// strings always encode
+	_ = encoder.Encode(text)
+	encoded := strings.TrimSuffix(buffer.String(), "\n")
+	return encoded[1 : len(encoded)-1]
+}
@@ -0,0 +1,45 @@
+package justgrep
+
+import (
+	"strings"
+	"testing"
+)
+
+func executeTemplate(t *testing.T, text string, colors bool, msg *Message) string {
+	tmpl, err := ParseTemplate("test", text, colors)
+	assert(t, "parse error of "+text, err, nil)
+	var output strings.Builder
+	err = tmpl.Execute(&output, msg)
+	assert(t, "error of "+text, err, nil)
+	return output.String()
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	msg := getTestMessage()
+	templates := map[string]string{
+		`{{.Timestamp.UTC | timeformat "datetime"}}`:            "2021-09-19 15:42:15",
+		`{{.Timestamp | timeformat "unix"}}`:                    "1632066135",
+		`{{.User}}: {{.Text | truncate 10}}`:                    "mm2pl: -tags man…",
+		`{{truncate 40 .Text}}`:                                 "-tags many words asdasd",
+		`{{badge "subscriber" .}} {{badge "moderator" .}}|`:     "12 |",
+		`{{tagvalue "display-name" .}}{{tagvalue "missing" .}}`: "Mm2PL",
+		`"{{jsonescape "say \"hi\"\n<3"}}"`:                     `"say \"hi\"\n<3"`,
+		`{{color "red" .User}}`:                                 "mm2pl",
+	}
+	for text, expected := range templates {
+		assert(t, text, executeTemplate(t, text, false, msg), expected)
+	}
+
+	assert(t, "named color", executeTemplate(t, `{{color "red" "x"}}`, true, msg), "\x1b[31mx\x1b[0m")
+	assert(
+		t,
+		"color tag",
+		executeTemplate(t, `{{color (tagvalue "color" .) "x"}}`, true, msg),
+		"\x1b[38;2;218;165;32mx\x1b[0m",
+	)
+	assert(t, "no color tag", executeTemplate(t, `{{color "" "x"}}`, true, msg), "x")
+
+	tmpl, err := ParseTemplate("test", `{{color "nope" "x"}}`, true)
+	assert(t, "parse error", err, nil)
+	assert(t, "unknown color", tmpl.Execute(&strings.Builder{}, msg) != nil, true)
+}
@@ -0,0 +1,166 @@
+package justgrep
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Tokenizer splits the text of a message into words for word statistics like -top words.
+type Tokenizer interface {
+	Tokens(msg *Message) []string
+}
+
+// WhitespaceTokenizer splits text on whitespace and lowercases it, punctuation stays part of words.
+type WhitespaceTokenizer struct{}
+
+func (WhitespaceTokenizer) Tokens(msg *Message) []string {
+	return strings.Fields(strings.ToLower(msg.Text()))
+}
+
+// WordTokenizer splits text into lowercased words made of letters, numbers and apostrophes, in any script.
+type WordTokenizer struct{}
+
+func (WordTokenizer) Tokens(msg *Message) []string {
+	return words(msg.Text(), nil)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || r == '\''
+}
+
+// words appends the lowercased words of text to output.
+func words(text string, output []string) []string {
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !isWordRune(r) }) {
+		word = strings.Trim(word, "'")
+		if word != "" {
+			output = append(output, strings.ToLower(word))
+		}
+	}
+	return output
+}
+
+// EmoteTokenizer splits text like WordTokenizer, except for Twitch emotes which are kept as they're written, e.g.
+// "PogChamp" instead of "pogchamp". Emotes are found using the emotes tag, so only Twitch emotes the sender was allowed
+// to use are recognized. With SkipEmotes, emotes are left out.
+type EmoteTokenizer struct {
+	SkipEmotes bool
+}
+
+// emoteRange is where an emote is in the text, in runes.
+type emoteRange struct {
+	id    string
+	start int
+	end   int
+}
+
+// parseEmotes parses an emotes tag, e.g. "25:0-4,12-16/1902:6-10". Ranges are sorted, invalid ones are skipped.
+func parseEmotes(tag string) []emoteRange {
+	var ranges []emoteRange
+	for _, emote := range strings.Split(tag, "/") {
+		colon := strings.IndexByte(emote, ':')
+		if colon == -1 {
+			continue
+		}
+		for _, position := range strings.Split(emote[colon+1:], ",") {
+			dash := strings.IndexByte(position, '-')
+			if dash == -1 {
+				continue
+			}
+			start, err := strconv.Atoi(position[:dash])
+			if err != nil {
+				continue
+			}
+			end, err := strconv.Atoi(position[dash+1:])
+			if err != nil || end < start {
+				continue
+			}
+			ranges = append(ranges, emoteRange{id: emote[:colon], start: start, end: end})
+		}
+	}
+	sort.Slice(
+		ranges, func(i, j int) bool {
+			return ranges[i].start < ranges[j].start
+		},
+	)
+	return ranges
+}
+
+func (t EmoteTokenizer) Tokens(msg *Message) []string {
+	text := []rune(msg.Text())
+	var output []string
+	previous := 0
+	for _, emote := range parseEmotes(msg.Tags["emotes"]) {
+		if emote.start < previous || emote.end >= len(text) {
+			// overlapping or out of the text, the tag doesn't belong to it
+			continue
+		}
+		output = words(string(text[previous:emote.start]), output)
+		if !t.SkipEmotes {
+			output = append(output, string(text[emote.start:emote.end+1]))
+		}
+		previous = emote.end + 1
+	}
+	return words(string(text[previous:]), output)
+}
+
+// Tokenizers are the built-in tokenizers by name.
+var Tokenizers = map[string]Tokenizer{
+	"whitespace":  WhitespaceTokenizer{},
+	"words":       WordTokenizer{},
+	"emote-aware": EmoteTokenizer{},
+	"no-emotes":   EmoteTokenizer{SkipEmotes: true},
+}
+
+// EnglishStopwords are common English words which don't say much about a chat.
+var EnglishStopwords = []string{
+	"a", "about", "after", "all", "also", "am", "an", "and", "any", "are", "as", "at", "be", "because", "been",
+	"but", "by", "can", "could", "did", "do", "does", "for", "from", "get", "got", "had", "has", "have", "he", "her",
+	"him", "his", "how", "i", "i'm", "if", "in", "into", "is", "it", "it's", "its", "just", "like", "me", "my", "no",
+	"not", "now", "of", "on", "one", "or", "our", "out", "so", "some", "than", "that", "that's", "the", "their",
+	"them", "then", "there", "they", "this", "to", "too", "up", "us", "was", "we", "were", "what", "when", "which",
+	"who", "why", "will", "with", "would", "you", "your",
+}
+
+// StopwordTokenizer leaves the stopwords out of the tokens of Tokenizer. Stopwords are compared lowercased.
+type StopwordTokenizer struct {
+	Tokenizer Tokenizer
+	Stopwords map[string]bool
+}
+
+// NewStopwordTokenizer wraps tokenizer to leave out stopwords.
+func NewStopwordTokenizer(tokenizer Tokenizer, stopwords []string) *StopwordTokenizer {
+	set := make(map[string]bool, len(stopwords))
+	for _, word := range stopwords {
+		set[strings.ToLower(word)] = true
+	}
+	return &StopwordTokenizer{Tokenizer: tokenizer, Stopwords: set}
+}
+
+func (t *StopwordTokenizer) Tokens(msg *Message) []string {
+	tokens := t.Tokenizer.Tokens(msg)
+	kept := tokens[:0]
+	for _, token := range tokens {
+		if !t.Stopwords[strings.ToLower(token)] {
+			kept = append(kept, token)
+		}
+	}
+	return kept
+}
+
+// ReadStopwords reads a stopword list with one word per line. Empty lines and lines starting with # are skipped.
+func ReadStopwords(reader io.Reader) ([]string, error) {
+	var stopwords []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		stopwords = append(stopwords, line)
+	}
+	return stopwords, scanner.Err()
+}
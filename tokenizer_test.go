@@ -0,0 +1,38 @@
+package justgrep
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenizers(t *testing.T) {
+	msg, err := NewMessage(
+		"@emotes=25:0-4,32-36/1902:6-10;tmi-sent-ts=1000 :a!a@a.tmi.twitch.tv PRIVMSG #x :Kappa Keepo the Stream's GREAT, Kappa привет",
+	)
+	assert(t, "error", err, nil)
+	tests := map[string][]string{
+		"whitespace":  {"kappa", "keepo", "the", "stream's", "great,", "kappa", "привет"},
+		"words":       {"kappa", "keepo", "the", "stream's", "great", "kappa", "привет"},
+		"emote-aware": {"Kappa", "Keepo", "the", "stream's", "great", "Kappa", "привет"},
+		"no-emotes":   {"the", "stream's", "great", "привет"},
+	}
+	for name, expected := range tests {
+		assertStrSlc(t, name, Tokenizers[name].Tokens(msg), expected)
+	}
+
+	stopwords := NewStopwordTokenizer(Tokenizers["emote-aware"], append(EnglishStopwords, "kappa"))
+	assertStrSlc(t, "stopwords", stopwords.Tokens(msg), []string{"Keepo", "stream's", "great", "привет"})
+}
+
+func TestEmoteTokenizerBadTag(t *testing.T) {
+	// emotes out of the text or overlapping are ignored
+	msg, err := NewMessage("@emotes=25:0-4,2-6/1:50-60;tmi-sent-ts=1000 :a!a@a.tmi.twitch.tv PRIVMSG #x :Kappa hi")
+	assert(t, "error", err, nil)
+	assertStrSlc(t, "tokens", EmoteTokenizer{}.Tokens(msg), []string{"Kappa", "hi"})
+}
+
+func TestReadStopwords(t *testing.T) {
+	stopwords, err := ReadStopwords(strings.NewReader("# comment\nthe\n\n  LUL  \n"))
+	assert(t, "error", err, nil)
+	assertStrSlc(t, "stopwords", stopwords, []string{"the", "LUL"})
+}
@@ -0,0 +1,137 @@
+package justgrep
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TransportOptions configures the connections made to instances, e.g. for self-hosted instances with a private PKI or
+// to reach a specific replica of an instance.
+type TransportOptions struct {
+	// CACert is a PEM file with certificates trusted in addition to the system ones.
+	CACert string
+	// ClientCert and ClientKey are PEM files with the certificate presented to instances which ask for one.
+	ClientCert string
+	ClientKey  string
+	// InsecureSkipVerify accepts any certificate, which lets anyone in between read and change responses.
+	InsecureSkipVerify bool
+
+	// Resolve maps host:port to the IP address connected to instead, like the hosts file. TLS and the Host header
+	// still use the host, see ParseResolve.
+	Resolve map[string]string
+	// IPVersion limits connections to IPv4 with 4 or IPv6 with 6, 0 allows both.
+	IPVersion int
+}
+
+// ParseResolve parses a host:port:address override for TransportOptions.Resolve, like the --resolve option of curl.
+// IPv6 addresses can be written in brackets.
+func ParseResolve(value string) (hostPort string, address string, err error) {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.New(fmt.Sprintf("%q isn't host:port:address", value))
+	}
+	if _, err := strconv.ParseUint(parts[1], 10, 16); err != nil {
+		return "", "", errors.New(fmt.Sprintf("%q isn't a port", parts[1]))
+	}
+	address = strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+	if net.ParseIP(address) == nil {
+		return "", "", errors.New(fmt.Sprintf("%q isn't an IP address", parts[2]))
+	}
+	return net.JoinHostPort(strings.ToLower(parts[0]), parts[1]), address, nil
+}
+
+// TLSConfig returns the TLS configuration of the options, nil if they don't change anything.
+func (o TransportOptions) TLSConfig() (*tls.Config, error) {
+	if o.CACert == "" && o.ClientCert == "" && o.ClientKey == "" && !o.InsecureSkipVerify {
+		return nil, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: o.InsecureSkipVerify}
+	if o.CACert != "" {
+		pem, err := ioutil.ReadFile(o.CACert)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			// not available on every system
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New(fmt.Sprintf("%s contains no PEM certificates", o.CACert))
+		}
+		config.RootCAs = pool
+	}
+	if (o.ClientCert == "") != (o.ClientKey == "") {
+		return nil, errors.New("a client certificate needs both the certificate and the key")
+	}
+	if o.ClientCert != "" {
+		certificate, err := tls.LoadX509KeyPair(o.ClientCert, o.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// UserAgentRoundTripper wraps base to send userAgent as the User-Agent header of every request, instead of the one set
+// by whoever made the request.
+func UserAgentRoundTripper(base http.RoundTripper, userAgent string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &userAgentRoundTripper{base: base, userAgent: userAgent}
+}
+
+type userAgentRoundTripper struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// round trippers must not change the request
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.base.RoundTrip(req)
+}
+
+// NewTransport returns a copy of http.DefaultTransport configured with the options, to be used as the Transport of the
+// http.Client given to the rest of this package.
+func NewTransport(options TransportOptions) (*http.Transport, error) {
+	config, err := options.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if options.IPVersion != 0 && options.IPVersion != 4 && options.IPVersion != 6 {
+		return nil, errors.New(fmt.Sprintf("IP version %d doesn't exist, expected 4 or 6", options.IPVersion))
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config != nil {
+		transport.TLSClientConfig = config
+	}
+	if len(options.Resolve) != 0 || options.IPVersion != 0 {
+		// same as http.DefaultTransport
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		transport.DialContext = func(ctx context.Context, network string, address string) (net.Conn, error) {
+			if host, port, err := net.SplitHostPort(address); err == nil {
+				if resolved, ok := options.Resolve[net.JoinHostPort(strings.ToLower(host), port)]; ok {
+					address = net.JoinHostPort(resolved, port)
+				}
+			}
+			if options.IPVersion != 0 {
+				network = fmt.Sprintf("tcp%d", options.IPVersion)
+			}
+			return dialer.DialContext(ctx, network, address)
+		}
+	}
+	return transport, nil
+}
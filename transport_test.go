@@ -0,0 +1,166 @@
+package justgrep
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewTransport(t *testing.T) {
+	server := httptest.NewUnstartedServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if len(r.TLS.PeerCertificates) == 0 {
+					w.WriteHeader(http.StatusUnauthorized)
+				}
+			},
+		),
+	)
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "justgrep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the certificate of the test server is also used as the client certificate
+	certificate := server.TLS.Certificates[0]
+	key, err := x509.MarshalPKCS8PrivateKey(certificate.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Certificate[0]})
+	err = ioutil.WriteFile(certPath, certPEM, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(options TransportOptions) (int, error) {
+		transport, err := NewTransport(options)
+		if err != nil {
+			return 0, err
+		}
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err != nil {
+			return 0, err
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	_, err = get(TransportOptions{})
+	assert(t, "error with system CAs", err != nil, true)
+	status, err := get(TransportOptions{CACert: certPath})
+	assert(t, "error with CA", err, nil)
+	assert(t, "status without client certificate", status, http.StatusUnauthorized)
+	status, err = get(TransportOptions{CACert: certPath, ClientCert: certPath, ClientKey: keyPath})
+	assert(t, "error with client certificate", err, nil)
+	assert(t, "status with client certificate", status, http.StatusOK)
+	status, err = get(TransportOptions{InsecureSkipVerify: true})
+	assert(t, "error skipping verification", err, nil)
+	assert(t, "status skipping verification", status, http.StatusUnauthorized)
+	_, err = get(TransportOptions{ClientCert: certPath})
+	assert(t, "error without key", err != nil, true)
+	_, err = get(TransportOptions{CACert: keyPath})
+	assert(t, "error with a key as CA", err != nil, true)
+}
+
+func TestParseResolve(t *testing.T) {
+	hostPort, address, err := ParseResolve("Logs.example.com:443:[2001:db8::1]")
+	assert(t, "error", err, nil)
+	assert(t, "host and port", hostPort, "logs.example.com:443")
+	assert(t, "address", address, "2001:db8::1")
+	_, address, err = ParseResolve("logs.example.com:80:192.0.2.1")
+	assert(t, "error", err, nil)
+	assert(t, "IPv4 address", address, "192.0.2.1")
+	for _, invalid := range []string{"logs.example.com:192.0.2.1", "logs.example.com:http:192.0.2.1", "a:80:b"} {
+		_, _, err = ParseResolve(invalid)
+		assert(t, "error for "+invalid, err != nil, true)
+	}
+}
+
+func TestTransportResolve(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(r.Host))
+			},
+		),
+	)
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(options TransportOptions) (string, error) {
+		transport, err := NewTransport(options)
+		if err != nil {
+			return "", err
+		}
+		resp, err := (&http.Client{Transport: transport}).Get("http://logs.example.invalid:" + port)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	resolve := map[string]string{"logs.example.invalid:" + port: "127.0.0.1"}
+	host, err := get(TransportOptions{Resolve: resolve})
+	assert(t, "error", err, nil)
+	assert(t, "host", host, "logs.example.invalid:"+port)
+	_, err = get(TransportOptions{Resolve: resolve, IPVersion: 6})
+	assert(t, "error connecting to an IPv4 address with IPv6", err != nil, true)
+	_, err = get(TransportOptions{IPVersion: 5})
+	assert(t, "error with IP version 5", err != nil, true)
+}
+
+func TestUserAgentRoundTripper(t *testing.T) {
+	var userAgents []string
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				userAgents = append(userAgents, r.Header.Get("User-Agent"))
+			},
+		),
+	)
+	defer server.Close()
+
+	client := &http.Client{Transport: UserAgentRoundTripper(nil, "custom/1.0")}
+	_, err := GetChannelsFromJustLog(context.Background(), client, server.URL)
+	assert(t, "error", err != nil, true)
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	assert(t, "request unchanged", req.Header.Get("User-Agent"), UserAgent)
+	assert(t, "user agents", strings.Join(userAgents, " "), "custom/1.0 custom/1.0")
+
+	// without it, UserAgent is sent
+	_, _ = GetChannelsFromJustLog(context.Background(), server.Client(), server.URL)
+	assert(t, "default user agent", userAgents[2], UserAgent)
+}
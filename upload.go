@@ -0,0 +1,171 @@
+package justgrep
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const HasteURL = "https://hastebin.com"
+const GitHubAPIURL = "https://api.github.com"
+
+// Uploader uploads results to a paste service and returns a link to them.
+type Uploader interface {
+	Upload(ctx context.Context, name string, content []byte) (string, error)
+}
+
+// uploadClient has what every uploader needs: the token sent as a bearer token, if there's one, and the HTTP client.
+type uploadClient struct {
+	Token string
+	HTTP  *http.Client
+}
+
+// post sends body to url, it returns the response body and headers if the request succeeded.
+func (c *uploadClient) post(
+	ctx context.Context,
+	url string,
+	contentType string,
+	body []byte,
+) ([]byte, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Content-Type", contentType)
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	output, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil, errors.New(
+			fmt.Sprintf("upload: request to %s failed: %s %s", url, resp.Status, bytes.TrimSpace(output)),
+		)
+	}
+	return output, resp.Header, nil
+}
+
+// HasteUploader uploads to a haste-server, like hastebin.com.
+type HasteUploader struct {
+	// URL defaults to HasteURL
+	URL string
+	uploadClient
+}
+
+func (u *HasteUploader) Upload(ctx context.Context, _ string, content []byte) (string, error) {
+	base := strings.TrimSuffix(orDefault(u.URL, HasteURL), "/")
+	body, _, err := u.post(ctx, base+"/documents", "text/plain; charset=utf-8", content)
+	if err != nil {
+		return "", err
+	}
+	var document struct {
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(body, &document); err != nil || document.Key == "" {
+		return "", errors.New(fmt.Sprintf("upload: unexpected response from %s: %.200s", base, body))
+	}
+	return base + "/" + document.Key, nil
+}
+
+// GistUploader uploads to a secret GitHub gist, which needs a token allowed to create gists.
+type GistUploader struct {
+	// APIURL defaults to GitHubAPIURL
+	APIURL string
+	uploadClient
+}
+
+func (u *GistUploader) Upload(ctx context.Context, name string, content []byte) (string, error) {
+	if u.Token == "" {
+		return "", errors.New("upload: gists need a GitHub token")
+	}
+	request, err := json.Marshal(
+		map[string]interface{}{
+			"description": "justgrep results",
+			"public":      false,
+			"files": map[string]interface{}{
+				name: map[string]string{"content": string(content)},
+			},
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	base := strings.TrimSuffix(orDefault(u.APIURL, GitHubAPIURL), "/")
+	body, _, err := u.post(ctx, base+"/gists", "application/json", request)
+	if err != nil {
+		return "", err
+	}
+	var gist struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.Unmarshal(body, &gist); err != nil || gist.HTMLURL == "" {
+		return "", errors.New(fmt.Sprintf("upload: unexpected response from %s: %.200s", base, body))
+	}
+	return gist.HTMLURL, nil
+}
+
+// HTTPUploader POSTs results to URL as they are. The link is taken from the url or link field of a JSON response, a
+// response which is just a link, or the Location header.
+type HTTPUploader struct {
+	URL string
+	uploadClient
+}
+
+func (u *HTTPUploader) Upload(ctx context.Context, _ string, content []byte) (string, error) {
+	body, header, err := u.post(ctx, u.URL, "text/plain; charset=utf-8", content)
+	if err != nil {
+		return "", err
+	}
+	var response struct {
+		URL  string `json:"url"`
+		Link string `json:"link"`
+	}
+	if json.Unmarshal(body, &response) == nil && orDefault(response.URL, response.Link) != "" {
+		return orDefault(response.URL, response.Link), nil
+	}
+	text := strings.TrimSpace(string(body))
+	if (strings.HasPrefix(text, "https://") || strings.HasPrefix(text, "http://")) && !strings.ContainsAny(text, " \n") {
+		return text, nil
+	}
+	if location := header.Get("Location"); location != "" {
+		return location, nil
+	}
+	return "", errors.New(fmt.Sprintf("upload: no link in the response from %s: %.200s", u.URL, body))
+}
+
+// NewUploader returns the uploader for service: haste, haste=URL of a haste-server, gist, or an http(s) URL to POST
+// results to. token is sent as a bearer token, hastebin.com and gists need one.
+func NewUploader(service string, token string, client *http.Client) (Uploader, error) {
+	auth := uploadClient{Token: token, HTTP: client}
+	switch {
+	case service == "haste":
+		return &HasteUploader{uploadClient: auth}, nil
+	case strings.HasPrefix(service, "haste="):
+		return &HasteUploader{URL: strings.TrimPrefix(service, "haste="), uploadClient: auth}, nil
+	case service == "gist":
+		return &GistUploader{uploadClient: auth}, nil
+	case strings.HasPrefix(service, "https://") || strings.HasPrefix(service, "http://"):
+		return &HTTPUploader{URL: service, uploadClient: auth}, nil
+	}
+	return nil, errors.New(
+		fmt.Sprintf("upload: unknown service %q, expected haste, haste=URL, gist or an http(s) URL", service),
+	)
+}
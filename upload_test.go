@@ -0,0 +1,93 @@
+package justgrep
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUploaders(t *testing.T) {
+	var auth, body string
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				data, _ := ioutil.ReadAll(r.Body)
+				auth, body = r.Header.Get("Authorization"), string(data)
+				switch r.URL.Path {
+				case "/documents":
+					_, _ = w.Write([]byte(`{"key":"abc"}`))
+				case "/gists":
+					var gist struct {
+						Files map[string]struct {
+							Content string `json:"content"`
+						} `json:"files"`
+					}
+					_ = json.Unmarshal(data, &gist)
+					body = gist.Files["results.log"].Content
+					w.WriteHeader(http.StatusCreated)
+					_, _ = w.Write([]byte(`{"html_url":"https://gist.example/1"}`))
+				case "/json":
+					_, _ = w.Write([]byte(`{"link":"https://paste.example/json"}`))
+				case "/text":
+					_, _ = w.Write([]byte("https://paste.example/text\n"))
+				case "/location":
+					w.Header().Set("Location", "https://paste.example/location")
+					w.WriteHeader(http.StatusCreated)
+				case "/nothing":
+					_, _ = w.Write([]byte("thanks"))
+				default:
+					http.Error(w, "nope", http.StatusForbidden)
+				}
+			},
+		),
+	)
+	defer server.Close()
+
+	tests := []struct {
+		uploader Uploader
+		link     string
+		auth     string
+	}{
+		{&HasteUploader{URL: server.URL, uploadClient: uploadClient{Token: "t"}}, server.URL + "/abc", "Bearer t"},
+		{&GistUploader{APIURL: server.URL, uploadClient: uploadClient{Token: "g"}}, "https://gist.example/1", "Bearer g"},
+		{&HTTPUploader{URL: server.URL + "/json"}, "https://paste.example/json", ""},
+		{&HTTPUploader{URL: server.URL + "/text"}, "https://paste.example/text", ""},
+		{&HTTPUploader{URL: server.URL + "/location"}, "https://paste.example/location", ""},
+	}
+	for _, test := range tests {
+		link, err := test.uploader.Upload(context.Background(), "results.log", []byte("line\n"))
+		assert(t, "error", err, nil)
+		assert(t, "link", link, test.link)
+		assert(t, "auth", auth, test.auth)
+		assert(t, "body", body, "line\n")
+	}
+
+	_, err := (&HTTPUploader{URL: server.URL + "/nothing"}).Upload(context.Background(), "results.log", nil)
+	if err == nil {
+		t.Errorf("expected an error for a response without a link")
+	}
+	_, err = (&HTTPUploader{URL: server.URL + "/forbidden"}).Upload(context.Background(), "results.log", nil)
+	if err == nil {
+		t.Errorf("expected an error for a failed request")
+	}
+	_, err = (&GistUploader{APIURL: server.URL}).Upload(context.Background(), "results.log", nil)
+	if err == nil {
+		t.Errorf("expected an error for gists without a token")
+	}
+}
+
+func TestNewUploader(t *testing.T) {
+	uploader, err := NewUploader("haste=https://paste.example", "", nil)
+	assert(t, "error", err, nil)
+	assert(t, "haste URL", uploader.(*HasteUploader).URL, "https://paste.example")
+	uploader, err = NewUploader("https://paste.example/upload", "x", nil)
+	assert(t, "error", err, nil)
+	assert(t, "token", uploader.(*HTTPUploader).Token, "x")
+	_, err = NewUploader("ftp://paste.example", "", nil)
+	if err == nil {
+		t.Errorf("expected an error for an unknown service")
+	}
+}
@@ -0,0 +1,58 @@
+package justgrep
+
+import (
+	"regexp"
+	"strings"
+)
+
+// UserMatcher matches names of users against a set of exact names and regular expressions, a name matches if it's
+// one of Names or any of Regexes matches it. Names are compared case-insensitively. The zero value matches nothing,
+// filters ignore empty UserMatchers.
+type UserMatcher struct {
+	// Names are lowercase
+	Names   map[string]bool
+	Regexes []*regexp.Regexp
+}
+
+// NewUserMatcher creates a UserMatcher for names and regexes, either can be empty.
+func NewUserMatcher(names []string, regexes []*regexp.Regexp) UserMatcher {
+	matcher := UserMatcher{Regexes: regexes}
+	if len(names) != 0 {
+		matcher.Names = make(map[string]bool, len(names))
+		for _, name := range names {
+			matcher.Names[strings.ToLower(name)] = true
+		}
+	}
+	return matcher
+}
+
+// IsEmpty returns true if m has neither names nor regexes.
+func (m UserMatcher) IsEmpty() bool {
+	return len(m.Names) == 0 && len(m.Regexes) == 0
+}
+
+// Rule returns the name or regex matching name, regexes written between slashes. It's empty if none matches.
+func (m UserMatcher) Rule(name string) string {
+	if lower := strings.ToLower(name); m.Names[lower] {
+		return lower
+	}
+	for _, regex := range m.Regexes {
+		if regex.MatchString(name) {
+			return "/" + regex.String() + "/"
+		}
+	}
+	return ""
+}
+
+// Matches returns true if name is one of the names or matches one of the regexes.
+func (m UserMatcher) Matches(name string) bool {
+	if len(m.Names) != 0 && (m.Names[name] || m.Names[strings.ToLower(name)]) {
+		return true
+	}
+	for _, regex := range m.Regexes {
+		if regex.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
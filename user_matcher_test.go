@@ -0,0 +1,21 @@
+package justgrep
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestUserMatcher(t *testing.T) {
+	matcher := NewUserMatcher([]string{"Pajlada"}, []*regexp.Regexp{regexp.MustCompile("^forsen")})
+	assert(t, "empty", matcher.IsEmpty(), false)
+	assert(t, "name", matcher.Matches("pajlada"), true)
+	assert(t, "name with other case", matcher.Matches("PAJLADA"), true)
+	assert(t, "regex", matcher.Matches("forsenbot"), true)
+	assert(t, "neither", matcher.Matches("someone"), false)
+	assert(t, "zero value empty", UserMatcher{}.IsEmpty(), true)
+	assert(t, "zero value", UserMatcher{}.Matches("pajlada"), false)
+
+	assert(t, "rule of a name", matcher.Rule("PAJLADA"), "pajlada")
+	assert(t, "rule of a regex", matcher.Rule("forsenbot"), "/^forsen/")
+	assert(t, "no rule", matcher.Rule("someone"), "")
+}
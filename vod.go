@@ -0,0 +1,73 @@
+package justgrep
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VOD describes a Twitch VOD, messages sent while the stream was live can be linked to the moment in the VOD.
+type VOD struct {
+	ID    string
+	Start time.Time
+
+	// Duration is zero if the length of the VOD is unknown
+	Duration time.Duration
+}
+
+// ParseVODID accepts a VOD id ("1234", "v1234") or a link to it ("https://www.twitch.tv/videos/1234?t=1h") and returns
+// the numeric id.
+func ParseVODID(input string) (string, error) {
+	id := strings.TrimPrefix(strings.TrimSpace(input), "v")
+	if strings.Contains(input, "/") {
+		u, err := url.Parse(input)
+		if err != nil {
+			return "", err
+		}
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) < 2 || parts[len(parts)-2] != "videos" {
+			return "", errors.New(fmt.Sprintf("%q doesn't look like a link to a VOD", input))
+		}
+		id = parts[len(parts)-1]
+	}
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return "", errors.New(fmt.Sprintf("%q isn't a valid VOD id", input))
+	}
+	return id, nil
+}
+
+// NewVODFromHelix creates a VOD using the start time and length reported by Helix.
+func NewVODFromHelix(video *HelixVideo) (*VOD, error) {
+	duration, err := time.ParseDuration(video.Duration)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to parse VOD duration %q: %s", video.Duration, err))
+	}
+	return &VOD{ID: video.ID, Start: video.CreatedAt, Duration: duration}, nil
+}
+
+// Offset returns how far into the VOD timestamp is. ok is false if timestamp isn't covered by the VOD.
+func (v *VOD) Offset(timestamp time.Time) (offset time.Duration, ok bool) {
+	offset = timestamp.Sub(v.Start)
+	if offset < 0 || (v.Duration != 0 && offset > v.Duration) {
+		return 0, false
+	}
+	return offset, true
+}
+
+// FormatVODOffset formats offset the way Twitch expects it in the t parameter, e.g. "1h2m3s".
+func FormatVODOffset(offset time.Duration) string {
+	seconds := int64(offset / time.Second)
+	return fmt.Sprintf("%dh%dm%ds", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// Link returns a link to the moment of timestamp in the VOD. ok is false if timestamp isn't covered by the VOD.
+func (v *VOD) Link(timestamp time.Time) (link string, ok bool) {
+	offset, ok := v.Offset(timestamp)
+	if !ok {
+		return "", false
+	}
+	return "https://www.twitch.tv/videos/" + v.ID + "?t=" + FormatVODOffset(offset), true
+}
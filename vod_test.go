@@ -0,0 +1,44 @@
+package justgrep
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseVODID(t *testing.T) {
+	for input, expect := range map[string]string{
+		"1234":                                   "1234",
+		"v1234":                                  "1234",
+		"https://www.twitch.tv/videos/1234":      "1234",
+		"https://www.twitch.tv/videos/1234?t=1h": "1234",
+		"twitch.tv/videos/1234/":                 "1234",
+	} {
+		have, err := ParseVODID(input)
+		assert(t, "error for "+input, err, nil)
+		assert(t, "id for "+input, have, expect)
+	}
+	for _, input := range []string{"", "abc", "https://www.twitch.tv/pajlada"} {
+		_, err := ParseVODID(input)
+		if err == nil {
+			t.Errorf("expected ParseVODID(%q) to fail", input)
+		}
+	}
+}
+
+func TestVODLink(t *testing.T) {
+	start := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	vod := &VOD{ID: "1234", Start: start, Duration: 2 * time.Hour}
+
+	link, ok := vod.Link(start.Add(time.Hour + 2*time.Minute + 3*time.Second + 500*time.Millisecond))
+	assert(t, "ok", ok, true)
+	assert(t, "link", link, "https://www.twitch.tv/videos/1234?t=1h2m3s")
+
+	_, ok = vod.Link(start.Add(-time.Second))
+	assert(t, "ok before start", ok, false)
+	_, ok = vod.Link(start.Add(3 * time.Hour))
+	assert(t, "ok after end", ok, false)
+
+	vod.Duration = 0
+	_, ok = vod.Link(start.Add(3 * time.Hour))
+	assert(t, "ok with unknown duration", ok, true)
+}